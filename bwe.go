@@ -1,6 +1,8 @@
 package mrtp
 
 import (
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/Willi-42/go-nada/nada"
@@ -17,6 +19,35 @@ const (
 	ECNCE
 )
 
+// NewECN parses an ECN codepoint name as returned by [ECN.String].
+func NewECN(s string) (ECN, error) {
+	switch strings.ToLower(s) {
+	case "not-ect":
+		return ECNNonECT, nil
+	case "ect1":
+		return ECNECT1, nil
+	case "ect0":
+		return ECNECT0, nil
+	case "ce":
+		return ECNCE, nil
+	}
+	return ECNNonECT, fmt.Errorf("unknown ECN codepoint: %s", s)
+}
+
+func (e ECN) String() string {
+	switch e {
+	case ECNNonECT:
+		return "not-ect"
+	case ECNECT1:
+		return "ect1"
+	case ECNECT0:
+		return "ect0"
+	case ECNCE:
+		return "ce"
+	}
+	return "unknown"
+}
+
 type BWE interface {
 	OnAck(sequenceNumber uint64, size int, departure, arrival time.Time, ecn ECN)
 	OnLoss(sequenceNumber uint64, size int, departure time.Time)
@@ -25,13 +56,36 @@ type BWE interface {
 	UpdateTargetRate(time.Time) int
 }
 
-var _ BWE = (*Nada)(nil)
+var (
+	_ BWE              = (*Nada)(nil)
+	_ BWEStateReporter = (*Nada)(nil)
+)
 
 type Nada struct {
-	nada *nada.SenderOnly
+	nada  *nada.SenderOnly
+	stats bweFeedbackStats
+	delay bweDelayStats
+}
+
+// NadaOption sets optional parameters of [NewNada].
+type NadaOption func(*nada.Config)
+
+// NadaRefCongLevel sets the reference congestion level. Default: 15ms.
+func NadaRefCongLevel(level time.Duration) NadaOption {
+	return func(c *nada.Config) {
+		c.RefCongLevel = uint64(level.Milliseconds())
+	}
+}
+
+// NadaQDelayWrapping enables or disables the wrapping of the queuing delay
+// after losses. Default: disabled.
+func NadaQDelayWrapping(enabled bool) NadaOption {
+	return func(c *nada.Config) {
+		c.DeactivateQDelayWrapping = !enabled
+	}
 }
 
-func NewNada(initRate, minRate, maxRate uint, feedbackInterval time.Duration) *Nada {
+func NewNada(initRate, minRate, maxRate uint, feedbackInterval time.Duration, opts ...NadaOption) *Nada {
 	nadaConfig := nada.Config{
 		MinRate:                  uint64(minRate),
 		MaxRate:                  uint64(maxRate),
@@ -40,6 +94,9 @@ func NewNada(initRate, minRate, maxRate uint, feedbackInterval time.Duration) *N
 		DeactivateQDelayWrapping: true,
 		RefCongLevel:             15, // ms
 	}
+	for _, opt := range opts {
+		opt(&nadaConfig)
+	}
 	nada := nada.NewSenderOnly(nadaConfig)
 	return &Nada{
 		nada: &nada,
@@ -48,11 +105,14 @@ func NewNada(initRate, minRate, maxRate uint, feedbackInterval time.Duration) *N
 
 // OnAck implements [BWE].
 func (n *Nada) OnAck(sequenceNumber uint64, size int, departure time.Time, arrival time.Time, ecn ECN) {
+	n.stats.onAck(ecn)
+	n.delay.onAck(departure, arrival)
 	n.nada.OnAck(sequenceNumber, departure, arrival, uint64(8*size), ecn == ECNCE)
 }
 
 // OnLoss implements [BWE].
 func (n *Nada) OnLoss(sequenceNumber uint64, size int, departure time.Time) {
+	n.stats.onLoss()
 	n.nada.OnLoss(sequenceNumber, departure)
 }
 
@@ -63,24 +123,63 @@ func (n *Nada) UpdateECNCounts(ect0 uint64, ect1 uint64, ce uint64) {
 
 // UpdateRTT implements [BWE].
 func (n *Nada) UpdateRTT(rtt time.Duration) {
+	n.stats.onRTT(rtt)
 	n.nada.UpdateRTT(rtt)
 }
 
 // UpdateTargetRate implements [BWE].
-func (n *Nada) UpdateTargetRate(time.Time) int {
-	return int(n.nada.UpdateTargetRate())
+func (n *Nada) UpdateTargetRate(now time.Time) int {
+	rate := int(n.nada.UpdateTargetRate())
+	n.stats.onTargetRate(rate)
+	n.delay.onTargetRate(rate)
+	return rate
+}
+
+// BWEState implements [BWEStateReporter]. The NADA implementation does not
+// expose its queuing delay and rate mode. The queuing delay and delay
+// gradient are measured from the acknowledged packets like NADA does, the
+// state is the direction of the last target rate change.
+func (n *Nada) BWEState() BWEState {
+	state := n.stats.bweState()
+	n.delay.apply(&state)
+	return state
 }
 
-var _ BWE = (*GCC)(nil)
+var (
+	_ BWE              = (*GCC)(nil)
+	_ BWEStateReporter = (*GCC)(nil)
+)
 
 type GCC struct {
 	gcc     *gcc.SendSideController
 	lastRTT time.Duration
+	stats   bweFeedbackStats
+	delay   bweDelayStats
+}
+
+type gccConfig struct {
+	loggerFactory pion_logging.LoggerFactory
+}
+
+// GCCOption sets optional parameters of [NewGCC].
+type GCCOption func(*gccConfig)
+
+// GCCLoggerFactory sets the logger factory used by the GCC controller.
+// Default: a JSON logger factory.
+func GCCLoggerFactory(f pion_logging.LoggerFactory) GCCOption {
+	return func(c *gccConfig) {
+		c.loggerFactory = f
+	}
 }
 
-func NewGCC(initialRate, minRate, maxRate uint) (*GCC, error) {
-	plf := pion_logging.NewJSONLoggerFactory()
-	gcc, err := gcc.NewSendSideController(int(initialRate), int(minRate), int(maxRate), gcc.WithLoggerFactory(plf))
+func NewGCC(initialRate, minRate, maxRate uint, opts ...GCCOption) (*GCC, error) {
+	config := gccConfig{
+		loggerFactory: pion_logging.NewJSONLoggerFactory(),
+	}
+	for _, opt := range opts {
+		opt(&config)
+	}
+	gcc, err := gcc.NewSendSideController(int(initialRate), int(minRate), int(maxRate), gcc.WithLoggerFactory(config.loggerFactory))
 	if err != nil {
 		return nil, err
 	}
@@ -90,12 +189,15 @@ func NewGCC(initialRate, minRate, maxRate uint) (*GCC, error) {
 }
 
 // OnAck implements [BWE].
-func (g *GCC) OnAck(sequenceNumber uint64, size int, departure time.Time, arrival time.Time, _ ECN) {
+func (g *GCC) OnAck(sequenceNumber uint64, size int, departure time.Time, arrival time.Time, ecn ECN) {
+	g.stats.onAck(ecn)
+	g.delay.onAck(departure, arrival)
 	g.gcc.OnAck(sequenceNumber, size, departure, arrival)
 }
 
 // OnLoss implements [BWE].
 func (g *GCC) OnLoss(uint64, int, time.Time) {
+	g.stats.onLoss()
 	g.gcc.OnLoss()
 }
 
@@ -106,10 +208,24 @@ func (g *GCC) UpdateECNCounts(uint64, uint64, uint64) {
 
 // UpdateRTT implements [BWE].
 func (g *GCC) UpdateRTT(rtt time.Duration) {
+	g.stats.onRTT(rtt)
 	g.lastRTT = rtt
 }
 
 // UpdateTargetRate implements [BWE].
 func (g *GCC) UpdateTargetRate(time time.Time) int {
-	return g.gcc.OnFeedback(time, g.lastRTT)
+	rate := g.gcc.OnFeedback(time, g.lastRTT)
+	g.stats.onTargetRate(rate)
+	g.delay.onTargetRate(rate)
+	return rate
+}
+
+// BWEState implements [BWEStateReporter]. The GCC implementation does not
+// expose its delay estimate and rate control state. The queuing delay and
+// delay gradient are measured from the acknowledged packets, see
+// [Nada.BWEState].
+func (g *GCC) BWEState() BWEState {
+	state := g.stats.bweState()
+	g.delay.apply(&state)
+	return state
 }
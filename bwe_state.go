@@ -0,0 +1,227 @@
+package mrtp
+
+import (
+	"log/slog"
+	"time"
+)
+
+// BWERateState describes the decision of a rate controller in its last
+// target rate update.
+type BWERateState string
+
+const (
+	BWERateIncrease BWERateState = "increase"
+	BWERateHold     BWERateState = "hold"
+	BWERateDecrease BWERateState = "decrease"
+)
+
+// BWEState is a snapshot of the internal state of a bandwidth estimator.
+// Fields the estimator does not report are zero. [Nada] and [GCC] keep their
+// own delay estimates and controller state inside the wrapped
+// implementations. They report the queuing delay, delay gradient and state
+// measured from their feedback instead, see [Nada.BWEState].
+type BWEState struct {
+	TargetRate int
+	// State is empty if the estimator does not report its controller state.
+	State BWERateState
+
+	RTT          time.Duration
+	QueuingDelay time.Duration
+	// DelayGradient is the change of the one-way delay in seconds per
+	// second.
+	DelayGradient float64
+	// LossRatio is the fraction of packets reported lost since the previous
+	// target rate update.
+	LossRatio float64
+	// ECNMarkRatio is the (smoothed) fraction of CE marked packets.
+	ECNMarkRatio float64
+}
+
+// LogValue implements [slog.LogValuer].
+func (s BWEState) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.Int("target-rate", s.TargetRate),
+		slog.String("state", string(s.State)),
+		slog.Int64("rtt", s.RTT.Microseconds()),
+		slog.Int64("queuing-delay", s.QueuingDelay.Microseconds()),
+		slog.Float64("delay-gradient", s.DelayGradient),
+		slog.Float64("loss-ratio", s.LossRatio),
+		slog.Float64("ecn-mark-ratio", s.ECNMarkRatio),
+	)
+}
+
+// BWEStateReporter is an optional interface implemented by BWEs that expose
+// their internal state.
+type BWEStateReporter interface {
+	BWEState() BWEState
+}
+
+// GetBWEState returns the state of bwe if it implements [BWEStateReporter].
+// BWEs wrapping other BWEs can expose the wrapped BWE using an
+// Unwrap() BWE method.
+func GetBWEState(bwe BWE) (BWEState, bool) {
+	for bwe != nil {
+		if r, ok := bwe.(BWEStateReporter); ok {
+			return r.BWEState(), true
+		}
+		u, ok := bwe.(interface{ Unwrap() BWE })
+		if !ok {
+			return BWEState{}, false
+		}
+		bwe = u.Unwrap()
+	}
+	return BWEState{}, false
+}
+
+// bweFeedbackStats summarizes the feedback passed to a BWE between two target
+// rate updates. BWEs use it to report the parts of their state that are
+// measured rather than estimated.
+type bweFeedbackStats struct {
+	rtt         time.Duration
+	acked, lost uint64
+	marked      uint64
+	lossRatio   float64
+	markRatio   float64
+	rate        int
+}
+
+func (t *bweFeedbackStats) onAck(ecn ECN) {
+	t.acked++
+	if ecn == ECNCE {
+		t.marked++
+	}
+}
+
+func (t *bweFeedbackStats) onLoss() {
+	t.lost++
+}
+
+func (t *bweFeedbackStats) onRTT(rtt time.Duration) {
+	t.rtt = rtt
+}
+
+func (t *bweFeedbackStats) onTargetRate(rate int) {
+	if total := t.acked + t.lost; total > 0 {
+		t.lossRatio = float64(t.lost) / float64(total)
+	}
+	if t.acked > 0 {
+		t.markRatio = float64(t.marked) / float64(t.acked)
+	}
+	t.acked, t.lost, t.marked = 0, 0, 0
+	t.rate = rate
+}
+
+func (t *bweFeedbackStats) bweState() BWEState {
+	return BWEState{
+		TargetRate:   t.rate,
+		RTT:          t.rtt,
+		LossRatio:    t.lossRatio,
+		ECNMarkRatio: t.markRatio,
+	}
+}
+
+const (
+	// bweBaseOWDWindow is the length of a base delay history bucket of
+	// bweDelayStats. bweBaseOWDBuckets buckets are kept, so that the base
+	// delay adapts to route changes.
+	bweBaseOWDWindow  = time.Minute
+	bweBaseOWDBuckets = 10
+)
+
+// bweDelayStats measures the queuing delay, the delay gradient and the
+// direction of the target rate changes of a BWE from its feedback. It is used
+// by BWEs that wrap implementations which do not expose their own estimates.
+//
+// The queuing delay is the smallest one-way delay acknowledged since the
+// previous target rate update relative to the base delay, the minimum
+// one-way delay of the last bweBaseOWDBuckets windows, as in NADA (RFC
+// 8698). The delay gradient is the least squares slope of the one-way delays
+// over their arrival times since the previous update, like the trendline of
+// GCC. Unknown clock offsets cancel out in both.
+type bweDelayStats struct {
+	baseOWD      []time.Duration
+	baseOWDStart time.Time
+
+	// samples since the previous update, arrival times relative to
+	// firstArrival
+	minOWD                   time.Duration
+	firstArrival             time.Time
+	n                        int
+	sumX, sumY, sumXX, sumXY float64
+
+	qdelay   time.Duration
+	gradient float64
+	rate     int
+	state    BWERateState
+	hasRate  bool
+}
+
+func (t *bweDelayStats) onAck(departure, arrival time.Time) {
+	owd := arrival.Sub(departure)
+	if len(t.baseOWD) == 0 || arrival.Sub(t.baseOWDStart) > bweBaseOWDWindow {
+		if len(t.baseOWD) == bweBaseOWDBuckets {
+			t.baseOWD = t.baseOWD[1:]
+		}
+		t.baseOWD = append(t.baseOWD, owd)
+		t.baseOWDStart = arrival
+	}
+	last := len(t.baseOWD) - 1
+	t.baseOWD[last] = min(t.baseOWD[last], owd)
+
+	if t.n == 0 {
+		t.minOWD = owd
+		t.firstArrival = arrival
+	}
+	t.minOWD = min(t.minOWD, owd)
+	x := arrival.Sub(t.firstArrival).Seconds()
+	y := owd.Seconds()
+	t.n++
+	t.sumX += x
+	t.sumY += y
+	t.sumXX += x * x
+	t.sumXY += x * y
+}
+
+// onTargetRate updates the estimates from the samples since the previous
+// update. Without samples, the previous estimates are kept.
+func (t *bweDelayStats) onTargetRate(rate int) {
+	if t.n > 0 {
+		base := t.baseOWD[0]
+		for _, d := range t.baseOWD[1:] {
+			base = min(base, d)
+		}
+		t.qdelay = t.minOWD - base
+	}
+	n := float64(t.n)
+	if denominator := n*t.sumXX - t.sumX*t.sumX; t.n >= 2 && denominator > 0 {
+		t.gradient = (n*t.sumXY - t.sumX*t.sumY) / denominator
+	}
+	t.n = 0
+	t.sumX, t.sumY, t.sumXX, t.sumXY = 0, 0, 0, 0
+
+	t.state = BWERateHold
+	if t.hasRate {
+		t.state = rateDirection(t.rate, rate)
+	}
+	t.rate = rate
+	t.hasRate = true
+}
+
+// apply sets the measured fields of state.
+func (t *bweDelayStats) apply(state *BWEState) {
+	state.QueuingDelay = t.qdelay
+	state.DelayGradient = t.gradient
+	state.State = t.state
+}
+
+// rateDirection returns the state that corresponds to a target rate change
+// from old to rate.
+func rateDirection(old, rate int) BWERateState {
+	switch {
+	case rate > old:
+		return BWERateIncrease
+	case rate < old:
+		return BWERateDecrease
+	}
+	return BWERateHold
+}
@@ -0,0 +1,82 @@
+package mrtp
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBWEFeedbackStats(t *testing.T) {
+	var stats bweFeedbackStats
+
+	stats.onAck(ECNECT0)
+	stats.onAck(ECNCE)
+	stats.onLoss()
+	stats.onRTT(40 * time.Millisecond)
+	stats.onTargetRate(1000)
+
+	state := stats.bweState()
+	assert.Equal(t, 1000, state.TargetRate)
+	assert.Empty(t, state.State)
+	assert.Equal(t, 40*time.Millisecond, state.RTT)
+	assert.Zero(t, state.QueuingDelay)
+	assert.InDelta(t, 1.0/3, state.LossRatio, 1e-9)
+	assert.InDelta(t, 0.5, state.ECNMarkRatio, 1e-9)
+
+	// ratios are computed per target rate update
+	stats.onAck(ECNECT0)
+	stats.onTargetRate(500)
+
+	state = stats.bweState()
+	assert.Equal(t, 500, state.TargetRate)
+	assert.Equal(t, 0.0, state.LossRatio)
+	assert.Equal(t, 0.0, state.ECNMarkRatio)
+}
+
+func TestBWEDelayStats(t *testing.T) {
+	var stats bweDelayStats
+	departure := time.Unix(0, 0)
+	// one-way delays with an unknown clock offset of one second
+	owd := func(d time.Duration) time.Time {
+		return departure.Add(time.Second + d)
+	}
+
+	stats.onAck(departure, owd(10*time.Millisecond))
+	stats.onTargetRate(1000)
+	var state BWEState
+	stats.apply(&state)
+	assert.Equal(t, BWERateHold, state.State)
+	assert.Zero(t, state.QueuingDelay)
+
+	// the queue grows by 10ms every 100ms
+	for i := range 5 {
+		departure = departure.Add(100 * time.Millisecond)
+		stats.onAck(departure, owd(time.Duration(20+10*i)*time.Millisecond))
+	}
+	stats.onTargetRate(500)
+	stats.apply(&state)
+	assert.Equal(t, BWERateDecrease, state.State)
+	assert.Equal(t, 10*time.Millisecond, state.QueuingDelay)
+	assert.InDelta(t, 10.0/110, state.DelayGradient, 1e-9)
+
+	// estimates are kept without new samples
+	stats.onTargetRate(600)
+	stats.apply(&state)
+	assert.Equal(t, BWERateIncrease, state.State)
+	assert.Equal(t, 10*time.Millisecond, state.QueuingDelay)
+	assert.InDelta(t, 10.0/110, state.DelayGradient, 1e-9)
+}
+
+func TestGetBWEStateUnwrapsRecorder(t *testing.T) {
+	s := NewSCReAM(1_000_000, 100_000, 2_000_000)
+	s.UpdateTargetRate(time.Unix(0, 0))
+
+	state, ok := GetBWEState(NewBWERecorder(s, &bytes.Buffer{}))
+	assert.True(t, ok)
+	assert.Equal(t, 1_000_000, state.TargetRate)
+
+	_, ok = GetBWEState(&fakeBWE{})
+	assert.False(t, ok)
+}
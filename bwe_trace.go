@@ -0,0 +1,209 @@
+package mrtp
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// BWETraceEventType identifies the [BWE] method a [BWETraceEvent] was recorded
+// from.
+type BWETraceEventType string
+
+const (
+	BWETraceAck        BWETraceEventType = "ack"
+	BWETraceLoss       BWETraceEventType = "loss"
+	BWETraceRTT        BWETraceEventType = "rtt"
+	BWETraceECNCounts  BWETraceEventType = "ecn-counts"
+	BWETraceTargetRate BWETraceEventType = "target-rate"
+)
+
+// BWETraceEvent is a single recorded call to a [BWE]. Timestamps are stored as
+// nanoseconds since the Unix epoch. Only the fields relevant for the event
+// type are set.
+type BWETraceEvent struct {
+	// Time is the wall clock time at which the call was recorded.
+	Time int64             `json:"time"`
+	Type BWETraceEventType `json:"type"`
+
+	SequenceNumber uint64 `json:"seq,omitempty"`
+	Size           int    `json:"size,omitempty"`
+	Departure      int64  `json:"departure,omitempty"`
+	Arrival        int64  `json:"arrival,omitempty"`
+	ECN            ECN    `json:"ecn,omitempty"`
+
+	RTT time.Duration `json:"rtt,omitempty"`
+
+	ECT0 uint64 `json:"ect0,omitempty"`
+	ECT1 uint64 `json:"ect1,omitempty"`
+	CE   uint64 `json:"ce,omitempty"`
+
+	// Now is the argument of UpdateTargetRate and TargetRate the value
+	// returned by the recorded BWE.
+	Now        int64 `json:"now,omitempty"`
+	TargetRate int   `json:"target-rate,omitempty"`
+}
+
+var _ BWE = (*BWERecorder)(nil)
+
+// BWERecorder is a [BWE] decorator that forwards all calls to the wrapped BWE
+// and writes every call as a JSON encoded [BWETraceEvent] line to a writer.
+// The trace is buffered, since the BWE is called for every acknowledged packet,
+// and only complete after Flush. Traces can be fed into other BWE
+// implementations using [ReplayBWETrace].
+type BWERecorder struct {
+	bwe BWE
+
+	lock    sync.Mutex
+	writer  *bufio.Writer
+	encoder *json.Encoder
+	err     error
+}
+
+// NewBWERecorder creates a recorder that wraps bwe and writes the trace to w.
+func NewBWERecorder(bwe BWE, w io.Writer) *BWERecorder {
+	writer := bufio.NewWriter(w)
+	return &BWERecorder{
+		bwe:     bwe,
+		writer:  writer,
+		encoder: json.NewEncoder(writer),
+	}
+}
+
+// Unwrap returns the recorded BWE.
+func (r *BWERecorder) Unwrap() BWE {
+	return r.bwe
+}
+
+// Err returns the first error that occurred while writing the trace.
+func (r *BWERecorder) Err() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.err
+}
+
+// Flush writes the buffered part of the trace to the underlying writer.
+func (r *BWERecorder) Flush() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.err != nil {
+		return r.err
+	}
+	r.err = r.writer.Flush()
+	return r.err
+}
+
+func (r *BWERecorder) record(e BWETraceEvent) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.err != nil {
+		return
+	}
+	e.Time = time.Now().UnixNano()
+	r.err = r.encoder.Encode(e)
+}
+
+// OnAck implements [BWE].
+func (r *BWERecorder) OnAck(sequenceNumber uint64, size int, departure time.Time, arrival time.Time, ecn ECN) {
+	r.record(BWETraceEvent{
+		Type:           BWETraceAck,
+		SequenceNumber: sequenceNumber,
+		Size:           size,
+		Departure:      departure.UnixNano(),
+		Arrival:        arrival.UnixNano(),
+		ECN:            ecn,
+	})
+	r.bwe.OnAck(sequenceNumber, size, departure, arrival, ecn)
+}
+
+// OnLoss implements [BWE].
+func (r *BWERecorder) OnLoss(sequenceNumber uint64, size int, departure time.Time) {
+	r.record(BWETraceEvent{
+		Type:           BWETraceLoss,
+		SequenceNumber: sequenceNumber,
+		Size:           size,
+		Departure:      departure.UnixNano(),
+	})
+	r.bwe.OnLoss(sequenceNumber, size, departure)
+}
+
+// UpdateRTT implements [BWE].
+func (r *BWERecorder) UpdateRTT(rtt time.Duration) {
+	r.record(BWETraceEvent{
+		Type: BWETraceRTT,
+		RTT:  rtt,
+	})
+	r.bwe.UpdateRTT(rtt)
+}
+
+// UpdateECNCounts implements [BWE].
+func (r *BWERecorder) UpdateECNCounts(ect0 uint64, ect1 uint64, ce uint64) {
+	r.record(BWETraceEvent{
+		Type: BWETraceECNCounts,
+		ECT0: ect0,
+		ECT1: ect1,
+		CE:   ce,
+	})
+	r.bwe.UpdateECNCounts(ect0, ect1, ce)
+}
+
+// UpdateTargetRate implements [BWE].
+func (r *BWERecorder) UpdateTargetRate(now time.Time) int {
+	rate := r.bwe.UpdateTargetRate(now)
+	r.record(BWETraceEvent{
+		Type:       BWETraceTargetRate,
+		Now:        now.UnixNano(),
+		TargetRate: rate,
+	})
+	return rate
+}
+
+// BWEReplaySample is a target rate update produced while replaying a trace.
+type BWEReplaySample struct {
+	// Time is the argument passed to UpdateTargetRate.
+	Time time.Time
+	// Recorded is the target rate returned by the recorded BWE.
+	Recorded int
+	// Replayed is the target rate returned by the BWE used for replaying.
+	Replayed int
+}
+
+// ReplayBWETrace reads a trace written by a [BWERecorder] from r and feeds all
+// events into bwe in the recorded order. It returns one sample per recorded
+// UpdateTargetRate call.
+func ReplayBWETrace(r io.Reader, bwe BWE) ([]BWEReplaySample, error) {
+	decoder := json.NewDecoder(r)
+	samples := []BWEReplaySample{}
+	for {
+		var e BWETraceEvent
+		if err := decoder.Decode(&e); err != nil {
+			if errors.Is(err, io.EOF) {
+				return samples, nil
+			}
+			return samples, err
+		}
+		switch e.Type {
+		case BWETraceAck:
+			bwe.OnAck(e.SequenceNumber, e.Size, time.Unix(0, e.Departure), time.Unix(0, e.Arrival), e.ECN)
+		case BWETraceLoss:
+			bwe.OnLoss(e.SequenceNumber, e.Size, time.Unix(0, e.Departure))
+		case BWETraceRTT:
+			bwe.UpdateRTT(e.RTT)
+		case BWETraceECNCounts:
+			bwe.UpdateECNCounts(e.ECT0, e.ECT1, e.CE)
+		case BWETraceTargetRate:
+			now := time.Unix(0, e.Now)
+			samples = append(samples, BWEReplaySample{
+				Time:     now,
+				Recorded: e.TargetRate,
+				Replayed: bwe.UpdateTargetRate(now),
+			})
+		default:
+			return samples, fmt.Errorf("unknown BWE trace event type: %q", e.Type)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package mrtp
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type bweCall struct {
+	method string
+	args   []any
+}
+
+type fakeBWE struct {
+	calls []bweCall
+	rate  int
+}
+
+func (f *fakeBWE) OnAck(sequenceNumber uint64, size int, departure time.Time, arrival time.Time, ecn ECN) {
+	f.calls = append(f.calls, bweCall{"ack", []any{sequenceNumber, size, departure.UnixNano(), arrival.UnixNano(), ecn}})
+}
+
+func (f *fakeBWE) OnLoss(sequenceNumber uint64, size int, departure time.Time) {
+	f.calls = append(f.calls, bweCall{"loss", []any{sequenceNumber, size, departure.UnixNano()}})
+}
+
+func (f *fakeBWE) UpdateRTT(rtt time.Duration) {
+	f.calls = append(f.calls, bweCall{"rtt", []any{rtt}})
+}
+
+func (f *fakeBWE) UpdateECNCounts(ect0 uint64, ect1 uint64, ce uint64) {
+	f.calls = append(f.calls, bweCall{"ecn", []any{ect0, ect1, ce}})
+}
+
+func (f *fakeBWE) UpdateTargetRate(now time.Time) int {
+	f.calls = append(f.calls, bweCall{"rate", []any{now.UnixNano()}})
+	f.rate += 1000
+	return f.rate
+}
+
+func TestBWERecordReplay(t *testing.T) {
+	recorded := &fakeBWE{rate: 10_000}
+	buf := &bytes.Buffer{}
+	r := NewBWERecorder(recorded, buf)
+
+	start := time.Unix(100, 0)
+	r.OnAck(1, 1200, start, start.Add(10*time.Millisecond), ECNECT1)
+	r.OnLoss(2, 1000, start.Add(time.Millisecond))
+	r.OnAck(3, 1200, start.Add(2*time.Millisecond), start.Add(15*time.Millisecond), ECNCE)
+	r.UpdateECNCounts(0, 1, 1)
+	r.UpdateRTT(25 * time.Millisecond)
+	assert.Equal(t, 11_000, r.UpdateTargetRate(start.Add(20*time.Millisecond)))
+	assert.Equal(t, 12_000, r.UpdateTargetRate(start.Add(40*time.Millisecond)))
+	require.NoError(t, r.Err())
+
+	// the trace is buffered until flushed
+	assert.Zero(t, buf.Len())
+	require.NoError(t, r.Flush())
+
+	replayed := &fakeBWE{rate: 0}
+	samples, err := ReplayBWETrace(buf, replayed)
+	require.NoError(t, err)
+
+	assert.Equal(t, recorded.calls, replayed.calls)
+	assert.Equal(t, []BWEReplaySample{
+		{Time: start.Add(20 * time.Millisecond), Recorded: 11_000, Replayed: 1000},
+		{Time: start.Add(40 * time.Millisecond), Recorded: 12_000, Replayed: 2000},
+	}, samples)
+}
+
+func TestReplayBWETraceUnknownEvent(t *testing.T) {
+	_, err := ReplayBWETrace(bytes.NewBufferString(`{"time":1,"type":"foo"}`+"\n"), &fakeBWE{})
+	assert.Error(t, err)
+}
@@ -1,47 +1,233 @@
 package mrtp
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
 
+	"github.com/pion/rtp"
+	"github.com/pion/rtp/codecs"
+)
+
+// Codec identifies a codec in the codec registry. Use [NewCodec] to look up a
+// codec by name and [RegisterCodec] to add new codecs.
 type Codec int
 
 const (
 	H264 Codec = iota
 	VP8
+	VP9
+	AV1
+	OPUS
+	// FAKE is a placeholder codec for synthetic payloads that are sent
+	// without codec specific RTP payloading.
+	FAKE
 )
 
-func (c Codec) ClockRate() int {
-	switch c {
-	default:
-		return 90_000
+// CodecInfo describes a codec in the codec registry.
+type CodecInfo struct {
+	// Name is the encoding name used in MIME types and SDP, e.g. "H264".
+	// Lookups by name are case insensitive.
+	Name string
+
+	// MediaType is "video" or "audio".
+	MediaType string
+
+	ClockRate uint32
+
+	// Channels is the number of audio channels, zero for video.
+	Channels uint16
+
+	// PayloadType is the default RTP payload type.
+	PayloadType uint8
+
+	// SDPFmtpLine holds the format parameters announced in SDP.
+	SDPFmtpLine string
+
+	// NewPayloader creates an RTP payloader for the codec.
+	NewPayloader func() rtp.Payloader
+
+	// NewDepacketizer creates an RTP depacketizer for the codec. Codecs
+	// without depacketizer pass RTP payloads through unchanged.
+	NewDepacketizer func() rtp.Depacketizer
+}
+
+// MimeType returns the MIME type of the codec, e.g. "video/H264".
+func (i CodecInfo) MimeType() string {
+	return i.MediaType + "/" + i.Name
+}
+
+var (
+	codecRegistryLock sync.RWMutex
+	codecRegistry     = []CodecInfo{
+		H264: {
+			Name:            "H264",
+			MediaType:       "video",
+			ClockRate:       90_000,
+			PayloadType:     96,
+			SDPFmtpLine:     "level-asymmetry-allowed=1;packetization-mode=1;profile-level-id=42001f",
+			NewPayloader:    func() rtp.Payloader { return &codecs.H264Payloader{} },
+			NewDepacketizer: func() rtp.Depacketizer { return &codecs.H264Packet{} },
+		},
+		VP8: {
+			Name:            "VP8",
+			MediaType:       "video",
+			ClockRate:       90_000,
+			PayloadType:     97,
+			NewPayloader:    func() rtp.Payloader { return &codecs.VP8Payloader{} },
+			NewDepacketizer: func() rtp.Depacketizer { return &codecs.VP8Packet{} },
+		},
+		VP9: {
+			Name:            "VP9",
+			MediaType:       "video",
+			ClockRate:       90_000,
+			PayloadType:     98,
+			SDPFmtpLine:     "profile-id=0",
+			NewPayloader:    func() rtp.Payloader { return &codecs.VP9Payloader{} },
+			NewDepacketizer: func() rtp.Depacketizer { return &codecs.VP9Packet{} },
+		},
+		AV1: {
+			Name:            "AV1",
+			MediaType:       "video",
+			ClockRate:       90_000,
+			PayloadType:     100,
+			NewPayloader:    func() rtp.Payloader { return &codecs.AV1Payloader{} },
+			NewDepacketizer: func() rtp.Depacketizer { return &codecs.AV1Depacketizer{} },
+		},
+		OPUS: {
+			Name:            "opus",
+			MediaType:       "audio",
+			ClockRate:       48_000,
+			Channels:        2,
+			PayloadType:     111,
+			SDPFmtpLine:     "minptime=10;useinbandfec=1",
+			NewPayloader:    func() rtp.Payloader { return &codecs.OpusPayloader{} },
+			NewDepacketizer: func() rtp.Depacketizer { return &codecs.OpusPacket{} },
+		},
+		FAKE: {
+			Name:        "FAKE",
+			MediaType:   "video",
+			ClockRate:   90_000,
+			PayloadType: 99,
+			// use G722 as 0s are a valid payload for it
+			NewPayloader: func() rtp.Payloader { return &codecs.G722Payloader{} },
+		},
+	}
+)
+
+// RegisterCodec adds a new codec to the registry and returns its identifier.
+// Name and MediaType are required and the name must not be registered yet.
+func RegisterCodec(info CodecInfo) (Codec, error) {
+	if len(info.Name) == 0 || len(info.MediaType) == 0 {
+		return 0, errors.New("codec name and media type are required")
 	}
+	codecRegistryLock.Lock()
+	defer codecRegistryLock.Unlock()
+	for _, c := range codecRegistry {
+		if strings.EqualFold(c.Name, info.Name) {
+			return 0, fmt.Errorf("codec already registered: %v", info.Name)
+		}
+	}
+	codecRegistry = append(codecRegistry, info)
+	return Codec(len(codecRegistry) - 1), nil
 }
 
+// Codecs returns all registered codecs.
+func Codecs() []Codec {
+	codecRegistryLock.RLock()
+	defer codecRegistryLock.RUnlock()
+	codecs := make([]Codec, len(codecRegistry))
+	for i := range codecRegistry {
+		codecs[i] = Codec(i)
+	}
+	return codecs
+}
+
+// CodecNames returns the names of all registered codecs, e.g. for flag usage
+// strings.
+func CodecNames() string {
+	names := []string{}
+	for _, c := range Codecs() {
+		names = append(names, c.String())
+	}
+	return strings.Join(names, ", ")
+}
+
+// NewCodec looks up a codec by its name or MIME type. The lookup is case
+// insensitive.
 func NewCodec(s string) (Codec, error) {
-	switch s {
-	case "H264":
-		return H264, nil
-	case "VP8":
-		return VP8, nil
+	codecRegistryLock.RLock()
+	defer codecRegistryLock.RUnlock()
+	for i, c := range codecRegistry {
+		if strings.EqualFold(c.Name, s) || strings.EqualFold(c.MimeType(), s) {
+			return Codec(i), nil
+		}
 	}
 	return H264, fmt.Errorf("unknown codec: %s", s)
 }
 
+// Info returns the registry entry of c.
+func (c Codec) Info() (CodecInfo, bool) {
+	codecRegistryLock.RLock()
+	defer codecRegistryLock.RUnlock()
+	if c < 0 || int(c) >= len(codecRegistry) {
+		return CodecInfo{}, false
+	}
+	return codecRegistry[c], true
+}
+
+func (c Codec) info() CodecInfo {
+	info, _ := c.Info()
+	return info
+}
+
+func (c Codec) ClockRate() int {
+	return int(c.info().ClockRate)
+}
+
 func (c Codec) String() string {
-	switch c {
-	case H264:
-		return "H264"
-	case VP8:
-		return "VP8"
+	if info, ok := c.Info(); ok {
+		return info.Name
 	}
 	return "unknown"
 }
 
 func (c Codec) MediaType() string {
-	switch c {
-	case H264:
-		return "video"
-	case VP8:
-		return "video"
+	if info, ok := c.Info(); ok {
+		return info.MediaType
 	}
 	return "video"
 }
+
+// MimeType returns the MIME type of c, e.g. "video/H264".
+func (c Codec) MimeType() string {
+	return c.MediaType() + "/" + c.String()
+}
+
+// PayloadType returns the default RTP payload type of c.
+func (c Codec) PayloadType() uint8 {
+	return c.info().PayloadType
+}
+
+// NewPayloader creates an RTP payloader for c.
+func (c Codec) NewPayloader() (rtp.Payloader, error) {
+	info := c.info()
+	if info.NewPayloader == nil {
+		return nil, fmt.Errorf("no RTP payloader for codec: %v", c)
+	}
+	return info.NewPayloader(), nil
+}
+
+// NewDepacketizer creates an RTP depacketizer for c. It returns nil without
+// error for codecs whose payloads are not depacketized.
+func (c Codec) NewDepacketizer() (rtp.Depacketizer, error) {
+	info, ok := c.Info()
+	if !ok {
+		return nil, fmt.Errorf("unknown codec: %v", int(c))
+	}
+	if info.NewDepacketizer == nil {
+		return nil, nil
+	}
+	return info.NewDepacketizer(), nil
+}
@@ -0,0 +1,76 @@
+package mrtp
+
+import (
+	"testing"
+
+	"github.com/pion/rtp/codecs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewCodec(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		codec Codec
+	}{
+		{"H264", H264},
+		{"h264", H264},
+		{"VP8", VP8},
+		{"vp9", VP9},
+		{"av1", AV1},
+		{"Opus", OPUS},
+		{"audio/opus", OPUS},
+		{"fake", FAKE},
+		{"video/VP8", VP8},
+	} {
+		c, err := NewCodec(tc.name)
+		require.NoError(t, err, tc.name)
+		assert.Equal(t, tc.codec, c, tc.name)
+	}
+	_, err := NewCodec("mpeg2")
+	assert.Error(t, err)
+}
+
+func TestCodecInfo(t *testing.T) {
+	assert.Equal(t, "FAKE", FAKE.String())
+	assert.Equal(t, "video/VP9", VP9.MimeType())
+	assert.Equal(t, 90_000, H264.ClockRate())
+	assert.Equal(t, 48_000, OPUS.ClockRate())
+	assert.Equal(t, "audio/opus", OPUS.MimeType())
+	assert.Equal(t, "unknown", Codec(-1).String())
+
+	p, err := VP8.NewPayloader()
+	require.NoError(t, err)
+	assert.IsType(t, &codecs.VP8Payloader{}, p)
+
+	d, err := FAKE.NewDepacketizer()
+	require.NoError(t, err)
+	assert.Nil(t, d)
+
+	_, err = Codec(-1).NewDepacketizer()
+	assert.Error(t, err)
+}
+
+func TestRegisterCodec(t *testing.T) {
+	c, err := RegisterCodec(CodecInfo{
+		Name:        "test-codec",
+		MediaType:   "audio",
+		ClockRate:   8000,
+		PayloadType: 100,
+	})
+	require.NoError(t, err)
+	assert.Contains(t, Codecs(), c)
+	assert.Equal(t, "audio/test-codec", c.MimeType())
+
+	found, err := NewCodec("TEST-CODEC")
+	require.NoError(t, err)
+	assert.Equal(t, c, found)
+
+	_, err = c.NewPayloader()
+	assert.Error(t, err)
+
+	_, err = RegisterCodec(CodecInfo{Name: "h264", MediaType: "video"})
+	assert.Error(t, err)
+	_, err = RegisterCodec(CodecInfo{Name: "x"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,168 @@
+package gopipe
+
+import (
+	"cmp"
+	"log/slog"
+	"math"
+	"slices"
+	"sync"
+	"time"
+)
+
+// FrameRateDecimator drops frames to reduce the frame rate to the rate set
+// with SetFrameRate. It keeps every n-th frame, where n is the source frame
+// rate divided by the target frame rate rounded to the nearest integer, and
+// extends the FrameDuration of kept frames accordingly.
+type FrameRateDecimator struct {
+	lock      sync.Mutex
+	frameRate float64
+
+	divisor int
+	count   int
+}
+
+func NewFrameRateDecimator() *FrameRateDecimator {
+	return &FrameRateDecimator{}
+}
+
+// SetFrameRate sets the target frame rate. Zero keeps all frames.
+func (d *FrameRateDecimator) SetFrameRate(fps float64) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.frameRate = fps
+}
+
+// keep reports whether the next frame of a source with frame rate srcFPS is
+// kept and returns the decimation divisor.
+func (d *FrameRateDecimator) keep(srcFPS float64) (bool, int) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	divisor := 1
+	if d.frameRate > 0 && d.frameRate < srcFPS {
+		divisor = int(math.Round(srcFPS / d.frameRate))
+	}
+	if divisor != d.divisor {
+		d.divisor = divisor
+		d.count = 0
+	}
+	keep := d.count%divisor == 0
+	d.count++
+	return keep, divisor
+}
+
+func (d *FrameRateDecimator) Link(next Sink, i Info) (Sink, error) {
+	srcFPS := float64(i.TimebaseNum) / float64(i.TimebaseDen)
+	return WriterFunc(func(b []byte, a Attributes) error {
+		keep, divisor := d.keep(srcFPS)
+		if !keep {
+			return nil
+		}
+		if divisor > 1 {
+			if frameDuration, err := getFrameDuration(a); err == nil {
+				a[FrameDuration] = frameDuration * time.Duration(divisor)
+			}
+		}
+		return next.Write(b, a)
+	}), nil
+}
+
+// QualityStep is a resolution and frame rate that a [QualityAdapter] selects
+// if the target rate is at least MinRate.
+type QualityStep struct {
+	Width     int
+	Height    int
+	FrameRate float64
+	MinRate   uint64
+}
+
+// qualityBitsPerPixel is the number of bits per pixel that DefaultQualitySteps
+// assumes for acceptable quality.
+const qualityBitsPerPixel = 0.03
+
+// DefaultQualitySteps returns steps with full, half and quarter resolution at
+// full and half frame rate of the source, ordered by decreasing MinRate.
+// Frame rates below 10 fps are left out.
+func DefaultQualitySteps(width, height int, frameRate float64) []QualityStep {
+	var steps []QualityStep
+	for _, scale := range []int{1, 2, 4} {
+		for _, fps := range []float64{frameRate, frameRate / 2} {
+			if fps < 10 && fps != frameRate {
+				continue
+			}
+			w, h := width/scale&^1, height/scale&^1
+			steps = append(steps, QualityStep{
+				Width:     w,
+				Height:    h,
+				FrameRate: fps,
+				MinRate:   uint64(qualityBitsPerPixel * float64(w*h) * fps),
+			})
+		}
+	}
+	slices.SortStableFunc(steps, func(a, b QualityStep) int {
+		return cmp.Compare(b.MinRate, a.MinRate)
+	})
+	return steps
+}
+
+// qualityUpSwitchFactor is the factor by which the target rate must exceed
+// the MinRate of a higher step before the QualityAdapter switches up.
+const qualityUpSwitchFactor = 1.2
+
+// QualityAdapter selects the resolution of a [Scaler] and the frame rate of a
+// [FrameRateDecimator] from the target rate. It switches down as soon as the
+// target rate falls below the MinRate of the current step and switches up
+// only if the target rate exceeds the MinRate of a higher step by 20%.
+type QualityAdapter struct {
+	scaler    *Scaler
+	decimator *FrameRateDecimator
+	steps     []QualityStep
+
+	lock    sync.Mutex
+	current int
+}
+
+// NewQualityAdapter creates an adapter that selects from steps, which must be
+// ordered from the highest to the lowest quality. The lowest step is used for
+// target rates below all MinRates.
+func NewQualityAdapter(scaler *Scaler, decimator *FrameRateDecimator, steps []QualityStep) *QualityAdapter {
+	return &QualityAdapter{
+		scaler:    scaler,
+		decimator: decimator,
+		steps:     steps,
+		current:   -1,
+	}
+}
+
+// SetTargetRate selects the step for targetRate in bits per second.
+func (a *QualityAdapter) SetTargetRate(targetRate uint64) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	if len(a.steps) == 0 {
+		return
+	}
+	next := len(a.steps) - 1
+	for i, step := range a.steps {
+		minRate := float64(step.MinRate)
+		if a.current >= 0 && i < a.current {
+			minRate *= qualityUpSwitchFactor
+		}
+		if float64(targetRate) >= minRate {
+			next = i
+			break
+		}
+	}
+	if next == a.current {
+		return
+	}
+	a.current = next
+	step := a.steps[next]
+	slog.Info("QUALITY_STEP", "width", step.Width, "height", step.Height, "frame-rate", step.FrameRate, "target-rate", targetRate)
+	if a.scaler != nil {
+		a.scaler.SetResolution(step.Width, step.Height)
+	}
+	if a.decimator != nil {
+		a.decimator.SetFrameRate(step.FrameRate)
+	}
+}
@@ -0,0 +1,172 @@
+package gopipe
+
+import (
+	"image"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mengelbart/mrtp/gopipe/codec"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testI420Frame returns an I420 frame with a horizontal luma gradient and
+// constant chroma planes.
+func testI420Frame(width, height int) []byte {
+	frame := make([]byte, codec.FrameSize(width, height, image.YCbCrSubsampleRatio420))
+	for y := range height {
+		for x := range width {
+			frame[y*width+x] = byte(x)
+		}
+	}
+	cSize := (width + 1) / 2 * ((height + 1) / 2)
+	for i := range cSize {
+		frame[width*height+i] = 100
+		frame[width*height+cSize+i] = 200
+	}
+	return frame
+}
+
+func TestScaler(t *testing.T) {
+	var frames [][]byte
+	var attrs []Attributes
+	sink := WriterFunc(func(b []byte, a Attributes) error {
+		frames = append(frames, b)
+		attrs = append(attrs, a)
+		return nil
+	})
+	scaler := NewScaler()
+	w, err := scaler.Link(sink, Info{Width: 8, Height: 4})
+	require.NoError(t, err)
+
+	frame := testI420Frame(8, 4)
+	require.NoError(t, w.Write(frame, Attributes{ChromaSubsampling: image.YCbCrSubsampleRatio420}))
+	assert.Equal(t, frame, frames[0])
+	assert.Equal(t, 8, attrs[0][Width])
+	assert.Equal(t, 4, attrs[0][Height])
+
+	scaler.SetResolution(4, 2)
+	require.NoError(t, w.Write(frame, Attributes{ChromaSubsampling: image.YCbCrSubsampleRatio420}))
+	expected := []byte{
+		1, 3, 5, 7, // averages of the luma gradient
+		1, 3, 5, 7,
+		100, 100, // Cb
+		200, 200, // Cr
+	}
+	assert.Equal(t, expected, frames[1])
+	assert.Equal(t, 4, attrs[1][Width])
+	assert.Equal(t, 2, attrs[1][Height])
+
+	// a 4:2:0 frame is too short for 4:4:4
+	err = w.Write(frame, Attributes{ChromaSubsampling: image.YCbCrSubsampleRatio444})
+	assert.Error(t, err)
+}
+
+func TestScalePlaneUpscale(t *testing.T) {
+	dst := make([]byte, 16)
+	scalePlane(dst, []byte{1, 2, 3, 4}, 2, 2, 4, 4)
+	assert.Equal(t, []byte{
+		1, 1, 2, 2,
+		1, 1, 2, 2,
+		3, 3, 4, 4,
+		3, 3, 4, 4,
+	}, dst)
+}
+
+func TestFrameRateDecimator(t *testing.T) {
+	var durations []time.Duration
+	sink := WriterFunc(func(_ []byte, a Attributes) error {
+		durations = append(durations, a[FrameDuration].(time.Duration))
+		return nil
+	})
+	decimator := NewFrameRateDecimator()
+	w, err := decimator.Link(sink, Info{TimebaseNum: 60, TimebaseDen: 1})
+	require.NoError(t, err)
+
+	write := func(n int) {
+		for range n {
+			require.NoError(t, w.Write(nil, Attributes{FrameDuration: 16 * time.Millisecond}))
+		}
+	}
+	write(4)
+	assert.Len(t, durations, 4)
+
+	decimator.SetFrameRate(30)
+	write(4)
+	assert.Len(t, durations, 6)
+	assert.Equal(t, 32*time.Millisecond, durations[5])
+
+	decimator.SetFrameRate(15)
+	write(8)
+	assert.Len(t, durations, 8)
+	assert.Equal(t, 64*time.Millisecond, durations[7])
+}
+
+func TestDefaultQualitySteps(t *testing.T) {
+	steps := DefaultQualitySteps(1280, 720, 60)
+	require.Len(t, steps, 6)
+	assert.Equal(t, QualityStep{Width: 1280, Height: 720, FrameRate: 60, MinRate: 1_658_880}, steps[0])
+	assert.Equal(t, QualityStep{Width: 1280, Height: 720, FrameRate: 30, MinRate: 829_440}, steps[1])
+	assert.Equal(t, QualityStep{Width: 320, Height: 180, FrameRate: 30, MinRate: 51_840}, steps[5])
+	for i := 1; i < len(steps); i++ {
+		assert.Less(t, steps[i].MinRate, steps[i-1].MinRate)
+	}
+
+	// frame rates below 10 fps are left out
+	assert.Len(t, DefaultQualitySteps(640, 360, 15), 3)
+}
+
+func TestQualityAdapter(t *testing.T) {
+	scaler := NewScaler()
+	decimator := NewFrameRateDecimator()
+	steps := []QualityStep{
+		{Width: 1280, Height: 720, FrameRate: 30, MinRate: 1_000_000},
+		{Width: 640, Height: 360, FrameRate: 30, MinRate: 300_000},
+		{Width: 320, Height: 180, FrameRate: 15, MinRate: 50_000},
+	}
+	adapter := NewQualityAdapter(scaler, decimator, steps)
+
+	assertStep := func(step QualityStep) {
+		t.Helper()
+		width, height := scaler.resolution()
+		assert.Equal(t, step.Width, width)
+		assert.Equal(t, step.Height, height)
+		assert.Equal(t, step.FrameRate, decimator.frameRate)
+	}
+
+	adapter.SetTargetRate(2_000_000)
+	assertStep(steps[0])
+
+	adapter.SetTargetRate(500_000)
+	assertStep(steps[1])
+
+	// switching up requires 20% headroom
+	adapter.SetTargetRate(1_100_000)
+	assertStep(steps[1])
+	adapter.SetTargetRate(1_200_000)
+	assertStep(steps[0])
+
+	// the lowest step is used below all minimum rates
+	adapter.SetTargetRate(10_000)
+	assertStep(steps[2])
+}
+
+func TestY4MSinkScalesResolutionChanges(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.y4m")
+	sink, err := NewY4MSink(path, 30, 1)
+	require.NoError(t, err)
+
+	attrs := func(width, height int) Attributes {
+		return Attributes{Width: width, Height: height, ChromaSubsampling: image.YCbCrSubsampleRatio420}
+	}
+	require.NoError(t, sink.Write(testI420Frame(8, 4), attrs(8, 4)))
+	require.NoError(t, sink.Write(testI420Frame(4, 2), attrs(4, 2)))
+	require.NoError(t, sink.Close())
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	header := "YUV4MPEG2 W8 H4 F30:1 Ip A0:0 C420jpeg\n"
+	assert.Equal(t, len(header)+2*(len("FRAME\n")+codec.FrameSize(8, 4, image.YCbCrSubsampleRatio420)), len(data))
+}
@@ -0,0 +1,137 @@
+//go:build cgo
+
+package gopipe
+
+import (
+	"context"
+	"os"
+	"testing"
+	"testing/synctest"
+	"time"
+
+	"github.com/mengelbart/mrtp"
+	"github.com/mengelbart/mrtp/gopipe/codec"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAOMDecode(t *testing.T) {
+	// video file must exist
+	if _, err := os.Stat("../simulation/Johnny_1280x720_60.y4m"); os.IsNotExist(err) {
+		println("Video file not found. See simulation folder for more information.\n")
+		t.Skip("video not found")
+	}
+
+	synctest.Test(t, func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+
+		framesReceived := 0
+
+		decoder, err := codec.NewAOMDecoder()
+		assert.NoError(t, err)
+
+		sink := WriterFunc(func(frame []byte, attr Attributes) error {
+			rawFrame, decodeErr := decoder.Decode(frame)
+			assert.NoError(t, decodeErr)
+			assert.NotNil(t, rawFrame)
+
+			framesReceived++
+
+			return err
+		})
+
+		file, err := os.Open("../simulation/Johnny_1280x720_60.y4m")
+		assert.NoError(t, err)
+		defer func() {
+			assert.NoError(t, file.Close())
+		}()
+
+		fileSrc, err := NewY4MSource(file)
+		assert.NoError(t, err)
+
+		i := fileSrc.GetInfo()
+		encoder := NewEncoder(mrtp.AV1)
+		frameInter := newFrameInterceptor(false, 0, nil)
+
+		writer, err := Chain(i, sink, encoder, frameInter)
+		assert.NoError(t, err)
+
+		assert.NoError(t, fileSrc.StartLive(ctx, writer))
+
+		assert.Equal(t, frameInter.count, framesReceived)
+
+		decoder.Close()
+		cancel()
+		synctest.Wait()
+	})
+}
+
+func TestAOMDecodeWithRtp(t *testing.T) {
+	// video file must exist
+	if _, err := os.Stat("../simulation/Johnny_1280x720_60.y4m"); os.IsNotExist(err) {
+		println("Video file not found. See simulation folder for more information.\n")
+		t.Skip("video not found")
+	}
+
+	synctest.Test(t, func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+
+		framesReceived := 0
+
+		decoder, err := codec.NewAOMDecoder()
+		assert.NoError(t, err)
+
+		timeout := 10 * time.Millisecond
+		depacketizer, err := newRTPDepacketizer(timeout, mrtp.AV1, func(frame []byte, pts int64) {
+			rawFrame, err := decoder.Decode(frame)
+			assert.NoError(t, err)
+			assert.NotNil(t, rawFrame)
+			framesReceived++
+		}, func(err error) {
+			assert.NoError(t, err)
+		})
+		assert.NoError(t, err)
+
+		depacketizer.start(ctx)
+
+		sink := WriterFunc(func(b []byte, _ Attributes) error {
+			return depacketizer.Write(b)
+		})
+
+		file, err := os.Open("../simulation/Johnny_1280x720_60.y4m")
+		assert.NoError(t, err)
+		defer func() {
+			assert.NoError(t, file.Close())
+		}()
+
+		fileSrc, err := NewY4MSource(file)
+		assert.NoError(t, err)
+
+		i := fileSrc.GetInfo()
+		encoder := NewEncoder(mrtp.AV1)
+		packetizer := &RTPPacketizerFactory{
+			MTU:       1420,
+			PT:        96,
+			SSRC:      0,
+			ClockRate: 90_000,
+			Codec:     mrtp.AV1,
+		}
+		pacer := NewFrameSpacer()
+		defer func() {
+			assert.NoError(t, pacer.Close())
+		}()
+
+		frameInter := newFrameInterceptor(false, 0, nil)
+
+		writer, err := Chain(i, sink, pacer, packetizer, encoder, frameInter)
+		assert.NoError(t, err)
+		assert.NoError(t, pacer.Start(ctx))
+
+		assert.NoError(t, fileSrc.StartLive(ctx, writer))
+
+		assert.Equal(t, frameInter.count, framesReceived)
+
+		assert.NoError(t, depacketizer.Close())
+		cancel()
+		synctest.Wait()
+	})
+}
@@ -3,6 +3,7 @@ package gopipe
 import (
 	"fmt"
 	"image"
+	"time"
 )
 
 type AttributeKey int
@@ -15,6 +16,11 @@ const (
 	Height
 	PTS
 	FrameDuration
+	// TemporalLayerID is the temporal layer of an encoded frame (int).
+	TemporalLayerID
+	// SpatialLayerSizes holds the sizes of the spatial layer frames of an
+	// encoded frame ([]int), see [codec.Frame].
+	SpatialLayerSizes
 )
 
 type Attributes map[any]any
@@ -33,6 +39,18 @@ func getPTS(attrs Attributes) (int64, error) {
 	return ptsVal, nil
 }
 
+func getFrameDuration(attrs Attributes) (time.Duration, error) {
+	fdAttr, ok := attrs[FrameDuration]
+	if !ok {
+		return 0, fmt.Errorf("FrameDuration attribute not found")
+	}
+	fdVal, ok := fdAttr.(time.Duration)
+	if !ok {
+		return 0, fmt.Errorf("FrameDuration attribute is not time.Duration")
+	}
+	return fdVal, nil
+}
+
 func getChromaSubsampling(attrs Attributes) (image.YCbCrSubsampleRatio, error) {
 	csAttr, ok := attrs[ChromaSubsampling]
 	if !ok {
@@ -68,3 +86,27 @@ func getHeight(attrs Attributes) (int, error) {
 	}
 	return heightVal, nil
 }
+
+func getTemporalLayerID(attrs Attributes) (int, error) {
+	tidAttr, ok := attrs[TemporalLayerID]
+	if !ok {
+		return 0, fmt.Errorf("TemporalLayerID attribute not found")
+	}
+	tidVal, ok := tidAttr.(int)
+	if !ok {
+		return 0, fmt.Errorf("TemporalLayerID attribute is not int")
+	}
+	return tidVal, nil
+}
+
+func getSpatialLayerSizes(attrs Attributes) ([]int, error) {
+	sizesAttr, ok := attrs[SpatialLayerSizes]
+	if !ok {
+		return nil, fmt.Errorf("SpatialLayerSizes attribute not found")
+	}
+	sizesVal, ok := sizesAttr.([]int)
+	if !ok {
+		return nil, fmt.Errorf("SpatialLayerSizes attribute is not []int")
+	}
+	return sizesVal, nil
+}
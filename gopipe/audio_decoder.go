@@ -0,0 +1,54 @@
+//go:build cgo
+
+package gopipe
+
+import (
+	"encoding/binary"
+	"fmt"
+	"log/slog"
+
+	"github.com/mengelbart/mrtp"
+	"github.com/mengelbart/mrtp/gopipe/codec"
+)
+
+// AudioDecoder decodes audio frames to interleaved little endian 16 bit PCM.
+type AudioDecoder struct {
+	decoder codec.AudioDecoder
+}
+
+func NewAudioDecoder(c mrtp.Codec, sampleRate, channels int) (*AudioDecoder, error) {
+	dec, err := codec.NewAudioDecoder(c, sampleRate, channels)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %v decoder: %w", c, err)
+	}
+	return &AudioDecoder{
+		decoder: dec,
+	}, nil
+}
+
+func (d *AudioDecoder) Link(next Sink, i Info) (Sink, error) {
+	return WriterFunc(func(encFrame []byte, attrs Attributes) error {
+		pts, err := getPTS(attrs)
+		if err != nil {
+			return err
+		}
+
+		pcm, err := d.decoder.Decode(encFrame)
+		if err != nil {
+			return fmt.Errorf("failed to decode audio frame: %w", err)
+		}
+
+		slog.Info("audio decoder src", "samples", len(pcm), "pts", pts)
+
+		b := make([]byte, 0, 2*len(pcm))
+		for _, sample := range pcm {
+			b = binary.LittleEndian.AppendUint16(b, uint16(sample))
+		}
+		return next.Write(b, attrs)
+	}), nil
+}
+
+func (d *AudioDecoder) Close() error {
+	d.decoder.Close()
+	return nil
+}
@@ -0,0 +1,76 @@
+//go:build cgo
+
+package gopipe
+
+import (
+	"encoding/binary"
+	"fmt"
+	"log/slog"
+
+	"github.com/mengelbart/mrtp"
+	"github.com/mengelbart/mrtp/gopipe/codec"
+)
+
+// AudioEncoder encodes frames of interleaved little endian 16 bit PCM.
+type AudioEncoder struct {
+	encoder codec.AudioEncoder
+
+	codec      mrtp.Codec
+	targetRate uint64
+}
+
+func NewAudioEncoder(codec mrtp.Codec, targetRate uint64) *AudioEncoder {
+	return &AudioEncoder{
+		codec:      codec,
+		targetRate: targetRate,
+	}
+}
+
+func (e *AudioEncoder) Link(f Sink, i Info) (Sink, error) {
+	enc, err := codec.NewAudioEncoder(codec.AudioConfig{
+		Codec:      e.codec,
+		SampleRate: i.SampleRate,
+		Channels:   i.Channels,
+		TargetRate: e.targetRate,
+	})
+	if err != nil {
+		return nil, err
+	}
+	e.encoder = enc
+
+	return WriterFunc(func(b []byte, a Attributes) error {
+		pts, err := getPTS(a)
+		if err != nil {
+			return err
+		}
+		pcm := make([]int16, len(b)/2)
+		for n := range pcm {
+			pcm[n] = int16(binary.LittleEndian.Uint16(b[2*n:]))
+		}
+		encoded, err := e.encoder.Encode(pcm)
+		if err != nil {
+			return fmt.Errorf("failed to encode audio frame: %w", err)
+		}
+		slog.Info("audio encoder src", "length", len(encoded), "pts", pts)
+		return f.Write(encoded, a)
+	}), nil
+}
+
+// Codec returns the codec of the encoded frames.
+func (e *AudioEncoder) Codec() mrtp.Codec {
+	return e.codec
+}
+
+func (e *AudioEncoder) SetTargetRate(targetRate uint64) {
+	slog.Info("NEW_TARGET_AUDIO_RATE", "rate", targetRate)
+	if e.encoder != nil {
+		e.encoder.SetTargetRate(targetRate)
+	}
+}
+
+func (e *AudioEncoder) Close() error {
+	if e.encoder != nil {
+		return e.encoder.Close()
+	}
+	return nil
+}
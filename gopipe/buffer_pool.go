@@ -0,0 +1,60 @@
+package gopipe
+
+import (
+	"math/bits"
+	"sync"
+)
+
+// maxPooledBuffers bounds the number of free buffers a BufferPool keeps per
+// size class.
+const maxPooledBuffers = 4096
+
+// BufferPool recycles buffers of elements that keep data beyond a Write
+// call, see [Sink]. Buffers taken with Get must be returned with Put once the
+// element no longer uses them.
+//
+// Free buffers are kept in power of two size classes, so that buffers of
+// mixed sizes, e.g. packets and frames, are reused for requests of their
+// size instead of being replaced by larger ones.
+type BufferPool struct {
+	lock sync.Mutex
+	// free[k] holds buffers with a capacity of at least 1<<k bytes
+	free [bits.UintSize][][]byte
+}
+
+func NewBufferPool() *BufferPool {
+	return &BufferPool{}
+}
+
+// Get returns a buffer of length n. Its content is undefined. It reuses a
+// free buffer of the smallest size class that fits n.
+func (p *BufferPool) Get(n int) []byte {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	// smallest class k with 1<<k >= n
+	class := bits.Len(uint(max(n, 1) - 1))
+	for k := class; k < len(p.free); k++ {
+		if free := p.free[k]; len(free) > 0 {
+			b := free[len(free)-1]
+			p.free[k] = free[:len(free)-1]
+			return b[:n]
+		}
+	}
+	return make([]byte, n, 1<<class)
+}
+
+// Put returns b to the pool.
+func (p *BufferPool) Put(b []byte) {
+	if cap(b) == 0 {
+		return
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	// largest class k with 1<<k <= cap(b)
+	class := bits.Len(uint(cap(b))) - 1
+	if len(p.free[class]) < maxPooledBuffers {
+		p.free[class] = append(p.free[class], b[:0])
+	}
+}
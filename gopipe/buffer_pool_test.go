@@ -0,0 +1,87 @@
+package gopipe
+
+import (
+	"math/rand/v2"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBufferPool(t *testing.T) {
+	pool := NewBufferPool()
+
+	b := pool.Get(100)
+	assert.Len(t, b, 100)
+	pool.Put(b)
+
+	// smaller buffers reuse the returned one
+	c := pool.Get(10)
+	assert.Len(t, c, 10)
+	assert.Equal(t, &b[0], &c[0])
+	pool.Put(c)
+
+	// larger buffers are allocated, the smaller buffer stays in the pool
+	d := pool.Get(200)
+	assert.Len(t, d, 200)
+	pool.Put(d)
+	assert.Equal(t, 2, pool.len())
+
+	// buffers are taken from the smallest class that fits
+	e := pool.Get(100)
+	assert.Equal(t, &b[0], &e[0])
+	f := pool.Get(150)
+	assert.Equal(t, &d[0], &f[0])
+	assert.Zero(t, pool.len())
+}
+
+// len returns the number of free buffers.
+func (p *BufferPool) len() int {
+	n := 0
+	for _, free := range p.free {
+		n += len(free)
+	}
+	return n
+}
+
+// pooledBytes returns the capacity of the free buffers.
+func (p *BufferPool) pooledBytes() int {
+	n := 0
+	for _, free := range p.free {
+		for _, b := range free {
+			n += cap(b)
+		}
+	}
+	return n
+}
+
+func BenchmarkBufferPool(b *testing.B) {
+	pool := NewBufferPool()
+	b.ReportAllocs()
+	for b.Loop() {
+		pool.Put(pool.Get(1200))
+	}
+}
+
+func BenchmarkBufferPoolMixedSizes(b *testing.B) {
+	pool := NewBufferPool()
+	// packets and frames of varying sizes, returned in a different order
+	rng := rand.New(rand.NewPCG(1, 2))
+	sizes := []int{300, 800, 1200, 1200, 1200, 5_000, 60_000}
+	bufs := make([][]byte, len(sizes))
+	b.ReportAllocs()
+	for b.Loop() {
+		rng.Shuffle(len(sizes), func(i, j int) {
+			sizes[i], sizes[j] = sizes[j], sizes[i]
+		})
+		for i, size := range sizes {
+			bufs[i] = pool.Get(size)
+		}
+		rng.Shuffle(len(bufs), func(i, j int) {
+			bufs[i], bufs[j] = bufs[j], bufs[i]
+		})
+		for _, buf := range bufs {
+			pool.Put(buf)
+		}
+	}
+	b.ReportMetric(float64(pool.pooledBytes()), "pooled-B")
+}
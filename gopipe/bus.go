@@ -0,0 +1,111 @@
+package gopipe
+
+import (
+	"fmt"
+	"log/slog"
+)
+
+type MessageType int
+
+const (
+	// MessageError reports an error that stops the pipeline.
+	MessageError MessageType = iota
+	// MessageWarning reports an error that affects only a part of the
+	// pipeline, e.g. a branch of a [Tee].
+	MessageWarning
+	// MessageEOS reports that all elements have processed the end of the
+	// stream.
+	MessageEOS
+)
+
+func (t MessageType) String() string {
+	switch t {
+	case MessageError:
+		return "error"
+	case MessageWarning:
+		return "warning"
+	case MessageEOS:
+		return "eos"
+	}
+	return "unknown"
+}
+
+// Message is posted on a [Bus] by the element Element.
+type Message struct {
+	Type    MessageType
+	Element any
+	Err     error
+}
+
+// busSize bounds the number of messages a Bus keeps until they are read.
+const busSize = 64
+
+// Bus passes asynchronous errors and the end of the stream from the elements
+// of a pipeline to the application. Posting never blocks: if the application
+// does not read the messages, new messages are dropped. Elements may post on a
+// nil bus, which logs the messages instead.
+type Bus struct {
+	messages chan Message
+
+	// warnOnly downgrades errors to warnings, see [Bus.warnings].
+	warnOnly bool
+}
+
+func NewBus() *Bus {
+	return &Bus{
+		messages: make(chan Message, busSize),
+	}
+}
+
+// Messages returns the channel of posted messages.
+func (b *Bus) Messages() <-chan Message {
+	return b.messages
+}
+
+func (b *Bus) Post(m Message) {
+	if b != nil && b.warnOnly && m.Type == MessageError {
+		m.Type = MessageWarning
+	}
+	if b == nil || b.messages == nil {
+		logMessage(m)
+		return
+	}
+	select {
+	case b.messages <- m:
+	default:
+		slog.Warn("bus full, dropping message")
+		logMessage(m)
+	}
+}
+
+// Error posts a MessageError of element.
+func (b *Bus) Error(element any, err error) {
+	b.Post(Message{Type: MessageError, Element: element, Err: err})
+}
+
+// Warning posts a MessageWarning of element.
+func (b *Bus) Warning(element any, err error) {
+	b.Post(Message{Type: MessageWarning, Element: element, Err: err})
+}
+
+// warnings returns a bus that posts on b but downgrades errors to warnings,
+// for elements whose errors must not stop the pipeline.
+func (b *Bus) warnings() *Bus {
+	if b == nil {
+		return &Bus{warnOnly: true}
+	}
+	return &Bus{messages: b.messages, warnOnly: true}
+}
+
+// logMessage logs m with the type of its element.
+func logMessage(m Message) {
+	element := fmt.Sprintf("%T", m.Element)
+	switch m.Type {
+	case MessageError:
+		slog.Error("pipeline error", "element", element, "error", m.Err)
+	case MessageWarning:
+		slog.Warn("pipeline warning", "element", element, "error", m.Err)
+	default:
+		slog.Info("pipeline message", "type", m.Type, "element", element)
+	}
+}
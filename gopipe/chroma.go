@@ -0,0 +1,67 @@
+package gopipe
+
+import (
+	"fmt"
+	"image"
+
+	"github.com/mengelbart/mrtp/gopipe/codec"
+)
+
+// ChromaConverter converts planar YCbCr frames to the chroma subsampling
+// given to NewChromaConverter, e.g. 4:4:4 frames to 4:2:0 for encoders that
+// only support 4:2:0. Chroma planes are downsampled by averaging and
+// upsampled by repeating samples. Frames without ChromaSubsampling attribute
+// are taken as 4:2:0.
+type ChromaConverter struct {
+	target image.YCbCrSubsampleRatio
+}
+
+func NewChromaConverter(target image.YCbCrSubsampleRatio) *ChromaConverter {
+	return &ChromaConverter{
+		target: target,
+	}
+}
+
+func (c *ChromaConverter) Link(next Sink, i Info) (Sink, error) {
+	return WriterFunc(func(b []byte, a Attributes) error {
+		csr, err := getChromaSubsampling(a)
+		if err != nil {
+			csr = image.YCbCrSubsampleRatio420
+		}
+		a[ChromaSubsampling] = c.target
+		if csr == c.target {
+			return next.Write(b, a)
+		}
+
+		width, err := getWidth(a)
+		if err != nil {
+			width = int(i.Width)
+		}
+		height, err := getHeight(a)
+		if err != nil {
+			height = int(i.Height)
+		}
+		if len(b) < codec.FrameSize(width, height, csr) {
+			return fmt.Errorf("chroma converter: frame too short for %vx%v %v: %v bytes", width, height, csr, len(b))
+		}
+
+		converted := make([]byte, codec.FrameSize(width, height, c.target))
+		convertChroma(converted, b, width, height, csr, c.target)
+		return next.Write(converted, a)
+	}), nil
+}
+
+// convertChroma converts the frame src of width x height with chroma
+// subsampling from to the subsampling to and writes it to dst.
+func convertChroma(dst, src []byte, width, height int, from, to image.YCbCrSubsampleRatio) {
+	ySize := width * height
+	copy(dst[:ySize], src[:ySize])
+
+	srcCWidth, srcCHeight := codec.ChromaSize(width, height, from)
+	srcCSize := srcCWidth * srcCHeight
+	cWidth, cHeight := codec.ChromaSize(width, height, to)
+	cSize := cWidth * cHeight
+
+	scalePlane(dst[ySize:ySize+cSize], src[ySize:ySize+srcCSize], srcCWidth, srcCHeight, cWidth, cHeight)
+	scalePlane(dst[ySize+cSize:ySize+2*cSize], src[ySize+srcCSize:ySize+2*srcCSize], srcCWidth, srcCHeight, cWidth, cHeight)
+}
@@ -0,0 +1,61 @@
+package gopipe
+
+import (
+	"bytes"
+	"image"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChromaConverter(t *testing.T) {
+	var frames [][]byte
+	var attrs []Attributes
+	sink := WriterFunc(func(b []byte, a Attributes) error {
+		frames = append(frames, b)
+		attrs = append(attrs, a)
+		return nil
+	})
+	converter := NewChromaConverter(image.YCbCrSubsampleRatio420)
+	w, err := converter.Link(sink, Info{Width: 4, Height: 2})
+	require.NoError(t, err)
+
+	luma := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+	frame444 := append(append([]byte{}, luma...),
+		10, 20, 30, 40, 10, 20, 30, 40, // Cb
+		50, 50, 50, 50, 60, 60, 60, 60, // Cr
+	)
+	require.NoError(t, w.Write(frame444, Attributes{ChromaSubsampling: image.YCbCrSubsampleRatio444}))
+	assert.Equal(t, append(append([]byte{}, luma...), 15, 35, 55, 55), frames[0])
+	assert.Equal(t, image.YCbCrSubsampleRatio420, attrs[0][ChromaSubsampling])
+
+	frame420 := append(append([]byte{}, luma...), 15, 35, 55, 55)
+	require.NoError(t, w.Write(frame420, Attributes{ChromaSubsampling: image.YCbCrSubsampleRatio420}))
+	assert.Equal(t, frame420, frames[1])
+
+	assert.Error(t, w.Write(luma, Attributes{ChromaSubsampling: image.YCbCrSubsampleRatio444}))
+}
+
+func TestConvertChromaUpsample(t *testing.T) {
+	luma := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+	src := append(append([]byte{}, luma...), 15, 35, 55, 75)
+	dst := make([]byte, 16)
+	convertChroma(dst, src, 4, 2, image.YCbCrSubsampleRatio420, image.YCbCrSubsampleRatio422)
+	assert.Equal(t, append(append([]byte{}, luma...), 15, 35, 15, 35, 55, 75, 55, 75), dst)
+}
+
+func TestY4MSourceChromaSubsampling(t *testing.T) {
+	src, err := NewY4MSource(bytes.NewBufferString("YUV4MPEG2 W4 H2 F30:1 C422\nFRAME\n" + string(make([]byte, 16))))
+	require.NoError(t, err)
+	assert.Equal(t, image.YCbCrSubsampleRatio422, src.ChromaSubsampling())
+	frame, attrs, err := src.getFrame()
+	require.NoError(t, err)
+	assert.Len(t, frame, 16)
+	assert.Equal(t, image.YCbCrSubsampleRatio422, attrs[ChromaSubsampling])
+
+	for _, cst := range []string{"411", "mono", "444alpha"} {
+		_, err := NewY4MSource(bytes.NewBufferString("YUV4MPEG2 W4 H2 F30:1 C" + cst + "\n"))
+		assert.Error(t, err, cst)
+	}
+}
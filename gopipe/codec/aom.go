@@ -0,0 +1,264 @@
+package codec
+
+/*
+#cgo pkg-config: aom
+#include <stdlib.h>
+#include "aom/aom_encoder.h"
+#include "aom/aomcx.h"
+#include "aom/aom_image.h"
+
+aom_codec_err_t aom_codec_enc_init_macro(
+	aom_codec_ctx_t *ctx,
+	aom_codec_iface_t *iface,
+	const aom_codec_enc_cfg_t *cfg,
+	aom_codec_flags_t flags
+) {
+	return aom_codec_enc_init(ctx, iface, cfg, flags);
+}
+
+aom_codec_err_t aom_set_cpu_used(aom_codec_ctx_t *ctx, int value) {
+	return aom_codec_control(ctx, AOME_SET_CPUUSED, value);
+}
+
+// Sets up img to describe a frame of fmt and size w x h without allocating
+// pixel data. The planes are set for each frame.
+aom_image_t *aom_img_describe(aom_image_t *img, aom_img_fmt_t fmt, unsigned int w, unsigned int h) {
+	static unsigned char placeholder;
+	return aom_img_wrap(img, fmt, w, h, 1, &placeholder);
+}
+
+void *aomPktBuf(const aom_codec_cx_pkt_t *pkt) {
+  return pkt->data.frame.buf;
+}
+
+int aomPktSz(const aom_codec_cx_pkt_t *pkt) {
+  return pkt->data.frame.sz;
+}
+
+aom_codec_frame_flags_t aomPktFrameFlags(const aom_codec_cx_pkt_t *pkt) {
+  return pkt->data.frame.flags;
+}
+
+*/
+import "C"
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"image"
+	"sync/atomic"
+	"time"
+	"unsafe"
+
+	"github.com/mengelbart/mrtp"
+)
+
+func init() {
+	RegisterEncoder(mrtp.AV1, func(c Config) (VideoEncoder, error) {
+		return NewAOMEncoder(c)
+	})
+}
+
+// AOMEncoder encodes AV1 using libaom. Encoded frames are temporal units in
+// the low overhead bitstream format.
+type AOMEncoder struct {
+	ctx *C.aom_codec_ctx_t
+	cfg *C.aom_codec_enc_cfg_t
+
+	raw   *C.aom_image_t // describes the input frame
+	out   Frame
+	frame []byte
+
+	targetBitrate atomic.Uint64
+	forceKeyFrame atomic.Bool
+
+	closed bool
+}
+
+func NewAOMEncoder(c Config) (*AOMEncoder, error) {
+	if c.Codec != mrtp.AV1 {
+		return nil, fmt.Errorf("unknown codec: %v", c.Codec)
+	}
+	if c.ScalabilityMode.IsLayered() {
+		return nil, fmt.Errorf("scalability mode %v not supported by libaom encoder", c.ScalabilityMode)
+	}
+	if c.PixelFormat != PixelFormatI420 {
+		return nil, fmt.Errorf("pixel format %v not supported by libaom encoder", c.PixelFormat)
+	}
+	minQ, maxQ, err := c.quantizerRange(10, 63)
+	if err != nil {
+		return nil, err
+	}
+	speed, err := c.speed(8)
+	if err != nil {
+		return nil, err
+	}
+	encoder := C.aom_codec_av1_cx()
+
+	var cfg C.aom_codec_enc_cfg_t
+	if res := C.aom_codec_enc_config_default(encoder, &cfg, C.AOM_USAGE_REALTIME); res != 0 {
+		return nil, fmt.Errorf("failed to get encoder default config: %v", res)
+	}
+
+	cfg.g_w = C.uint(c.Width)
+	cfg.g_h = C.uint(c.Height)
+	cfg.g_timebase.num = C.int(c.TimebaseNum)
+	cfg.g_timebase.den = C.int(c.TimebaseDen)
+	cfg.rc_end_usage = C.AOM_CBR
+	cfg.rc_target_bitrate = C.uint(c.TargetRate) / 1000
+	cfg.g_pass = C.AOM_RC_ONE_PASS
+	cfg.g_threads = C.uint(cmp.Or(c.Threads, 4))
+	cfg.rc_resize_mode = 0
+	cfg.g_lag_in_frames = 0 // Required for real-time encoding (no frame buffering)
+
+	cfg.g_error_resilient = C.AOM_ERROR_RESILIENT_DEFAULT
+	if c.DisableErrorResilience {
+		cfg.g_error_resilient = 0
+	}
+
+	if c.KeyFrameInterval > 0 {
+		cfg.kf_mode = C.AOM_KF_AUTO
+		cfg.kf_max_dist = C.uint(c.KeyFrameInterval)
+	}
+	if c.VBVBufferSize > 0 {
+		bufMs := c.VBVBufferSize.Milliseconds()
+		cfg.rc_buf_sz = C.uint(bufMs)
+		cfg.rc_buf_initial_sz = C.uint(bufMs * 4 / 6)
+		cfg.rc_buf_optimal_sz = C.uint(bufMs * 5 / 6)
+	}
+
+	cfg.rc_min_quantizer = C.uint(minQ)
+	cfg.rc_max_quantizer = C.uint(maxQ)
+	cfg.rc_undershoot_pct = C.uint(10)
+	cfg.rc_overshoot_pct = C.uint(10)
+
+	ctx := (*C.aom_codec_ctx_t)(C.malloc(C.size_t(unsafe.Sizeof(C.aom_codec_ctx_t{}))))
+	if ctx == nil {
+		return nil, fmt.Errorf("failed to allocate codec context")
+	}
+	if res := C.aom_codec_enc_init_macro(ctx, encoder, &cfg, 0); res != C.AOM_CODEC_OK {
+		C.free(unsafe.Pointer(ctx))
+		return nil, fmt.Errorf("failed to init encoder: code %v", res)
+	}
+	raw := (*C.aom_image_t)(C.malloc(C.size_t(unsafe.Sizeof(C.aom_image_t{}))))
+	if raw == nil {
+		C.aom_codec_destroy(ctx)
+		C.free(unsafe.Pointer(ctx))
+		return nil, fmt.Errorf("failed to allocate image")
+	}
+
+	// AOME_SET_CPUUSED: Speed vs quality tradeoff, realtime mode requires
+	// high values.
+	if res := C.aom_set_cpu_used(ctx, C.int(speed)); res != C.AOM_CODEC_OK {
+		C.aom_codec_destroy(ctx)
+		C.free(unsafe.Pointer(ctx))
+		C.free(unsafe.Pointer(raw))
+		return nil, fmt.Errorf("failed to set AOME_SET_CPUUSED: %v", res)
+	}
+
+	e := &AOMEncoder{
+		ctx:   ctx,
+		cfg:   &cfg,
+		raw:   raw,
+		frame: make([]byte, 0),
+	}
+	e.targetBitrate.Store(c.TargetRate)
+	return e, nil
+}
+
+func (e *AOMEncoder) Encode(
+	image *image.YCbCr,
+	pts int64,
+	duration time.Duration,
+) (*Frame, error) {
+	if e.closed {
+		return nil, fmt.Errorf("encoder is closed")
+	}
+	if image.SubsampleRatio != PixelFormatI420.SubsampleRatio() {
+		return nil, fmt.Errorf("chroma subsampling %v not supported by libaom encoder", image.SubsampleRatio)
+	}
+
+	raw := C.aom_img_describe(
+		e.raw,
+		C.AOM_IMG_FMT_I420,
+		C.uint(image.Bounds().Dx()),
+		C.uint(image.Bounds().Dy()),
+	)
+	if raw == nil {
+		return nil, fmt.Errorf("invalid image format")
+	}
+
+	raw.planes[0] = (*C.uchar)(unsafe.Pointer(&image.Y[0]))
+	raw.planes[1] = (*C.uchar)(unsafe.Pointer(&image.Cb[0]))
+	raw.planes[2] = (*C.uchar)(unsafe.Pointer(&image.Cr[0]))
+	raw.stride[0] = C.int(image.YStride)
+	raw.stride[1] = C.int(image.CStride)
+	raw.stride[2] = C.int(image.CStride)
+
+	targetAOMBitrate := C.uint(e.targetBitrate.Load() / 1000) // convert to kbps
+	if e.cfg.rc_target_bitrate != targetAOMBitrate && targetAOMBitrate >= 1 {
+		e.cfg.rc_target_bitrate = targetAOMBitrate
+		if rc := C.aom_codec_enc_config_set(e.ctx, e.cfg); rc != C.AOM_CODEC_OK {
+			return nil, fmt.Errorf("aom_codec_enc_config_set failed (%d)", rc)
+		}
+	}
+
+	var flags C.aom_enc_frame_flags_t
+	if e.forceKeyFrame.Swap(false) {
+		flags |= C.AOM_EFLAG_FORCE_KF
+	}
+
+	res := C.aom_codec_encode(
+		e.ctx,
+		raw,
+		C.aom_codec_pts_t(pts),
+		C.ulong(duration.Microseconds()),
+		flags,
+	)
+	if res != C.AOM_CODEC_OK {
+		return nil, fmt.Errorf("failed to encode frame: %v", res)
+	}
+
+	var iter C.aom_codec_iter_t
+	frame := &e.out
+	*frame = Frame{}
+	e.frame = e.frame[:0]
+	for {
+		pkt := C.aom_codec_get_cx_data(e.ctx, &iter)
+		if pkt == nil {
+			break
+		}
+		if pkt.kind == C.AOM_CODEC_CX_FRAME_PKT {
+			frame.IsKeyFrame = C.aomPktFrameFlags(pkt)&C.AOM_FRAME_IS_KEY == C.AOM_FRAME_IS_KEY
+			// valid until the next call to aom_codec_get_cx_data
+			encoded := unsafe.Slice((*byte)(C.aomPktBuf(pkt)), C.aomPktSz(pkt))
+			e.frame = append(e.frame, encoded...)
+		}
+	}
+	frame.Payload = e.frame
+	return frame, nil
+}
+
+func (e *AOMEncoder) SetTargetRate(targetRate uint64) {
+	e.targetBitrate.Store(targetRate)
+}
+
+func (e *AOMEncoder) ForceKeyFrame() {
+	e.forceKeyFrame.Store(true)
+}
+
+func (e *AOMEncoder) Close() error {
+	if e.closed {
+		return nil
+	}
+
+	e.closed = true
+
+	defer C.free(unsafe.Pointer(e.ctx))
+	defer C.free(unsafe.Pointer(e.raw))
+
+	if C.aom_codec_destroy(e.ctx) != 0 {
+		return errors.New("aom_codec_destroy failed")
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+package codec
+
+import (
+	"fmt"
+	"unsafe"
+
+	"github.com/mengelbart/mrtp"
+)
+
+/*
+#cgo pkg-config: aom
+#include <stdlib.h>
+#include <aom/aom_decoder.h>
+#include <aom/aomdx.h>
+#include <aom/aom_image.h>
+
+// Allocates and initializes a new AV1 decoder context
+aom_codec_ctx_t* newAOMDecoderCtx(aom_codec_err_t *err) {
+    aom_codec_ctx_t *ctx = (aom_codec_ctx_t*)malloc(sizeof(aom_codec_ctx_t));
+    *err = aom_codec_dec_init(ctx, aom_codec_av1_dx(), NULL, 0);
+    if (*err != AOM_CODEC_OK) {
+        free(ctx);
+        return NULL;
+    }
+    return ctx;
+}
+
+// Decodes an encoded temporal unit
+aom_codec_err_t aomDecodeFrame(aom_codec_ctx_t* ctx, const uint8_t* data, size_t data_sz) {
+    return aom_codec_decode(ctx, data, data_sz, NULL);
+}
+
+// Frees a decoder context
+void freeAOMDecoderCtx(aom_codec_ctx_t* ctx) {
+    aom_codec_destroy(ctx);
+    free(ctx);
+}
+
+*/
+import "C"
+
+// obuTemporalDelimiter is a temporal delimiter OBU with obu_has_size_field
+// set. RTP payloaders drop temporal delimiters, but libaom expects each
+// temporal unit to start with one.
+var obuTemporalDelimiter = []byte{0x12, 0x00}
+
+// AOMDecoder decodes AV1 temporal units in the low overhead bitstream format
+// using libaom.
+type AOMDecoder struct {
+	codecCtx *C.aom_codec_ctx_t
+	closed   bool
+
+	buf []byte
+	out DecodedFrame
+}
+
+func init() {
+	RegisterDecoder(mrtp.AV1, func(mrtp.Codec) (VideoDecoder, error) {
+		return NewAOMDecoder()
+	})
+}
+
+func NewAOMDecoder() (*AOMDecoder, error) {
+	var rc C.aom_codec_err_t
+	codecCtx := C.newAOMDecoderCtx(&rc)
+	if codecCtx == nil {
+		return nil, fmt.Errorf("aom_codec_dec_init failed: %v", rc)
+	}
+	return &AOMDecoder{
+		codecCtx: codecCtx,
+	}, nil
+}
+
+func (d *AOMDecoder) Decode(encFrame []byte) (*DecodedFrame, error) {
+	if d.closed {
+		return nil, fmt.Errorf("decoder is closed")
+	}
+	if len(encFrame) == 0 {
+		return nil, fmt.Errorf("decode failed: empty frame")
+	}
+
+	// obu_type is stored in bits 1-4 of the OBU header, 2 is
+	// OBU_TEMPORAL_DELIMITER.
+	if (encFrame[0]>>3)&0x0f != 2 {
+		d.buf = append(append(d.buf[:0], obuTemporalDelimiter...), encFrame...)
+		encFrame = d.buf
+	}
+
+	status := C.aomDecodeFrame(d.codecCtx, (*C.uint8_t)(&encFrame[0]), C.size_t(len(encFrame)))
+	if status != C.AOM_CODEC_OK {
+		return nil, fmt.Errorf("decode failed: %v", status)
+	}
+
+	var iter C.aom_codec_iter_t
+	input := C.aom_codec_get_frame(d.codecCtx, &iter)
+	if input == nil {
+		return nil, fmt.Errorf("decode failed: no image in decoder")
+	}
+
+	w := int(input.d_w)
+	h := int(input.d_h)
+	csr, err := subsampleRatio(int(input.x_chroma_shift), int(input.y_chroma_shift))
+	if err != nil {
+		return nil, fmt.Errorf("decode failed: %w", err)
+	}
+	cw, ch := ChromaSize(w, h, csr)
+
+	ySize := w * h
+	uSize := cw * ch
+	d.out.Data = resize(d.out.Data, ySize+uSize*2)
+	frameData := d.out.Data
+
+	copyAOMPlane(frameData[:ySize], input, 0, w, h)
+	copyAOMPlane(frameData[ySize:ySize+uSize], input, 1, cw, ch)
+	copyAOMPlane(frameData[ySize+uSize:], input, 2, cw, ch)
+
+	d.out.Width = w
+	d.out.Height = h
+	d.out.ChromaSubsampling = csr
+	return &d.out, nil
+}
+
+// copyAOMPlane copies plane of img to dst. Images with high bit depth sample
+// storage are converted to 8 bit.
+func copyAOMPlane(dst []byte, img *C.aom_image_t, plane, w, h int) {
+	stride := int(img.stride[plane])
+	src := unsafe.Slice((*byte)(unsafe.Pointer(img.planes[plane])), stride*h)
+	if img.fmt&C.AOM_IMG_FMT_HIGHBITDEPTH == 0 {
+		for r := range h {
+			copy(dst[r*w:r*w+w], src[r*stride:r*stride+w])
+		}
+		return
+	}
+	shift := uint(img.bit_depth) - 8
+	for r := range h {
+		row := src[r*stride:]
+		for c := range w {
+			sample := uint16(row[2*c]) | uint16(row[2*c+1])<<8
+			dst[r*w+c] = byte(sample >> shift)
+		}
+	}
+}
+
+func (d *AOMDecoder) Close() {
+	C.freeAOMDecoderCtx(d.codecCtx)
+	d.closed = true
+}
@@ -0,0 +1,147 @@
+package codec
+
+import (
+	"fmt"
+	"image"
+	"slices"
+	"strings"
+
+	"github.com/mengelbart/mrtp"
+)
+
+// PixelFormat is the planar YCbCr layout of the raw frames of an encoder. The
+// zero value is I420.
+type PixelFormat int
+
+const (
+	PixelFormatI420 PixelFormat = iota
+	PixelFormatI422
+	PixelFormatI444
+)
+
+func (f PixelFormat) String() string {
+	switch f {
+	case PixelFormatI420:
+		return "I420"
+	case PixelFormatI422:
+		return "I422"
+	case PixelFormatI444:
+		return "I444"
+	}
+	return fmt.Sprintf("PixelFormat(%d)", int(f))
+}
+
+// SubsampleRatio returns the chroma subsampling of f.
+func (f PixelFormat) SubsampleRatio() image.YCbCrSubsampleRatio {
+	switch f {
+	case PixelFormatI422:
+		return image.YCbCrSubsampleRatio422
+	case PixelFormatI444:
+		return image.YCbCrSubsampleRatio444
+	}
+	return image.YCbCrSubsampleRatio420
+}
+
+// PixelFormatOf returns the pixel format with chroma subsampling csr.
+// Subsamplings that no encoder supports, e.g. 4:1:1, return an error.
+func PixelFormatOf(csr image.YCbCrSubsampleRatio) (PixelFormat, error) {
+	switch csr {
+	case image.YCbCrSubsampleRatio420:
+		return PixelFormatI420, nil
+	case image.YCbCrSubsampleRatio422:
+		return PixelFormatI422, nil
+	case image.YCbCrSubsampleRatio444:
+		return PixelFormatI444, nil
+	}
+	return 0, fmt.Errorf("no pixel format for chroma subsampling %v", csr)
+}
+
+// ParsePixelFormat parses the name of a pixel format, e.g. "I444".
+func ParsePixelFormat(s string) (PixelFormat, error) {
+	for _, f := range []PixelFormat{PixelFormatI420, PixelFormatI422, PixelFormatI444} {
+		if strings.EqualFold(s, f.String()) {
+			return f, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid pixel format: %q", s)
+}
+
+// PixelFormats returns the pixel formats that the encoder of codec accepts.
+// VP9 uses profile 1 and H.264 the High 4:2:2 and High 4:4:4 Predictive
+// profiles for I422 and I444.
+func PixelFormats(codec mrtp.Codec) []PixelFormat {
+	switch codec {
+	case mrtp.VP9, mrtp.H264:
+		return []PixelFormat{PixelFormatI420, PixelFormatI422, PixelFormatI444}
+	}
+	return []PixelFormat{PixelFormatI420}
+}
+
+// SupportsPixelFormat reports whether the encoder of codec accepts frames in
+// pixel format f.
+func SupportsPixelFormat(codec mrtp.Codec, f PixelFormat) bool {
+	return slices.Contains(PixelFormats(codec), f)
+}
+
+// ChromaSize returns the width and height of the chroma planes of a frame of
+// width x height with chroma subsampling csr.
+func ChromaSize(width, height int, csr image.YCbCrSubsampleRatio) (int, int) {
+	switch csr {
+	case image.YCbCrSubsampleRatio422:
+		return (width + 1) / 2, height
+	case image.YCbCrSubsampleRatio420:
+		return (width + 1) / 2, (height + 1) / 2
+	case image.YCbCrSubsampleRatio440:
+		return width, (height + 1) / 2
+	case image.YCbCrSubsampleRatio411:
+		return (width + 3) / 4, height
+	case image.YCbCrSubsampleRatio410:
+		return (width + 3) / 4, (height + 1) / 2
+	}
+	return width, height
+}
+
+// FrameSize returns the size in bytes of a planar frame of width x height
+// with chroma subsampling csr.
+func FrameSize(width, height int, csr image.YCbCrSubsampleRatio) int {
+	cw, ch := ChromaSize(width, height, csr)
+	return width*height + 2*cw*ch
+}
+
+// subsampleRatio returns the chroma subsampling with horizontal and vertical
+// chroma shifts xShift and yShift, as reported by libvpx, libaom and
+// libavutil.
+func subsampleRatio(xShift, yShift int) (image.YCbCrSubsampleRatio, error) {
+	switch {
+	case xShift == 0 && yShift == 0:
+		return image.YCbCrSubsampleRatio444, nil
+	case xShift == 1 && yShift == 0:
+		return image.YCbCrSubsampleRatio422, nil
+	case xShift == 1 && yShift == 1:
+		return image.YCbCrSubsampleRatio420, nil
+	case xShift == 0 && yShift == 1:
+		return image.YCbCrSubsampleRatio440, nil
+	case xShift == 2 && yShift == 0:
+		return image.YCbCrSubsampleRatio411, nil
+	case xShift == 2 && yShift == 1:
+		return image.YCbCrSubsampleRatio410, nil
+	}
+	return 0, fmt.Errorf("unsupported chroma shift: %v, %v", xShift, yShift)
+}
+
+// copyPlane copies a plane of width x height samples with row stride stride
+// from src to dst, which has no padding between rows.
+func copyPlane(dst, src []byte, stride, width, height int) {
+	for r := range height {
+		copy(dst[r*width:r*width+width], src[r*stride:r*stride+width])
+	}
+}
+
+// resize returns b resliced to length n. It only allocates if b has less
+// capacity.
+func resize(b []byte, n int) []byte {
+	if cap(b) < n {
+		return make([]byte, n)
+	}
+	return b[:n]
+}
@@ -0,0 +1,70 @@
+package codec
+
+import (
+	"image"
+	"testing"
+
+	"github.com/mengelbart/mrtp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChromaSize(t *testing.T) {
+	cases := []struct {
+		csr           image.YCbCrSubsampleRatio
+		width, height int
+		frameSize     int
+	}{
+		{csr: image.YCbCrSubsampleRatio444, width: 5, height: 3, frameSize: 45},
+		{csr: image.YCbCrSubsampleRatio422, width: 3, height: 3, frameSize: 21},
+		{csr: image.YCbCrSubsampleRatio420, width: 3, height: 3, frameSize: 17},
+		{csr: image.YCbCrSubsampleRatio440, width: 5, height: 1, frameSize: 15},
+		{csr: image.YCbCrSubsampleRatio411, width: 3, height: 3, frameSize: 15},
+		{csr: image.YCbCrSubsampleRatio410, width: 3, height: 3, frameSize: 13},
+	}
+	for _, tc := range cases {
+		t.Run(tc.csr.String(), func(t *testing.T) {
+			// image.NewYCbCr uses the same plane sizes
+			img := image.NewYCbCr(image.Rect(0, 0, 4, 4), tc.csr)
+			cw, ch := ChromaSize(4, 4, tc.csr)
+			assert.Equal(t, len(img.Cb), cw*ch)
+			assert.Equal(t, img.CStride, cw)
+
+			assert.Equal(t, tc.frameSize, FrameSize(tc.width, tc.height, tc.csr))
+		})
+	}
+}
+
+func TestPixelFormat(t *testing.T) {
+	for _, f := range []PixelFormat{PixelFormatI420, PixelFormatI422, PixelFormatI444} {
+		parsed, err := ParsePixelFormat(f.String())
+		require.NoError(t, err)
+		assert.Equal(t, f, parsed)
+
+		fromRatio, err := PixelFormatOf(f.SubsampleRatio())
+		require.NoError(t, err)
+		assert.Equal(t, f, fromRatio)
+	}
+	_, err := ParsePixelFormat("NV12")
+	assert.Error(t, err)
+	_, err = PixelFormatOf(image.YCbCrSubsampleRatio411)
+	assert.Error(t, err)
+
+	assert.True(t, SupportsPixelFormat(mrtp.VP9, PixelFormatI444))
+	assert.True(t, SupportsPixelFormat(mrtp.H264, PixelFormatI422))
+	assert.False(t, SupportsPixelFormat(mrtp.VP8, PixelFormatI444))
+	assert.False(t, SupportsPixelFormat(mrtp.AV1, PixelFormatI422))
+}
+
+func TestSubsampleRatio(t *testing.T) {
+	csr, err := subsampleRatio(1, 1)
+	require.NoError(t, err)
+	assert.Equal(t, image.YCbCrSubsampleRatio420, csr)
+
+	csr, err = subsampleRatio(0, 0)
+	require.NoError(t, err)
+	assert.Equal(t, image.YCbCrSubsampleRatio444, csr)
+
+	_, err = subsampleRatio(1, 2)
+	assert.Error(t, err)
+}
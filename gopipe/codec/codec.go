@@ -0,0 +1,233 @@
+package codec
+
+import (
+	"cmp"
+	"fmt"
+	"image"
+	"strconv"
+	"time"
+
+	"github.com/mengelbart/mrtp"
+)
+
+// Config configures a video encoder. Zero values of the tuning fields select
+// the defaults of the encoder implementation.
+type Config struct {
+	Codec       mrtp.Codec
+	Width       uint
+	Height      uint
+	TimebaseNum int
+	TimebaseDen int
+
+	// PixelFormat is the layout of the raw frames. Encoders fail to
+	// initialize with formats they do not support, see [PixelFormats].
+	PixelFormat PixelFormat
+
+	// TargetRate is the initial target rate in bits per second.
+	TargetRate uint64
+
+	// Preset trades encoding speed for quality. x264 takes a preset name,
+	// e.g. "ultrafast" (default). libvpx and libaom take the cpu-used value,
+	// e.g. "5" (VP9 default) or "8" (AV1 default).
+	Preset string
+
+	// Threads is the number of encoder threads. Default: 4 for libvpx and
+	// libaom, automatic for x264.
+	Threads int
+
+	// KeyFrameInterval is the maximum number of frames between keyframes.
+	// x264 uses periodic intra refresh with this period instead of
+	// keyframes. Default: 60 for x264, the library default otherwise.
+	KeyFrameInterval int
+
+	// MinQuantizer and MaxQuantizer bound the quantizer. The range is 0-63
+	// for libvpx and libaom, 0-51 for x264. Default: 10-63 for libvpx and
+	// libaom, the library default for x264.
+	MinQuantizer int
+	MaxQuantizer int
+
+	// VBVBufferSize is the size of the rate control buffer in time at the
+	// target rate. Default: 1s for x264, the library default otherwise.
+	VBVBufferSize time.Duration
+
+	// DisableErrorResilience turns off the error resilient mode of libvpx
+	// and libaom, which is on by default. It has no effect on x264.
+	DisableErrorResilience bool
+
+	// ScalabilityMode selects the spatial and temporal layers of the encoded
+	// stream. Only libvpx supports layering: temporal layers for VP8, spatial
+	// and temporal layers for VP9. H.264 and AV1 streams are single layer, so
+	// they carry no layer IDs in RTP. x264 and libaom fail to initialize with
+	// a layered mode.
+	ScalabilityMode ScalabilityMode
+}
+
+// speed parses Preset as the cpu-used value of libvpx and libaom.
+func (c Config) speed(defaultSpeed int) (int, error) {
+	if len(c.Preset) == 0 {
+		return defaultSpeed, nil
+	}
+	speed, err := strconv.Atoi(c.Preset)
+	if err != nil {
+		return 0, fmt.Errorf("invalid preset %q: must be a cpu-used value", c.Preset)
+	}
+	return speed, nil
+}
+
+// quantizerRange returns the quantizer bounds of c, where zero values are
+// replaced by the defaults.
+func (c Config) quantizerRange(defaultMin, defaultMax int) (int, int, error) {
+	minQ := cmp.Or(c.MinQuantizer, defaultMin)
+	maxQ := cmp.Or(c.MaxQuantizer, defaultMax)
+	if minQ < 0 || minQ > maxQ {
+		return 0, 0, fmt.Errorf("invalid quantizer range: %v-%v", minQ, maxQ)
+	}
+	return minQ, maxQ, nil
+}
+
+// AudioConfig configures an audio encoder. Samples are interleaved signed
+// 16 bit PCM.
+type AudioConfig struct {
+	Codec      mrtp.Codec
+	SampleRate int
+	Channels   int
+	TargetRate uint64
+}
+
+// Frame is an encoded frame. Encoders reuse the frame and its payload, so
+// both are only valid until the next call to Encode.
+type Frame struct {
+	IsKeyFrame bool
+	Payload    []byte
+
+	// TemporalLayerID is the temporal layer of the frame.
+	TemporalLayerID int
+
+	// SpatialLayerSizes holds the size of each spatial layer frame in
+	// Payload, ordered from the lowest to the highest layer. It is nil for
+	// streams with a single spatial layer.
+	SpatialLayerSizes []int
+}
+
+// DecodedFrame is a decoded frame in planar YCbCr format. Decoders reuse the
+// frame and its data, so both are only valid until the next call to Decode.
+type DecodedFrame struct {
+	Data              []byte
+	Width             int
+	Height            int
+	ChromaSubsampling image.YCbCrSubsampleRatio
+}
+
+// VideoEncoder encodes raw frames. Implementations register a constructor
+// for their codecs with [RegisterEncoder]. Encode does not keep image after
+// it returns.
+type VideoEncoder interface {
+	Encode(image *image.YCbCr, pts int64, duration time.Duration) (*Frame, error)
+	SetTargetRate(targetRate uint64)
+	// ForceKeyFrame makes the encoder emit a keyframe for the next frame.
+	ForceKeyFrame()
+	Close() error
+}
+
+// VideoDecoder decodes encoded frames. Implementations register a
+// constructor for their codecs with [RegisterDecoder].
+type VideoDecoder interface {
+	Decode(encFrame []byte) (*DecodedFrame, error)
+	Close()
+}
+
+// AudioEncoder encodes frames of interleaved PCM samples. Implementations
+// register a constructor for their codecs with [RegisterAudioEncoder].
+type AudioEncoder interface {
+	Encode(pcm []int16) ([]byte, error)
+	SetTargetRate(targetRate uint64)
+	Close() error
+}
+
+// AudioDecoder decodes encoded audio frames to interleaved PCM samples.
+// Implementations register a constructor for their codecs with
+// [RegisterAudioDecoder].
+type AudioDecoder interface {
+	Decode(encFrame []byte) ([]int16, error)
+	Close()
+}
+
+// EncoderFactory creates an encoder for c.Codec.
+type EncoderFactory func(c Config) (VideoEncoder, error)
+
+// DecoderFactory creates a decoder for codec.
+type DecoderFactory func(codec mrtp.Codec) (VideoDecoder, error)
+
+// AudioEncoderFactory creates an audio encoder for c.Codec.
+type AudioEncoderFactory func(c AudioConfig) (AudioEncoder, error)
+
+// AudioDecoderFactory creates an audio decoder for codec with the given
+// output sample rate and channel count.
+type AudioDecoderFactory func(codec mrtp.Codec, sampleRate, channels int) (AudioDecoder, error)
+
+var (
+	encoders      = map[mrtp.Codec]EncoderFactory{}
+	decoders      = map[mrtp.Codec]DecoderFactory{}
+	audioEncoders = map[mrtp.Codec]AudioEncoderFactory{}
+	audioDecoders = map[mrtp.Codec]AudioDecoderFactory{}
+)
+
+// RegisterEncoder sets the encoder constructor of codec. It is meant to be
+// called from init functions.
+func RegisterEncoder(codec mrtp.Codec, f EncoderFactory) {
+	encoders[codec] = f
+}
+
+// RegisterDecoder sets the decoder constructor of codec. It is meant to be
+// called from init functions.
+func RegisterDecoder(codec mrtp.Codec, f DecoderFactory) {
+	decoders[codec] = f
+}
+
+// NewEncoder creates an encoder for c.Codec.
+func NewEncoder(c Config) (VideoEncoder, error) {
+	f, ok := encoders[c.Codec]
+	if !ok {
+		return nil, fmt.Errorf("no encoder for codec: %v", c.Codec)
+	}
+	return f(c)
+}
+
+// NewDecoder creates a decoder for codec.
+func NewDecoder(codec mrtp.Codec) (VideoDecoder, error) {
+	f, ok := decoders[codec]
+	if !ok {
+		return nil, fmt.Errorf("no decoder for codec: %v", codec)
+	}
+	return f(codec)
+}
+
+// RegisterAudioEncoder sets the audio encoder constructor of codec. It is
+// meant to be called from init functions.
+func RegisterAudioEncoder(codec mrtp.Codec, f AudioEncoderFactory) {
+	audioEncoders[codec] = f
+}
+
+// RegisterAudioDecoder sets the audio decoder constructor of codec. It is
+// meant to be called from init functions.
+func RegisterAudioDecoder(codec mrtp.Codec, f AudioDecoderFactory) {
+	audioDecoders[codec] = f
+}
+
+// NewAudioEncoder creates an audio encoder for c.Codec.
+func NewAudioEncoder(c AudioConfig) (AudioEncoder, error) {
+	f, ok := audioEncoders[c.Codec]
+	if !ok {
+		return nil, fmt.Errorf("no audio encoder for codec: %v", c.Codec)
+	}
+	return f(c)
+}
+
+// NewAudioDecoder creates an audio decoder for codec.
+func NewAudioDecoder(codec mrtp.Codec, sampleRate, channels int) (AudioDecoder, error) {
+	f, ok := audioDecoders[codec]
+	if !ok {
+		return nil, fmt.Errorf("no audio decoder for codec: %v", codec)
+	}
+	return f(codec, sampleRate, channels)
+}
@@ -0,0 +1,35 @@
+package codec
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfigSpeed(t *testing.T) {
+	speed, err := Config{}.speed(8)
+	assert.NoError(t, err)
+	assert.Equal(t, 8, speed)
+
+	speed, err = Config{Preset: "5"}.speed(8)
+	assert.NoError(t, err)
+	assert.Equal(t, 5, speed)
+
+	_, err = Config{Preset: "ultrafast"}.speed(8)
+	assert.Error(t, err)
+}
+
+func TestConfigQuantizerRange(t *testing.T) {
+	minQ, maxQ, err := Config{}.quantizerRange(10, 63)
+	assert.NoError(t, err)
+	assert.Equal(t, 10, minQ)
+	assert.Equal(t, 63, maxQ)
+
+	minQ, maxQ, err = Config{MaxQuantizer: 50}.quantizerRange(10, 63)
+	assert.NoError(t, err)
+	assert.Equal(t, 10, minQ)
+	assert.Equal(t, 50, maxQ)
+
+	_, _, err = Config{MinQuantizer: 40, MaxQuantizer: 20}.quantizerRange(10, 63)
+	assert.Error(t, err)
+}
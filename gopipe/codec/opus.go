@@ -0,0 +1,159 @@
+package codec
+
+/*
+#cgo pkg-config: opus
+#include <stdlib.h>
+#include <opus/opus.h>
+
+int opusSetBitrate(OpusEncoder *enc, opus_int32 bitrate) {
+	return opus_encoder_ctl(enc, OPUS_SET_BITRATE(bitrate));
+}
+
+*/
+import "C"
+import (
+	"fmt"
+	"sync/atomic"
+	"unsafe"
+
+	"github.com/mengelbart/mrtp"
+)
+
+// opusMaxPacketSize is the recommended maximum size of an encoded Opus packet.
+const opusMaxPacketSize = 4000
+
+// opusMaxFrameSize is the number of samples per channel of the longest Opus
+// frame (120ms at 48kHz).
+const opusMaxFrameSize = 5760
+
+func init() {
+	RegisterAudioEncoder(mrtp.OPUS, func(c AudioConfig) (AudioEncoder, error) {
+		return NewOpusEncoder(c)
+	})
+	RegisterAudioDecoder(mrtp.OPUS, func(_ mrtp.Codec, sampleRate, channels int) (AudioDecoder, error) {
+		return NewOpusDecoder(sampleRate, channels)
+	})
+}
+
+// OpusEncoder encodes interleaved 16 bit PCM using libopus. Each call to
+// Encode must pass exactly one frame of 2.5, 5, 10, 20, 40 or 60ms.
+type OpusEncoder struct {
+	enc      *C.OpusEncoder
+	channels int
+
+	bitrate       int
+	targetBitrate atomic.Uint64
+
+	buf    []byte
+	closed bool
+}
+
+func NewOpusEncoder(c AudioConfig) (*OpusEncoder, error) {
+	var rc C.int
+	enc := C.opus_encoder_create(C.opus_int32(c.SampleRate), C.int(c.Channels), C.OPUS_APPLICATION_AUDIO, &rc)
+	if rc != C.OPUS_OK {
+		return nil, fmt.Errorf("opus_encoder_create failed: %v", C.GoString(C.opus_strerror(rc)))
+	}
+	e := &OpusEncoder{
+		enc:      enc,
+		channels: c.Channels,
+		buf:      make([]byte, opusMaxPacketSize),
+	}
+	e.targetBitrate.Store(c.TargetRate)
+	return e, nil
+}
+
+func (e *OpusEncoder) Encode(pcm []int16) ([]byte, error) {
+	if e.closed {
+		return nil, fmt.Errorf("encoder is closed")
+	}
+	if len(pcm) == 0 {
+		return nil, fmt.Errorf("encode failed: empty frame")
+	}
+
+	if target := int(e.targetBitrate.Load()); target != e.bitrate && target > 0 {
+		if rc := C.opusSetBitrate(e.enc, C.opus_int32(target)); rc != C.OPUS_OK {
+			return nil, fmt.Errorf("OPUS_SET_BITRATE failed: %v", C.GoString(C.opus_strerror(rc)))
+		}
+		e.bitrate = target
+	}
+
+	n := C.opus_encode(
+		e.enc,
+		(*C.opus_int16)(unsafe.Pointer(&pcm[0])),
+		C.int(len(pcm)/e.channels),
+		(*C.uchar)(unsafe.Pointer(&e.buf[0])),
+		C.opus_int32(len(e.buf)),
+	)
+	if n < 0 {
+		return nil, fmt.Errorf("failed to encode frame: %v", C.GoString(C.opus_strerror(n)))
+	}
+	payload := make([]byte, int(n))
+	copy(payload, e.buf)
+	return payload, nil
+}
+
+func (e *OpusEncoder) SetTargetRate(targetRate uint64) {
+	e.targetBitrate.Store(targetRate)
+}
+
+func (e *OpusEncoder) Close() error {
+	if e.closed {
+		return nil
+	}
+	e.closed = true
+	C.opus_encoder_destroy(e.enc)
+	return nil
+}
+
+// OpusDecoder decodes Opus packets to interleaved 16 bit PCM using libopus.
+type OpusDecoder struct {
+	dec      *C.OpusDecoder
+	channels int
+	pcm      []int16
+	closed   bool
+}
+
+func NewOpusDecoder(sampleRate, channels int) (*OpusDecoder, error) {
+	var rc C.int
+	dec := C.opus_decoder_create(C.opus_int32(sampleRate), C.int(channels), &rc)
+	if rc != C.OPUS_OK {
+		return nil, fmt.Errorf("opus_decoder_create failed: %v", C.GoString(C.opus_strerror(rc)))
+	}
+	return &OpusDecoder{
+		dec:      dec,
+		channels: channels,
+		pcm:      make([]int16, opusMaxFrameSize*channels),
+	}, nil
+}
+
+func (d *OpusDecoder) Decode(encFrame []byte) ([]int16, error) {
+	if d.closed {
+		return nil, fmt.Errorf("decoder is closed")
+	}
+	if len(encFrame) == 0 {
+		return nil, fmt.Errorf("decode failed: empty frame")
+	}
+	n := C.opus_decode(
+		d.dec,
+		(*C.uchar)(unsafe.Pointer(&encFrame[0])),
+		C.opus_int32(len(encFrame)),
+		(*C.opus_int16)(unsafe.Pointer(&d.pcm[0])),
+		C.int(opusMaxFrameSize),
+		0,
+	)
+	if n < 0 {
+		return nil, fmt.Errorf("decode failed: %v", C.GoString(C.opus_strerror(n)))
+	}
+	pcm := make([]int16, int(n)*d.channels)
+	copy(pcm, d.pcm)
+	return pcm, nil
+}
+
+func (d *OpusDecoder) Close() {
+	if d.closed {
+		return
+	}
+	d.closed = true
+	C.opus_decoder_destroy(d.dec)
+}
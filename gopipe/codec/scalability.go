@@ -0,0 +1,120 @@
+package codec
+
+import (
+	"fmt"
+)
+
+const (
+	maxSpatialLayers  = 3
+	maxTemporalLayers = 3
+)
+
+// ScalabilityMode is the number of spatial and temporal layers of an encoded
+// stream. Modes are written as in the W3C WebRTC-SVC specification, e.g. L1T3
+// for one spatial and three temporal layers. The zero value is a single layer
+// stream (L1T1).
+type ScalabilityMode struct {
+	SpatialLayers  int
+	TemporalLayers int
+}
+
+// ParseScalabilityMode parses modes of the form LxTy with up to three spatial
+// and temporal layers.
+func ParseScalabilityMode(s string) (ScalabilityMode, error) {
+	var m ScalabilityMode
+	if _, err := fmt.Sscanf(s, "L%dT%d", &m.SpatialLayers, &m.TemporalLayers); err != nil || m.String() != s {
+		return ScalabilityMode{}, fmt.Errorf("invalid scalability mode: %q", s)
+	}
+	if m.SpatialLayers < 1 || m.SpatialLayers > maxSpatialLayers ||
+		m.TemporalLayers < 1 || m.TemporalLayers > maxTemporalLayers {
+		return ScalabilityMode{}, fmt.Errorf("unsupported scalability mode: %v", s)
+	}
+	return m, nil
+}
+
+func (m ScalabilityMode) String() string {
+	return fmt.Sprintf("L%dT%d", m.spatial(), m.temporal())
+}
+
+// IsLayered reports whether m has more than one spatial or temporal layer.
+func (m ScalabilityMode) IsLayered() bool {
+	return m.spatial() > 1 || m.temporal() > 1
+}
+
+func (m ScalabilityMode) spatial() int {
+	return max(m.SpatialLayers, 1)
+}
+
+func (m ScalabilityMode) temporal() int {
+	return max(m.TemporalLayers, 1)
+}
+
+// temporalPattern returns the temporal layer IDs of one period of frames.
+func (m ScalabilityMode) temporalPattern() []int {
+	switch m.temporal() {
+	case 2:
+		return []int{0, 1}
+	case 3:
+		return []int{0, 2, 1, 2}
+	}
+	return []int{0}
+}
+
+// temporalRateShares returns the cumulative share of the target rate of each
+// temporal layer and the layers below it.
+func (m ScalabilityMode) temporalRateShares() []float64 {
+	switch m.temporal() {
+	case 2:
+		return []float64{0.6, 1}
+	case 3:
+		return []float64{0.4, 0.6, 1}
+	}
+	return []float64{1}
+}
+
+// spatialRateShares returns the share of the target rate of each spatial
+// layer. Each layer gets twice the rate of the layer below it.
+func (m ScalabilityMode) spatialRateShares() []float64 {
+	n := m.spatial()
+	total := float64(int(1)<<n - 1)
+	shares := make([]float64, n)
+	for i := range shares {
+		shares[i] = float64(int(1)<<i) / total
+	}
+	return shares
+}
+
+// splitVP9Superframe returns the frames of a VP9 superframe. Data without a
+// superframe index is returned as a single frame.
+func splitVP9Superframe(data []byte) [][]byte {
+	if len(data) == 0 {
+		return nil
+	}
+	marker := data[len(data)-1]
+	if marker&0xe0 != 0xc0 {
+		return [][]byte{data}
+	}
+	frames := int(marker&0x07) + 1
+	sizeBytes := int(marker>>3&0x03) + 1
+	indexSize := 2 + sizeBytes*frames
+	if len(data) < indexSize || data[len(data)-indexSize] != marker {
+		return [][]byte{data}
+	}
+	index := data[len(data)-indexSize+1:]
+	end := len(data) - indexSize
+
+	result := make([][]byte, 0, frames)
+	offset := 0
+	for i := range frames {
+		size := 0
+		for j := range sizeBytes {
+			size |= int(index[i*sizeBytes+j]) << (8 * j)
+		}
+		if offset+size > end {
+			return [][]byte{data}
+		}
+		result = append(result, data[offset:offset+size])
+		offset += size
+	}
+	return result
+}
@@ -0,0 +1,71 @@
+package codec
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseScalabilityMode(t *testing.T) {
+	cases := []struct {
+		mode     string
+		expected ScalabilityMode
+		err      bool
+	}{
+		{mode: "L1T1", expected: ScalabilityMode{SpatialLayers: 1, TemporalLayers: 1}},
+		{mode: "L1T3", expected: ScalabilityMode{SpatialLayers: 1, TemporalLayers: 3}},
+		{mode: "L3T2", expected: ScalabilityMode{SpatialLayers: 3, TemporalLayers: 2}},
+		{mode: "L1T4", err: true},
+		{mode: "L0T1", err: true},
+		{mode: "L1T2h", err: true},
+		{mode: "S2T1", err: true},
+		{mode: "", err: true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.mode, func(t *testing.T) {
+			m, err := ParseScalabilityMode(tc.mode)
+			if tc.err {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, m)
+			assert.Equal(t, tc.mode, m.String())
+		})
+	}
+}
+
+func TestScalabilityModeZeroValue(t *testing.T) {
+	var m ScalabilityMode
+	assert.False(t, m.IsLayered())
+	assert.Equal(t, "L1T1", m.String())
+	assert.Equal(t, []int{0}, m.temporalPattern())
+	assert.Equal(t, []float64{1}, m.spatialRateShares())
+}
+
+func TestScalabilityModeRateShares(t *testing.T) {
+	m := ScalabilityMode{SpatialLayers: 2, TemporalLayers: 3}
+	assert.True(t, m.IsLayered())
+	assert.Equal(t, []int{0, 2, 1, 2}, m.temporalPattern())
+	assert.Equal(t, []float64{0.4, 0.6, 1}, m.temporalRateShares())
+	assert.InDeltaSlice(t, []float64{1.0 / 3, 2.0 / 3}, m.spatialRateShares(), 1e-9)
+}
+
+func TestSplitVP9Superframe(t *testing.T) {
+	frame0 := []byte{0x82, 0x49, 0x83}
+	frame1 := make([]byte, 300)
+	frame1[0] = 0x86
+
+	// two frames, two bytes per frame size
+	marker := byte(0xc0 | 1<<3 | 1)
+	superframe := append(append([]byte{}, frame0...), frame1...)
+	superframe = append(superframe, marker, 3, 0, 44, 1, marker)
+
+	assert.Equal(t, [][]byte{frame0, frame1}, splitVP9Superframe(superframe))
+	assert.Equal(t, [][]byte{frame1}, splitVP9Superframe(frame1))
+	assert.Nil(t, splitVP9Superframe(nil))
+
+	// sizes exceeding the data are not split
+	invalid := append(append([]byte{}, frame0...), marker, 4, 0, 44, 1, marker)
+	assert.Equal(t, [][]byte{invalid}, splitVP9Superframe(invalid))
+}
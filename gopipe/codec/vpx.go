@@ -16,8 +16,31 @@ vpx_codec_err_t vpx_codec_enc_init_macro(
 	return vpx_codec_enc_init(ctx, iface, cfg, flags);
 }
 
-inline vpx_codec_err_t vp9_set_cpu_used(vpx_codec_ctx_t *ctx, int value) {
-	return vpx_codec_control_(ctx, 13, value);  // VP9E_SET_CPU_USED = 13
+inline vpx_codec_err_t vpx_set_cpu_used(vpx_codec_ctx_t *ctx, int value) {
+	return vpx_codec_control_(ctx, 13, value);  // VP8E_SET_CPUUSED = 13
+}
+
+// Sets up img to describe a frame of fmt and size w x h without allocating
+// pixel data. The planes are set for each frame.
+vpx_image_t *vpx_img_describe(vpx_image_t *img, vpx_img_fmt_t fmt, unsigned int w, unsigned int h) {
+	static unsigned char placeholder;
+	return vpx_img_wrap(img, fmt, w, h, 1, &placeholder);
+}
+
+vpx_codec_err_t vp8_set_temporal_layer_id(vpx_codec_ctx_t *ctx, int id) {
+	return vpx_codec_control(ctx, VP8E_SET_TEMPORAL_LAYER_ID, id);
+}
+
+vpx_codec_err_t vp9_set_svc(vpx_codec_ctx_t *ctx, vpx_svc_extra_cfg_t *params) {
+	vpx_codec_err_t res = vpx_codec_control(ctx, VP9E_SET_SVC, 1);
+	if (res != VPX_CODEC_OK) {
+		return res;
+	}
+	return vpx_codec_control(ctx, VP9E_SET_SVC_PARAMETERS, params);
+}
+
+vpx_codec_err_t vp9_get_svc_layer_id(vpx_codec_ctx_t *ctx, vpx_svc_layer_id_t *id) {
+	return vpx_codec_control(ctx, VP9E_GET_SVC_LAYER_ID, id);
 }
 
 void *pktBuf(vpx_codec_cx_pkt_t *pkt) {
@@ -35,56 +58,76 @@ vpx_codec_frame_flags_t pktFrameFlags(vpx_codec_cx_pkt_t *pkt) {
 */
 import "C"
 import (
+	"cmp"
 	"errors"
 	"fmt"
 	"image"
 	"sync/atomic"
 	"time"
 	"unsafe"
+
+	"github.com/mengelbart/mrtp"
 )
 
-func getEncoderByName(codec CodecType) (*C.vpx_codec_iface_t, error) {
+func init() {
+	newEncoder := func(c Config) (VideoEncoder, error) {
+		return NewVPXEncoder(c)
+	}
+	RegisterEncoder(mrtp.VP8, newEncoder)
+	RegisterEncoder(mrtp.VP9, newEncoder)
+}
+
+func getEncoderByName(codec mrtp.Codec) (*C.vpx_codec_iface_t, error) {
 	switch codec {
-	case VP8:
+	case mrtp.VP8:
 		return C.vpx_codec_vp8_cx(), nil
-	case VP9:
+	case mrtp.VP9:
 		return C.vpx_codec_vp9_cx(), nil
 	}
 	return nil, fmt.Errorf("unknown codec: %v", codec)
 }
 
-type Frame struct {
-	IsKeyFrame bool
-	Payload    []byte
-}
-
 type VPXEncoder struct {
 	encoder *C.vpx_codec_iface_t
 	ctx     *C.vpx_codec_ctx_t
 	cfg     *C.vpx_codec_enc_cfg_t
+	raw     *C.vpx_image_t // describes the input frame
 
-	frame []byte
-	codec CodecType
+	out         Frame
+	frame       []byte
+	codec       mrtp.Codec
+	pixelFormat PixelFormat
+
+	scalabilityMode  ScalabilityMode
+	frameCount       int // frames since the last keyframe in VP8 layered mode
+	keyFrameInterval int
 
 	targetBitrate atomic.Uint64
+	forceKeyFrame atomic.Bool
 
 	closed bool
 }
 
-type Config struct {
-	Codec       CodecType
-	Width       uint
-	Height      uint
-	TimebaseNum int
-	TimebaseDen int
-	TargetRate  uint64
-}
-
 func NewVPXEncoder(c Config) (*VPXEncoder, error) {
 	encoder, err := getEncoderByName(c.Codec)
 	if err != nil {
 		return nil, err
 	}
+	if !SupportsPixelFormat(c.Codec, c.PixelFormat) {
+		return nil, fmt.Errorf("pixel format %v not supported by %v", c.PixelFormat, c.Codec)
+	}
+	minQ, maxQ, err := c.quantizerRange(10, 63)
+	if err != nil {
+		return nil, err
+	}
+	// VP8 keeps the library default unless a preset is given
+	speed, err := c.speed(-1)
+	if err != nil {
+		return nil, err
+	}
+	if speed < 0 && c.Codec == mrtp.VP9 {
+		speed = 5
+	}
 	var cfg C.vpx_codec_enc_cfg_t
 	if res := C.vpx_codec_enc_config_default(encoder, &cfg, 0); res != 0 {
 		return nil, fmt.Errorf("failed to get encoder default config: %v", res)
@@ -97,17 +140,37 @@ func NewVPXEncoder(c Config) (*VPXEncoder, error) {
 	cfg.g_timebase.den = C.int(c.TimebaseDen)
 	cfg.rc_end_usage = C.VPX_CBR
 	cfg.rc_target_bitrate = C.uint(c.TargetRate) / 1000
-	cfg.g_error_resilient = C.vpx_codec_er_flags_t(0)
 	cfg.g_pass = C.VPX_RC_ONE_PASS
-	cfg.g_threads = 4
+	cfg.g_threads = C.uint(cmp.Or(c.Threads, 4))
 	cfg.rc_resize_allowed = 0
 	cfg.g_lag_in_frames = 0 // Required for real-time encoding (no frame buffering)
 
+	// VP9 profile 1 carries 4:2:2 and 4:4:4 frames
+	if c.PixelFormat != PixelFormatI420 {
+		cfg.g_profile = 1
+	}
+
 	cfg.g_error_resilient = C.VPX_ERROR_RESILIENT_DEFAULT
+	if c.DisableErrorResilience {
+		cfg.g_error_resilient = C.vpx_codec_er_flags_t(0)
+	}
 
-	// TODO: how to configere these
-	cfg.rc_min_quantizer = C.uint(10)
-	cfg.rc_max_quantizer = C.uint(63)
+	if c.KeyFrameInterval > 0 {
+		cfg.kf_mode = C.VPX_KF_AUTO
+		cfg.kf_max_dist = C.uint(c.KeyFrameInterval)
+	}
+
+	cfg.rc_min_quantizer = C.uint(minQ)
+	cfg.rc_max_quantizer = C.uint(maxQ)
+
+	if c.VBVBufferSize > 0 {
+		// libvpx default: initial and optimal fill level at 4/6 and 5/6
+		// of the buffer
+		bufMs := c.VBVBufferSize.Milliseconds()
+		cfg.rc_buf_sz = C.uint(bufMs)
+		cfg.rc_buf_initial_sz = C.uint(bufMs * 4 / 6)
+		cfg.rc_buf_optimal_sz = C.uint(bufMs * 5 / 6)
+	}
 
 	// VP8: "This factor controls the maximum amount of bits that can be subtracted from the
 	// target bitrate in order to compensate for prior overshoot."
@@ -116,6 +179,15 @@ func NewVPXEncoder(c Config) (*VPXEncoder, error) {
 	cfg.rc_undershoot_pct = C.uint(10)
 	cfg.rc_overshoot_pct = C.uint(10)
 
+	mode := c.ScalabilityMode
+	if mode.spatial() > 1 && c.Codec != mrtp.VP9 {
+		return nil, fmt.Errorf("spatial layers not supported by %v", c.Codec)
+	}
+	if mode.IsLayered() {
+		setLayerConfig(&cfg, c.Codec, mode)
+		setLayerBitrates(&cfg, mode, cfg.rc_target_bitrate)
+	}
+
 	ctx := (*C.vpx_codec_ctx_t)(C.malloc(C.size_t(unsafe.Sizeof(C.vpx_codec_ctx_t{}))))
 	if ctx == nil {
 		return nil, fmt.Errorf("failed to allocate codec context")
@@ -124,13 +196,33 @@ func NewVPXEncoder(c Config) (*VPXEncoder, error) {
 	if res != 0 {
 		return nil, fmt.Errorf("failed to init encoder: code %v", res)
 	}
+	raw := (*C.vpx_image_t)(C.malloc(C.size_t(unsafe.Sizeof(C.vpx_image_t{}))))
+	if raw == nil {
+		return nil, fmt.Errorf("failed to allocate image")
+	}
+
+	// VP8E_SET_CPUUSED: Speed vs quality tradeoff
+	// higher values = faster encoding
+	if speed >= 0 {
+		if res := C.vpx_set_cpu_used(ctx, C.int(speed)); res != C.VPX_CODEC_OK {
+			return nil, fmt.Errorf("failed to set VP8E_SET_CPUUSED: %v", res)
+		}
+	}
 
 	// VP9-specific settings
-	if c.Codec == VP9 {
-		// VP9E_SET_CPU_USED: Speed vs quality tradeoff
-		// higher values = faster encoding
-		if res := C.vp9_set_cpu_used(ctx, 5); res != C.VPX_CODEC_OK {
-			return nil, fmt.Errorf("failed to set VP9E_SET_CPU_USED: %v", res)
+	if c.Codec == mrtp.VP9 {
+		if mode.IsLayered() {
+			var params C.vpx_svc_extra_cfg_t
+			for i := range mode.spatial() {
+				// each spatial layer doubles the resolution of the layer below
+				params.scaling_factor_num[i] = 1
+				params.scaling_factor_den[i] = C.int(1 << (mode.spatial() - 1 - i))
+				params.min_quantizers[i] = C.int(cfg.rc_min_quantizer)
+				params.max_quantizers[i] = C.int(cfg.rc_max_quantizer)
+			}
+			if res := C.vp9_set_svc(ctx, &params); res != C.VPX_CODEC_OK {
+				return nil, fmt.Errorf("failed to enable VP9 SVC: %v", res)
+			}
 		}
 	}
 
@@ -138,8 +230,14 @@ func NewVPXEncoder(c Config) (*VPXEncoder, error) {
 		ctx:     ctx,
 		encoder: encoder,
 		cfg:     &cfg,
+		raw:     raw,
 		frame:   make([]byte, 0),
 		codec:   c.Codec,
+
+		pixelFormat: c.PixelFormat,
+
+		scalabilityMode:  mode,
+		keyFrameInterval: c.KeyFrameInterval,
 	}
 
 	e.targetBitrate.Store(c.TargetRate)
@@ -154,35 +252,70 @@ func (e *VPXEncoder) Encode(
 	if e.closed {
 		return nil, fmt.Errorf("encoder is closed")
 	}
+	if image.SubsampleRatio != e.pixelFormat.SubsampleRatio() {
+		return nil, fmt.Errorf("chroma subsampling %v does not match pixel format %v", image.SubsampleRatio, e.pixelFormat)
+	}
 
-	raw := C.vpx_img_alloc(
-		nil,
-		C.VPX_IMG_FMT_I420,
+	raw := C.vpx_img_describe(
+		e.raw,
+		vpxImageFormat(e.pixelFormat),
 		C.uint(image.Bounds().Dx()),
 		C.uint(image.Bounds().Dy()),
-		1,
 	)
-	defer C.vpx_img_free(raw)
+	if raw == nil {
+		return nil, fmt.Errorf("invalid image format")
+	}
 
 	raw.planes[0] = (*C.uchar)(unsafe.Pointer(&image.Y[0]))
 	raw.planes[1] = (*C.uchar)(unsafe.Pointer(&image.Cb[0]))
 	raw.planes[2] = (*C.uchar)(unsafe.Pointer(&image.Cr[0]))
+	raw.stride[0] = C.int(image.YStride)
+	raw.stride[1] = C.int(image.CStride)
+	raw.stride[2] = C.int(image.CStride)
 
 	targetVpxBitrate := C.uint(float32(e.targetBitrate.Load() / 1000)) // convert to kbps
 	if e.cfg.rc_target_bitrate != targetVpxBitrate && targetVpxBitrate >= 1 {
 		e.cfg.rc_target_bitrate = targetVpxBitrate
+		if e.scalabilityMode.IsLayered() {
+			setLayerBitrates(e.cfg, e.scalabilityMode, targetVpxBitrate)
+		}
 		rc := C.vpx_codec_enc_config_set(e.ctx, e.cfg)
 		if rc != C.VPX_CODEC_OK {
 			return nil, fmt.Errorf("vpx_codec_enc_config_set failed (%d)", rc)
 		}
 	}
 
+	// In VP8 layered mode, automatic keyframes are disabled and the
+	// keyframe interval is enforced here.
+	layeredVP8 := e.codec == mrtp.VP8 && e.scalabilityMode.IsLayered()
+	if layeredVP8 && e.keyFrameInterval > 0 && e.frameCount >= e.keyFrameInterval {
+		e.forceKeyFrame.Store(true)
+	}
+
+	var flags C.vpx_enc_frame_flags_t
+	if e.forceKeyFrame.Swap(false) {
+		flags |= C.VPX_EFLAG_FORCE_KF
+		// keyframes must start a new temporal pattern in the base layer
+		e.frameCount = 0
+	}
+
+	temporalLayerID := 0
+	if layeredVP8 {
+		pattern := e.scalabilityMode.temporalPattern()
+		temporalLayerID = pattern[e.frameCount%len(pattern)]
+		flags |= vp8TemporalLayerFlags(e.scalabilityMode, temporalLayerID)
+		if res := C.vp8_set_temporal_layer_id(e.ctx, C.int(temporalLayerID)); res != C.VPX_CODEC_OK {
+			return nil, fmt.Errorf("failed to set VP8E_SET_TEMPORAL_LAYER_ID: %v", res)
+		}
+		e.frameCount++
+	}
+
 	res := C.vpx_codec_encode(
 		e.ctx,
 		raw,
 		C.vpx_codec_pts_t(pts),
 		C.ulong(duration.Microseconds()),
-		C.vpx_enc_frame_flags_t(0),
+		flags,
 		C.VPX_DL_REALTIME,
 	)
 
@@ -190,7 +323,8 @@ func (e *VPXEncoder) Encode(
 		return nil, fmt.Errorf("failed to encode frame: %v", res)
 	}
 	var iter C.vpx_codec_iter_t
-	frame := &Frame{}
+	frame := &e.out
+	*frame = Frame{TemporalLayerID: temporalLayerID}
 	e.frame = e.frame[:0]
 	for {
 		pkt := C.vpx_codec_get_cx_data(e.ctx, &iter)
@@ -199,19 +333,120 @@ func (e *VPXEncoder) Encode(
 		}
 		if pkt.kind == C.VPX_CODEC_CX_FRAME_PKT {
 			frame.IsKeyFrame = C.pktFrameFlags(pkt)&C.VPX_FRAME_IS_KEY == C.VPX_FRAME_IS_KEY
-			encoded := C.GoBytes(unsafe.Pointer(C.pktBuf(pkt)), C.pktSz(pkt))
+			// valid until the next call to vpx_codec_get_cx_data
+			encoded := unsafe.Slice((*byte)(C.pktBuf(pkt)), C.pktSz(pkt))
+			if e.codec == mrtp.VP9 && e.scalabilityMode.IsLayered() {
+				// Strip the superframe index so that each spatial layer
+				// frame can be packetized on its own. The VP9 decoder
+				// decodes concatenated frames without index.
+				for _, layer := range splitVP9Superframe(encoded) {
+					frame.SpatialLayerSizes = append(frame.SpatialLayerSizes, len(layer))
+					e.frame = append(e.frame, layer...)
+				}
+				continue
+			}
 			e.frame = append(e.frame, encoded...)
 		}
 	}
-	frame.Payload = make([]byte, len(e.frame))
-	copy(frame.Payload, e.frame)
+	if e.codec == mrtp.VP9 && e.scalabilityMode.IsLayered() {
+		var layerID C.vpx_svc_layer_id_t
+		if res := C.vp9_get_svc_layer_id(e.ctx, &layerID); res != C.VPX_CODEC_OK {
+			return nil, fmt.Errorf("failed to get VP9E_GET_SVC_LAYER_ID: %v", res)
+		}
+		frame.TemporalLayerID = int(layerID.temporal_layer_id)
+		if e.scalabilityMode.spatial() == 1 {
+			frame.SpatialLayerSizes = nil
+		}
+	}
+	frame.Payload = e.frame
 	return frame, nil
 }
 
+// vpxImageFormat returns the libvpx image format of f.
+func vpxImageFormat(f PixelFormat) C.vpx_img_fmt_t {
+	switch f {
+	case PixelFormatI422:
+		return C.VPX_IMG_FMT_I422
+	case PixelFormatI444:
+		return C.VPX_IMG_FMT_I444
+	}
+	return C.VPX_IMG_FMT_I420
+}
+
+// setLayerConfig configures the temporal layer pattern and, for VP9, the
+// number of spatial layers of cfg.
+func setLayerConfig(cfg *C.vpx_codec_enc_cfg_t, codec mrtp.Codec, mode ScalabilityMode) {
+	pattern := mode.temporalPattern()
+	cfg.ts_number_layers = C.uint(mode.temporal())
+	cfg.ts_periodicity = C.uint(len(pattern))
+	for i, id := range pattern {
+		cfg.ts_layer_id[i] = C.uint(id)
+	}
+	for i := range mode.temporal() {
+		cfg.ts_rate_decimator[i] = C.uint(1 << (mode.temporal() - 1 - i))
+	}
+
+	switch codec {
+	case mrtp.VP8:
+		// Automatic keyframes could land in an upper temporal layer. Keyframes
+		// are forced on request or after KeyFrameInterval frames instead,
+		// which restarts the pattern.
+		cfg.kf_mode = C.VPX_KF_DISABLED
+	case mrtp.VP9:
+		cfg.ss_number_layers = C.uint(mode.spatial())
+		switch mode.temporal() {
+		case 1:
+			cfg.temporal_layering_mode = C.VP9E_TEMPORAL_LAYERING_MODE_NOLAYERING
+		case 2:
+			cfg.temporal_layering_mode = C.VP9E_TEMPORAL_LAYERING_MODE_0101
+		case 3:
+			cfg.temporal_layering_mode = C.VP9E_TEMPORAL_LAYERING_MODE_0212
+		}
+	}
+}
+
+// setLayerBitrates splits the target rate of cfg in kbps between the layers of
+// mode.
+func setLayerBitrates(cfg *C.vpx_codec_enc_cfg_t, mode ScalabilityMode, kbps C.uint) {
+	temporalShares := mode.temporalRateShares()
+	for t, share := range temporalShares {
+		cfg.ts_target_bitrate[t] = C.uint(share * float64(kbps))
+	}
+	for s, spatialShare := range mode.spatialRateShares() {
+		cfg.ss_target_bitrate[s] = C.uint(spatialShare * float64(kbps))
+		for t, share := range temporalShares {
+			cfg.layer_target_bitrate[s*len(temporalShares)+t] = C.uint(spatialShare * share * float64(kbps))
+		}
+	}
+}
+
+// vp8TemporalLayerFlags returns the reference and update flags of a frame in
+// temporal layer id. The base layer only references and updates the last
+// frame buffer. In three layer mode, layer 1 updates the golden frame buffer
+// which layer 2 may reference. Frames of the top layer update nothing, so
+// they can be dropped without breaking the lower layers.
+func vp8TemporalLayerFlags(mode ScalabilityMode, id int) C.vpx_enc_frame_flags_t {
+	switch {
+	case id == 0:
+		return C.VP8_EFLAG_NO_REF_GF | C.VP8_EFLAG_NO_REF_ARF |
+			C.VP8_EFLAG_NO_UPD_GF | C.VP8_EFLAG_NO_UPD_ARF
+	case id < mode.temporal()-1:
+		return C.VP8_EFLAG_NO_REF_GF | C.VP8_EFLAG_NO_REF_ARF |
+			C.VP8_EFLAG_NO_UPD_LAST | C.VP8_EFLAG_NO_UPD_ARF
+	default:
+		return C.VP8_EFLAG_NO_REF_ARF |
+			C.VP8_EFLAG_NO_UPD_LAST | C.VP8_EFLAG_NO_UPD_GF | C.VP8_EFLAG_NO_UPD_ARF
+	}
+}
+
 func (e *VPXEncoder) SetTargetRate(targetRate uint64) {
 	e.targetBitrate.Store(targetRate)
 }
 
+func (e *VPXEncoder) ForceKeyFrame() {
+	e.forceKeyFrame.Store(true)
+}
+
 func (e *VPXEncoder) Close() error {
 	if e.closed {
 		return nil
@@ -220,6 +455,7 @@ func (e *VPXEncoder) Close() error {
 	e.closed = true
 
 	defer C.free(unsafe.Pointer(e.ctx))
+	defer C.free(unsafe.Pointer(e.raw))
 
 	if C.vpx_codec_destroy(e.ctx) != 0 {
 		return errors.New("vpx_codec_destroy failed")
@@ -2,8 +2,9 @@ package codec
 
 import (
 	"fmt"
-	"image"
 	"unsafe"
+
+	"github.com/mengelbart/mrtp"
 )
 
 /*
@@ -65,14 +66,23 @@ type VPXDecoder struct {
 	closed   bool
 
 	iter C.vpx_codec_iter_t
+	out  DecodedFrame
+}
+
+func init() {
+	newDecoder := func(codec mrtp.Codec) (VideoDecoder, error) {
+		return NewVPXDecoder(codec)
+	}
+	RegisterDecoder(mrtp.VP8, newDecoder)
+	RegisterDecoder(mrtp.VP9, newDecoder)
 }
 
-func NewVPXDecoder(codec CodecType) (*VPXDecoder, error) {
+func NewVPXDecoder(codec mrtp.Codec) (*VPXDecoder, error) {
 	var ccodec *C.vpx_codec_iface_t
 	switch codec {
-	case VP8:
+	case mrtp.VP8:
 		ccodec = C.ifaceVP8Decoder()
-	case VP9:
+	case mrtp.VP9:
 		ccodec = C.ifaceVP9Decoder()
 	default:
 		return nil, fmt.Errorf("unsupported codec for decoder: %s", codec.String())
@@ -107,44 +117,35 @@ func (d *VPXDecoder) Decode(encFrame []byte) (*DecodedFrame, error) {
 
 	w := int(input.d_w)
 	h := int(input.d_h)
+	csr, err := subsampleRatio(int(input.x_chroma_shift), int(input.y_chroma_shift))
+	if err != nil {
+		C.freeFrame(input)
+		return nil, fmt.Errorf("decode failed: %w", err)
+	}
+	cw, ch := ChromaSize(w, h, csr)
 	yStride := int(input.stride[0])
 	uStride := int(input.stride[1])
 	vStride := int(input.stride[2])
 
 	ySrc := unsafe.Slice((*byte)(unsafe.Pointer(input.planes[0])), yStride*h)
-	uSrc := unsafe.Slice((*byte)(unsafe.Pointer(input.planes[1])), uStride*h/2)
-	vSrc := unsafe.Slice((*byte)(unsafe.Pointer(input.planes[2])), vStride*h/2)
+	uSrc := unsafe.Slice((*byte)(unsafe.Pointer(input.planes[1])), uStride*ch)
+	vSrc := unsafe.Slice((*byte)(unsafe.Pointer(input.planes[2])), vStride*ch)
 
-	// YUV 4:2:0
 	ySize := w * h
-	uSize := (w / 2) * (h / 2)
-	frameData := make([]byte, ySize+uSize*2)
+	cSize := cw * ch
+	d.out.Data = resize(d.out.Data, ySize+cSize*2)
+	frameData := d.out.Data
 
-	// copy Y plane
-	for r := range h {
-		copy(frameData[r*w:r*w+w], ySrc[r*yStride:r*yStride+w])
-	}
-
-	// copy U plane
-	uOffset := ySize
-	for r := 0; r < h/2; r++ {
-		copy(frameData[uOffset+r*(w/2):uOffset+r*(w/2)+(w/2)], uSrc[r*uStride:r*uStride+(w/2)])
-	}
-
-	// copy V plane
-	vOffset := ySize + uSize
-	for r := 0; r < h/2; r++ {
-		copy(frameData[vOffset+r*(w/2):vOffset+r*(w/2)+(w/2)], vSrc[r*vStride:r*vStride+(w/2)])
-	}
+	copyPlane(frameData[:ySize], ySrc, yStride, w, h)
+	copyPlane(frameData[ySize:ySize+cSize], uSrc, uStride, cw, ch)
+	copyPlane(frameData[ySize+cSize:], vSrc, vStride, cw, ch)
 
 	C.freeFrame(input)
 
-	return &DecodedFrame{
-		Data:              frameData,
-		Width:             w,
-		Height:            h,
-		ChromaSubsampling: image.YCbCrSubsampleRatio420,
-	}, nil
+	d.out.Width = w
+	d.out.Height = h
+	d.out.ChromaSubsampling = csr
+	return &d.out, nil
 }
 
 func (d *VPXDecoder) Close() {
@@ -4,50 +4,112 @@ package codec
 // #include "x264_bridge.h"
 import "C"
 import (
+	"cmp"
 	"fmt"
 	"image"
 	"sync"
 	"sync/atomic"
+	"time"
 	"unsafe"
+
+	"github.com/mengelbart/mrtp"
 )
 
+func init() {
+	RegisterEncoder(mrtp.H264, func(c Config) (VideoEncoder, error) {
+		enc, err := NewX264encoder(c)
+		if err != nil {
+			return nil, err
+		}
+		return x264VideoEncoder{enc}, nil
+	})
+}
+
+// x264VideoEncoder adapts X264encoder to the VideoEncoder interface. x264
+// does not need the PTS and duration of frames.
+type x264VideoEncoder struct {
+	*X264encoder
+}
+
+func (e x264VideoEncoder) Encode(image *image.YCbCr, _ int64, _ time.Duration) (*Frame, error) {
+	return e.X264encoder.Encode(image)
+}
+
 type X264encoder struct {
-	engine *C.Encoder
-	mu     sync.Mutex
-	closed bool
+	engine      *C.Encoder
+	mu          sync.Mutex
+	closed      bool
+	pixelFormat PixelFormat
+	out         Frame
 
 	targetBitrate       atomic.Uint64 // kbps
 	currentTrgetBitrate uint64        // kbps
 }
 
 func NewX264encoder(c Config) (*X264encoder, error) {
+	// x264 has no control over the reference structure of single frames,
+	// which temporal layering requires. Without layers, there is also
+	// nothing to signal with the frame marking extension.
+	if c.ScalabilityMode.IsLayered() {
+		return nil, fmt.Errorf("scalability mode %v not supported by x264", c.ScalabilityMode)
+	}
+	csp, profile, err := x264Format(c.PixelFormat)
+	if err != nil {
+		return nil, err
+	}
 	param := C.x264_param_t{
-		i_csp:        C.X264_CSP_I420,
+		i_csp:        csp,
 		i_width:      C.int(c.Width),
 		i_height:     C.int(c.Height),
 		i_fps_num:    C.uint(c.TimebaseNum),
 		i_fps_den:    C.uint(c.TimebaseDen),
-		i_keyint_max: C.int(60), // intra-refresh cycle: 60 frames
+		i_keyint_max: C.int(cmp.Or(c.KeyFrameInterval, 60)), // intra-refresh cycle
+		i_threads:    C.int(c.Threads),                      // 0: automatic
+	}
+	if c.MinQuantizer > 0 || c.MaxQuantizer > 0 {
+		minQ, maxQ, err := c.quantizerRange(0, 51)
+		if err != nil {
+			return nil, err
+		}
+		param.rc.i_qp_min = C.int(minQ)
+		param.rc.i_qp_max = C.int(maxQ)
 	}
+	vbvBufferMs := cmp.Or(c.VBVBufferSize, time.Second).Milliseconds()
 	param.rc.i_bitrate = C.int(c.TargetRate / 1000) // convert to kbps
 	param.rc.i_vbv_max_bitrate = param.rc.i_bitrate
-	param.rc.i_vbv_buffer_size = param.rc.i_vbv_max_bitrate // 1 second buffer
+	param.rc.i_vbv_buffer_size = C.int(int64(param.rc.i_vbv_max_bitrate) * vbvBufferMs / 1000)
 
 	var rc C.int
-	// cPreset will be freed in C.enc_new
-	cPreset := C.CString("ultrafast")
-	engine := C.enc_new(param, cPreset, &rc)
+	// cPreset and cProfile will be freed in C.enc_new
+	cPreset := C.CString(cmp.Or(c.Preset, "ultrafast"))
+	cProfile := C.CString(profile)
+	engine := C.enc_new(param, cPreset, cProfile, C.int(vbvBufferMs), &rc)
 	if rc != 0 {
 		return nil, fmt.Errorf("failed to create x264 encoder with error code: %v", rc)
 	}
 
 	e := X264encoder{
 		engine:              engine,
+		pixelFormat:         c.PixelFormat,
 		currentTrgetBitrate: c.TargetRate,
 	}
 	return &e, nil
 }
 
+// x264Format returns the x264 colorspace and the lowest profile that supports
+// pixel format f.
+func x264Format(f PixelFormat) (C.int, string, error) {
+	switch f {
+	case PixelFormatI420:
+		return C.X264_CSP_I420, "high", nil
+	case PixelFormatI422:
+		return C.X264_CSP_I422, "high422", nil
+	case PixelFormatI444:
+		return C.X264_CSP_I444, "high444", nil
+	}
+	return 0, "", fmt.Errorf("pixel format %v not supported by x264", f)
+}
+
 func (e *X264encoder) Encode(image *image.YCbCr) (*Frame, error) {
 	e.mu.Lock()
 	defer e.mu.Unlock()
@@ -55,6 +117,9 @@ func (e *X264encoder) Encode(image *image.YCbCr) (*Frame, error) {
 	if e.closed {
 		return nil, fmt.Errorf("encoder is closed")
 	}
+	if image.SubsampleRatio != e.pixelFormat.SubsampleRatio() {
+		return nil, fmt.Errorf("chroma subsampling %v does not match pixel format %v", image.SubsampleRatio, e.pixelFormat)
+	}
 
 	bitrate := e.targetBitrate.Load()
 	if bitrate != e.currentTrgetBitrate {
@@ -77,11 +142,11 @@ func (e *X264encoder) Encode(image *image.YCbCr) (*Frame, error) {
 		return nil, fmt.Errorf("failed to encode image with error code: %v", rc)
 	}
 
-	encoded := C.GoBytes(unsafe.Pointer(s.data), s.data_len)
-
-	frame := &Frame{
-		Payload:    encoded,
-		IsKeyFrame: false, // TODO
+	frame := &e.out
+	*frame = Frame{
+		// the NAL units are valid until the next call to enc_encode
+		Payload:    unsafe.Slice((*byte)(unsafe.Pointer(s.data)), s.data_len),
+		IsKeyFrame: s.is_key_frame != 0,
 	}
 
 	return frame, nil
@@ -91,6 +156,17 @@ func (e *X264encoder) SetTargetRate(bitrate uint64) {
 	e.targetBitrate.Store(bitrate)
 }
 
+// ForceKeyFrame makes the next encoded frame an IDR frame.
+func (e *X264encoder) ForceKeyFrame() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.closed {
+		return
+	}
+	e.engine.force_key_frame = 1
+}
+
 func (e *X264encoder) Close() error {
 	e.mu.Lock()
 	defer e.mu.Unlock()
@@ -16,6 +16,7 @@
 typedef struct Slice {
   unsigned char *data;
   int data_len;
+  int is_key_frame;
 } Slice;
 
 typedef struct Encoder {
@@ -23,13 +24,17 @@ typedef struct Encoder {
   x264_picture_t pic_in;
   x264_param_t param;
   int force_key_frame;
+  int vbv_buffer_ms;
 } Encoder;
 
-Encoder *enc_new(x264_param_t param, char *preset, int *rc) {
+Encoder *enc_new(x264_param_t param, char *preset, char *profile, int vbv_buffer_ms, int *rc) {
   Encoder *e = (Encoder *)malloc(sizeof(Encoder));
+  e->force_key_frame = 0;
+  e->vbv_buffer_ms = vbv_buffer_ms;
 
   if (x264_param_default_preset(&e->param, preset, "zerolatency") < 0) {
     free(preset);
+    free(profile);
     *rc = ERR_DEFAULT_PRESET;
     goto fail;
   }
@@ -44,20 +49,29 @@ Encoder *enc_new(x264_param_t param, char *preset, int *rc) {
   // Use periodic intra refresh instead of key frames
   e->param.i_keyint_max = param.i_keyint_max;
   e->param.b_intra_refresh = 1;
+  if (param.i_threads > 0) {
+    e->param.i_threads = param.i_threads;
+  }
   // Rate control:
   e->param.rc.i_rc_method = X264_RC_ABR;
   e->param.rc.i_bitrate = param.rc.i_bitrate;
   e->param.rc.i_vbv_max_bitrate = param.rc.i_vbv_max_bitrate;
   e->param.rc.i_vbv_buffer_size = param.rc.i_vbv_buffer_size;
+  if (param.rc.i_qp_max > 0) {
+    e->param.rc.i_qp_min = param.rc.i_qp_min;
+    e->param.rc.i_qp_max = param.rc.i_qp_max;
+  }
   e->param.rc.f_rate_tolerance = 1.0;  // here we set the inital tolarance
   // For streaming:
   e->param.b_repeat_headers = 1;
   e->param.b_annexb = 1;
 
-  if (x264_param_apply_profile(&e->param, "high") < 0) {
+  if (x264_param_apply_profile(&e->param, profile) < 0) {
+    free(profile);
     *rc = ERR_APPLY_PROFILE;
     goto fail;
   }
+  free(profile);
 
   x264_picture_t pic_in;
   if (x264_picture_alloc(&pic_in, param.i_csp, param.i_width, param.i_height) < 0) {
@@ -94,7 +108,7 @@ static int apply_target_bitrate(Encoder *e, int target_bitrate) {
   e->param.rc.f_rate_tolerance = 0.1;
   // VBV ceiling == target
   e->param.rc.i_vbv_max_bitrate = target_encoder_bitrate;
-  e->param.rc.i_vbv_buffer_size = target_encoder_bitrate; // 1-second buffer
+  e->param.rc.i_vbv_buffer_size = (int)((int64_t)target_encoder_bitrate * e->vbv_buffer_ms / 1000);
   e->param.rc.f_vbv_buffer_init = 0.6;
   int success = x264_encoder_reconfig(e->h, &e->param);
   return success; // 0 on success or negative on error
@@ -116,7 +130,7 @@ Slice enc_encode(Encoder *e, uint8_t *y, uint8_t *cb, uint8_t *cr, int *rc) {
 
   int frame_size = x264_encoder_encode(e->h, &nal, &i_nal, &e->pic_in, &pic_out);
   e->force_key_frame = 0;
-  Slice s = {.data_len = frame_size};
+  Slice s = {.data_len = frame_size, .is_key_frame = 0};
   if (frame_size <= 0) {
     *rc = ERR_ENCODE;
     return s;
@@ -124,6 +138,7 @@ Slice enc_encode(Encoder *e, uint8_t *y, uint8_t *cb, uint8_t *cr, int *rc) {
 
   e->pic_in.i_pts++;
   s.data = nal->p_payload;
+  s.is_key_frame = pic_out.b_keyframe;
   return s;
 }
 
@@ -9,8 +9,9 @@ import "C"
 import (
 	"errors"
 	"fmt"
-	"image"
 	"unsafe"
+
+	"github.com/mengelbart/mrtp"
 )
 
 var ErrFrameNotReady = errors.New("h264: frame not ready, decoder needs more input packets")
@@ -18,6 +19,13 @@ var ErrFrameNotReady = errors.New("h264: frame not ready, decoder needs more inp
 type H264Decoder struct {
 	dec    *C.H264Decoder
 	closed bool
+	out    DecodedFrame
+}
+
+func init() {
+	RegisterDecoder(mrtp.H264, func(mrtp.Codec) (VideoDecoder, error) {
+		return NewH264Decoder()
+	})
 }
 
 func NewH264Decoder() (*H264Decoder, error) {
@@ -49,42 +57,32 @@ func (d *H264Decoder) Decode(encFrame []byte) (*DecodedFrame, error) {
 
 	w := int(C.h264dec_width(d.dec))
 	h := int(C.h264dec_height(d.dec))
+	csr, err := subsampleRatio(int(C.h264dec_chroma_shift_w(d.dec)), int(C.h264dec_chroma_shift_h(d.dec)))
+	if err != nil {
+		return nil, fmt.Errorf("h264dec_get_frame failed: %w", err)
+	}
+	cw, ch := ChromaSize(w, h, csr)
 	yStride := int(C.h264dec_y_linesize(d.dec))
 	uStride := int(C.h264dec_u_linesize(d.dec))
 	vStride := int(C.h264dec_v_linesize(d.dec))
 
 	ySrc := unsafe.Slice((*byte)(unsafe.Pointer(C.h264dec_y_plane(d.dec))), yStride*h)
-	uSrc := unsafe.Slice((*byte)(unsafe.Pointer(C.h264dec_u_plane(d.dec))), uStride*h/2)
-	vSrc := unsafe.Slice((*byte)(unsafe.Pointer(C.h264dec_v_plane(d.dec))), vStride*h/2)
+	uSrc := unsafe.Slice((*byte)(unsafe.Pointer(C.h264dec_u_plane(d.dec))), uStride*ch)
+	vSrc := unsafe.Slice((*byte)(unsafe.Pointer(C.h264dec_v_plane(d.dec))), vStride*ch)
 
-	// YUV 4:2:0
 	ySize := w * h
-	uSize := (w / 2) * (h / 2)
-	frameData := make([]byte, ySize+uSize*2)
-
-	// copy Y plane
-	for r := range h {
-		copy(frameData[r*w:r*w+w], ySrc[r*yStride:r*yStride+w])
-	}
-
-	// copy U plane
-	uOffset := ySize
-	for r := 0; r < h/2; r++ {
-		copy(frameData[uOffset+r*(w/2):uOffset+r*(w/2)+(w/2)], uSrc[r*uStride:r*uStride+(w/2)])
-	}
-
-	// copy V plane
-	vOffset := ySize + uSize
-	for r := 0; r < h/2; r++ {
-		copy(frameData[vOffset+r*(w/2):vOffset+r*(w/2)+(w/2)], vSrc[r*vStride:r*vStride+(w/2)])
-	}
-
-	return &DecodedFrame{
-		Data:              frameData,
-		Width:             w,
-		Height:            h,
-		ChromaSubsampling: image.YCbCrSubsampleRatio420,
-	}, nil
+	cSize := cw * ch
+	d.out.Data = resize(d.out.Data, ySize+cSize*2)
+	frameData := d.out.Data
+
+	copyPlane(frameData[:ySize], ySrc, yStride, w, h)
+	copyPlane(frameData[ySize:ySize+cSize], uSrc, uStride, cw, ch)
+	copyPlane(frameData[ySize+cSize:], vSrc, vStride, cw, ch)
+
+	d.out.Width = w
+	d.out.Height = h
+	d.out.ChromaSubsampling = csr
+	return &d.out, nil
 }
 
 func (d *H264Decoder) Close() {
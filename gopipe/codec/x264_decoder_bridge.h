@@ -4,6 +4,7 @@
 #include <libavcodec/avcodec.h>
 #include <libavutil/error.h>
 #include <libavutil/frame.h>
+#include <libavutil/pixdesc.h>
 
 
 #define H264DEC_EAGAIN AVERROR(EAGAIN)
@@ -90,6 +91,18 @@ int h264dec_height(H264Decoder *d)
     return d->frame->height;
 }
 
+// Returns the log2 of the horizontal chroma subsampling factor of the frame.
+int h264dec_chroma_shift_w(H264Decoder *d)
+{
+    return av_pix_fmt_desc_get(d->frame->format)->log2_chroma_w;
+}
+
+// Returns the log2 of the vertical chroma subsampling factor of the frame.
+int h264dec_chroma_shift_h(H264Decoder *d)
+{
+    return av_pix_fmt_desc_get(d->frame->format)->log2_chroma_h;
+}
+
 uint8_t *h264dec_y_plane(H264Decoder *d)
 {
     return d->frame->data[0];
@@ -6,35 +6,24 @@ import (
 	"fmt"
 	"log/slog"
 
+	"github.com/mengelbart/mrtp"
 	"github.com/mengelbart/mrtp/gopipe/codec"
 )
 
 type Decoder struct {
-	x264dec *codec.H264Decoder
-	vpxdec  *codec.VPXDecoder
+	decoder codec.VideoDecoder
+
+	onDecodeError func(error)
 }
 
-func NewDecoder(c codec.CodecType) (*Decoder, error) {
-	switch c {
-	case codec.H264:
-		dec, err := codec.NewH264Decoder()
-		if err != nil {
-			return nil, fmt.Errorf("failed to create H264 decoder: %w", err)
-		}
-		return &Decoder{
-			x264dec: dec,
-		}, nil
-	case codec.VP8, codec.VP9:
-		dec, err := codec.NewVPXDecoder(c)
-		if err != nil {
-			return nil, fmt.Errorf("failed to create H264 decoder: %w", err)
-		}
-		return &Decoder{
-			vpxdec: dec,
-		}, nil
-	default:
-		return nil, fmt.Errorf("unsupported codec: %v", c)
+func NewDecoder(c mrtp.Codec) (*Decoder, error) {
+	dec, err := codec.NewDecoder(c)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %v decoder: %w", c, err)
 	}
+	return &Decoder{
+		decoder: dec,
+	}, nil
 }
 
 func (d *Decoder) Link(next Sink, i Info) (Sink, error) {
@@ -44,15 +33,13 @@ func (d *Decoder) Link(next Sink, i Info) (Sink, error) {
 			return err
 		}
 
-		var decFrame *codec.DecodedFrame
-		if d.x264dec != nil {
-			decFrame, err = d.x264dec.Decode(encFrame)
-		} else if d.vpxdec != nil {
-			decFrame, err = d.vpxdec.Decode(encFrame)
-		} else {
-			return fmt.Errorf("no decoder available")
-		}
+		decFrame, err := d.decoder.Decode(encFrame)
 		if err != nil {
+			if d.onDecodeError != nil {
+				// drop the frame and let the callback recover
+				d.onDecodeError(err)
+				return nil
+			}
 			return fmt.Errorf("failed to decode frame: %w", err)
 		}
 
@@ -71,12 +58,14 @@ func (d *Decoder) Link(next Sink, i Info) (Sink, error) {
 	}), nil
 }
 
+// OnDecodeError sets a callback for frames that fail to decode, e.g. to
+// request a keyframe. If set, frames that fail to decode are dropped instead
+// of failing the pipeline.
+func (d *Decoder) OnDecodeError(f func(error)) {
+	d.onDecodeError = f
+}
+
 func (d *Decoder) Close() error {
-	if d.x264dec != nil {
-		d.x264dec.Close()
-	}
-	if d.vpxdec != nil {
-		d.vpxdec.Close()
-	}
+	d.decoder.Close()
 	return nil
 }
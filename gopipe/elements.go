@@ -0,0 +1,273 @@
+package gopipe
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"time"
+
+	"github.com/mengelbart/mrtp/gopipe/codec"
+)
+
+// The elements of pipeline descriptions, see Registry.Parse. Codec elements
+// are registered in elements_cgo.go.
+func init() {
+	RegisterElement("y4msrc", newY4MSourceElement)
+	RegisterElement("wavsrc", newWAVSourceElement)
+	RegisterElement("fakesrc", newFakeSourceElement)
+	RegisterElement("rtppay", newRTPPacketizerElement)
+	RegisterElement("rtpdepay", newRTPDepacketizerElement)
+	RegisterElement("spacer", func(context.Context, *Properties) (any, error) {
+		return NewFrameSpacer(), nil
+	})
+	RegisterElement("queue", newQueueElement)
+	RegisterElement("scale", newScalerElement)
+	RegisterElement("decimate", newDecimatorElement)
+	RegisterElement("chromaconvert", newChromaConverterElement)
+	RegisterElement("framedrop", newFrameDropperElement)
+	RegisterElement("framedropmonitor", newFrameDropperMonitorElement)
+	RegisterElement("layerfilter", newLayerFilterElement)
+	RegisterElement("y4msink", newY4MSinkElement)
+	RegisterElement("wavsink", newWAVSinkElement)
+	RegisterElement("fakesink", func(context.Context, *Properties) (any, error) {
+		return NewFakeSink()
+	})
+}
+
+// y4mFileSource closes the file of a Y4MSource with the pipeline.
+type y4mFileSource struct {
+	*Y4MSource
+	file *os.File
+}
+
+func (s *y4mFileSource) Close() error {
+	return s.file.Close()
+}
+
+func newY4MSourceElement(_ context.Context, p *Properties) (any, error) {
+	location := p.Required("location")
+	if err := p.Err(); err != nil {
+		return nil, err
+	}
+	file, err := os.Open(location)
+	if err != nil {
+		return nil, err
+	}
+	src, err := NewY4MSource(file)
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	return &y4mFileSource{Y4MSource: src, file: file}, nil
+}
+
+// wavFileSource closes the file of a WAVSource with the pipeline.
+type wavFileSource struct {
+	*WAVSource
+	file *os.File
+}
+
+func (s *wavFileSource) Close() error {
+	return s.file.Close()
+}
+
+func newWAVSourceElement(_ context.Context, p *Properties) (any, error) {
+	location := p.Required("location")
+	frameDuration := p.Duration("frame-duration", 20*time.Millisecond)
+	if err := p.Err(); err != nil {
+		return nil, err
+	}
+	file, err := os.Open(location)
+	if err != nil {
+		return nil, err
+	}
+	src, err := NewWAVSource(file, frameDuration)
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	return &wavFileSource{WAVSource: src, file: file}, nil
+}
+
+func newFakeSourceElement(_ context.Context, p *Properties) (any, error) {
+	runTime := p.Duration("duration", time.Duration(math.MaxInt64))
+	rate := p.Int("rate", 750_000)
+	minRate := p.Int("min-rate", 250_000)
+	maxRate := p.Int("max-rate", 8_000_000)
+	fps := p.Int("fps", 30)
+	width := p.Int("width", 1920)
+	height := p.Int("height", 1080)
+	modelName := p.String("model", "constant")
+	// statistical model
+	config := StatisticalModelConfig{
+		GOPLength:     p.Int("gop", 0),
+		KeyFrameRatio: p.Float("keyframe-ratio", 0),
+		SizeDeviation: p.Float("size-deviation", 0),
+		ReactionTime:  p.Duration("reaction-time", 0),
+		Seed:          p.Uint64("seed", 0),
+	}
+	// trace model
+	trace := p.String("trace", "")
+	scaleTrace := p.Bool("scale-trace", true)
+	if err := p.Err(); err != nil {
+		return nil, err
+	}
+	if fps <= 0 || width <= 0 || height <= 0 {
+		return nil, errors.New("fps, width and height must be positive")
+	}
+
+	var model FrameSizeModel
+	switch modelName {
+	case "constant":
+		model = &ConstantModel{}
+	case "statistical":
+		model = NewStatisticalModel(config)
+	case "trace":
+		file, err := os.Open(trace)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		if model, err = NewTraceModel(file, scaleTrace); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown model %q, expected constant, statistical or trace", modelName)
+	}
+	return NewFakeSource(runTime, minRate, maxRate, rate,
+		FakeSourceModel(model),
+		FakeSourceFrameRate(fps),
+		FakeSourceResolution(uint(width), uint(height)),
+	)
+}
+
+func newRTPPacketizerElement(_ context.Context, p *Properties) (any, error) {
+	c := p.Codec("codec")
+	mtu := p.Int("mtu", 1420)
+	pt := p.Int("pt", int(c.PayloadType()))
+	ssrc := p.Uint64("ssrc", 0)
+	clockRate := p.Int("clock-rate", c.ClockRate())
+	if err := p.Err(); err != nil {
+		return nil, err
+	}
+	scalabilityMode, err := codec.ParseScalabilityMode(p.String("scalability-mode", "L1T1"))
+	if err != nil {
+		return nil, err
+	}
+	if mtu <= 0 || mtu > math.MaxUint16 || pt < 0 || pt > 127 || ssrc > math.MaxUint32 || clockRate <= 0 {
+		return nil, errors.New("mtu, pt, ssrc or clock-rate out of range")
+	}
+	return &RTPPacketizerFactory{
+		MTU:             uint16(mtu),
+		PT:              uint8(pt),
+		SSRC:            uint32(ssrc),
+		ClockRate:       uint32(clockRate),
+		Codec:           c,
+		ScalabilityMode: scalabilityMode,
+	}, nil
+}
+
+func newRTPDepacketizerElement(_ context.Context, p *Properties) (any, error) {
+	c := p.Codec("codec")
+	timeout := p.Duration("timeout", 150*time.Millisecond)
+	if err := p.Err(); err != nil {
+		return nil, err
+	}
+	return NewRTPDepacketizer(timeout, c)
+}
+
+func newQueueElement(_ context.Context, p *Properties) (any, error) {
+	size := p.Int("size", 30)
+	if err := p.Err(); err != nil {
+		return nil, err
+	}
+	if size <= 0 {
+		return nil, errors.New("size must be positive")
+	}
+	return NewQueue(QueueSize(size)), nil
+}
+
+func newScalerElement(_ context.Context, p *Properties) (any, error) {
+	width := p.Int("width", 0)
+	height := p.Int("height", 0)
+	if err := p.Err(); err != nil {
+		return nil, err
+	}
+	s := NewScaler()
+	s.SetResolution(width, height)
+	return s, nil
+}
+
+func newDecimatorElement(_ context.Context, p *Properties) (any, error) {
+	fps := p.Float("fps", 0)
+	if err := p.Err(); err != nil {
+		return nil, err
+	}
+	d := NewFrameRateDecimator()
+	d.SetFrameRate(fps)
+	return d, nil
+}
+
+func newChromaConverterElement(_ context.Context, p *Properties) (any, error) {
+	format, err := codec.ParsePixelFormat(p.String("format", codec.PixelFormatI420.String()))
+	if err != nil {
+		return nil, err
+	}
+	return NewChromaConverter(format.SubsampleRatio()), nil
+}
+
+func newFrameDropperElement(_ context.Context, p *Properties) (any, error) {
+	window := p.Duration("window", 500*time.Millisecond)
+	if err := p.Err(); err != nil {
+		return nil, err
+	}
+	return NewFrameDropper(FrameDropperWindow(window)), nil
+}
+
+func newFrameDropperMonitorElement(_ context.Context, p *Properties) (any, error) {
+	e := p.Element("dropper")
+	if err := p.Err(); err != nil {
+		return nil, err
+	}
+	dropper, ok := e.(*FrameDropper)
+	if !ok {
+		return nil, fmt.Errorf("dropper is not a framedrop element: %T", e)
+	}
+	return dropper.Monitor(), nil
+}
+
+func newLayerFilterElement(_ context.Context, p *Properties) (any, error) {
+	c := p.Codec("codec")
+	spatial := p.Int("spatial", -1)
+	temporal := p.Int("temporal", -1)
+	if err := p.Err(); err != nil {
+		return nil, err
+	}
+	f, err := NewRTPLayerFilter(c)
+	if err != nil {
+		return nil, err
+	}
+	f.SetMaxLayers(spatial, temporal)
+	return f, nil
+}
+
+func newY4MSinkElement(_ context.Context, p *Properties) (any, error) {
+	location := p.Required("location")
+	fps := p.Int("fps", 30)
+	if err := p.Err(); err != nil {
+		return nil, err
+	}
+	return NewY4MSink(location, fps, 1)
+}
+
+func newWAVSinkElement(_ context.Context, p *Properties) (any, error) {
+	location := p.Required("location")
+	sampleRate := p.Int("sample-rate", 48_000)
+	channels := p.Int("channels", 2)
+	if err := p.Err(); err != nil {
+		return nil, err
+	}
+	return NewWAVSink(location, sampleRate, channels)
+}
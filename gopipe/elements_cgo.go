@@ -0,0 +1,87 @@
+//go:build cgo
+
+package gopipe
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/mengelbart/mrtp"
+	"github.com/mengelbart/mrtp/gopipe/codec"
+)
+
+// The codec elements of pipeline descriptions. Next to the generic encoder
+// and decoder elements with a codec property, each codec registered at init
+// time has elements named after it, e.g. vp8enc and vp8dec.
+func init() {
+	RegisterElement("encoder", newEncoderElement)
+	RegisterElement("decoder", newDecoderElement)
+	for _, c := range mrtp.Codecs() {
+		if c == mrtp.FAKE {
+			continue
+		}
+		name := strings.ToLower(c.String())
+		RegisterElement(name+"enc", withCodec(c, newEncoderElement))
+		RegisterElement(name+"dec", withCodec(c, newDecoderElement))
+	}
+}
+
+// withCodec returns a factory that creates elements for codec c.
+func withCodec(c mrtp.Codec, f ElementFactory) ElementFactory {
+	return func(ctx context.Context, p *Properties) (any, error) {
+		if p.Has("codec") {
+			return nil, errors.New("codec is set by the element name")
+		}
+		p.values["codec"] = c.String()
+		return f(ctx, p)
+	}
+}
+
+func newEncoderElement(_ context.Context, p *Properties) (any, error) {
+	c := p.Codec("codec")
+	if c.MediaType() == "audio" {
+		rate := p.Uint64("rate", 64_000)
+		if err := p.Err(); err != nil {
+			return nil, err
+		}
+		return NewAudioEncoder(c, rate), nil
+	}
+
+	opts := []EncoderOption{
+		EncoderPreset(p.String("preset", "")),
+		EncoderThreads(p.Int("threads", 0)),
+		EncoderKeyFrameInterval(p.Int("keyframe-interval", 0)),
+		EncoderQuantizerRange(p.Int("min-quantizer", 0), p.Int("max-quantizer", 0)),
+		EncoderVBVBufferSize(p.Duration("vbv-buffer", 0)),
+		EncoderErrorResilience(p.Bool("error-resilient", true)),
+	}
+	if p.Has("rate") {
+		opts = append(opts, EncoderInitialRate(p.Uint64("rate", 0)))
+	}
+	pixelFormat, err := codec.ParsePixelFormat(p.String("pixel-format", codec.PixelFormatI420.String()))
+	if err != nil {
+		return nil, err
+	}
+	scalabilityMode, err := codec.ParseScalabilityMode(p.String("scalability-mode", "L1T1"))
+	if err != nil {
+		return nil, err
+	}
+	if err = p.Err(); err != nil {
+		return nil, err
+	}
+	opts = append(opts, EncoderPixelFormat(pixelFormat), EncoderScalabilityMode(scalabilityMode))
+	return NewEncoder(c, opts...), nil
+}
+
+func newDecoderElement(_ context.Context, p *Properties) (any, error) {
+	c := p.Codec("codec")
+	if err := p.Err(); err != nil {
+		return nil, err
+	}
+	if c.MediaType() == "audio" {
+		info, _ := c.Info()
+		return NewAudioDecoder(c, int(info.ClockRate), int(info.Channels))
+	}
+	return NewDecoder(c)
+}
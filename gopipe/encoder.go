@@ -6,64 +6,118 @@ import (
 	"fmt"
 	"image"
 	"log/slog"
+	"sync"
 	"time"
 
+	"github.com/mengelbart/mrtp"
 	"github.com/mengelbart/mrtp/gopipe/codec"
 )
 
-func getFrameDuration(attrs Attributes) (time.Duration, error) {
-	fdAttr, ok := attrs[FrameDuration]
-	if !ok {
-		return 0, fmt.Errorf("FrameDuration attribute not found")
+// EncoderOption configures an [Encoder].
+type EncoderOption func(*Encoder)
+
+// EncoderScalabilityMode sets the spatial and temporal layers of the encoded
+// stream. Default: single layer.
+func EncoderScalabilityMode(m codec.ScalabilityMode) EncoderOption {
+	return func(e *Encoder) {
+		e.config.ScalabilityMode = m
 	}
-	fdVal, ok := fdAttr.(time.Duration)
-	if !ok {
-		return 0, fmt.Errorf("FrameDuration attribute is not time.Duration")
+}
+
+// EncoderPixelFormat sets the pixel format that the encoder is initialized
+// with. Frames in another format reinitialize the encoder. Default: I420.
+func EncoderPixelFormat(f codec.PixelFormat) EncoderOption {
+	return func(e *Encoder) {
+		e.config.PixelFormat = f
+	}
+}
+
+// EncoderInitialRate sets the target rate in bits per second that the
+// encoder starts with, e.g. the initial rate of the BWE. Default: 750 kbps.
+func EncoderInitialRate(rate uint64) EncoderOption {
+	return func(e *Encoder) {
+		e.config.TargetRate = rate
+	}
+}
+
+// EncoderPreset sets the speed preset, see [codec.Config].
+func EncoderPreset(preset string) EncoderOption {
+	return func(e *Encoder) {
+		e.config.Preset = preset
+	}
+}
+
+// EncoderThreads sets the number of encoder threads.
+func EncoderThreads(threads int) EncoderOption {
+	return func(e *Encoder) {
+		e.config.Threads = threads
+	}
+}
+
+// EncoderKeyFrameInterval sets the maximum number of frames between
+// keyframes.
+func EncoderKeyFrameInterval(frames int) EncoderOption {
+	return func(e *Encoder) {
+		e.config.KeyFrameInterval = frames
+	}
+}
+
+// EncoderQuantizerRange bounds the quantizer of the encoder.
+func EncoderQuantizerRange(minQ, maxQ int) EncoderOption {
+	return func(e *Encoder) {
+		e.config.MinQuantizer = minQ
+		e.config.MaxQuantizer = maxQ
+	}
+}
+
+// EncoderVBVBufferSize sets the size of the rate control buffer in time at
+// the target rate.
+func EncoderVBVBufferSize(size time.Duration) EncoderOption {
+	return func(e *Encoder) {
+		e.config.VBVBufferSize = size
+	}
+}
+
+// EncoderErrorResilience enables or disables the error resilient mode of
+// encoders that support it. Default: enabled.
+func EncoderErrorResilience(enabled bool) EncoderOption {
+	return func(e *Encoder) {
+		e.config.DisableErrorResilience = !enabled
 	}
-	return fdVal, nil
 }
 
 type Encoder struct {
-	vpxEnc  *codec.VPXEncoder
-	x264Enc *codec.X264encoder
+	lock    sync.Mutex
+	encoder codec.VideoEncoder
 
-	codec codec.CodecType
+	// config holds the encoder settings, Link sets the format.
+	config codec.Config
 }
 
-func NewEncoder(codec codec.CodecType) *Encoder {
-	return &Encoder{
-		codec: codec,
+func NewEncoder(codec mrtp.Codec, opts ...EncoderOption) *Encoder {
+	e := &Encoder{}
+	e.config.Codec = codec
+	e.config.TargetRate = 750_000
+	for _, opt := range opts {
+		opt(e)
 	}
+	return e
 }
 
 func (e *Encoder) Link(f Sink, i Info) (Sink, error) {
-	conf := codec.Config{
-		Codec:       e.codec,
-		Width:       i.Width,
-		Height:      i.Height,
-		TargetRate:  750_000,
-		TimebaseNum: i.TimebaseNum,
-		TimebaseDen: i.TimebaseDen,
-	}
-	switch e.codec {
-	case codec.VP8, codec.VP9:
-		enc, err := codec.NewVPXEncoder(conf)
-		if err != nil {
-			return nil, err
-		}
-		e.vpxEnc = enc
-	case codec.H264:
-		enc, err := codec.NewX264encoder(conf)
-		if err != nil {
-			return nil, err
-		}
-		e.x264Enc = enc
-	default:
-		return nil, fmt.Errorf("unsupported codec: %v", e.codec)
+	e.config.Width = i.Width
+	e.config.Height = i.Height
+	e.config.TimebaseNum = i.TimebaseNum
+	e.config.TimebaseDen = i.TimebaseDen
+	if err := e.open(); err != nil {
+		return nil, err
 	}
 
 	frameCount := 0 // logging: plot script requires this field
 
+	// img wraps the planes of the current frame
+	img := &image.YCbCr{}
+
 	return WriterFunc(func(b []byte, a Attributes) error {
 		frameDuration, err := getFrameDuration(a)
 		if err != nil {
@@ -80,55 +134,138 @@ func (e *Encoder) Link(f Sink, i Info) (Sink, error) {
 		if err != nil {
 			return err
 		}
-		image := image.NewYCbCr(
-			image.Rect(0, 0, int(i.Width), int(i.Height)),
-			csr,
-		)
-
-		ySize := i.Width * i.Height
-		uSize := ySize / 4
-		image.Y = b[:ySize]
-		image.Cb = b[ySize : ySize+uSize]
-		image.Cr = b[ySize+uSize:]
-
-		var encoded *codec.Frame
-		if e.vpxEnc != nil {
-			encoded, err = e.vpxEnc.Encode(image, pts, frameDuration)
-			if err != nil {
-				return err
-			}
-		} else if e.x264Enc != nil {
-			encoded, err = e.x264Enc.Encode(image)
-			if err != nil {
-				return err
-			}
+		pixelFormat, err := codec.PixelFormatOf(csr)
+		if err != nil {
+			return fmt.Errorf("encoder: %w, convert frames with a ChromaConverter", err)
+		}
+		if !codec.SupportsPixelFormat(e.config.Codec, pixelFormat) {
+			return fmt.Errorf("encoder: %v does not support pixel format %v, convert frames with a ChromaConverter", e.config.Codec, pixelFormat)
+		}
+		// frames that carry their size, e.g. from a Scaler, may change the
+		// resolution
+		width, err := getWidth(a)
+		if err != nil {
+			width = int(i.Width)
+		}
+		height, err := getHeight(a)
+		if err != nil {
+			height = int(i.Height)
+		}
+		if len(b) < codec.FrameSize(width, height, csr) {
+			return fmt.Errorf("encoder: frame too short for %vx%v %v: %v bytes", width, height, pixelFormat, len(b))
+		}
+		if err = e.reconfigure(uint(width), uint(height), pixelFormat); err != nil {
+			return err
+		}
+
+		ySize := width * height
+		cWidth, cHeight := codec.ChromaSize(width, height, csr)
+		cSize := cWidth * cHeight
+		*img = image.YCbCr{
+			Y:              b[:ySize],
+			Cb:             b[ySize : ySize+cSize],
+			Cr:             b[ySize+cSize : ySize+2*cSize],
+			YStride:        width,
+			CStride:        cWidth,
+			SubsampleRatio: csr,
+			Rect:           image.Rect(0, 0, width, height),
 		}
 
-		slog.Info("encoder src", "length", len(encoded.Payload), "pts", pts, "duration", frameDuration.Microseconds(), "keyframe", encoded.IsKeyFrame, "frame-count", frameCount)
+		e.lock.Lock()
+		encoded, err := e.encoder.Encode(img, pts, frameDuration)
+		e.lock.Unlock()
+		if err != nil {
+			return err
+		}
+
+		slog.Info("encoder src", "length", len(encoded.Payload), "pts", pts, "duration", frameDuration.Microseconds(), "keyframe", encoded.IsKeyFrame, "temporal-layer", encoded.TemporalLayerID, "frame-count", frameCount)
 		frameCount++
 
 		a[IsKeyFrame] = encoded.IsKeyFrame
+		a[TemporalLayerID] = encoded.TemporalLayerID
+		if encoded.SpatialLayerSizes != nil {
+			a[SpatialLayerSizes] = encoded.SpatialLayerSizes
+		}
 		return f.Write(encoded.Payload, a)
 	}), nil
 }
 
+func (e *Encoder) open() error {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	enc, err := codec.NewEncoder(e.config)
+	if err != nil {
+		return err
+	}
+	e.encoder = enc
+	return nil
+}
+
+// reconfigure replaces the encoder by a new one for frames of width x height
+// in pixelFormat if the format changed. The new encoder starts at the current
+// target rate with a keyframe.
+func (e *Encoder) reconfigure(width, height uint, pixelFormat codec.PixelFormat) error {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	if width == e.config.Width && height == e.config.Height && pixelFormat == e.config.PixelFormat {
+		return nil
+	}
+	slog.Info("ENCODER_RECONFIGURE", "width", width, "height", height, "pixel-format", pixelFormat)
+	if err := e.encoder.Close(); err != nil {
+		return err
+	}
+	e.config.Width = width
+	e.config.Height = height
+	e.config.PixelFormat = pixelFormat
+	enc, err := codec.NewEncoder(e.config)
+	if err != nil {
+		return err
+	}
+	e.encoder = enc
+	return nil
+}
+
 func (e *Encoder) SetTargetRate(targetRate uint64) {
 	// reduce target rate
 	targetRate = uint64(0.9 * float64(targetRate))
 	slog.Info("NEW_TARGET_MEDIA_RATE", "rate", targetRate)
 
-	if e.vpxEnc != nil {
-		e.vpxEnc.SetTargetRate(targetRate)
-	} else if e.x264Enc != nil {
-		e.x264Enc.SetTargetRate(targetRate)
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	// keep the rate for encoders created on resolution changes
+	e.config.TargetRate = targetRate
+	if e.encoder != nil {
+		e.encoder.SetTargetRate(targetRate)
+	}
+}
+
+// Codec returns the codec of the encoded frames.
+func (e *Encoder) Codec() mrtp.Codec {
+	return e.config.Codec
+}
+
+// ForceKeyFrame makes the encoder emit a keyframe for the next frame, e.g.
+// in response to a keyframe request of the receiver.
+func (e *Encoder) ForceKeyFrame() {
+	slog.Info("FORCE_KEY_FRAME")
+
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	if e.encoder != nil {
+		e.encoder.ForceKeyFrame()
 	}
 }
 
 func (e *Encoder) Close() error {
-	if e.vpxEnc != nil {
-		return e.vpxEnc.Close()
-	} else if e.x264Enc != nil {
-		return e.x264Enc.Close()
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	if e.encoder != nil {
+		return e.encoder.Close()
 	}
 	return nil
 }
@@ -0,0 +1,68 @@
+//go:build cgo
+
+package gopipe
+
+import (
+	"image"
+	"testing"
+	"time"
+
+	"github.com/mengelbart/mrtp"
+	"github.com/mengelbart/mrtp/gopipe/codec"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncoderOptions(t *testing.T) {
+	e := NewEncoder(mrtp.VP8)
+	assert.Equal(t, codec.Config{Codec: mrtp.VP8, TargetRate: 750_000}, e.config)
+
+	e = NewEncoder(
+		mrtp.H264,
+		EncoderInitialRate(1_000_000),
+		EncoderPreset("veryfast"),
+		EncoderThreads(2),
+		EncoderKeyFrameInterval(120),
+		EncoderQuantizerRange(20, 40),
+		EncoderVBVBufferSize(500*time.Millisecond),
+		EncoderErrorResilience(false),
+		EncoderPixelFormat(codec.PixelFormatI444),
+	)
+	assert.Equal(t, codec.Config{
+		Codec:                  mrtp.H264,
+		PixelFormat:            codec.PixelFormatI444,
+		TargetRate:             1_000_000,
+		Preset:                 "veryfast",
+		Threads:                2,
+		KeyFrameInterval:       120,
+		MinQuantizer:           20,
+		MaxQuantizer:           40,
+		VBVBufferSize:          500 * time.Millisecond,
+		DisableErrorResilience: true,
+	}, e.config)
+}
+
+func BenchmarkEncoder(b *testing.B) {
+	for _, c := range []mrtp.Codec{mrtp.VP8, mrtp.H264} {
+		b.Run(c.String(), func(b *testing.B) {
+			sink := WriterFunc(func([]byte, Attributes) error { return nil })
+			info := Info{Width: 320, Height: 240, TimebaseNum: 30, TimebaseDen: 1}
+			w, err := NewEncoder(c).Link(sink, info)
+			require.NoError(b, err)
+
+			frame := make([]byte, codec.FrameSize(320, 240, image.YCbCrSubsampleRatio420))
+			pts := int64(0)
+
+			b.ReportAllocs()
+			for b.Loop() {
+				attrs := Attributes{
+					PTS:               pts,
+					FrameDuration:     33 * time.Millisecond,
+					ChromaSubsampling: image.YCbCrSubsampleRatio420,
+				}
+				require.NoError(b, w.Write(frame, attrs))
+				pts += 33_000
+			}
+		})
+	}
+}
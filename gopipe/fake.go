@@ -2,6 +2,7 @@ package gopipe
 
 import (
 	"context"
+	"errors"
 	"log/slog"
 	"sync"
 	"time"
@@ -24,8 +25,38 @@ func (a *FakeSink) Write(b []byte, attrs Attributes) error {
 	return nil
 }
 
-// FakeSource implements a simple codec that produces frames at a constant rate
-// with sizes exactly matching the target bitrate.
+// FakeSourceOption configures a [FakeSource].
+type FakeSourceOption func(*FakeSource)
+
+// FakeSourceModel sets the model that generates the frames. Default: a
+// [ConstantModel]. A [StatisticalModel] or [TraceModel] produces frames with
+// the size variations of a real encoder.
+func FakeSourceModel(model FrameSizeModel) FakeSourceOption {
+	return func(s *FakeSource) {
+		s.model = model
+	}
+}
+
+// FakeSourceFrameRate sets the frame rate, which must be positive. Default:
+// 30.
+func FakeSourceFrameRate(fps int) FakeSourceOption {
+	return func(s *FakeSource) {
+		s.fps = fps
+	}
+}
+
+// FakeSourceResolution sets the resolution reported by GetInfo. Default:
+// 1920x1080.
+func FakeSourceResolution(width, height uint) FakeSourceOption {
+	return func(s *FakeSource) {
+		s.width = width
+		s.height = height
+	}
+}
+
+// FakeSource implements a synthetic codec that produces frames at a constant
+// frame rate with sizes generated by a FrameSizeModel. It allows to run
+// simulations without cgo codecs.
 type FakeSource struct {
 	logger logging.LeveledLogger
 
@@ -33,6 +64,9 @@ type FakeSource struct {
 	maxTargetRateBps int
 	targetBitrateBps int
 	fps              int
+	width            uint
+	height           uint
+	model            FrameSizeModel
 	bitrateUpdateCh  chan int
 
 	done chan struct{}
@@ -42,25 +76,37 @@ type FakeSource struct {
 }
 
 // NewFakeSource creates a new FakeSource with the specified target bitrate.
-func NewFakeSource(runTime time.Duration, minTargetRateBps, maxTargetRateBps, initTargetBitrateBps int) *FakeSource {
-	return &FakeSource{
+func NewFakeSource(runTime time.Duration, minTargetRateBps, maxTargetRateBps, initTargetBitrateBps int, opts ...FakeSourceOption) (*FakeSource, error) {
+	s := &FakeSource{
 		logger:           logging.NewDefaultLoggerFactory().NewLogger("perfect_codec"),
 		minTargetRateBps: minTargetRateBps,
 		maxTargetRateBps: maxTargetRateBps,
 		targetBitrateBps: initTargetBitrateBps,
 		fps:              30,
+		width:            1920,
+		height:           1080,
 		bitrateUpdateCh:  make(chan int),
 		done:             make(chan struct{}),
 		wg:               sync.WaitGroup{},
 		runTime:          runTime,
 	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.fps <= 0 {
+		return nil, errors.New("frame rate must be positive")
+	}
+	if s.model == nil {
+		s.model = &ConstantModel{}
+	}
+	return s, nil
 }
 
 func (s *FakeSource) GetInfo() Info {
 	return Info{
-		Width:       1920,
-		Height:      1080,
-		TimebaseNum: 30,
+		Width:       s.width,
+		Height:      s.height,
+		TimebaseNum: s.fps,
 		TimebaseDen: 1,
 	}
 }
@@ -81,8 +127,7 @@ func (c *FakeSource) SetTargetRate(targetRate uint64) {
 
 // Start begins the codec operation, generating frames at the configured frame rate.
 func (c *FakeSource) StartLive(ctx context.Context, pipeline Sink) error {
-	fps := float64(30) / float64(1)
-	msToNextFrame := time.Duration(float64(time.Second) / fps)
+	msToNextFrame := time.Second / time.Duration(c.fps)
 
 	maxFrame := c.runTime / msToNextFrame
 	FrameCount := 0
@@ -90,6 +135,9 @@ func (c *FakeSource) StartLive(ctx context.Context, pipeline Sink) error {
 	pts := int64(0)
 	ticker := time.NewTicker(msToNextFrame)
 
+	// sinks only borrow frames, so all frames share one buffer
+	var buf []byte
+
 	defer ticker.Stop()
 	for {
 		select {
@@ -102,13 +150,18 @@ func (c *FakeSource) StartLive(ctx context.Context, pipeline Sink) error {
 			}
 			FrameCount++
 
-			size := c.targetBitrateBps / (8.0 * c.fps)
-			buf := make([]byte, size)
+			size, keyFrame := c.model.NextFrame(c.targetBitrateBps, msToNextFrame)
+			if cap(buf) < size {
+				buf = make([]byte, size)
+			}
+			buf = buf[:size]
 
 			attr := Attributes{}
 			attr[PTS] = pts
 			attr[FrameDuration] = msToNextFrame
+			attr[IsKeyFrame] = keyFrame
 
+			slog.Info("encoder src", "length", size, "pts", pts, "duration", msToNextFrame.Microseconds(), "keyframe", keyFrame, "frame-count", FrameCount-1)
 			pts += msToNextFrame.Microseconds()
 
 			err := pipeline.Write(buf, attr)
@@ -0,0 +1,113 @@
+package gopipe
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// FrameDropperOption configures a [FrameDropper].
+type FrameDropperOption func(*FrameDropper)
+
+// FrameDropperWindow sets the size of the leaky bucket in time at the target
+// rate, i.e. how much the encoder output may exceed the target rate before
+// frames are dropped. Default: 500ms.
+func FrameDropperWindow(window time.Duration) FrameDropperOption {
+	return func(d *FrameDropper) {
+		d.window = window
+	}
+}
+
+// FrameDropper drops raw frames in front of the encoder while the encoder
+// output exceeds the target rate, similar to the frame dropper of WebRTC. It
+// keeps a leaky bucket that the encoded frames fill and that drains at the
+// target rate. Input frames are dropped while the bucket holds more than the
+// window. The dropper is linked in front of the encoder, the processor
+// returned by Monitor behind it. Dropped frames leave a gap in the PTS, which
+// the [RTPPacketizer] skips in the RTP timestamps.
+type FrameDropper struct {
+	window time.Duration
+
+	lock       sync.Mutex
+	targetRate uint64
+	bucket     float64 // bits
+	dropped    int     // consecutive dropped frames
+}
+
+func NewFrameDropper(opts ...FrameDropperOption) *FrameDropper {
+	d := &FrameDropper{
+		window: 500 * time.Millisecond,
+	}
+	for _, opt := range opts {
+		opt(d)
+	}
+	return d
+}
+
+// SetTargetRate sets the target rate in bits per second. Frames are not
+// dropped before a target rate is set.
+func (d *FrameDropper) SetTargetRate(targetRate uint64) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.targetRate = targetRate
+}
+
+// drop drains the bucket by the bits of frameDuration at the target rate and
+// reports whether the frame with pts is dropped.
+func (d *FrameDropper) drop(pts int64, frameDuration time.Duration) bool {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if d.targetRate == 0 {
+		return false
+	}
+	d.bucket = max(0, d.bucket-float64(d.targetRate)*frameDuration.Seconds())
+	limit := float64(d.targetRate) * d.window.Seconds()
+	if d.bucket > limit {
+		d.dropped++
+		slog.Info("FRAME_DROPPED", "pts", pts, "bucket", int(d.bucket), "target-rate", d.targetRate, "consecutive", d.dropped)
+		return true
+	}
+	d.dropped = 0
+	return false
+}
+
+func (d *FrameDropper) fill(bits int) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.bucket += float64(bits)
+}
+
+// Link returns the sink for raw frames in front of the encoder.
+func (d *FrameDropper) Link(next Sink, i Info) (Sink, error) {
+	fps := float64(i.TimebaseNum) / float64(i.TimebaseDen)
+	defaultFrameDuration := time.Duration(float64(time.Second) / fps)
+	return WriterFunc(func(b []byte, a Attributes) error {
+		frameDuration, err := getFrameDuration(a)
+		if err != nil {
+			frameDuration = defaultFrameDuration
+		}
+		pts, _ := getPTS(a)
+		if d.drop(pts, frameDuration) {
+			return nil
+		}
+		return next.Write(b, a)
+	}), nil
+}
+
+// Monitor returns a processor that measures the size of encoded frames. It
+// is linked behind the encoder.
+func (d *FrameDropper) Monitor() Processor {
+	return frameDropperMonitor{d}
+}
+
+type frameDropperMonitor struct {
+	dropper *FrameDropper
+}
+
+func (m frameDropperMonitor) Link(next Sink, _ Info) (Sink, error) {
+	return WriterFunc(func(b []byte, a Attributes) error {
+		m.dropper.fill(8 * len(b))
+		return next.Write(b, a)
+	}), nil
+}
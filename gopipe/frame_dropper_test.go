@@ -0,0 +1,120 @@
+package gopipe
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mengelbart/mrtp"
+	"github.com/pion/rtp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// linkFrameDropper links dropper around a fake encoder that emits frames of
+// the sizes in bytes returned by frameSize and returns the input sink and the
+// PTS of the encoded frames.
+func linkFrameDropper(t *testing.T, dropper *FrameDropper, frameSize func(int) int) (Sink, *[]int64) {
+	var encoded []int64
+	sink := WriterFunc(func(_ []byte, a Attributes) error {
+		encoded = append(encoded, a[PTS].(int64))
+		return nil
+	})
+	count := 0
+	encoder := processorFunc(func(next Sink, _ Info) (Sink, error) {
+		return WriterFunc(func(_ []byte, a Attributes) error {
+			count++
+			return next.Write(make([]byte, frameSize(count-1)), a)
+		}), nil
+	})
+	w, err := Chain(Info{TimebaseNum: 25, TimebaseDen: 1}, sink, dropper.Monitor(), encoder, dropper)
+	require.NoError(t, err)
+	return w, &encoded
+}
+
+type processorFunc func(Sink, Info) (Sink, error)
+
+func (f processorFunc) Link(s Sink, i Info) (Sink, error) {
+	return f(s, i)
+}
+
+func TestFrameDropper(t *testing.T) {
+	dropper := NewFrameDropper()
+	// a keyframe of one second at the target rate followed by frames that
+	// match the target rate
+	w, encoded := linkFrameDropper(t, dropper, func(i int) int {
+		if i == 0 {
+			return 125_000
+		}
+		return 5_000
+	})
+	dropper.SetTargetRate(1_000_000)
+
+	for i := range 20 {
+		require.NoError(t, w.Write(nil, Attributes{PTS: int64(i), FrameDuration: 40 * time.Millisecond}))
+	}
+	// the keyframe exceeds the window by 500ms, which takes 12.5 frames to
+	// drain
+	assert.Equal(t, []int64{0, 13, 14, 15, 16, 17, 18, 19}, *encoded)
+}
+
+func TestFrameDropperOvershoot(t *testing.T) {
+	dropper := NewFrameDropper(FrameDropperWindow(100 * time.Millisecond))
+	// frames of twice the target rate
+	w, encoded := linkFrameDropper(t, dropper, func(int) int { return 10_000 })
+	dropper.SetTargetRate(1_000_000)
+
+	for i := range 100 {
+		require.NoError(t, w.Write(nil, Attributes{PTS: int64(i)}))
+	}
+	assert.InDelta(t, 50, len(*encoded), 3)
+}
+
+func TestFrameDropperWithoutTargetRate(t *testing.T) {
+	w, encoded := linkFrameDropper(t, NewFrameDropper(), func(int) int { return 1_000_000 })
+	for i := range 10 {
+		require.NoError(t, w.Write(nil, Attributes{PTS: int64(i)}))
+	}
+	assert.Len(t, *encoded, 10)
+}
+
+func TestFrameDropperRTPTimestamps(t *testing.T) {
+	dropper := NewFrameDropper()
+	timestamps := map[int64]uint32{}
+	sink := WriterFunc(func(b []byte, a Attributes) error {
+		pkt := &rtp.Packet{}
+		require.NoError(t, pkt.Unmarshal(b))
+		timestamps[a[PTS].(int64)] = pkt.Timestamp
+		return nil
+	})
+	packetizer := &RTPPacketizerFactory{
+		MTU:       1200,
+		PT:        mrtp.FAKE.PayloadType(),
+		ClockRate: 90_000,
+		Codec:     mrtp.FAKE,
+	}
+	count := 0
+	encoder := processorFunc(func(next Sink, _ Info) (Sink, error) {
+		return WriterFunc(func(_ []byte, a Attributes) error {
+			count++
+			size := 5_000
+			if count == 1 {
+				size = 125_000
+			}
+			return next.Write(make([]byte, size), a)
+		}), nil
+	})
+	w, err := Chain(Info{TimebaseNum: 25, TimebaseDen: 1}, sink, packetizer, dropper.Monitor(), encoder, dropper)
+	require.NoError(t, err)
+	dropper.SetTargetRate(1_000_000)
+
+	for i := range 20 {
+		pts := int64(i) * (40 * time.Millisecond).Microseconds()
+		require.NoError(t, w.Write(nil, Attributes{PTS: pts, FrameDuration: 40 * time.Millisecond}))
+	}
+	// frames 1 to 12 are dropped, the RTP timestamps of the following
+	// frames still match their PTS
+	require.Len(t, timestamps, 8)
+	for pts, ts := range timestamps {
+		assert.Equal(t, uint32(pts*90_000/1_000_000), ts-timestamps[0], "pts %v", pts)
+	}
+}
@@ -0,0 +1,171 @@
+package gopipe
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand/v2"
+	"time"
+)
+
+// FrameSizeModel generates the frames of a [FakeSource].
+type FrameSizeModel interface {
+	// NextFrame returns the size in bytes of the next frame of duration
+	// frameDuration at targetRate bits per second and whether it is a
+	// keyframe.
+	NextFrame(targetRate int, frameDuration time.Duration) (int, bool)
+}
+
+// ConstantModel produces frames with sizes exactly matching the target rate.
+// Only the first frame is a keyframe.
+type ConstantModel struct {
+	started bool
+}
+
+func (m *ConstantModel) NextFrame(targetRate int, frameDuration time.Duration) (int, bool) {
+	keyFrame := !m.started
+	m.started = true
+	return int(bytesPerFrame(float64(targetRate), frameDuration)), keyFrame
+}
+
+func bytesPerFrame(rate float64, frameDuration time.Duration) float64 {
+	return rate * frameDuration.Seconds() / 8
+}
+
+// StatisticalModelConfig configures a [StatisticalModel]. Zero values select
+// the defaults.
+type StatisticalModelConfig struct {
+	// GOPLength is the number of frames from one keyframe to the next.
+	// Default: 150.
+	GOPLength int
+
+	// KeyFrameRatio is the size of keyframes relative to the mean size of
+	// delta frames. Default: 6.
+	KeyFrameRatio float64
+
+	// SizeDeviation is the standard deviation of the logarithm of the frame
+	// sizes. Default: 0.25.
+	SizeDeviation float64
+
+	// ReactionTime is the time constant in which the output rate follows a
+	// new target rate, which models the lag of encoder rate control.
+	// Default: 500ms.
+	ReactionTime time.Duration
+
+	// Seed seeds the random frame size noise.
+	Seed uint64
+}
+
+// StatisticalModel is a video traffic model of a real encoder. It emits a
+// keyframe every GOP, budgets the keyframes in the GOP, so that the mean
+// output rate matches the target rate, and adds lognormal noise to all frame
+// sizes. The output rate follows changes of the target rate with a delay.
+type StatisticalModel struct {
+	gopLength     int
+	keyFrameRatio float64
+	sigma         float64
+	reactionTime  time.Duration
+	rng           *rand.Rand
+
+	frame int
+	rate  float64 // rate of the rate control in bits per second
+}
+
+func NewStatisticalModel(c StatisticalModelConfig) *StatisticalModel {
+	return &StatisticalModel{
+		gopLength:     cmp.Or(c.GOPLength, 150),
+		keyFrameRatio: cmp.Or(c.KeyFrameRatio, 6),
+		sigma:         cmp.Or(c.SizeDeviation, 0.25),
+		reactionTime:  cmp.Or(c.ReactionTime, 500*time.Millisecond),
+		rng:           rand.New(rand.NewPCG(c.Seed, c.Seed)),
+	}
+}
+
+func (m *StatisticalModel) NextFrame(targetRate int, frameDuration time.Duration) (int, bool) {
+	if m.frame == 0 {
+		m.rate = float64(targetRate)
+	} else {
+		// first order lag of the rate control
+		alpha := 1 - math.Exp(-frameDuration.Seconds()/m.reactionTime.Seconds())
+		m.rate += alpha * (float64(targetRate) - m.rate)
+	}
+	keyFrame := m.frame%m.gopLength == 0
+	m.frame++
+
+	// the GOP holds one keyframe and gopLength-1 delta frames
+	n := float64(m.gopLength)
+	size := bytesPerFrame(m.rate, frameDuration) * n / (n - 1 + m.keyFrameRatio)
+	if keyFrame {
+		size *= m.keyFrameRatio
+	}
+	// lognormal noise with mean 1
+	size *= math.Exp(m.sigma*m.rng.NormFloat64() - m.sigma*m.sigma/2)
+	return max(1, int(size)), keyFrame
+}
+
+// TraceModel replays the frame sizes of a recorded encoder. The sizes are
+// scaled by the ratio of the target rate to the mean rate of the trace, so
+// that the output follows the target rate while keeping the frame size
+// pattern of the trace. The trace is repeated when it ends.
+type TraceModel struct {
+	frames   []traceFrame
+	meanSize float64
+	scale    bool
+	next     int
+}
+
+type traceFrame struct {
+	size     int
+	keyFrame bool
+}
+
+// NewTraceModel reads the "encoder src" records of an [Encoder] from a JSON
+// log in r, as written by send-go with JSON logging. Other records are
+// skipped. If scale is false, the sizes are replayed as recorded and the
+// target rate is ignored.
+func NewTraceModel(r io.Reader, scale bool) (*TraceModel, error) {
+	decoder := json.NewDecoder(r)
+	m := &TraceModel{
+		scale: scale,
+	}
+	total := 0
+	for {
+		var record struct {
+			Msg      string `json:"msg"`
+			Length   int    `json:"length"`
+			KeyFrame bool   `json:"keyframe"`
+		}
+		if err := decoder.Decode(&record); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, fmt.Errorf("invalid frame size trace: %w", err)
+		}
+		if record.Msg != "encoder src" {
+			continue
+		}
+		m.frames = append(m.frames, traceFrame{
+			size:     record.Length,
+			keyFrame: record.KeyFrame,
+		})
+		total += record.Length
+	}
+	if len(m.frames) == 0 || total == 0 {
+		return nil, errors.New("invalid frame size trace: no encoded frames")
+	}
+	m.meanSize = float64(total) / float64(len(m.frames))
+	return m, nil
+}
+
+func (m *TraceModel) NextFrame(targetRate int, frameDuration time.Duration) (int, bool) {
+	frame := m.frames[m.next]
+	m.next = (m.next + 1) % len(m.frames)
+	if !m.scale {
+		return frame.size, frame.keyFrame
+	}
+	scale := bytesPerFrame(float64(targetRate), frameDuration) / m.meanSize
+	return max(1, int(float64(frame.size)*scale)), frame.keyFrame
+}
@@ -0,0 +1,124 @@
+package gopipe
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"testing/synctest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testFrameDuration = time.Second / 30
+
+func TestStatisticalModel(t *testing.T) {
+	model := NewStatisticalModel(StatisticalModelConfig{GOPLength: 30, Seed: 1})
+
+	var keyFrames []int
+	total := 0
+	maxDelta := 0
+	for i := range 3000 {
+		size, keyFrame := model.NextFrame(1_000_000, testFrameDuration)
+		if keyFrame {
+			keyFrames = append(keyFrames, i)
+		} else {
+			maxDelta = max(maxDelta, size)
+		}
+		total += size
+	}
+	assert.Len(t, keyFrames, 100)
+	assert.Equal(t, []int{0, 30, 60}, keyFrames[:3])
+
+	// the mean rate matches the target rate
+	rate := float64(8*total) / (3000 * testFrameDuration.Seconds())
+	assert.InEpsilon(t, 1_000_000, rate, 0.02)
+	// delta frames vary in size
+	assert.Greater(t, float64(maxDelta), bytesPerFrame(1_000_000, testFrameDuration))
+}
+
+func TestStatisticalModelReactionTime(t *testing.T) {
+	// no keyframes after the first frame and no noise
+	model := NewStatisticalModel(StatisticalModelConfig{
+		GOPLength:     1_000_000,
+		SizeDeviation: 1e-9,
+		ReactionTime:  time.Second,
+	})
+	model.NextFrame(1_000_000, testFrameDuration)
+	before, _ := model.NextFrame(1_000_000, testFrameDuration)
+
+	after, _ := model.NextFrame(2_000_000, testFrameDuration)
+	assert.Less(t, after, 2*before)
+	assert.Greater(t, after, before)
+
+	// 5 time constants later the rate has converged
+	for range 150 {
+		after, _ = model.NextFrame(2_000_000, testFrameDuration)
+	}
+	assert.InEpsilon(t, 2*before, after, 0.01)
+}
+
+func TestTraceModel(t *testing.T) {
+	trace := strings.Join([]string{
+		`{"level":"INFO","msg":"encoder sink","length":100}`,
+		`{"level":"INFO","msg":"encoder src","length":3000,"keyframe":true}`,
+		`{"level":"INFO","msg":"encoder src","length":1000,"keyframe":false}`,
+		`{"level":"INFO","msg":"encoder src","length":2000,"keyframe":false}`,
+	}, "\n")
+
+	model, err := NewTraceModel(strings.NewReader(trace), false)
+	require.NoError(t, err)
+	for _, want := range []int{3000, 1000, 2000, 3000} {
+		size, keyFrame := model.NextFrame(1_000_000, testFrameDuration)
+		assert.Equal(t, want, size)
+		assert.Equal(t, want == 3000, keyFrame)
+	}
+
+	// 200 kbps at 25 fps are 1000 bytes per frame, half the mean of the
+	// trace
+	model, err = NewTraceModel(strings.NewReader(trace), true)
+	require.NoError(t, err)
+	for _, want := range []int{1500, 500, 1000} {
+		size, _ := model.NextFrame(200_000, 40*time.Millisecond)
+		assert.Equal(t, want, size)
+	}
+
+	_, err = NewTraceModel(strings.NewReader(`{"msg":"encoder sink","length":100}`), false)
+	assert.Error(t, err)
+	_, err = NewTraceModel(strings.NewReader("level=INFO msg=\"encoder src\""), false)
+	assert.Error(t, err)
+}
+
+func TestFakeSource(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		// the constant model is the default
+		source, err := NewFakeSource(
+			time.Second, 100_000, 1_000_000, 240_000,
+			FakeSourceFrameRate(25),
+			FakeSourceResolution(640, 480),
+		)
+		require.NoError(t, err)
+		assert.Equal(t, Info{Width: 640, Height: 480, TimebaseNum: 25, TimebaseDen: 1}, source.GetInfo())
+
+		var frames [][]byte
+		var keyFrames []bool
+		sink := WriterFunc(func(b []byte, a Attributes) error {
+			frames = append(frames, bytes.Clone(b))
+			keyFrames = append(keyFrames, a[IsKeyFrame].(bool))
+			return nil
+		})
+		require.NoError(t, source.StartLive(context.Background(), sink))
+		require.NoError(t, source.Close())
+
+		assert.Len(t, frames, 25)
+		assert.Len(t, frames[0], 1200)
+		assert.Equal(t, []bool{true, false}, keyFrames[:2])
+	})
+}
+
+func TestFakeSourceInvalidFrameRate(t *testing.T) {
+	_, err := NewFakeSource(time.Second, 100_000, 1_000_000, 240_000, FakeSourceFrameRate(0))
+	assert.Error(t, err)
+}
@@ -9,22 +9,31 @@ import (
 type packets struct {
 	payloads   [][]byte
 	attributes Attributes
+
+	// flushed marks the end of the stream, it is closed once all packets
+	// before it are sent
+	flushed chan struct{}
 }
 
+// FrameSpacer spreads the packets of a frame over a part of the frame
+// duration. It queues the packets in buffers from a BufferPool and sends them
+// from a goroutine that runs from Start until the context is done or the
+// spacer is closed. Errors of the next sink are posted on the bus.
 type FrameSpacer struct {
 	writer        Sink
 	frameDuration time.Duration
 	pktChan       chan packets
+	pool          *BufferPool
+	bus           *Bus
+	metrics       *ElementMetrics
 
 	ctx    context.Context
 	cancel context.CancelFunc
 }
 
-func NewFrameSpacer(ctx context.Context) *FrameSpacer {
-	spacerCtx, cancel := context.WithCancel(ctx)
+func NewFrameSpacer() *FrameSpacer {
 	return &FrameSpacer{
-		ctx:    spacerCtx,
-		cancel: cancel,
+		pool: NewBufferPool(),
 	}
 }
 
@@ -33,34 +42,66 @@ func (p *FrameSpacer) Link(w Sink, i Info) (Sink, error) {
 	p.writer = w
 	fps := float64(i.TimebaseNum) / float64(i.TimebaseDen)
 	p.frameDuration = time.Duration(float64(time.Second) / fps)
-	go p.run()
 	return p, nil
 }
 
+func (p *FrameSpacer) SetBus(bus *Bus) {
+	p.bus = bus
+}
+
+// SetMetrics reports the number of queued frames to m.
+func (p *FrameSpacer) SetMetrics(m *ElementMetrics) {
+	p.metrics = m
+}
+
+func (p *FrameSpacer) Start(ctx context.Context) error {
+	p.ctx, p.cancel = context.WithCancel(ctx)
+	go p.run()
+	return nil
+}
+
 func (p *FrameSpacer) Write(pkt []byte, attr Attributes) error {
 	return p.writer.Write(pkt, attr)
 }
 
 func (p *FrameSpacer) WriteAll(pkts [][]byte, attr Attributes) error {
 	slog.Info("spacer got packets", "count", len(pkts))
+	// the packets are borrowed, copy them for the queue
+	payloads := make([][]byte, len(pkts))
+	for i, pkt := range pkts {
+		payloads[i] = p.pool.Get(len(pkt))
+		copy(payloads[i], pkt)
+	}
 	p.pktChan <- packets{
-		payloads:   pkts,
+		payloads:   payloads,
 		attributes: attr,
 	}
+	p.metrics.SetQueueDepth(len(p.pktChan))
 	return nil
 }
 
+// send writes pkt to the next sink and returns its buffer to the pool.
+func (p *FrameSpacer) send(pkt []byte, attr Attributes) {
+	if err := p.writer.Write(pkt, attr); err != nil {
+		p.bus.Error(p, err)
+	}
+	p.pool.Put(pkt)
+}
+
 func (p *FrameSpacer) run() {
 	for {
 		select {
 		case <-p.ctx.Done():
 			return
 		case pkts := <-p.pktChan:
+			p.metrics.SetQueueDepth(len(p.pktChan))
+			if pkts.flushed != nil {
+				close(pkts.flushed)
+				continue
+			}
 			if len(p.pktChan) > 2 {
 				for _, pkt := range pkts.payloads {
-					if err := p.writer.Write(pkt, pkts.attributes); err != nil {
-						slog.Error("failed to send packet", "error", err)
-					}
+					p.send(pkt, pkts.attributes)
 				}
 				continue
 			}
@@ -81,14 +122,30 @@ func (p *FrameSpacer) run() {
 					break
 				}
 				next, pkts.payloads = pkts.payloads[0], pkts.payloads[1:]
-				if err := p.writer.Write(next, pkts.attributes); err != nil {
-					slog.Error("failed to send packet", "error", err)
-				}
+				p.send(next, pkts.attributes)
 			}
 		}
 	}
 }
 
+// EndOfStream waits until the queued packets are sent.
+func (p *FrameSpacer) EndOfStream() error {
+	if p.ctx == nil {
+		return nil
+	}
+	flushed := make(chan struct{})
+	select {
+	case p.pktChan <- packets{flushed: flushed}:
+	case <-p.ctx.Done():
+		return nil
+	}
+	select {
+	case <-flushed:
+	case <-p.ctx.Done():
+	}
+	return nil
+}
+
 func (p *FrameSpacer) Close() error {
 	if p.cancel != nil {
 		p.cancel()
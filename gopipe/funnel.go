@@ -0,0 +1,122 @@
+package gopipe
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Funnel merges several branches into one sink. Each branch writes to its own
+// input, the writes of all inputs are serialized, so branches may run in
+// different goroutines, e.g. behind a [Queue] or in different sources.
+type Funnel struct {
+	lock sync.Mutex
+	sink Sink
+}
+
+func NewFunnel(sink Sink) *Funnel {
+	return &Funnel{
+		sink: sink,
+	}
+}
+
+// Input returns a new input of the funnel. Errors of the sink are returned to
+// the branch that wrote the frame.
+func (f *Funnel) Input() Sink {
+	return &funnelInput{
+		write: func(bufs [][]byte, attrs Attributes) error {
+			f.lock.Lock()
+			defer f.lock.Unlock()
+			return writeAll(f.sink, bufs, attrs)
+		},
+	}
+}
+
+// funnelInput is an input of a Funnel or Selector.
+type funnelInput struct {
+	write func([][]byte, Attributes) error
+	buf   [][]byte
+}
+
+func (i *funnelInput) Write(buf []byte, attrs Attributes) error {
+	i.buf = append(i.buf[:0], buf)
+	return i.write(i.buf, attrs)
+}
+
+func (i *funnelInput) WriteAll(bufs [][]byte, attrs Attributes) error {
+	return i.write(bufs, attrs)
+}
+
+// Selector forwards the frames of one of several branches to a sink and drops
+// the frames of all other branches, e.g. to switch between encoders of
+// different resolutions. Like in a [Funnel], the writes of all inputs are
+// serialized.
+type Selector struct {
+	lock    sync.Mutex
+	sink    Sink
+	inputs  int
+	active  int
+	pending int
+}
+
+func NewSelector(sink Sink) *Selector {
+	return &Selector{
+		sink:    sink,
+		pending: -1,
+	}
+}
+
+// Input returns a new input of the selector. Inputs are numbered from 0 in
+// the order of creation, the first input is active.
+func (s *Selector) Input() Sink {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	index := s.inputs
+	s.inputs++
+	return &funnelInput{
+		write: func(bufs [][]byte, attrs Attributes) error {
+			return s.write(index, bufs, attrs)
+		},
+	}
+}
+
+// Select activates the input index. For encoded video, the switch happens at
+// the next keyframe of the input, so the frames behind the selector remain
+// decodable. Frames without IsKeyFrame attribute switch immediately.
+func (s *Selector) Select(index int) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if index < 0 || index >= s.inputs {
+		return fmt.Errorf("selector has no input %v", index)
+	}
+	if index == s.active {
+		s.pending = -1
+		return nil
+	}
+	s.pending = index
+	return nil
+}
+
+// Active returns the index of the input that is forwarded.
+func (s *Selector) Active() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.active
+}
+
+func (s *Selector) write(index int, bufs [][]byte, attrs Attributes) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if index == s.pending {
+		if keyFrame, ok := attrs[IsKeyFrame].(bool); !ok || keyFrame {
+			s.active = index
+			s.pending = -1
+		}
+	}
+	if index != s.active {
+		return nil
+	}
+	return writeAll(s.sink, bufs, attrs)
+}
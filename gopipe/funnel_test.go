@@ -0,0 +1,61 @@
+package gopipe
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFunnel(t *testing.T) {
+	var sink recordingSink
+	f := NewFunnel(&sink)
+
+	var wg sync.WaitGroup
+	for i := range 4 {
+		in := f.Input()
+		wg.Go(func() {
+			for range 100 {
+				assert.NoError(t, in.Write([]byte{byte(i)}, Attributes{}))
+			}
+		})
+	}
+	wg.Wait()
+	assert.Len(t, sink.frames, 400)
+
+	require.NoError(t, f.Input().(MultiWriter).WriteAll([][]byte{{1}, {2}}, Attributes{}))
+	assert.Equal(t, []byte{1, 2}, sink.frames[400])
+	assert.Equal(t, 401, sink.writes)
+}
+
+func TestSelector(t *testing.T) {
+	var sink recordingSink
+	s := NewSelector(&sink)
+	a, b := s.Input(), s.Input()
+	frame := func(in Sink, v byte, keyFrame bool) {
+		require.NoError(t, in.Write([]byte{v}, Attributes{IsKeyFrame: keyFrame}))
+	}
+
+	frame(a, 1, true)
+	frame(b, 2, true)
+	assert.Equal(t, [][]byte{{1}}, sink.frames)
+
+	// the switch waits for a keyframe of b
+	require.NoError(t, s.Select(1))
+	frame(b, 3, false)
+	frame(a, 4, false)
+	assert.Equal(t, 0, s.Active())
+	frame(b, 5, true)
+	frame(a, 6, false)
+	frame(b, 7, false)
+	assert.Equal(t, 1, s.Active())
+	assert.Equal(t, [][]byte{{1}, {4}, {5}, {7}}, sink.frames)
+
+	// frames without keyframe attribute switch immediately
+	require.NoError(t, s.Select(0))
+	require.NoError(t, a.Write([]byte{8}, Attributes{}))
+	assert.Equal(t, []byte{8}, sink.frames[4])
+
+	assert.Error(t, s.Select(2))
+}
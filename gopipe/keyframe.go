@@ -0,0 +1,131 @@
+package gopipe
+
+import (
+	"io"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/pion/rtcp"
+)
+
+// KeyFrameRequester sends RTCP Picture Loss Indications to request a keyframe
+// from the sender. Requests are rate limited to one per minInterval.
+type KeyFrameRequester struct {
+	writer      io.Writer
+	mediaSSRC   uint32
+	minInterval time.Duration
+
+	lock        sync.Mutex
+	lastRequest time.Time
+}
+
+// NewKeyFrameRequester creates a requester that writes RTCP packets for the
+// stream with SSRC mediaSSRC to w.
+func NewKeyFrameRequester(w io.Writer, mediaSSRC uint32, minInterval time.Duration) *KeyFrameRequester {
+	return &KeyFrameRequester{
+		writer:      w,
+		mediaSSRC:   mediaSSRC,
+		minInterval: minInterval,
+	}
+}
+
+// RequestKeyFrame sends a PLI unless another request was sent less than
+// minInterval ago.
+func (r *KeyFrameRequester) RequestKeyFrame() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	now := time.Now()
+	if !r.lastRequest.IsZero() && now.Sub(r.lastRequest) < r.minInterval {
+		return nil
+	}
+	r.lastRequest = now
+
+	buf, err := rtcp.Marshal([]rtcp.Packet{
+		&rtcp.PictureLossIndication{MediaSSRC: r.mediaSSRC},
+	})
+	if err != nil {
+		return err
+	}
+	slog.Info("sending keyframe request", "media-ssrc", r.mediaSSRC)
+	_, err = r.writer.Write(buf)
+	return err
+}
+
+// KeyFrameForcer is implemented by encoders that can emit a keyframe on
+// request, e.g. [Encoder].
+type KeyFrameForcer interface {
+	ForceKeyFrame()
+}
+
+// KeyFrameHandler forces keyframes when it receives RTCP PLI or FIR packets
+// for its media SSRC. Keyframes are forced at most once per minInterval.
+type KeyFrameHandler struct {
+	encoder     KeyFrameForcer
+	mediaSSRC   uint32
+	minInterval time.Duration
+
+	lock          sync.Mutex
+	lastKeyFrame  time.Time
+	lastFIRSeqNos map[uint32]uint8
+}
+
+func NewKeyFrameHandler(encoder KeyFrameForcer, mediaSSRC uint32, minInterval time.Duration) *KeyFrameHandler {
+	return &KeyFrameHandler{
+		encoder:       encoder,
+		mediaSSRC:     mediaSSRC,
+		minInterval:   minInterval,
+		lastFIRSeqNos: map[uint32]uint8{},
+	}
+}
+
+// HandleRTCP parses a compound RTCP packet and forces a keyframe if it
+// contains a keyframe request. Other RTCP packets are ignored.
+func (h *KeyFrameHandler) HandleRTCP(buf []byte) error {
+	pkts, err := rtcp.Unmarshal(buf)
+	if err != nil {
+		return err
+	}
+	request := false
+	for _, pkt := range pkts {
+		switch p := pkt.(type) {
+		case *rtcp.PictureLossIndication:
+			request = request || p.MediaSSRC == h.mediaSSRC
+		case *rtcp.FullIntraRequest:
+			for _, entry := range p.FIR {
+				if entry.SSRC == h.mediaSSRC && h.isNewFIR(p.SenderSSRC, entry.SequenceNumber) {
+					request = true
+				}
+			}
+		}
+	}
+	if request {
+		h.forceKeyFrame()
+	}
+	return nil
+}
+
+// isNewFIR reports whether seqNr is a new FIR command of sender. Repeated
+// FIRs with the same sequence number are retransmissions (RFC 5104).
+func (h *KeyFrameHandler) isNewFIR(sender uint32, seqNr uint8) bool {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	last, ok := h.lastFIRSeqNos[sender]
+	h.lastFIRSeqNos[sender] = seqNr
+	return !ok || last != seqNr
+}
+
+func (h *KeyFrameHandler) forceKeyFrame() {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	now := time.Now()
+	if !h.lastKeyFrame.IsZero() && now.Sub(h.lastKeyFrame) < h.minInterval {
+		slog.Info("ignoring keyframe request", "since-last", now.Sub(h.lastKeyFrame))
+		return
+	}
+	h.lastKeyFrame = now
+	h.encoder.ForceKeyFrame()
+}
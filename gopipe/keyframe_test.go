@@ -0,0 +1,78 @@
+package gopipe
+
+import (
+	"bytes"
+	"testing"
+	"testing/synctest"
+	"time"
+
+	"github.com/pion/rtcp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type keyFrameCounter int
+
+func (c *keyFrameCounter) ForceKeyFrame() {
+	*c++
+}
+
+func TestKeyFrameRequester(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		var buf bytes.Buffer
+		r := NewKeyFrameRequester(&buf, 42, 500*time.Millisecond)
+
+		require.NoError(t, r.RequestKeyFrame())
+		pkts, err := rtcp.Unmarshal(buf.Bytes())
+		require.NoError(t, err)
+		assert.Equal(t, []rtcp.Packet{&rtcp.PictureLossIndication{MediaSSRC: 42}}, pkts)
+
+		buf.Reset()
+		time.Sleep(100 * time.Millisecond)
+		require.NoError(t, r.RequestKeyFrame())
+		assert.Zero(t, buf.Len())
+
+		time.Sleep(400 * time.Millisecond)
+		require.NoError(t, r.RequestKeyFrame())
+		assert.NotZero(t, buf.Len())
+	})
+}
+
+func TestKeyFrameHandler(t *testing.T) {
+	marshal := func(pkts ...rtcp.Packet) []byte {
+		buf, err := rtcp.Marshal(pkts)
+		require.NoError(t, err)
+		return buf
+	}
+
+	synctest.Test(t, func(t *testing.T) {
+		var counter keyFrameCounter
+		h := NewKeyFrameHandler(&counter, 42, 500*time.Millisecond)
+
+		// PLI for another stream
+		require.NoError(t, h.HandleRTCP(marshal(&rtcp.PictureLossIndication{MediaSSRC: 7})))
+		assert.Equal(t, keyFrameCounter(0), counter)
+
+		require.NoError(t, h.HandleRTCP(marshal(&rtcp.PictureLossIndication{MediaSSRC: 42})))
+		assert.Equal(t, keyFrameCounter(1), counter)
+
+		// rate limited
+		require.NoError(t, h.HandleRTCP(marshal(&rtcp.PictureLossIndication{MediaSSRC: 42})))
+		assert.Equal(t, keyFrameCounter(1), counter)
+
+		time.Sleep(500 * time.Millisecond)
+		fir := &rtcp.FullIntraRequest{
+			SenderSSRC: 1,
+			FIR:        []rtcp.FIREntry{{SSRC: 42, SequenceNumber: 1}},
+		}
+		require.NoError(t, h.HandleRTCP(marshal(fir)))
+		assert.Equal(t, keyFrameCounter(2), counter)
+
+		// retransmitted FIR
+		time.Sleep(500 * time.Millisecond)
+		require.NoError(t, h.HandleRTCP(marshal(fir)))
+		assert.Equal(t, keyFrameCounter(2), counter)
+
+		assert.Error(t, h.HandleRTCP([]byte{1, 2, 3}))
+	})
+}
@@ -0,0 +1,395 @@
+package gopipe
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/mengelbart/mrtp"
+)
+
+// ElementFactory creates a pipeline element from its properties. Elements are
+// a [Source], a [Processor] or a [Sink]. Elements that run goroutines start
+// them in Start, see [Starter].
+type ElementFactory func(ctx context.Context, p *Properties) (any, error)
+
+var elements = map[string]ElementFactory{}
+
+// RegisterElement adds an element to all registries created afterwards. It
+// is meant to be called from init functions.
+func RegisterElement(name string, f ElementFactory) {
+	elements[name] = f
+}
+
+// Registry maps element names to factories. Applications register elements
+// that depend on their state, e.g. network sinks, in their own registry.
+type Registry struct {
+	factories map[string]ElementFactory
+	metrics   *Metrics
+}
+
+// NewRegistry creates a registry with the elements added by
+// [RegisterElement].
+func NewRegistry() *Registry {
+	return &Registry{
+		factories: maps.Clone(elements),
+	}
+}
+
+// Register sets the factory of the element name.
+func (r *Registry) Register(name string, f ElementFactory) {
+	r.factories[name] = f
+}
+
+// Lookup returns the factory of the element name, e.g. to wrap it in an
+// application specific factory.
+func (r *Registry) Lookup(name string) (ElementFactory, bool) {
+	f, ok := r.factories[name]
+	return f, ok
+}
+
+// SetMetrics lets the elements of pipelines parsed afterwards report to m
+// under their name property or element name, see [Metrics]. A nil m disables
+// metrics.
+func (r *Registry) SetMetrics(m *Metrics) {
+	r.metrics = m
+}
+
+// Names returns the sorted names of all elements.
+func (r *Registry) Names() []string {
+	return slices.Sorted(maps.Keys(r.factories))
+}
+
+// ParsePipeline creates a pipeline from desc with the elements added by
+// [RegisterElement], see [Registry.Parse].
+func ParsePipeline(ctx context.Context, desc string) (*Pipeline, error) {
+	return NewRegistry().Parse(ctx, desc)
+}
+
+// Parse creates a pipeline from a description in the spirit of gst-launch:
+// elements are separated by '!' and listed in the direction of the data flow,
+// each element is its name followed by key=value properties. Values
+// containing spaces or '!' are double quoted. For example:
+//
+//	y4msrc location=video.y4m ! vp8enc rate=1000000 ! rtppay mtu=1200 ! spacer ! fakesink
+//
+// The elements are linked like in [NewPipeline]. The property name of any element
+// names it for [Pipeline.Element] and for properties of later elements that
+// refer to it.
+func (r *Registry) Parse(ctx context.Context, desc string) (*Pipeline, error) {
+	descs, err := parseDescription(desc)
+	if err != nil {
+		return nil, err
+	}
+	var elements []any
+	var labels []string
+	names := map[string]any{}
+	for _, d := range descs {
+		label := d.name
+		if name, ok := d.properties["name"]; ok {
+			label = name
+		}
+		labels = append(labels, label)
+		e, err := r.build(ctx, d, elements, names)
+		if err != nil {
+			// close the elements created so far
+			_ = closeElements(elements)
+			return nil, err
+		}
+		elements = append(elements, e)
+	}
+	p, err := newPipeline(elements, labels, r.metrics)
+	if err != nil {
+		_ = closeElements(elements)
+		return nil, err
+	}
+	p.names = names
+	return p, nil
+}
+
+// build creates the element of d behind the elements created so far.
+func (r *Registry) build(ctx context.Context, d elementDescription, elements []any, names map[string]any) (any, error) {
+	f, ok := r.factories[d.name]
+	if !ok {
+		return nil, fmt.Errorf("unknown element: %q", d.name)
+	}
+	name, named := d.properties["name"]
+	delete(d.properties, "name")
+	if _, ok = names[name]; named && ok {
+		return nil, fmt.Errorf("%v: duplicate name %q", d.name, name)
+	}
+
+	props := &Properties{
+		values: d.properties,
+		used:   map[string]bool{},
+		names:  names,
+	}
+	if len(elements) > 0 {
+		props.upstream = elements[len(elements)-1]
+	}
+	e, err := f(ctx, props)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", d.name, err)
+	}
+	if err = props.check(); err != nil {
+		if c, ok := e.(io.Closer); ok {
+			_ = c.Close()
+		}
+		return nil, fmt.Errorf("%v: %w", d.name, err)
+	}
+	if named {
+		names[name] = e
+	}
+	return e, nil
+}
+
+// Properties holds the properties of an element. The getters return the
+// default value for unset properties. The first invalid value is recorded and
+// fails the creation of the element, so factories may check Err only before
+// they allocate resources.
+type Properties struct {
+	values   map[string]string
+	used     map[string]bool
+	names    map[string]any
+	upstream any
+	err      error
+}
+
+func (p *Properties) get(key string) (string, bool) {
+	p.used[key] = true
+	v, ok := p.values[key]
+	return v, ok
+}
+
+func (p *Properties) fail(key, value string, err error) {
+	if p.err == nil {
+		p.err = fmt.Errorf("invalid property %v=%q: %w", key, value, err)
+	}
+}
+
+// Err returns the first invalid property value.
+func (p *Properties) Err() error {
+	return p.err
+}
+
+// check returns Err or an error for unknown properties.
+func (p *Properties) check() error {
+	if p.err != nil {
+		return p.err
+	}
+	for _, key := range slices.Sorted(maps.Keys(p.values)) {
+		if !p.used[key] {
+			return fmt.Errorf("unknown property: %q", key)
+		}
+	}
+	return nil
+}
+
+// Has reports whether the property key is set.
+func (p *Properties) Has(key string) bool {
+	_, ok := p.get(key)
+	return ok
+}
+
+func (p *Properties) String(key, def string) string {
+	if v, ok := p.get(key); ok {
+		return v
+	}
+	return def
+}
+
+// Required returns the value of key and records an error if it is unset.
+func (p *Properties) Required(key string) string {
+	v, ok := p.get(key)
+	if !ok && p.err == nil {
+		p.err = fmt.Errorf("missing property: %q", key)
+	}
+	return v
+}
+
+func (p *Properties) Int(key string, def int) int {
+	v, ok := p.get(key)
+	if !ok {
+		return def
+	}
+	i, err := strconv.Atoi(v)
+	if err != nil {
+		p.fail(key, v, err)
+	}
+	return i
+}
+
+// Uint64 parses the value of key, e.g. a rate in bits per second.
+func (p *Properties) Uint64(key string, def uint64) uint64 {
+	v, ok := p.get(key)
+	if !ok {
+		return def
+	}
+	u, err := strconv.ParseUint(v, 10, 64)
+	if err != nil {
+		p.fail(key, v, err)
+	}
+	return u
+}
+
+func (p *Properties) Float(key string, def float64) float64 {
+	v, ok := p.get(key)
+	if !ok {
+		return def
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		p.fail(key, v, err)
+	}
+	return f
+}
+
+func (p *Properties) Bool(key string, def bool) bool {
+	v, ok := p.get(key)
+	if !ok {
+		return def
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		p.fail(key, v, err)
+	}
+	return b
+}
+
+// Duration parses the value of key with time.ParseDuration, e.g. "150ms".
+func (p *Properties) Duration(key string, def time.Duration) time.Duration {
+	v, ok := p.get(key)
+	if !ok {
+		return def
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		p.fail(key, v, err)
+	}
+	return d
+}
+
+// Codec returns the codec named by key. If key is unset, it returns the codec
+// of the previous element, e.g. an encoder, and records an error if that
+// element has no codec.
+func (p *Properties) Codec(key string) mrtp.Codec {
+	v, ok := p.get(key)
+	if !ok {
+		if e, ok := p.upstream.(interface{ Codec() mrtp.Codec }); ok {
+			return e.Codec()
+		}
+		if p.err == nil {
+			p.err = fmt.Errorf("missing property %q: previous element has no codec", key)
+		}
+		return 0
+	}
+	c, err := mrtp.NewCodec(v)
+	if err != nil {
+		p.fail(key, v, err)
+	}
+	return c
+}
+
+// Element returns the earlier element whose name property is the value of
+// key and records an error if there is none.
+func (p *Properties) Element(key string) any {
+	name := p.Required(key)
+	if p.err != nil {
+		return nil
+	}
+	e, ok := p.names[name]
+	if !ok {
+		p.fail(key, name, errors.New("no earlier element with this name"))
+	}
+	return e
+}
+
+type elementDescription struct {
+	name       string
+	properties map[string]string
+}
+
+// parseDescription splits a pipeline description into its elements.
+func parseDescription(desc string) ([]elementDescription, error) {
+	var descs []elementDescription
+	var fields []string
+	appendElement := func() error {
+		if len(fields) == 0 {
+			return errors.New("empty element in pipeline description")
+		}
+		d := elementDescription{
+			name:       fields[0],
+			properties: map[string]string{},
+		}
+		for _, field := range fields[1:] {
+			key, value, ok := strings.Cut(field, "=")
+			if !ok || len(key) == 0 {
+				return fmt.Errorf("%v: invalid property %q, expected key=value", d.name, field)
+			}
+			if strings.HasPrefix(value, `"`) {
+				var err error
+				if value, err = strconv.Unquote(value); err != nil {
+					return fmt.Errorf("%v: invalid quoted value %v", d.name, value)
+				}
+			}
+			if _, ok := d.properties[key]; ok {
+				return fmt.Errorf("%v: duplicate property %q", d.name, key)
+			}
+			d.properties[key] = value
+		}
+		descs = append(descs, d)
+		fields = fields[:0]
+		return nil
+	}
+
+	var field strings.Builder
+	endField := func() {
+		if field.Len() > 0 {
+			fields = append(fields, field.String())
+			field.Reset()
+		}
+	}
+	quoted := false
+	escaped := false
+	for _, r := range desc {
+		switch {
+		case quoted:
+			field.WriteRune(r)
+			switch {
+			case escaped:
+				escaped = false
+			case r == '\\':
+				escaped = true
+			case r == '"':
+				quoted = false
+			}
+		case r == '"':
+			quoted = true
+			field.WriteRune(r)
+		case r == '!':
+			endField()
+			if err := appendElement(); err != nil {
+				return nil, err
+			}
+		case unicode.IsSpace(r):
+			endField()
+		default:
+			field.WriteRune(r)
+		}
+	}
+	if quoted {
+		return nil, errors.New("unterminated quote in pipeline description")
+	}
+	endField()
+	if err := appendElement(); err != nil {
+		return nil, err
+	}
+	return descs, nil
+}
@@ -0,0 +1,153 @@
+package gopipe
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"testing/synctest"
+	"time"
+
+	"github.com/mengelbart/mrtp"
+	"github.com/pion/rtp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseDescription(t *testing.T) {
+	descs, err := parseDescription(`y4msrc location="my video.y4m" ! vp8enc rate=1000000!rtppay  mtu=1200 ! fakesink`)
+	require.NoError(t, err)
+	assert.Equal(t, []elementDescription{
+		{name: "y4msrc", properties: map[string]string{"location": "my video.y4m"}},
+		{name: "vp8enc", properties: map[string]string{"rate": "1000000"}},
+		{name: "rtppay", properties: map[string]string{"mtu": "1200"}},
+		{name: "fakesink", properties: map[string]string{}},
+	}, descs)
+
+	descs, err = parseDescription(`y4msink location="a \"!\" b"`)
+	require.NoError(t, err)
+	assert.Equal(t, `a "!" b`, descs[0].properties["location"])
+
+	for _, desc := range []string{
+		"",
+		"fakesrc ! ! fakesink",
+		"fakesrc !",
+		"fakesrc rate",
+		"fakesrc =1",
+		"fakesrc rate=1 rate=2",
+		`y4msrc location="video.y4m`,
+	} {
+		_, err = parseDescription(desc)
+		assert.Error(t, err, desc)
+	}
+}
+
+// testCodecElement is a processor that reports codec like an encoder.
+type testCodecElement struct {
+	codec mrtp.Codec
+}
+
+func (e *testCodecElement) Codec() mrtp.Codec {
+	return e.codec
+}
+
+func (e *testCodecElement) Link(next Sink, _ Info) (Sink, error) {
+	return next, nil
+}
+
+func TestParsePipeline(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		var packets []rtp.Packet
+		r := NewRegistry()
+		r.Register("testenc", func(context.Context, *Properties) (any, error) {
+			return &testCodecElement{codec: mrtp.FAKE}, nil
+		})
+		r.Register("testsink", func(context.Context, *Properties) (any, error) {
+			return WriterFunc(func(b []byte, _ Attributes) error {
+				var pkt rtp.Packet
+				require.NoError(t, pkt.Unmarshal(b))
+				packets = append(packets, pkt)
+				return nil
+			}), nil
+		})
+
+		p, err := r.Parse(context.Background(), "fakesrc name=src duration=1s fps=10 width=640 height=480 model=constant rate=96000 ! testenc ! rtppay mtu=1000 ssrc=7 ! testsink")
+		require.NoError(t, err)
+		assert.Equal(t, Info{Width: 640, Height: 480, TimebaseNum: 10, TimebaseDen: 1}, p.Info())
+		assert.Len(t, p.Elements(), 4)
+		src, ok := p.Element("src")
+		require.True(t, ok)
+		assert.IsType(t, &FakeSource{}, src)
+
+		require.NoError(t, p.Run(context.Background()))
+		require.NoError(t, p.Close())
+
+		// 10 frames of 1200 bytes in two packets each
+		require.Len(t, packets, 20)
+		assert.Equal(t, uint32(7), packets[0].SSRC)
+		assert.Equal(t, mrtp.FAKE.PayloadType(), packets[0].PayloadType)
+	})
+}
+
+func TestParsePipelineWithoutSource(t *testing.T) {
+	var frames int
+	r := NewRegistry()
+	r.Register("testsink", func(context.Context, *Properties) (any, error) {
+		return WriterFunc(func([]byte, Attributes) error {
+			frames++
+			return nil
+		}), nil
+	})
+	p, err := r.Parse(context.Background(), "framedrop name=dropper window=1s ! framedropmonitor dropper=dropper ! testsink")
+	require.NoError(t, err)
+	defer p.Close()
+
+	require.NoError(t, p.Start(context.Background()))
+	p.SetTargetRate(8_000)
+	// the first frame fills the bucket beyond the window
+	for i := range 3 {
+		require.NoError(t, p.Write(make([]byte, 2_000), Attributes{PTS: int64(i), FrameDuration: 100 * time.Millisecond}))
+	}
+	assert.Equal(t, 1, frames)
+}
+
+func TestParsePipelineErrors(t *testing.T) {
+	for _, desc := range []string{
+		"nosuchelement ! fakesink",
+		"fakesrc nosuchproperty=1 ! fakesink",
+		"fakesrc fps=thirty ! fakesink",
+		"fakesrc model=nosuchmodel ! fakesink",
+		"fakesrc ! rtppay ! fakesink",
+		"fakesrc ! rtppay codec=FAKE",
+		"fakesrc",
+		"fakesink ! fakesink",
+		"spacer name=a ! spacer name=a ! fakesink",
+		"framedropmonitor dropper=nosuchelement ! fakesink",
+		"y4msink ! fakesink",
+		"queue size=0 ! fakesink",
+	} {
+		_, err := ParsePipeline(context.Background(), desc)
+		assert.Error(t, err, desc)
+	}
+}
+
+func TestParsePipelineClosesElements(t *testing.T) {
+	var calls []string
+	r := NewRegistry()
+	r.Register("testelement", func(_ context.Context, p *Properties) (any, error) {
+		return &lifecycleElement{name: p.String("id", ""), calls: &calls}, nil
+	})
+	r.Register("testfail", func(context.Context, *Properties) (any, error) {
+		return nil, errors.New("failed")
+	})
+
+	// creating an element fails
+	_, err := r.Parse(context.Background(), "testelement id=a ! testfail ! fakesink")
+	assert.Error(t, err)
+	assert.Equal(t, []string{"close a"}, calls)
+
+	// linking fails, the last element is not a sink
+	calls = nil
+	_, err = r.Parse(context.Background(), "testelement id=a ! testelement id=b")
+	assert.Error(t, err)
+	assert.Equal(t, []string{"close a", "close b"}, calls)
+}
@@ -0,0 +1,425 @@
+package gopipe
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxFramesInFlight bounds the number of frames an ElementMetrics keeps to
+// match the outputs to the inputs of an element.
+const maxFramesInFlight = 1024
+
+// MetricsOption configures [Metrics].
+type MetricsOption func(*Metrics)
+
+// MetricsTraceSize sets the number of frames traced per element. Later frames
+// are counted, but not traced. Default: 100000.
+func MetricsTraceSize(size int) MetricsOption {
+	return func(m *Metrics) {
+		m.traceSize = size
+	}
+}
+
+// Metrics collects the metrics of the elements of pipelines, see
+// [NewPipelineWithMetrics]. Snapshots can be taken at any time, the per frame
+// trace is exported at the end of a run, e.g. to read the encoding time,
+// pacing delay or depacketization delay of each frame.
+type Metrics struct {
+	traceSize int
+
+	lock     sync.Mutex
+	elements []*ElementMetrics
+	names    map[string]*ElementMetrics
+}
+
+func NewMetrics(opts ...MetricsOption) *Metrics {
+	m := &Metrics{
+		traceSize: 100_000,
+		names:     map[string]*ElementMetrics{},
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+// Element returns the metrics of the element name.
+func (m *Metrics) Element(name string) *ElementMetrics {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if e, ok := m.names[name]; ok {
+		return e
+	}
+	e := &ElementMetrics{
+		name:      name,
+		traceSize: m.traceSize,
+		frames:    map[int64]*FrameTrace{},
+	}
+	m.elements = append(m.elements, e)
+	m.names[name] = e
+	return e
+}
+
+// newElement returns the metrics of a new element named name, or name with a
+// suffix if the name is taken.
+func (m *Metrics) newElement(name string) *ElementMetrics {
+	m.lock.Lock()
+	unique := name
+	for i := 2; m.names[unique] != nil; i++ {
+		unique = fmt.Sprintf("%v-%v", name, i)
+	}
+	m.lock.Unlock()
+	return m.Element(unique)
+}
+
+func (m *Metrics) all() []*ElementMetrics {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return append([]*ElementMetrics(nil), m.elements...)
+}
+
+// Snapshot returns the current metrics of all elements in the order they
+// were added.
+func (m *Metrics) Snapshot() []ElementSnapshot {
+	var snapshots []ElementSnapshot
+	for _, e := range m.all() {
+		snapshots = append(snapshots, e.Snapshot())
+	}
+	return snapshots
+}
+
+// Trace returns the traced frames of all elements.
+func (m *Metrics) Trace() []FrameTrace {
+	var trace []FrameTrace
+	for _, e := range m.all() {
+		trace = append(trace, e.Trace()...)
+	}
+	return trace
+}
+
+// WriteJSON writes a snapshot and the trace as one JSON object.
+func (m *Metrics) WriteJSON(w io.Writer) error {
+	return json.NewEncoder(w).Encode(struct {
+		Elements []ElementSnapshot `json:"elements"`
+		Frames   []FrameTrace      `json:"frames"`
+	}{
+		Elements: m.Snapshot(),
+		Frames:   m.Trace(),
+	})
+}
+
+// WriteSnapshotCSV writes a snapshot as CSV with one row per element.
+// Latencies are in microseconds.
+func (m *Metrics) WriteSnapshotCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{
+		"element", "frames-in", "frames-out", "bytes-in", "bytes-out",
+		"mean-latency", "min-latency", "max-latency", "queue-depth", "max-queue-depth",
+	}); err != nil {
+		return err
+	}
+	for _, s := range m.Snapshot() {
+		if err := cw.Write([]string{
+			s.Element,
+			strconv.Itoa(s.FramesIn),
+			strconv.Itoa(s.FramesOut),
+			strconv.Itoa(s.BytesIn),
+			strconv.Itoa(s.BytesOut),
+			strconv.FormatInt(s.MeanLatency.Microseconds(), 10),
+			strconv.FormatInt(s.MinLatency.Microseconds(), 10),
+			strconv.FormatInt(s.MaxLatency.Microseconds(), 10),
+			strconv.Itoa(s.QueueDepth),
+			strconv.Itoa(s.MaxQueueDepth),
+		}); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteTraceCSV writes the trace as CSV with one row per element and frame.
+// Times are in microseconds since the Unix epoch, latencies in microseconds.
+func (m *Metrics) WriteTraceCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"element", "pts", "in", "out", "latency", "bytes-in", "bytes-out"}); err != nil {
+		return err
+	}
+	for _, f := range m.Trace() {
+		out := ""
+		if f.Out != 0 {
+			out = strconv.FormatInt(f.Out/1e3, 10)
+		}
+		if err := cw.Write([]string{
+			f.Element,
+			strconv.FormatInt(f.PTS, 10),
+			strconv.FormatInt(f.In/1e3, 10),
+			out,
+			strconv.FormatInt(f.Latency.Microseconds(), 10),
+			strconv.Itoa(f.BytesIn),
+			strconv.Itoa(f.BytesOut),
+		}); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// ElementSnapshot holds the metrics of an element at one point in time.
+// Frames are counted per write, i.e. packetized elements count packets.
+type ElementSnapshot struct {
+	Element   string `json:"element"`
+	FramesIn  int    `json:"frames-in"`
+	FramesOut int    `json:"frames-out"`
+	BytesIn   int    `json:"bytes-in"`
+	BytesOut  int    `json:"bytes-out"`
+
+	// The latency from the input of a frame to each of its outputs.
+	MeanLatency time.Duration `json:"mean-latency"`
+	MinLatency  time.Duration `json:"min-latency"`
+	MaxLatency  time.Duration `json:"max-latency"`
+
+	QueueDepth    int `json:"queue-depth"`
+	MaxQueueDepth int `json:"max-queue-depth"`
+}
+
+// FrameTrace is the path of the frame with PTS PTS through an element.
+// Timestamps are nanoseconds since the Unix epoch, Out is the time of the
+// last output and zero for frames that were not written, e.g. dropped frames.
+type FrameTrace struct {
+	Element  string        `json:"element"`
+	PTS      int64         `json:"pts"`
+	In       int64         `json:"in"`
+	Out      int64         `json:"out,omitempty"`
+	Latency  time.Duration `json:"latency"`
+	BytesIn  int           `json:"bytes-in"`
+	BytesOut int           `json:"bytes-out"`
+}
+
+// MetricsReporter is implemented by elements that report metrics a pipeline
+// cannot observe from the outside, e.g. the depth of a queue.
+type MetricsReporter interface {
+	SetMetrics(*ElementMetrics)
+}
+
+// ElementMetrics collects the metrics of one element. Frames are matched by
+// their PTS attribute, frames without PTS are counted but not traced. All
+// methods may be called on a nil ElementMetrics, which does nothing.
+type ElementMetrics struct {
+	name      string
+	traceSize int
+
+	lock          sync.Mutex
+	framesIn      int
+	framesOut     int
+	bytesIn       int
+	bytesOut      int
+	latencies     int
+	latencySum    time.Duration
+	minLatency    time.Duration
+	maxLatency    time.Duration
+	queueDepth    int
+	maxQueueDepth int
+
+	// frames maps the PTS of the frames in flight to their trace, order
+	// holds their PTS in the order of arrival
+	frames map[int64]*FrameTrace
+	order  []int64
+	trace  []*FrameTrace
+}
+
+// Name returns the name of the element.
+func (m *ElementMetrics) Name() string {
+	return m.name
+}
+
+// FrameIn counts an input of n bytes.
+func (m *ElementMetrics) FrameIn(a Attributes, n int) {
+	if m == nil {
+		return
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.framesIn++
+	m.bytesIn += n
+	if pts, err := getPTS(a); err == nil {
+		m.arrived(pts, n)
+	}
+}
+
+// Arrived marks the arrival of n bytes of the frame pts for elements whose
+// input has no PTS, e.g. depacketizers. Arrivals are not counted as inputs.
+func (m *ElementMetrics) Arrived(pts int64, n int) {
+	if m == nil {
+		return
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.arrived(pts, n)
+}
+
+func (m *ElementMetrics) arrived(pts int64, n int) {
+	if f, ok := m.frames[pts]; ok {
+		f.BytesIn += n
+		return
+	}
+	f := &FrameTrace{
+		Element: m.name,
+		PTS:     pts,
+		In:      time.Now().UnixNano(),
+		BytesIn: n,
+	}
+	m.frames[pts] = f
+	m.order = append(m.order, pts)
+	if len(m.order) > maxFramesInFlight {
+		delete(m.frames, m.order[0])
+		m.order = m.order[1:]
+	}
+	if len(m.trace) < m.traceSize {
+		m.trace = append(m.trace, f)
+	}
+}
+
+// FrameOut counts an output of n bytes and the latency since the input of the
+// frame.
+func (m *ElementMetrics) FrameOut(a Attributes, n int) {
+	if m == nil {
+		return
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.framesOut++
+	m.bytesOut += n
+	pts, err := getPTS(a)
+	if err != nil {
+		return
+	}
+	f, ok := m.frames[pts]
+	if !ok {
+		return
+	}
+	now := time.Now().UnixNano()
+	f.Out = now
+	f.Latency = time.Duration(now - f.In)
+	f.BytesOut += n
+
+	if m.latencies == 0 || f.Latency < m.minLatency {
+		m.minLatency = f.Latency
+	}
+	m.maxLatency = max(m.maxLatency, f.Latency)
+	m.latencySum += f.Latency
+	m.latencies++
+}
+
+// SetQueueDepth sets the number of frames or packets the element holds.
+func (m *ElementMetrics) SetQueueDepth(depth int) {
+	if m == nil {
+		return
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.queueDepth = depth
+	m.maxQueueDepth = max(m.maxQueueDepth, depth)
+}
+
+func (m *ElementMetrics) Snapshot() ElementSnapshot {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	s := ElementSnapshot{
+		Element:       m.name,
+		FramesIn:      m.framesIn,
+		FramesOut:     m.framesOut,
+		BytesIn:       m.bytesIn,
+		BytesOut:      m.bytesOut,
+		MinLatency:    m.minLatency,
+		MaxLatency:    m.maxLatency,
+		QueueDepth:    m.queueDepth,
+		MaxQueueDepth: m.maxQueueDepth,
+	}
+	if m.latencies > 0 {
+		s.MeanLatency = m.latencySum / time.Duration(m.latencies)
+	}
+	return s
+}
+
+// Trace returns the traced frames in the order of their arrival.
+func (m *ElementMetrics) Trace() []FrameTrace {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	trace := make([]FrameTrace, len(m.trace))
+	for i, f := range m.trace {
+		trace[i] = *f
+	}
+	return trace
+}
+
+// elementName returns the name of the type of e without package, e.g.
+// Encoder for *gopipe.Encoder.
+func elementName(e any) string {
+	name := strings.TrimLeft(fmt.Sprintf("%T", e), "*")
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		name = name[i+1:]
+	}
+	return name
+}
+
+// probe is a sink that reports the writes to the next sink to metrics, either
+// as inputs of the element behind it or as outputs of the element in front
+// of it.
+type probe struct {
+	next    Sink
+	metrics *ElementMetrics
+	input   bool
+}
+
+// newProbe returns a probe that implements MultiWriter if next does, so
+// elements in front of it still write frames at once.
+func newProbe(next Sink, metrics *ElementMetrics, input bool) Sink {
+	p := &probe{
+		next:    next,
+		metrics: metrics,
+		input:   input,
+	}
+	if _, ok := next.(MultiWriter); ok {
+		return &multiProbe{probe: p}
+	}
+	return p
+}
+
+func (p *probe) report(a Attributes, n int) {
+	if p.input {
+		p.metrics.FrameIn(a, n)
+	} else {
+		p.metrics.FrameOut(a, n)
+	}
+}
+
+func (p *probe) Write(b []byte, a Attributes) error {
+	p.report(a, len(b))
+	return p.next.Write(b, a)
+}
+
+type multiProbe struct {
+	*probe
+}
+
+func (p *multiProbe) WriteAll(bufs [][]byte, a Attributes) error {
+	n := 0
+	for _, b := range bufs {
+		n += len(b)
+	}
+	p.report(a, n)
+	return p.next.(MultiWriter).WriteAll(bufs, a)
+}
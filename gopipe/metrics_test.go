@@ -0,0 +1,172 @@
+package gopipe
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"testing"
+	"testing/synctest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestElementMetrics(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		m := NewMetrics(MetricsTraceSize(2)).Element("encoder")
+
+		for pts := range int64(3) {
+			m.FrameIn(Attributes{PTS: pts}, 1000)
+			time.Sleep(time.Duration(pts+1) * time.Millisecond)
+			m.FrameOut(Attributes{PTS: pts}, 100)
+		}
+		// frames without PTS are counted only
+		m.FrameIn(Attributes{}, 1000)
+		m.SetQueueDepth(3)
+		m.SetQueueDepth(1)
+
+		assert.Equal(t, ElementSnapshot{
+			Element:       "encoder",
+			FramesIn:      4,
+			FramesOut:     3,
+			BytesIn:       4000,
+			BytesOut:      300,
+			MeanLatency:   2 * time.Millisecond,
+			MinLatency:    time.Millisecond,
+			MaxLatency:    3 * time.Millisecond,
+			QueueDepth:    1,
+			MaxQueueDepth: 3,
+		}, m.Snapshot())
+
+		trace := m.Trace()
+		require.Len(t, trace, 2)
+		assert.Equal(t, FrameTrace{
+			Element:  "encoder",
+			PTS:      1,
+			In:       trace[1].In,
+			Out:      trace[1].In + 2e6,
+			Latency:  2 * time.Millisecond,
+			BytesIn:  1000,
+			BytesOut: 100,
+		}, trace[1])
+
+		// nil metrics do nothing
+		var nilMetrics *ElementMetrics
+		nilMetrics.FrameIn(Attributes{PTS: int64(0)}, 1)
+		nilMetrics.Arrived(0, 1)
+		nilMetrics.FrameOut(Attributes{PTS: int64(0)}, 1)
+		nilMetrics.SetQueueDepth(1)
+	})
+}
+
+func TestElementMetricsArrived(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		m := NewMetrics().Element("depacketizer")
+
+		// the packets of a frame without PTS attribute
+		m.FrameIn(Attributes{}, 100)
+		m.Arrived(3000, 100)
+		time.Sleep(10 * time.Millisecond)
+		m.FrameIn(Attributes{}, 50)
+		m.Arrived(3000, 50)
+		m.FrameOut(Attributes{PTS: int64(3000)}, 120)
+
+		trace := m.Trace()
+		require.Len(t, trace, 1)
+		assert.Equal(t, 10*time.Millisecond, trace[0].Latency)
+		assert.Equal(t, 150, trace[0].BytesIn)
+		assert.Equal(t, 2, m.Snapshot().FramesIn)
+	})
+}
+
+func TestPipelineMetrics(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		encoder := processorFunc(func(next Sink, _ Info) (Sink, error) {
+			return WriterFunc(func(b []byte, a Attributes) error {
+				time.Sleep(5 * time.Millisecond)
+				return next.Write(b[:100], a)
+			}), nil
+		})
+		var sink recordingSink
+		m := NewMetrics()
+		p, err := NewPipelineWithMetrics(m, newTestSource(t, time.Second), encoder, NewQueue(), &sink)
+		require.NoError(t, err)
+		require.NoError(t, p.Run(context.Background()))
+		require.NoError(t, p.Close())
+
+		snapshots := m.Snapshot()
+		require.Len(t, snapshots, 4)
+		assert.Equal(t, ElementSnapshot{Element: "FakeSource", FramesOut: 10, BytesOut: 12_000}, snapshots[0])
+		assert.Equal(t, ElementSnapshot{
+			Element:     "processorFunc",
+			FramesIn:    10,
+			FramesOut:   10,
+			BytesIn:     12_000,
+			BytesOut:    1000,
+			MeanLatency: 5 * time.Millisecond,
+			MinLatency:  5 * time.Millisecond,
+			MaxLatency:  5 * time.Millisecond,
+		}, snapshots[1])
+		assert.Equal(t, "Queue", snapshots[2].Element)
+		assert.Equal(t, 10, snapshots[2].FramesOut)
+		assert.Equal(t, ElementSnapshot{Element: "recordingSink", FramesIn: 10, BytesIn: 1000}, snapshots[3])
+
+		var out bytes.Buffer
+		require.NoError(t, m.WriteJSON(&out))
+		var export struct {
+			Elements []ElementSnapshot `json:"elements"`
+			Frames   []FrameTrace      `json:"frames"`
+		}
+		require.NoError(t, json.Unmarshal(out.Bytes(), &export))
+		assert.Equal(t, snapshots, export.Elements)
+		// the traces of the encoder, the queue and the sink
+		assert.Len(t, export.Frames, 30)
+		assert.Equal(t, m.Trace(), export.Frames)
+
+		out.Reset()
+		require.NoError(t, m.WriteTraceCSV(&out))
+		records, err := csv.NewReader(&out).ReadAll()
+		require.NoError(t, err)
+		require.Len(t, records, 31)
+		assert.Equal(t, []string{"processorFunc", "0"}, records[1][:2])
+		assert.Equal(t, "5000", records[1][4])
+
+		out.Reset()
+		require.NoError(t, m.WriteSnapshotCSV(&out))
+		records, err = csv.NewReader(&out).ReadAll()
+		require.NoError(t, err)
+		require.Len(t, records, 5)
+		assert.Equal(t, []string{"processorFunc", "10", "10", "12000", "1000", "5000", "5000", "5000", "0", "0"}, records[2])
+	})
+}
+
+func TestParsePipelineMetrics(t *testing.T) {
+	r := NewRegistry()
+	m := NewMetrics()
+	r.SetMetrics(m)
+	p, err := r.Parse(context.Background(), "queue ! queue name=second ! queue ! fakesink")
+	require.NoError(t, err)
+	require.NoError(t, p.Close())
+
+	var names []string
+	for _, s := range m.Snapshot() {
+		names = append(names, s.Element)
+	}
+	assert.Equal(t, []string{"queue", "second", "queue-2", "fakesink"}, names)
+}
+
+func TestProbeMultiWriter(t *testing.T) {
+	var sink recordingSink
+	m := NewMetrics().Element("sink")
+	probe := newProbe(&sink, m, true)
+	w, ok := probe.(MultiWriter)
+	require.True(t, ok)
+	require.NoError(t, w.WriteAll([][]byte{{1}, {2, 3}}, Attributes{}))
+	assert.Equal(t, 1, sink.writes)
+	assert.Equal(t, 3, m.Snapshot().BytesIn)
+
+	_, ok = newProbe(WriterFunc(sink.Write), m, true).(MultiWriter)
+	assert.False(t, ok)
+}
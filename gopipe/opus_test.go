@@ -0,0 +1,86 @@
+//go:build cgo
+
+package gopipe
+
+import (
+	"context"
+	"encoding/binary"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/synctest"
+	"time"
+
+	"github.com/mengelbart/mrtp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpusWithRTP(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sine.wav")
+
+	// two seconds of a 440Hz sine
+	sink, err := NewWAVSink(path, 48_000, 2)
+	require.NoError(t, err)
+	pcm := make([]byte, 0, 2*48_000*4)
+	for i := range 2 * 48_000 {
+		sample := uint16(int16(8000 * math.Sin(2*math.Pi*440*float64(i)/48_000)))
+		pcm = binary.LittleEndian.AppendUint16(pcm, sample)
+		pcm = binary.LittleEndian.AppendUint16(pcm, sample)
+	}
+	require.NoError(t, sink.Write(pcm, nil))
+	require.NoError(t, sink.Close())
+
+	synctest.Test(t, func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+
+		framesReceived := 0
+		samplesReceived := 0
+
+		decoder, err := NewAudioDecoder(mrtp.OPUS, 48_000, 2)
+		require.NoError(t, err)
+		pcmSink := WriterFunc(func(b []byte, _ Attributes) error {
+			framesReceived++
+			samplesReceived += len(b) / 4
+			return nil
+		})
+
+		depacketizer, err := NewRTPDepacketizer(10*time.Millisecond, mrtp.OPUS)
+		require.NoError(t, err)
+		receiver, err := NewPipeline(depacketizer, decoder, pcmSink)
+		require.NoError(t, err)
+		require.NoError(t, receiver.Start(ctx))
+
+		file, err := os.Open(path)
+		require.NoError(t, err)
+		defer func() {
+			assert.NoError(t, file.Close())
+		}()
+
+		src, err := NewWAVSource(file, 20*time.Millisecond)
+		require.NoError(t, err)
+
+		encoder := NewAudioEncoder(mrtp.OPUS, 64_000)
+		packetizer := &RTPPacketizerFactory{
+			MTU:       1420,
+			PT:        mrtp.OPUS.PayloadType(),
+			SSRC:      0,
+			ClockRate: uint32(mrtp.OPUS.ClockRate()),
+			Codec:     mrtp.OPUS,
+		}
+		// the sender owns the receiver and closes it with itself
+		sender, err := NewPipeline(src, encoder, packetizer, receiver)
+		require.NoError(t, err)
+
+		require.NoError(t, sender.Run(ctx))
+		time.Sleep(100 * time.Millisecond)
+
+		assert.Equal(t, 100, framesReceived)
+		assert.Equal(t, 2*48_000, samplesReceived)
+
+		assert.NoError(t, sender.Close())
+		cancel()
+		synctest.Wait()
+	})
+}
@@ -1,12 +1,29 @@
 package gopipe
 
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"sync"
+)
+
 type Info struct {
 	Width       uint
 	Height      uint
 	TimebaseNum int
 	TimebaseDen int
+
+	// SampleRate and Channels describe audio streams.
+	SampleRate int
+	Channels   int
 }
 
+// Sink consumes the buffers of a pipeline. Buffers passed to Write are only
+// borrowed for the duration of the call: the caller may reuse a buffer as soon
+// as Write returns, so sinks that keep data, e.g. in a queue, must copy it.
+// Sinks may modify the buffer in place.
 type Sink interface {
 	Write([]byte, Attributes) error
 }
@@ -17,6 +34,8 @@ func (f WriterFunc) Write(b []byte, a Attributes) error {
 	return f(b, a)
 }
 
+// MultiWriter is a Sink that takes all packets of a frame at once. The
+// buffers are borrowed like in Write.
 type MultiWriter interface {
 	Sink
 	WriteAll([][]byte, Attributes) error
@@ -26,6 +45,32 @@ type Processor interface {
 	Link(Sink, Info) (Sink, error)
 }
 
+// Source produces the data of a pipeline.
+type Source interface {
+	GetInfo() Info
+	StartLive(ctx context.Context, pipeline Sink) error
+}
+
+// Starter is implemented by elements that run goroutines. They start them in
+// Start, not in Link, and stop them when ctx is done or the element is
+// closed.
+type Starter interface {
+	Start(ctx context.Context) error
+}
+
+// EOSHandler is implemented by elements that hold data, e.g. queues. At the
+// end of the stream, EndOfStream writes the data to the next sink and returns
+// once it is written.
+type EOSHandler interface {
+	EndOfStream() error
+}
+
+// BusPoster is implemented by elements that report asynchronous errors. They
+// post them on the bus set by SetBus before the element is started.
+type BusPoster interface {
+	SetBus(*Bus)
+}
+
 func Chain(i Info, f Sink, processors ...Processor) (Sink, error) {
 	var err error
 	for _, p := range processors {
@@ -36,3 +81,270 @@ func Chain(i Info, f Sink, processors ...Processor) (Sink, error) {
 	}
 	return f, nil
 }
+
+// Pipeline owns a linked chain of elements: it starts them, propagates the
+// end of the stream through them and closes them. Asynchronous errors and the
+// end of the stream are posted on its [Bus]. Pipelines without source are fed
+// by writing to them.
+type Pipeline struct {
+	info     Info
+	source   Source
+	sink     Sink
+	elements []any
+	names    map[string]any
+	bus      *Bus
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewPipeline links elements listed in the direction of the data flow: the
+// first element may be a Source, the last element must be a Sink and all
+// elements in between must be Processors. The pipeline owns the elements and
+// closes them with the pipeline, or if linking fails.
+func NewPipeline(elements ...any) (*Pipeline, error) {
+	return NewPipelineWithMetrics(nil, elements...)
+}
+
+// NewPipelineWithMetrics is like NewPipeline, but the elements report to m
+// under the name of their type, see [Metrics]. If m is nil, no metrics are
+// collected.
+func NewPipelineWithMetrics(m *Metrics, elements ...any) (*Pipeline, error) {
+	p, err := newPipeline(elements, nil, m)
+	if err != nil {
+		_ = closeElements(elements)
+		return nil, err
+	}
+	return p, nil
+}
+
+// newPipeline creates a pipeline whose elements report to m, if not nil,
+// under the given names or the names of their types if names is nil. If
+// linking fails, the caller closes the elements.
+func newPipeline(elements []any, names []string, m *Metrics) (*Pipeline, error) {
+	p := &Pipeline{
+		elements: elements,
+		names:    map[string]any{},
+		bus:      NewBus(),
+	}
+	var metrics []*ElementMetrics
+	if m != nil {
+		metrics = make([]*ElementMetrics, len(elements))
+		for i, e := range elements {
+			name := elementName(e)
+			if names != nil {
+				name = names[i]
+			}
+			metrics[i] = m.newElement(name)
+			if reporter, ok := e.(MetricsReporter); ok {
+				reporter.SetMetrics(metrics[i])
+			}
+		}
+	}
+	for _, e := range elements {
+		if poster, ok := e.(BusPoster); ok {
+			poster.SetBus(p.bus)
+		}
+	}
+	if err := p.link(metrics); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// link links the elements like Chain. If metrics is not nil, it holds the
+// metrics of each element and the elements are linked through probes.
+func (p *Pipeline) link(metrics []*ElementMetrics) error {
+	probe := func(s Sink, i int, input bool) Sink {
+		if metrics == nil {
+			return s
+		}
+		return newProbe(s, metrics[i], input)
+	}
+
+	first := 0
+	if len(p.elements) > 0 {
+		if source, ok := p.elements[0].(Source); ok {
+			p.source = source
+			p.info = source.GetInfo()
+			first = 1
+		}
+	}
+	if len(p.elements) == first {
+		return errors.New("pipeline has no sink")
+	}
+	last := len(p.elements) - 1
+	sink, ok := p.elements[last].(Sink)
+	if _, isProcessor := p.elements[last].(Processor); !ok || isProcessor {
+		return fmt.Errorf("pipeline must end with a sink, got %T", p.elements[last])
+	}
+	sink = probe(sink, last, true)
+
+	// link the processors from the last to the first
+	for i := last - 1; i >= first; i-- {
+		processor, ok := p.elements[i].(Processor)
+		if !ok {
+			return fmt.Errorf("not a processor: %T", p.elements[i])
+		}
+		s, err := processor.Link(probe(sink, i, false), p.info)
+		if err != nil {
+			return err
+		}
+		sink = probe(s, i, true)
+	}
+	if p.source != nil {
+		sink = probe(sink, 0, false)
+	}
+	p.sink = sink
+	return nil
+}
+
+// Info returns the info of the source, or zero for pipelines without source.
+func (p *Pipeline) Info() Info {
+	return p.info
+}
+
+// Bus returns the bus of the pipeline.
+func (p *Pipeline) Bus() *Bus {
+	return p.bus
+}
+
+// Write writes to the first element after the source.
+func (p *Pipeline) Write(b []byte, a Attributes) error {
+	return p.sink.Write(b, a)
+}
+
+// Start starts the elements, the last element first, and runs the source in
+// a goroutine. It does not block: when the source ends, the pipeline
+// propagates the end of the stream, errors of the source are posted on the
+// bus. The elements stop when ctx is done or the pipeline is stopped.
+func (p *Pipeline) Start(ctx context.Context) error {
+	if p.cancel != nil {
+		return errors.New("pipeline already started")
+	}
+	ctx, p.cancel = context.WithCancel(ctx)
+	if err := startElements(ctx, p.elements); err != nil {
+		p.cancel()
+		return err
+	}
+	if p.source != nil {
+		p.wg.Go(func() {
+			if err := p.source.StartLive(ctx, p.sink); err != nil {
+				// errors caused by stopping the pipeline are expected
+				if ctx.Err() == nil {
+					p.bus.Error(p.source, err)
+				}
+				return
+			}
+			_ = p.EndOfStream()
+		})
+	}
+	return nil
+}
+
+// Run starts the pipeline and waits for the end of the stream or the first
+// error. It consumes the messages on the bus.
+func (p *Pipeline) Run(ctx context.Context) error {
+	if err := p.Start(ctx); err != nil {
+		return err
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case m := <-p.bus.Messages():
+			switch m.Type {
+			case MessageError:
+				return fmt.Errorf("%T: %w", m.Element, m.Err)
+			case MessageEOS:
+				return nil
+			}
+			logMessage(m)
+		}
+	}
+}
+
+// EndOfStream lets the elements write the data they hold, in the direction
+// of the data flow, and posts a MessageEOS once all elements are done.
+// Pipelines with source call it when the source ends, pipelines without
+// source when the application stops writing.
+func (p *Pipeline) EndOfStream() error {
+	err := endOfStream(p.elements)
+	if err != nil {
+		p.bus.Error(p, err)
+	}
+	p.bus.Post(Message{Type: MessageEOS, Element: p})
+	return err
+}
+
+// Stop stops the source and the goroutines of the elements without writing
+// the data they hold.
+func (p *Pipeline) Stop() {
+	if p.cancel != nil {
+		p.cancel()
+	}
+	p.wg.Wait()
+}
+
+// Elements returns the elements in the order of the data flow.
+func (p *Pipeline) Elements() []any {
+	return p.elements
+}
+
+// Element returns the element with the given name property, see
+// [Registry.Parse].
+func (p *Pipeline) Element(name string) (any, bool) {
+	e, ok := p.names[name]
+	return e, ok
+}
+
+// SetTargetRate sets the target rate of all elements that have one, e.g.
+// encoders and frame droppers.
+func (p *Pipeline) SetTargetRate(targetRate uint64) {
+	for _, e := range p.elements {
+		if r, ok := e.(interface{ SetTargetRate(uint64) }); ok {
+			r.SetTargetRate(targetRate)
+		}
+	}
+}
+
+// Close stops the pipeline and closes all elements that implement io.Closer.
+func (p *Pipeline) Close() error {
+	p.Stop()
+	return closeElements(p.elements)
+}
+
+// startElements starts elements, listed in the direction of the data flow,
+// from the last to the first, so each element can write as soon as it is
+// started.
+func startElements(ctx context.Context, elements []any) error {
+	for _, e := range slices.Backward(elements) {
+		if s, ok := e.(Starter); ok {
+			if err := s.Start(ctx); err != nil {
+				return fmt.Errorf("failed to start %T: %w", e, err)
+			}
+		}
+	}
+	return nil
+}
+
+// endOfStream notifies elements in the direction of the data flow.
+func endOfStream(elements []any) error {
+	var errs []error
+	for _, e := range elements {
+		if h, ok := e.(EOSHandler); ok {
+			errs = append(errs, h.EndOfStream())
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func closeElements(elements []any) error {
+	var errs []error
+	for _, e := range elements {
+		if c, ok := e.(io.Closer); ok {
+			errs = append(errs, c.Close())
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,169 @@
+package gopipe
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"testing/synctest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// lifecycleElement is a processor that records the calls of the pipeline.
+type lifecycleElement struct {
+	name  string
+	calls *[]string
+}
+
+func (e *lifecycleElement) Link(next Sink, _ Info) (Sink, error) {
+	return next, nil
+}
+
+func (e *lifecycleElement) Start(context.Context) error {
+	*e.calls = append(*e.calls, "start "+e.name)
+	return nil
+}
+
+func (e *lifecycleElement) EndOfStream() error {
+	*e.calls = append(*e.calls, "eos "+e.name)
+	return nil
+}
+
+func (e *lifecycleElement) Close() error {
+	*e.calls = append(*e.calls, "close "+e.name)
+	return nil
+}
+
+func newTestSource(t testing.TB, runTime time.Duration) *FakeSource {
+	source, err := NewFakeSource(runTime, 0, 1_000_000, 96_000, FakeSourceFrameRate(10))
+	require.NoError(t, err)
+	return source
+}
+
+func TestPipeline(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		var calls []string
+		var sink recordingSink
+		queue := NewQueue()
+		p, err := NewPipeline(
+			newTestSource(t, time.Second),
+			&lifecycleElement{name: "a", calls: &calls},
+			queue,
+			&lifecycleElement{name: "b", calls: &calls},
+			&sink,
+		)
+		require.NoError(t, err)
+		assert.Equal(t, Info{Width: 1920, Height: 1080, TimebaseNum: 10, TimebaseDen: 1}, p.Info())
+
+		require.NoError(t, p.Run(context.Background()))
+		// the queue wrote all frames before the end of the stream reached b
+		assert.Len(t, sink.frames, 10)
+		assert.Equal(t, []string{"start b", "start a", "eos a", "eos b"}, calls)
+
+		require.NoError(t, p.Close())
+		assert.Equal(t, []string{"close a", "close b"}, calls[4:])
+		assert.ErrorIs(t, queue.Write(nil, Attributes{}), ErrQueueClosed)
+	})
+}
+
+func TestPipelineError(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		errSink := errors.New("sink failed")
+		queue := NewQueue()
+		p, err := NewPipeline(
+			newTestSource(t, time.Hour),
+			queue,
+			WriterFunc(func([]byte, Attributes) error {
+				return errSink
+			}),
+		)
+		require.NoError(t, err)
+		defer p.Close()
+
+		// the error of the asynchronous write stops the pipeline
+		err = p.Run(context.Background())
+		assert.ErrorIs(t, err, errSink)
+	})
+}
+
+func TestPipelineTee(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		var main, branch recordingSink
+		tee := NewTee()
+		tee.AddBranch(&branch, NewQueue())
+		tee.AddBranch(WriterFunc(func([]byte, Attributes) error {
+			return errors.New("branch failed")
+		}))
+		p, err := NewPipeline(newTestSource(t, time.Second), tee, &main)
+		require.NoError(t, err)
+
+		// failing branches post warnings, the queue of the other branch is
+		// flushed at the end of the stream
+		require.NoError(t, p.Run(context.Background()))
+		require.NoError(t, p.Close())
+		assert.Len(t, main.frames, 10)
+		assert.Len(t, branch.frames, 10)
+	})
+}
+
+func TestPipelineTeeQueueError(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		var main recordingSink
+		failed := 0
+		tee := NewTee()
+		tee.AddBranch(WriterFunc(func([]byte, Attributes) error {
+			failed++
+			return errors.New("branch failed")
+		}), NewQueue())
+		p, err := NewPipeline(newTestSource(t, time.Second), tee, &main)
+		require.NoError(t, err)
+
+		// the errors of the queue in the branch are posted as warnings and
+		// do not stop the pipeline
+		require.NoError(t, p.Run(context.Background()))
+		require.NoError(t, p.Close())
+		assert.Len(t, main.frames, 10)
+		assert.Equal(t, 10, failed)
+	})
+}
+
+func TestPipelineWithoutSource(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		var sink recordingSink
+		p, err := NewPipeline(NewQueue(), &sink)
+		require.NoError(t, err)
+		defer p.Close()
+
+		done := make(chan error)
+		go func() {
+			done <- p.Run(context.Background())
+		}()
+		synctest.Wait()
+		for i := range 3 {
+			require.NoError(t, p.Write([]byte{byte(i)}, Attributes{}))
+		}
+		require.NoError(t, p.EndOfStream())
+		require.NoError(t, <-done)
+		assert.Equal(t, [][]byte{{0}, {1}, {2}}, sink.frames)
+	})
+}
+
+func TestNewPipelineErrors(t *testing.T) {
+	var calls []string
+	_, err := NewPipeline(&lifecycleElement{name: "a", calls: &calls})
+	assert.Error(t, err)
+	// the pipeline owns the elements even if linking fails
+	assert.Equal(t, []string{"close a"}, calls)
+
+	for _, elements := range [][]any{
+		{},
+		{newTestSource(t, time.Second)},
+		{&recordingSink{}, &recordingSink{}},
+		{NewQueue()},
+	} {
+		_, err = NewPipeline(elements...)
+		assert.Error(t, err)
+	}
+}
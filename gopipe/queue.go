@@ -0,0 +1,211 @@
+package gopipe
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+)
+
+// ErrQueueClosed is returned by writes to a closed [Queue].
+var ErrQueueClosed = errors.New("queue closed")
+
+// QueueOption configures a [Queue].
+type QueueOption func(*Queue)
+
+// QueueSize sets the number of frames the queue holds before it drops new
+// frames. Default: 30.
+func QueueSize(size int) QueueOption {
+	return func(q *Queue) {
+		q.size = size
+	}
+}
+
+type queueItem struct {
+	payloads   [][]byte
+	attributes Attributes
+	multi      bool
+
+	// flushed marks the end of the stream, see Queue.EndOfStream
+	flushed chan struct{}
+}
+
+// Queue decouples the next sink from the writer: frames are written from a
+// goroutine that runs from Start until the context is done or the queue is
+// closed, so a slow sink does not stall the writer. When the queue is full,
+// new frames are dropped. Errors of the next sink are posted on the bus. The
+// queue copies the frames into buffers from a BufferPool.
+type Queue struct {
+	size    int
+	writer  Sink
+	pool    *BufferPool
+	bus     *Bus
+	metrics *ElementMetrics
+	ctx     context.Context
+
+	lock    sync.Mutex
+	items   chan queueItem
+	closed  bool
+	dropped int
+	done    chan struct{}
+}
+
+func NewQueue(opts ...QueueOption) *Queue {
+	q := &Queue{
+		size: 30,
+		pool: NewBufferPool(),
+	}
+	for _, opt := range opts {
+		opt(q)
+	}
+	return q
+}
+
+func (q *Queue) Link(w Sink, _ Info) (Sink, error) {
+	q.writer = w
+	q.items = make(chan queueItem, q.size)
+	return q, nil
+}
+
+func (q *Queue) SetBus(bus *Bus) {
+	q.bus = bus
+}
+
+// SetMetrics reports the number of queued frames to m.
+func (q *Queue) SetMetrics(m *ElementMetrics) {
+	q.metrics = m
+}
+
+func (q *Queue) Start(ctx context.Context) error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if q.closed {
+		return ErrQueueClosed
+	}
+	q.ctx = ctx
+	q.done = make(chan struct{})
+	go q.run()
+	return nil
+}
+
+func (q *Queue) Write(buf []byte, attrs Attributes) error {
+	return q.push([][]byte{buf}, attrs, false)
+}
+
+// WriteAll queues all packets of a frame as one item, see [MultiWriter].
+func (q *Queue) WriteAll(bufs [][]byte, attrs Attributes) error {
+	return q.push(bufs, attrs, true)
+}
+
+func (q *Queue) push(bufs [][]byte, attrs Attributes, multi bool) error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if q.closed {
+		return ErrQueueClosed
+	}
+	if len(q.items) == cap(q.items) {
+		q.dropped++
+		slog.Info("queue full, dropping frame", "size", q.size, "dropped", q.dropped)
+		return nil
+	}
+	// the buffers are borrowed, copy them for the queue
+	payloads := make([][]byte, len(bufs))
+	for i, buf := range bufs {
+		payloads[i] = q.pool.Get(len(buf))
+		copy(payloads[i], buf)
+	}
+	q.items <- queueItem{
+		payloads:   payloads,
+		attributes: attrs,
+		multi:      multi,
+	}
+	q.metrics.SetQueueDepth(len(q.items))
+	return nil
+}
+
+// Dropped returns the number of frames dropped because the queue was full.
+func (q *Queue) Dropped() int {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	return q.dropped
+}
+
+func (q *Queue) run() {
+	defer close(q.done)
+	for {
+		select {
+		case <-q.ctx.Done():
+			return
+		case item, ok := <-q.items:
+			if !ok {
+				return
+			}
+			if item.flushed != nil {
+				close(item.flushed)
+				continue
+			}
+			q.metrics.SetQueueDepth(len(q.items))
+			q.write(item)
+		}
+	}
+}
+
+func (q *Queue) write(item queueItem) {
+	var err error
+	if item.multi {
+		err = writeAll(q.writer, item.payloads, item.attributes)
+	} else {
+		err = q.writer.Write(item.payloads[0], item.attributes)
+	}
+	if err != nil {
+		q.bus.Error(q, err)
+	}
+	for _, buf := range item.payloads {
+		q.pool.Put(buf)
+	}
+}
+
+// EndOfStream waits until the queued frames are written.
+func (q *Queue) EndOfStream() error {
+	q.lock.Lock()
+	if q.closed || q.done == nil {
+		q.lock.Unlock()
+		return nil
+	}
+	// the marker is not dropped, writers wait until the queue has room
+	flushed := make(chan struct{})
+	select {
+	case q.items <- queueItem{flushed: flushed}:
+	case <-q.done:
+	}
+	q.lock.Unlock()
+
+	select {
+	case <-flushed:
+	case <-q.done:
+	}
+	return nil
+}
+
+// Close writes the queued frames unless the context is done and waits for the
+// goroutine to stop.
+func (q *Queue) Close() error {
+	q.lock.Lock()
+	if q.closed {
+		q.lock.Unlock()
+		return nil
+	}
+	q.closed = true
+	if q.items != nil {
+		close(q.items)
+	}
+	done := q.done
+	q.lock.Unlock()
+
+	if done != nil {
+		<-done
+	}
+	return nil
+}
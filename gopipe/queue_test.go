@@ -0,0 +1,90 @@
+package gopipe
+
+import (
+	"context"
+	"testing"
+	"testing/synctest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueue(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		var sink recordingSink
+		unblock := make(chan struct{})
+		slow := processorFunc(func(next Sink, _ Info) (Sink, error) {
+			return WriterFunc(func(b []byte, a Attributes) error {
+				<-unblock
+				return next.Write(b, a)
+			}), nil
+		})
+		q := NewQueue(QueueSize(2))
+		w, err := Chain(Info{}, &sink, slow, q)
+		require.NoError(t, err)
+		require.NoError(t, q.Start(context.Background()))
+
+		// the first frame blocks the goroutine, the next two fill the queue
+		buf := []byte{0}
+		for i := range 5 {
+			buf[0] = byte(i)
+			require.NoError(t, w.Write(buf, Attributes{}))
+			synctest.Wait()
+		}
+		assert.Equal(t, 2, q.Dropped())
+
+		close(unblock)
+		require.NoError(t, q.Close())
+		assert.Equal(t, [][]byte{{0}, {1}, {2}}, sink.frames)
+		assert.ErrorIs(t, w.Write(buf, Attributes{}), ErrQueueClosed)
+	})
+}
+
+func TestQueueWriteAll(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		var sink recordingSink
+		q := NewQueue()
+		w, err := q.Link(&sink, Info{})
+		require.NoError(t, err)
+		require.NoError(t, q.Start(context.Background()))
+
+		require.NoError(t, w.(MultiWriter).WriteAll([][]byte{{1}, {2, 3}}, Attributes{}))
+		require.NoError(t, q.Close())
+		assert.Equal(t, [][]byte{{1, 2, 3}}, sink.frames)
+		assert.Equal(t, 1, sink.writes)
+	})
+}
+
+func TestQueueContextDone(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		var sink recordingSink
+		q := NewQueue()
+		_, err := q.Link(&sink, Info{})
+		require.NoError(t, err)
+		require.NoError(t, q.Start(ctx))
+
+		cancel()
+		synctest.Wait()
+		require.NoError(t, q.Write([]byte{1}, Attributes{}))
+		require.NoError(t, q.Close())
+		assert.Empty(t, sink.frames)
+	})
+}
+
+func TestQueueEndOfStream(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		var sink recordingSink
+		q := NewQueue()
+		_, err := q.Link(&sink, Info{})
+		require.NoError(t, err)
+		require.NoError(t, q.Start(context.Background()))
+
+		for i := range 3 {
+			require.NoError(t, q.Write([]byte{byte(i)}, Attributes{}))
+		}
+		require.NoError(t, q.EndOfStream())
+		assert.Len(t, sink.frames, 3)
+		require.NoError(t, q.Close())
+	})
+}
@@ -2,16 +2,17 @@ package gopipe
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
+	"sync"
 	"sync/atomic"
 	"time"
 
-	"github.com/mengelbart/mrtp/gopipe/codec"
+	"github.com/mengelbart/mrtp"
 	"github.com/mengelbart/mrtp/internal/logging"
 	"github.com/pion/interceptor/pkg/jitterbuffer"
 	"github.com/pion/rtp"
-	"github.com/pion/rtp/codecs"
 )
 
 // rtpDepacketizer is the actual depacketizer implementation
@@ -19,6 +20,18 @@ type rtpDepacketizer struct {
 	jitterBuffer *jitterbuffer.JitterBuffer
 	frameBuffer  []byte
 	onFrame      func([]byte, int64) // callback for complete frames
+	onError      func(error)         // callback for undepacketizable packets
+	onFatalError func(error)         // callback for errors that stop Run
+
+	// pool holds the copies of the packets in the jitter buffer, buffers
+	// maps sequence numbers to them until the packets are played out. The
+	// jitter buffer keeps late and duplicate packets forever, they are
+	// dropped before they reach it. lock guards buffers and the playout
+	// head.
+	pool    *BufferPool
+	buffers map[uint16][]byte
+	playing bool // at least one packet was played out
+	lock    sync.Mutex
 
 	ctx     context.Context
 	cancel  context.CancelFunc
@@ -27,34 +40,38 @@ type rtpDepacketizer struct {
 	missedPacketTime *time.Time
 	fastSkip         bool   // skip missing packets immediately after first timeout until buffer drains
 	playoutTs        uint32 // playout timestamp of the current frame being assembled
-	codec            codec.CodecType
+	codec            mrtp.Codec
 
 	maxTimeout     time.Duration
 	currentTimeout atomic.Int64
 
-	vp8Depacketizer  codecs.VP8Packet
-	vp9Depacketizer  codecs.VP9Packet
-	h264Depacketizer codecs.H264Packet
+	depacketizer rtp.Depacketizer // nil for codecs without payload format
+
+	onFrameDropped func() // called when a frame is dropped due to packet loss
+
+	metrics *ElementMetrics // reports the arrival of the packets of a frame
 
 	unwrapper *logging.Unwrapper // for logging the rtp packets
 }
 
-func newRTPDepacketizer(maxTimeout time.Duration, c codec.CodecType, onFrame func(encFrame []byte, pts int64)) (*rtpDepacketizer, error) {
-	if c != codec.VP8 && c != codec.VP9 && c != codec.H264 && c != codec.FAKE {
-		return nil, fmt.Errorf("unsupported codec for depacketizer: %s", c.String())
+func newRTPDepacketizer(maxTimeout time.Duration, c mrtp.Codec, onFrame func(encFrame []byte, pts int64), onError func(error)) (*rtpDepacketizer, error) {
+	depacketizer, err := c.NewDepacketizer()
+	if err != nil {
+		return nil, fmt.Errorf("unsupported codec for depacketizer: %w", err)
 	}
 
-	ctx, cancel := context.WithCancel(context.Background())
 	d := &rtpDepacketizer{
 		jitterBuffer: jitterbuffer.New(),
 		frameBuffer:  make([]byte, 0, 2000),
 		onFrame:      onFrame,
-		ctx:          ctx,
-		cancel:       cancel,
+		onError:      onError,
+		pool:         NewBufferPool(),
+		buffers:      map[uint16][]byte{},
 		trigger:      make(chan struct{}, 1),
 		maxTimeout:   maxTimeout,
 		unwrapper:    &logging.Unwrapper{},
 		codec:        c,
+		depacketizer: depacketizer,
 	}
 	d.currentTimeout.Store(int64(maxTimeout))
 	return d, nil
@@ -73,16 +90,26 @@ func (d *rtpDepacketizer) UpdateRTT(rtt time.Duration) {
 
 // Write just pushes to jitter buffer
 func (d *rtpDepacketizer) Write(rtpBuf []byte) error {
-	// copy rtp data to avoid memory reuse
-	rtpBufCopy := make([]byte, len(rtpBuf))
+	// the jitter buffer keeps the packet, copy the borrowed buffer
+	rtpBufCopy := d.pool.Get(len(rtpBuf))
 	copy(rtpBufCopy, rtpBuf)
 
 	pkt := new(rtp.Packet)
 	if err := pkt.Unmarshal(rtpBufCopy); err != nil {
+		d.pool.Put(rtpBufCopy)
 		return err
 	}
 
-	d.jitterBuffer.Push(pkt)
+	d.lock.Lock()
+	if !d.push(pkt, rtpBufCopy) {
+		d.lock.Unlock()
+		d.pool.Put(rtpBufCopy)
+		slog.Info("packetizer drops late or duplicate packet", "seqnr", pkt.SequenceNumber)
+		return nil
+	}
+	d.lock.Unlock()
+
+	d.metrics.Arrived(int64(pkt.Timestamp), len(rtpBuf))
 
 	// Signal that new packet is available
 	select {
@@ -93,6 +120,54 @@ func (d *rtpDepacketizer) Write(rtpBuf []byte) error {
 	return nil
 }
 
+// push pushes pkt to the jitter buffer and tracks its buffer. It reports false
+// for duplicates and for packets behind the playout head, which the jitter
+// buffer would never play out. d.lock must be held.
+func (d *rtpDepacketizer) push(pkt *rtp.Packet, buf []byte) bool {
+	if _, ok := d.buffers[pkt.SequenceNumber]; ok {
+		return false
+	}
+	// the playout head follows the first packet until playout starts
+	if d.playing || len(d.buffers) > 0 {
+		if int16(pkt.SequenceNumber-d.jitterBuffer.PlayoutHead()) < 0 {
+			return false
+		}
+	}
+	d.buffers[pkt.SequenceNumber] = buf
+	d.jitterBuffer.Push(pkt)
+	return true
+}
+
+// pop pops the packet at the playout head.
+func (d *rtpDepacketizer) pop() (*rtp.Packet, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	pkt, err := d.jitterBuffer.Pop()
+	if err == nil {
+		d.playing = true
+	}
+	return pkt, err
+}
+
+// skip moves the playout head past a lost packet and returns the sequence
+// number of the lost packet.
+func (d *rtpDepacketizer) skip() uint16 {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	playoutHead := d.jitterBuffer.PlayoutHead()
+	d.jitterBuffer.SetPlayoutHead(playoutHead + 1)
+	return playoutHead
+}
+
+// start runs the goroutine that assembles frames until ctx is done or the
+// depacketizer is closed.
+func (d *rtpDepacketizer) start(ctx context.Context) {
+	d.ctx, d.cancel = context.WithCancel(ctx)
+	go d.Run()
+}
+
 // Run processes packets and assembles frames
 func (d *rtpDepacketizer) Run() {
 	for {
@@ -100,12 +175,20 @@ func (d *rtpDepacketizer) Run() {
 		case <-d.ctx.Done():
 			return
 		case <-d.trigger:
-			d.processPackets()
+			if err := d.processPackets(); err != nil {
+				if d.onFatalError != nil {
+					d.onFatalError(err)
+				}
+				return
+			}
 		}
 	}
 }
 
-func (d *rtpDepacketizer) processPackets() {
+// processPackets assembles the frames of the packets in the jitter buffer.
+// Lost and undepacketizable packets drop their frames, other errors of the
+// jitter buffer are returned.
+func (d *rtpDepacketizer) processPackets() error {
 	droppingFrame := false
 	for {
 		_, err := d.jitterBuffer.Peek(true)
@@ -116,24 +199,24 @@ func (d *rtpDepacketizer) processPackets() {
 			}
 			d.fastSkip = false
 			d.missedPacketTime = nil
-			return
+			return nil
 		}
 
-		pkt, err := d.jitterBuffer.Pop()
+		pkt, err := d.pop()
 		if err == jitterbuffer.ErrPopWhileBuffering {
 			// still buffering - wait for more packets
-			return
+			return nil
 		}
 		if err == jitterbuffer.ErrNotFound {
 			// missing packet
 			if d.fastSkip {
 				// already timed out once - skip immediately to avoid cascading delay
-				playoutHead := d.jitterBuffer.PlayoutHead()
+				playoutHead := d.skip()
 
 				slog.Info("packitzier fast-skipping lost packet", "seqnr", playoutHead)
 
-				d.jitterBuffer.SetPlayoutHead(playoutHead + 1)
 				d.frameBuffer = d.frameBuffer[:0]
+				d.dropFrame(droppingFrame)
 				droppingFrame = true
 				continue
 			}
@@ -143,26 +226,25 @@ func (d *rtpDepacketizer) processPackets() {
 				// start new timeout
 				now := time.Now()
 				d.missedPacketTime = &now
-				return
+				return nil
 			} else if time.Since(*d.missedPacketTime) > time.Duration(d.currentTimeout.Load()) {
 				// timeout expired, drop current frame and enter fast-skip mode
-				playoutHead := d.jitterBuffer.PlayoutHead()
+				playoutHead := d.skip()
 
 				slog.Info("packitzier dropping frame, rtp packet lost", "seqnr", playoutHead)
 
-				d.jitterBuffer.SetPlayoutHead(playoutHead + 1)
 				d.frameBuffer = d.frameBuffer[:0]
+				d.dropFrame(droppingFrame)
 				droppingFrame = true
 				d.fastSkip = true
 				continue
 			}
 
 			// still waiting for missing packet
-			return
+			return nil
 		}
 		if err != nil {
-			slog.Error("Depackitzer error: ", "mst", err.Error())
-			return
+			return err
 		}
 
 		if d.playoutTs != pkt.Timestamp {
@@ -184,79 +266,134 @@ func (d *rtpDepacketizer) processPackets() {
 			"pts", pkt.Timestamp, // should be fine to use rtp ts as pts
 		)
 
-		var payload []byte
-		switch d.codec {
-		case codec.VP8:
-			payload, err = d.vp8Depacketizer.Unmarshal(pkt.Payload)
+		payload := pkt.Payload
+		if d.depacketizer != nil {
+			payload, err = d.depacketizer.Unmarshal(pkt.Payload)
 			if err != nil {
-				panic(err)
-			}
-		case codec.VP9:
-			payload, err = d.vp9Depacketizer.Unmarshal(pkt.Payload)
-			if err != nil {
-				panic(err)
-			}
-		case codec.H264:
-			payload, err = d.h264Depacketizer.Unmarshal(pkt.Payload)
-			if err != nil {
-				panic(err)
+				// the frame cannot be assembled without the packet
+				d.onError(err)
+				d.release(pkt.SequenceNumber)
+				d.frameBuffer = d.frameBuffer[:0]
+				d.dropFrame(droppingFrame)
+				droppingFrame = true
+				continue
 			}
-		case codec.FAKE:
-			// just pass it through
-			payload = pkt.Payload
 		}
 
 		d.frameBuffer = append(d.frameBuffer, payload...)
+		d.release(pkt.SequenceNumber)
 
-		// end of frame
+		// end of frame, the frame buffer is borrowed by onFrame
 		if pkt.Marker && !droppingFrame {
-			frame := make([]byte, len(d.frameBuffer))
-			copy(frame, d.frameBuffer)
-			d.onFrame(frame, int64(pkt.Timestamp))
+			d.onFrame(d.frameBuffer, int64(pkt.Timestamp))
 		}
 	}
 }
 
+// release returns the buffer of the packet with sequence number seq to the
+// pool.
+func (d *rtpDepacketizer) release(seq uint16) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if buf, ok := d.buffers[seq]; ok {
+		delete(d.buffers, seq)
+		d.pool.Put(buf)
+	}
+}
+
+// dropFrame reports a dropped frame unless the current frame was already
+// being dropped.
+func (d *rtpDepacketizer) dropFrame(alreadyDropping bool) {
+	if !alreadyDropping && d.onFrameDropped != nil {
+		d.onFrameDropped()
+	}
+}
+
 func (d *rtpDepacketizer) Close() error {
-	d.cancel()
+	if d.cancel != nil {
+		d.cancel()
+	}
 	return nil
 }
 
-// RTPDepacketizer is a linkable depacketizer element
+// RTPDepacketizer is a linkable depacketizer element. It assembles frames in
+// a goroutine that runs from Start until the context is done or the
+// depacketizer is closed. Errors of the next sink and invalid payloads drop
+// the affected frames and are posted as warnings on the bus, errors of the
+// jitter buffer stop the depacketizer and are posted as errors.
 type RTPDepacketizer struct {
 	depacketizer *rtpDepacketizer
+	codec        mrtp.Codec
 	next         Sink
+	bus          *Bus
 }
 
-func NewRTPDepacketizer(timeout time.Duration, codec codec.CodecType) (*RTPDepacketizer, error) {
-	adapter := &RTPDepacketizer{}
+func NewRTPDepacketizer(timeout time.Duration, codec mrtp.Codec) (*RTPDepacketizer, error) {
+	adapter := &RTPDepacketizer{
+		codec: codec,
+	}
 
 	// forwards to next writer when frame is complete
 	var err error
 	adapter.depacketizer, err = newRTPDepacketizer(timeout, codec, func(frame []byte, pts int64) {
-		if adapter.next != nil {
-			// Forward the assembled frame to the next stage
-			if writeErr := adapter.next.Write(frame, Attributes{PTS: pts}); writeErr != nil {
-				panic(writeErr)
-			}
-		} else {
-			panic("RTPDepacketizer: used before linked")
+		// Forward the assembled frame to the next stage
+		if writeErr := adapter.next.Write(frame, Attributes{PTS: pts}); writeErr != nil {
+			adapter.bus.Warning(adapter, writeErr)
 		}
+	}, func(depacketizeErr error) {
+		adapter.bus.Warning(adapter, depacketizeErr)
 	})
+	if err != nil {
+		return nil, err
+	}
+	adapter.depacketizer.onFatalError = func(fatalErr error) {
+		adapter.bus.Error(adapter, fatalErr)
+	}
 
-	return adapter, err
+	return adapter, nil
 }
 
 func (d *RTPDepacketizer) Link(next Sink, i Info) (Sink, error) {
 	d.next = next
 
-	go d.depacketizer.Run()
-
 	return WriterFunc(func(rtpPacket []byte, attrs Attributes) error {
 		return d.depacketizer.Write(rtpPacket)
 	}), nil
 }
 
+func (d *RTPDepacketizer) SetBus(bus *Bus) {
+	d.bus = bus
+}
+
+// SetMetrics reports the arrival of the packets of each frame to m, so the
+// latency of the depacketizer includes the time frames wait for missing
+// packets.
+func (d *RTPDepacketizer) SetMetrics(m *ElementMetrics) {
+	d.depacketizer.metrics = m
+}
+
+// Start starts assembling frames. The depacketizer must be linked before.
+func (d *RTPDepacketizer) Start(ctx context.Context) error {
+	if d.next == nil {
+		return errors.New("RTPDepacketizer: started before linked")
+	}
+	d.depacketizer.start(ctx)
+	return nil
+}
+
+// OnFrameDropped sets a callback that is called whenever a frame is dropped
+// because of packet loss, e.g. to request a keyframe. It must be set before
+// the depacketizer is started.
+func (d *RTPDepacketizer) OnFrameDropped(f func()) {
+	d.depacketizer.onFrameDropped = f
+}
+
+// Codec returns the codec of the depacketized frames.
+func (d *RTPDepacketizer) Codec() mrtp.Codec {
+	return d.codec
+}
+
 func (d *RTPDepacketizer) UpdateRTT(rtt time.Duration) {
 	d.depacketizer.UpdateRTT(rtt)
 }
@@ -0,0 +1,114 @@
+package gopipe
+
+import (
+	"encoding/binary"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/mengelbart/mrtp"
+	"github.com/pion/interceptor/pkg/jitterbuffer"
+	"github.com/pion/rtp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// marshalFramePacket returns a packet that holds a complete frame whose
+// payload is the sequence number and a fill of size bytes.
+func marshalFramePacket(t testing.TB, seq uint16, size int) []byte {
+	payload := make([]byte, 2+size)
+	binary.BigEndian.PutUint16(payload, seq)
+	pkt := &rtp.Packet{
+		Header: rtp.Header{
+			Version:        2,
+			Marker:         true,
+			SequenceNumber: seq,
+			Timestamp:      uint32(seq) * 3000,
+		},
+		Payload: payload,
+	}
+	buf, err := pkt.Marshal()
+	require.NoError(t, err)
+	return buf
+}
+
+func TestRTPDepacketizerLateAndDuplicatePackets(t *testing.T) {
+	var frames []uint16
+	d, err := newRTPDepacketizer(time.Second, mrtp.FAKE, func(frame []byte, _ int64) {
+		frames = append(frames, binary.BigEndian.Uint16(frame))
+	}, func(err error) {
+		assert.NoError(t, err)
+	})
+	require.NoError(t, err)
+
+	var expected []uint16
+	for seq := range uint16(60) {
+		require.NoError(t, d.Write(marshalFramePacket(t, seq, 10)))
+		expected = append(expected, seq)
+	}
+	require.NoError(t, d.processPackets())
+
+	// late packets and duplicates of packets that were played out
+	require.NoError(t, d.Write(marshalFramePacket(t, 10, 10)))
+	require.NoError(t, d.Write(marshalFramePacket(t, 59, 10)))
+	for seq := uint16(60); seq < 70; seq++ {
+		require.NoError(t, d.Write(marshalFramePacket(t, seq, 10)))
+		expected = append(expected, seq)
+	}
+	// a duplicate of a packet that is still buffered
+	require.NoError(t, d.Write(marshalFramePacket(t, 65, 10)))
+	require.NoError(t, d.processPackets())
+
+	assert.Equal(t, expected, frames)
+	assert.Empty(t, d.buffers)
+	_, err = d.jitterBuffer.Peek(true)
+	assert.ErrorIs(t, err, jitterbuffer.ErrBufferUnderrun)
+}
+
+func TestRTPDepacketizerWarnings(t *testing.T) {
+	depacketizer, err := NewRTPDepacketizer(time.Second, mrtp.FAKE)
+	require.NoError(t, err)
+	bus := NewBus()
+	depacketizer.SetBus(bus)
+	w, err := depacketizer.Link(WriterFunc(func([]byte, Attributes) error {
+		return errors.New("sink failed")
+	}), Info{})
+	require.NoError(t, err)
+
+	for seq := range uint16(50) {
+		require.NoError(t, w.Write(marshalFramePacket(t, seq, 10), Attributes{}))
+	}
+	require.NoError(t, depacketizer.depacketizer.processPackets())
+
+	// errors of single frames do not stop the pipeline
+	require.Len(t, bus.Messages(), 50)
+	m := <-bus.Messages()
+	assert.Equal(t, MessageWarning, m.Type)
+	assert.Same(t, depacketizer, m.Element)
+}
+
+func BenchmarkRTPDepacketizer(b *testing.B) {
+	d, err := newRTPDepacketizer(time.Second, mrtp.FAKE, func([]byte, int64) {}, func(err error) {
+		require.NoError(b, err)
+	})
+	require.NoError(b, err)
+
+	// one late duplicate every 8 packets
+	const lateEvery = 8
+	pkts := make([][]byte, 1<<16)
+	for i := range pkts {
+		pkts[i] = marshalFramePacket(b, uint16(i), 1200)
+	}
+	b.ReportAllocs()
+	b.SetBytes(int64(len(pkts[0])))
+	seq := 0
+	for b.Loop() {
+		require.NoError(b, d.Write(pkts[seq%len(pkts)]))
+		if seq%lateEvery == 0 && seq >= 100 {
+			require.NoError(b, d.Write(slices.Clone(pkts[(seq-60)%len(pkts)])))
+		}
+		require.NoError(b, d.processPackets())
+		seq++
+	}
+}
@@ -7,29 +7,32 @@ import (
 	"log/slog"
 	"os"
 	"slices"
-	"sync"
 	"testing"
 	"testing/synctest"
 	"time"
 
-	"github.com/mengelbart/mrtp/gopipe/codec"
+	"github.com/mengelbart/mrtp"
 	"github.com/pion/rtp"
 	"github.com/stretchr/testify/assert"
 )
 
 func TestDepacketizerVP8(t *testing.T) {
-	testDepacketizerWithCodec(t, codec.VP8)
+	testDepacketizerWithCodec(t, mrtp.VP8)
 }
 
 func TestDepacketizerVP9(t *testing.T) {
-	testDepacketizerWithCodec(t, codec.VP9)
+	testDepacketizerWithCodec(t, mrtp.VP9)
 }
 
 func TestDepacketizerH264(t *testing.T) {
-	testDepacketizerWithCodec(t, codec.H264)
+	testDepacketizerWithCodec(t, mrtp.H264)
 }
 
-func testDepacketizerWithCodec(t *testing.T, codec codec.CodecType) {
+func TestDepacketizerAV1(t *testing.T) {
+	testDepacketizerWithCodec(t, mrtp.AV1)
+}
+
+func testDepacketizerWithCodec(t *testing.T, codec mrtp.Codec) {
 	// video file must exist
 	if _, err := os.Stat("../simulation/Johnny_1280x720_60.y4m"); os.IsNotExist(err) {
 		println("Video file not found. See simulation folder for more information.\n")
@@ -45,13 +48,12 @@ func testDepacketizerWithCodec(t *testing.T, codec codec.CodecType) {
 		depacketizer, err := newRTPDepacketizer(timeout, codec, func(frame []byte, pts int64) {
 			slog.Info("got frame", "size", len(frame))
 			framesReceived++
+		}, func(err error) {
+			assert.NoError(t, err)
 		})
 		assert.NoError(t, err)
 
-		var wg sync.WaitGroup
-		wg.Go(func() {
-			depacketizer.Run()
-		})
+		depacketizer.start(ctx)
 
 		sink := WriterFunc(func(b []byte, _ Attributes) error {
 			return depacketizer.Write(b)
@@ -75,7 +77,7 @@ func testDepacketizerWithCodec(t *testing.T, codec codec.CodecType) {
 			ClockRate: 90_000,
 			Codec:     codec,
 		}
-		pacer := NewFrameSpacer(ctx)
+		pacer := NewFrameSpacer()
 		defer func() {
 			assert.NoError(t, pacer.Close())
 		}()
@@ -83,6 +85,7 @@ func testDepacketizerWithCodec(t *testing.T, codec codec.CodecType) {
 		frameInter := newFrameInterceptor(false, 0, nil)
 		rtpPipeline, err := Chain(i, sink, pacer, packetizer, encoder, frameInter)
 		assert.NoError(t, err)
+		assert.NoError(t, pacer.Start(ctx))
 
 		assert.NoError(t, fileSrc.StartLive(ctx, rtpPipeline))
 
@@ -95,14 +98,14 @@ func testDepacketizerWithCodec(t *testing.T, codec codec.CodecType) {
 }
 
 func TestDepacketizerFrameIntegrityVP8(t *testing.T) {
-	testDepacketizerFrameIntegrityWithCodec(t, codec.VP8)
+	testDepacketizerFrameIntegrityWithCodec(t, mrtp.VP8)
 }
 
 func TestDepacketizerFrameIntegrityVP9(t *testing.T) {
-	testDepacketizerFrameIntegrityWithCodec(t, codec.VP9)
+	testDepacketizerFrameIntegrityWithCodec(t, mrtp.VP9)
 }
 
-func testDepacketizerFrameIntegrityWithCodec(t *testing.T, codec codec.CodecType) {
+func testDepacketizerFrameIntegrityWithCodec(t *testing.T, codec mrtp.Codec) {
 	// video file must exist
 	if _, err := os.Stat("../simulation/Johnny_1280x720_60.y4m"); os.IsNotExist(err) {
 		println("Video file not found. See simulation folder for more information.\n")
@@ -126,13 +129,12 @@ func testDepacketizerFrameIntegrityWithCodec(t *testing.T, codec codec.CodecType
 				receivedFrames = append(receivedFrames, frameCopy)
 			}
 			receivedFrameCount++
+		}, func(err error) {
+			assert.NoError(t, err)
 		})
 		assert.NoError(t, err)
 
-		var wg sync.WaitGroup
-		wg.Go(func() {
-			depacketizer.Run()
-		})
+		depacketizer.start(ctx)
 
 		// sink writes to depacketizer
 		sink := WriterFunc(func(b []byte, _ Attributes) error {
@@ -158,7 +160,7 @@ func testDepacketizerFrameIntegrityWithCodec(t *testing.T, codec codec.CodecType
 			ClockRate: 90_000,
 			Codec:     codec,
 		}
-		pacer := NewFrameSpacer(ctx)
+		pacer := NewFrameSpacer()
 		defer func() {
 			assert.NoError(t, pacer.Close())
 		}()
@@ -167,6 +169,7 @@ func testDepacketizerFrameIntegrityWithCodec(t *testing.T, codec codec.CodecType
 
 		rtpPipeline, err := Chain(i, sink, pacer, packetizer, frameInter, encoder)
 		assert.NoError(t, err)
+		assert.NoError(t, pacer.Start(ctx))
 
 		fps := float64(i.TimebaseNum) / float64(i.TimebaseDen)
 		frameDuration := time.Duration(float64(time.Second) / fps)
@@ -193,20 +196,19 @@ func testDepacketizerFrameIntegrityWithCodec(t *testing.T, codec codec.CodecType
 		}
 
 		assert.NoError(t, depacketizer.Close())
-		wg.Wait()
 		synctest.Wait()
 	})
 }
 
 func TestDepacketizerRTPdropsVP8(t *testing.T) {
-	testDepacketizerRTPdropsWithCodec(t, codec.VP8)
+	testDepacketizerRTPdropsWithCodec(t, mrtp.VP8)
 }
 
 func TestDepacketizerRTPdropsVP9(t *testing.T) {
-	testDepacketizerRTPdropsWithCodec(t, codec.VP9)
+	testDepacketizerRTPdropsWithCodec(t, mrtp.VP9)
 }
 
-func testDepacketizerRTPdropsWithCodec(t *testing.T, codec codec.CodecType) {
+func testDepacketizerRTPdropsWithCodec(t *testing.T, codec mrtp.Codec) {
 	// video file must exist
 	if _, err := os.Stat("../simulation/Johnny_1280x720_60.y4m"); os.IsNotExist(err) {
 		println("Video file not found. See simulation folder for more information.\n")
@@ -232,13 +234,16 @@ func testDepacketizerRTPdropsWithCodec(t *testing.T, codec codec.CodecType) {
 				receivedFrames = append(receivedFrames, frameCopy)
 			}
 			receivedFrameCount++
+		}, func(err error) {
+			assert.NoError(t, err)
 		})
 		assert.NoError(t, err)
+		droppedFrameCount := 0
+		depacketizer.onFrameDropped = func() {
+			droppedFrameCount++
+		}
 
-		var wg sync.WaitGroup
-		wg.Go(func() {
-			depacketizer.Run()
-		})
+		depacketizer.start(ctx)
 
 		// Sink writes to depacketizer
 		sink := WriterFunc(func(b []byte, _ Attributes) error {
@@ -264,7 +269,7 @@ func testDepacketizerRTPdropsWithCodec(t *testing.T, codec codec.CodecType) {
 			ClockRate: 90_000,
 			Codec:     codec,
 		}
-		pacer := NewFrameSpacer(ctx)
+		pacer := NewFrameSpacer()
 		defer func() {
 			assert.NoError(t, pacer.Close())
 		}()
@@ -274,6 +279,7 @@ func testDepacketizerRTPdropsWithCodec(t *testing.T, codec codec.CodecType) {
 
 		rtpPipeline, err := Chain(i, sink, pacer, dropInter, packetizer, frameInter, encoder)
 		assert.NoError(t, err)
+		assert.NoError(t, pacer.Start(ctx))
 
 		fps := float64(i.TimebaseNum) / float64(i.TimebaseDen)
 		frameDuration := time.Duration(float64(time.Second) / fps)
@@ -292,6 +298,10 @@ func testDepacketizerRTPdropsWithCodec(t *testing.T, codec codec.CodecType) {
 		expectedReceivedFrames := frameInter.count - len(framesToBeDropped)
 		assert.Equal(t, expectedReceivedFrames, receivedFrameCount)
 
+		// consecutive lost frames may be reported as a single drop
+		assert.Positive(t, droppedFrameCount)
+		assert.LessOrEqual(t, droppedFrameCount, len(framesToBeDropped))
+
 		// compare each frame, skipping the dropped ones
 		receivedIdx := 0
 		for sentIdx := 0; sentIdx < len(frameInter.sentFrames); sentIdx++ {
@@ -307,7 +317,6 @@ func testDepacketizerRTPdropsWithCodec(t *testing.T, codec codec.CodecType) {
 		}
 
 		assert.NoError(t, depacketizer.Close())
-		wg.Wait()
 		synctest.Wait()
 	})
 }
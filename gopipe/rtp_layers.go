@@ -0,0 +1,255 @@
+package gopipe
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"sync/atomic"
+
+	"github.com/mengelbart/mrtp"
+	"github.com/pion/rtp"
+	"github.com/pion/rtp/codecs"
+)
+
+// rtpLayer describes the layer frame that is passed to a layerPayloader next.
+type rtpLayer struct {
+	temporalLayerID int
+	spatialLayerID  int
+	isKeyFrame      bool
+}
+
+// layerPayloader is an RTP payloader that writes the layer IDs of frames into
+// the payload descriptor.
+type layerPayloader interface {
+	rtp.Payloader
+	setLayer(l rtpLayer)
+}
+
+// newLayerPayloader returns a layer aware payloader for codec, or nil if the
+// payload format of codec has no layer IDs. It is only used for layered
+// streams. The VP9 payloader does not send the scalability structure, single
+// layer VP9 streams use the pion payloader, which sends it on keyframes.
+func newLayerPayloader(codec mrtp.Codec) layerPayloader {
+	switch codec {
+	case mrtp.VP8:
+		return &vp8LayerPayloader{pictureID: uint16(rand.IntN(0x8000))}
+	case mrtp.VP9:
+		return &vp9LayerPayloader{pictureID: uint16(rand.IntN(0x8000))}
+	}
+	return nil
+}
+
+// vp8LayerPayloader writes VP8 payload descriptors (RFC 7741) with picture
+// ID, TL0PICIDX and TID.
+type vp8LayerPayloader struct {
+	layer     rtpLayer
+	pictureID uint16
+	tl0PicIdx uint8
+}
+
+func (p *vp8LayerPayloader) setLayer(l rtpLayer) {
+	p.layer = l
+	p.pictureID = (p.pictureID + 1) & 0x7fff
+	if l.temporalLayerID == 0 {
+		p.tl0PicIdx++
+	}
+}
+
+func (p *vp8LayerPayloader) Payload(mtu uint16, payload []byte) [][]byte {
+	/*
+	 *       +-+-+-+-+-+-+-+-+
+	 *       |X|R|N|S|R| PID |
+	 *       +-+-+-+-+-+-+-+-+
+	 *  X:   |I|L|T|K| RSV   |
+	 *       +-+-+-+-+-+-+-+-+
+	 *  I:   |M| PictureID   |
+	 *       +-+-+-+-+-+-+-+-+
+	 *       |   PictureID   |
+	 *       +-+-+-+-+-+-+-+-+
+	 *  L:   |   TL0PICIDX   |
+	 *       +-+-+-+-+-+-+-+-+
+	 *  T/K: |TID|Y| KEYIDX  |
+	 *       +-+-+-+-+-+-+-+-+
+	 */
+	const headerSize = 6
+	return fragment(mtu, headerSize, payload, func(out []byte, first, _ bool) {
+		out[0] = 0x80 // X=1
+		if first {
+			out[0] |= 0x10 // S=1
+		}
+		out[1] = 0x80 | 0x40 | 0x20 // I=1, L=1, T=1
+		out[2] = 0x80 | byte(p.pictureID>>8)
+		out[3] = byte(p.pictureID)
+		out[4] = p.tl0PicIdx
+		out[5] = byte(p.layer.temporalLayerID&0x03) << 6
+	})
+}
+
+// vp9LayerPayloader writes VP9 payload descriptors in non-flexible mode with
+// picture ID and layer indices. Layer frames of the same picture share the
+// picture ID.
+type vp9LayerPayloader struct {
+	layer     rtpLayer
+	pictureID uint16
+	tl0PicIdx uint8
+}
+
+func (p *vp9LayerPayloader) setLayer(l rtpLayer) {
+	p.layer = l
+	if l.spatialLayerID > 0 {
+		return
+	}
+	p.pictureID = (p.pictureID + 1) & 0x7fff
+	if l.temporalLayerID == 0 {
+		p.tl0PicIdx++
+	}
+}
+
+func (p *vp9LayerPayloader) Payload(mtu uint16, payload []byte) [][]byte {
+	/*
+	 *       +-+-+-+-+-+-+-+-+
+	 *       |I|P|L|F|B|E|V|Z|
+	 *       +-+-+-+-+-+-+-+-+
+	 *  I:   |M| PICTURE ID  |
+	 *       +-+-+-+-+-+-+-+-+
+	 *  M:   | EXTENDED PID  |
+	 *       +-+-+-+-+-+-+-+-+
+	 *  L:   | TID |U| SID |D|
+	 *       +-+-+-+-+-+-+-+-+
+	 *       |   TL0PICIDX   |
+	 *       +-+-+-+-+-+-+-+-+
+	 */
+	const headerSize = 5
+	return fragment(mtu, headerSize, payload, func(out []byte, first, last bool) {
+		out[0] = 0x80 | 0x20 // I=1, L=1
+		if !p.layer.isKeyFrame {
+			out[0] |= 0x40 // P=1
+		}
+		if first {
+			out[0] |= 0x08 // B=1
+		}
+		if last {
+			out[0] |= 0x04 // E=1
+		}
+		out[1] = 0x80 | byte(p.pictureID>>8)
+		out[2] = byte(p.pictureID)
+		out[3] = byte(p.layer.temporalLayerID&0x07)<<5 | byte(p.layer.spatialLayerID&0x07)<<1
+		if p.layer.spatialLayerID > 0 {
+			out[3] |= 0x01 // D=1
+		}
+		out[4] = p.tl0PicIdx
+	})
+}
+
+// fragment splits payload into packets of at most mtu bytes with a header
+// of headerSize bytes, which writeHeader fills in.
+func fragment(mtu uint16, headerSize int, payload []byte, writeHeader func(out []byte, first, last bool)) [][]byte {
+	maxFragmentSize := int(mtu) - headerSize
+	if maxFragmentSize <= 0 || len(payload) == 0 {
+		return [][]byte{}
+	}
+	var payloads [][]byte
+	for offset := 0; offset < len(payload); offset += maxFragmentSize {
+		size := min(maxFragmentSize, len(payload)-offset)
+		out := make([]byte, headerSize+size)
+		writeHeader(out, offset == 0, offset+size == len(payload))
+		copy(out[headerSize:], payload[offset:offset+size])
+		payloads = append(payloads, out)
+	}
+	return payloads
+}
+
+// RTPLayerFilter forwards RTP packets of VP8 and VP9 streams up to a maximum
+// spatial and temporal layer. Packets of upper layers are dropped and the
+// sequence numbers of the remaining packets are rewritten to stay
+// continuous, so that a relay or receiver can reduce the rate of a layered
+// stream without re-encoding.
+type RTPLayerFilter struct {
+	codec mrtp.Codec
+
+	maxSpatialLayer  atomic.Int64
+	maxTemporalLayer atomic.Int64
+
+	dropped uint16
+}
+
+// NewRTPLayerFilter creates a filter for codec that initially forwards all
+// layers.
+func NewRTPLayerFilter(codec mrtp.Codec) (*RTPLayerFilter, error) {
+	if codec != mrtp.VP8 && codec != mrtp.VP9 {
+		return nil, fmt.Errorf("layer filter not supported for codec: %v", codec)
+	}
+	f := &RTPLayerFilter{
+		codec: codec,
+	}
+	f.SetMaxLayers(-1, -1)
+	return f, nil
+}
+
+// Codec returns the codec of the filtered packets.
+func (f *RTPLayerFilter) Codec() mrtp.Codec {
+	return f.codec
+}
+
+// SetMaxLayers sets the highest spatial and temporal layer IDs that are
+// forwarded. Negative values forward all layers.
+func (f *RTPLayerFilter) SetMaxLayers(spatial, temporal int) {
+	f.maxSpatialLayer.Store(int64(spatial))
+	f.maxTemporalLayer.Store(int64(temporal))
+}
+
+func (f *RTPLayerFilter) Link(next Sink, _ Info) (Sink, error) {
+	return WriterFunc(func(b []byte, a Attributes) error {
+		pkt := &rtp.Packet{}
+		if err := pkt.Unmarshal(b); err != nil {
+			return err
+		}
+		forward, endOfPicture, err := f.filter(pkt.Payload)
+		if err != nil {
+			return err
+		}
+		if !forward {
+			f.dropped++
+			return nil
+		}
+		if f.dropped == 0 && !endOfPicture {
+			return next.Write(b, a)
+		}
+		// the header keeps its size, rewrite it in place
+		pkt.SequenceNumber -= f.dropped
+		pkt.Marker = pkt.Marker || endOfPicture
+		if _, err := pkt.Header.MarshalTo(b); err != nil {
+			return err
+		}
+		return next.Write(b, a)
+	}), nil
+}
+
+// filter reports whether a packet with payload should be forwarded and
+// whether it ends the picture after upper spatial layers were dropped.
+func (f *RTPLayerFilter) filter(payload []byte) (forward, endOfPicture bool, err error) {
+	maxSpatial := f.maxSpatialLayer.Load()
+	maxTemporal := f.maxTemporalLayer.Load()
+
+	switch f.codec {
+	case mrtp.VP8:
+		var vp8 codecs.VP8Packet
+		if _, err = vp8.Unmarshal(payload); err != nil {
+			return false, false, err
+		}
+		forward = maxTemporal < 0 || vp8.T == 0 || int64(vp8.TID) <= maxTemporal
+		return forward, false, nil
+	case mrtp.VP9:
+		var vp9 codecs.VP9Packet
+		if _, err = vp9.Unmarshal(payload); err != nil {
+			return false, false, err
+		}
+		if !vp9.L {
+			return true, false, nil
+		}
+		forward = (maxTemporal < 0 || int64(vp9.TID) <= maxTemporal) &&
+			(maxSpatial < 0 || int64(vp9.SID) <= maxSpatial)
+		endOfPicture = forward && vp9.E && int64(vp9.SID) == maxSpatial
+		return forward, endOfPicture, nil
+	}
+	return true, false, nil
+}
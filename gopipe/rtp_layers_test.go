@@ -0,0 +1,227 @@
+package gopipe
+
+import (
+	"bytes"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/mengelbart/mrtp"
+	"github.com/mengelbart/mrtp/gopipe/codec"
+	"github.com/pion/rtp"
+	"github.com/pion/rtp/codecs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type layeredFrame struct {
+	temporalLayerID   int
+	spatialLayerSizes []int
+	isKeyFrame        bool
+}
+
+// packetizeLayeredFrames packetizes frames of a layered stream of codec with
+// the given layer attributes and passes the packets through the processors.
+func packetizeLayeredFrames(t *testing.T, c mrtp.Codec, frames []layeredFrame, processors ...Processor) []*rtp.Packet {
+	t.Helper()
+
+	var pkts []*rtp.Packet
+	sink := WriterFunc(func(b []byte, _ Attributes) error {
+		// the packetizer reuses b
+		pkt := &rtp.Packet{}
+		require.NoError(t, pkt.Unmarshal(slices.Clone(b)))
+		pkts = append(pkts, pkt)
+		return nil
+	})
+	packetizer := &RTPPacketizerFactory{
+		MTU:       200,
+		PT:        96,
+		SSRC:      0,
+		ClockRate: 90_000,
+		Codec:     c,
+		// the layers of the mode are not checked against the frames
+		ScalabilityMode: codec.ScalabilityMode{SpatialLayers: 2, TemporalLayers: 3},
+	}
+	info := Info{TimebaseNum: 30, TimebaseDen: 1}
+	w, err := Chain(info, sink, append(processors, packetizer)...)
+	require.NoError(t, err)
+
+	for i, f := range frames {
+		size := 300
+		a := Attributes{
+			PTS:             int64(i),
+			FrameDuration:   33 * time.Millisecond,
+			IsKeyFrame:      f.isKeyFrame,
+			TemporalLayerID: f.temporalLayerID,
+		}
+		if f.spatialLayerSizes != nil {
+			a[SpatialLayerSizes] = f.spatialLayerSizes
+			size = 0
+			for _, s := range f.spatialLayerSizes {
+				size += s
+			}
+		}
+		require.NoError(t, w.Write(bytes.Repeat([]byte{byte(i)}, size), a))
+	}
+	return pkts
+}
+
+func assertContinuousSequenceNumbers(t *testing.T, pkts []*rtp.Packet) {
+	t.Helper()
+	for i := 1; i < len(pkts); i++ {
+		assert.Equal(t, pkts[i-1].SequenceNumber+1, pkts[i].SequenceNumber)
+	}
+}
+
+func TestRTPPacketizerVP8TemporalLayers(t *testing.T) {
+	frames := []layeredFrame{
+		{temporalLayerID: 0, isKeyFrame: true},
+		{temporalLayerID: 2},
+		{temporalLayerID: 1},
+		{temporalLayerID: 2},
+		{temporalLayerID: 0},
+	}
+	pkts := packetizeLayeredFrames(t, mrtp.VP8, frames)
+	require.Len(t, pkts, 2*len(frames))
+
+	for i, pkt := range pkts {
+		frame := i / 2
+		var vp8 codecs.VP8Packet
+		payload, err := vp8.Unmarshal(pkt.Payload)
+		require.NoError(t, err)
+		assert.Equal(t, uint8(1), vp8.T)
+		assert.Equal(t, uint8(frames[frame].temporalLayerID), vp8.TID)
+		assert.Equal(t, i%2 == 0, vp8.S == 1)
+		assert.Equal(t, i%2 == 1, pkt.Marker)
+		assert.Equal(t, bytes.Repeat([]byte{byte(frame)}, len(payload)), payload)
+		if frame > 0 && i%2 == 0 {
+			var prev codecs.VP8Packet
+			_, err = prev.Unmarshal(pkts[i-1].Payload)
+			require.NoError(t, err)
+			assert.Equal(t, (prev.PictureID+1)&0x7fff, vp8.PictureID)
+			if vp8.TID == 0 {
+				assert.Equal(t, prev.TL0PICIDX+1, vp8.TL0PICIDX)
+			} else {
+				assert.Equal(t, prev.TL0PICIDX, vp8.TL0PICIDX)
+			}
+		}
+	}
+}
+
+func TestRTPPacketizerVP9SpatialLayers(t *testing.T) {
+	frames := []layeredFrame{
+		{temporalLayerID: 0, spatialLayerSizes: []int{100, 300}, isKeyFrame: true},
+		{temporalLayerID: 1, spatialLayerSizes: []int{100, 300}},
+	}
+	pkts := packetizeLayeredFrames(t, mrtp.VP9, frames)
+	// one packet for layer 0 and two for layer 1 per frame
+	require.Len(t, pkts, 6)
+
+	expectedSIDs := []uint8{0, 1, 1, 0, 1, 1}
+	for i, pkt := range pkts {
+		frame := i / 3
+		var vp9 codecs.VP9Packet
+		_, err := vp9.Unmarshal(pkt.Payload)
+		require.NoError(t, err)
+		assert.True(t, vp9.L)
+		assert.Equal(t, expectedSIDs[i], vp9.SID)
+		assert.Equal(t, uint8(frames[frame].temporalLayerID), vp9.TID)
+		assert.Equal(t, !frames[frame].isKeyFrame, vp9.P)
+		assert.Equal(t, vp9.SID > 0, vp9.D)
+		assert.Equal(t, i%3 != 2, vp9.B)
+		assert.Equal(t, i%3 != 1, vp9.E)
+		assert.Equal(t, i%3 == 2, pkt.Marker)
+		assert.Equal(t, pkts[frame*3].Timestamp, pkt.Timestamp)
+	}
+	var first, second codecs.VP9Packet
+	_, err := first.Unmarshal(pkts[0].Payload)
+	require.NoError(t, err)
+	_, err = second.Unmarshal(pkts[2].Payload)
+	require.NoError(t, err)
+	assert.Equal(t, first.PictureID, second.PictureID)
+	assert.NotEqual(t, pkts[0].Timestamp, pkts[3].Timestamp)
+}
+
+func TestRTPPacketizerSingleLayer(t *testing.T) {
+	var pkts []*rtp.Packet
+	sink := WriterFunc(func(b []byte, _ Attributes) error {
+		pkt := &rtp.Packet{}
+		require.NoError(t, pkt.Unmarshal(slices.Clone(b)))
+		pkts = append(pkts, pkt)
+		return nil
+	})
+	packetizer := &RTPPacketizerFactory{
+		MTU:       200,
+		PT:        96,
+		ClockRate: 90_000,
+		Codec:     mrtp.VP8,
+	}
+	w, err := Chain(Info{TimebaseNum: 30, TimebaseDen: 1}, sink, packetizer)
+	require.NoError(t, err)
+	require.NoError(t, w.Write(make([]byte, 100), Attributes{
+		PTS:             int64(0),
+		FrameDuration:   33 * time.Millisecond,
+		IsKeyFrame:      true,
+		TemporalLayerID: 0,
+	}))
+
+	// single layer streams use the payloader of the codec registry, which
+	// does not write layer indices
+	require.Len(t, pkts, 1)
+	var vp8 codecs.VP8Packet
+	_, err = vp8.Unmarshal(pkts[0].Payload)
+	require.NoError(t, err)
+	assert.Equal(t, uint8(0), vp8.T)
+	assert.Equal(t, uint8(0), vp8.L)
+}
+
+func TestRTPLayerFilter(t *testing.T) {
+	t.Run("VP8 temporal layers", func(t *testing.T) {
+		filter, err := NewRTPLayerFilter(mrtp.VP8)
+		require.NoError(t, err)
+		filter.SetMaxLayers(-1, 1)
+
+		frames := []layeredFrame{
+			{temporalLayerID: 0, isKeyFrame: true},
+			{temporalLayerID: 2},
+			{temporalLayerID: 1},
+			{temporalLayerID: 2},
+			{temporalLayerID: 0},
+		}
+		pkts := packetizeLayeredFrames(t, mrtp.VP8, frames, filter)
+		require.Len(t, pkts, 6)
+		assertContinuousSequenceNumbers(t, pkts)
+		for _, pkt := range pkts {
+			var vp8 codecs.VP8Packet
+			_, err = vp8.Unmarshal(pkt.Payload)
+			require.NoError(t, err)
+			assert.LessOrEqual(t, vp8.TID, uint8(1))
+		}
+	})
+
+	t.Run("VP9 spatial layers", func(t *testing.T) {
+		filter, err := NewRTPLayerFilter(mrtp.VP9)
+		require.NoError(t, err)
+		filter.SetMaxLayers(0, -1)
+
+		frames := []layeredFrame{
+			{temporalLayerID: 0, spatialLayerSizes: []int{100, 300}, isKeyFrame: true},
+			{temporalLayerID: 1, spatialLayerSizes: []int{100, 300}},
+		}
+		pkts := packetizeLayeredFrames(t, mrtp.VP9, frames, filter)
+		require.Len(t, pkts, 2)
+		assertContinuousSequenceNumbers(t, pkts)
+		for _, pkt := range pkts {
+			var vp9 codecs.VP9Packet
+			_, err = vp9.Unmarshal(pkt.Payload)
+			require.NoError(t, err)
+			assert.Equal(t, uint8(0), vp9.SID)
+			assert.True(t, pkt.Marker)
+		}
+	})
+
+	t.Run("unsupported codec", func(t *testing.T) {
+		_, err := NewRTPLayerFilter(mrtp.H264)
+		assert.Error(t, err)
+	})
+}
@@ -1,37 +1,26 @@
 package gopipe
 
 import (
-	"fmt"
 	"log/slog"
 	"time"
 
+	"github.com/mengelbart/mrtp"
 	"github.com/mengelbart/mrtp/gopipe/codec"
 	"github.com/mengelbart/mrtp/internal/logging"
 	"github.com/pion/rtp"
-	"github.com/pion/rtp/codecs"
 )
 
-func getPacketizerByName(c codec.CodecType) (rtp.Payloader, error) {
-	switch c {
-	case codec.VP8:
-		return &codecs.VP8Payloader{}, nil
-	case codec.VP9:
-		return &codecs.VP9Payloader{}, nil
-	case codec.H264:
-		return &codecs.H264Payloader{}, nil
-	case codec.FAKE:
-		// use G722 as 0s are a valid payload for it
-		return &codecs.G722Payloader{}, nil
-	}
-	return nil, fmt.Errorf("unknown codec: %v", c)
-}
-
 type RTPPacketizerFactory struct {
 	MTU       uint16
 	PT        uint8
 	SSRC      uint32
 	ClockRate uint32
-	Codec     codec.CodecType
+	Codec     mrtp.Codec
+
+	// ScalabilityMode is the mode of the encoded stream. Layered VP8 and
+	// VP9 streams carry the layer IDs of each frame in the payload
+	// descriptor. All other streams use the payloader of Codec.
+	ScalabilityMode codec.ScalabilityMode
 }
 
 type RTPPacketizer struct {
@@ -42,7 +31,18 @@ type RTPPacketizer struct {
 
 	frameDuration time.Duration
 	packetizer    rtp.Packetizer
-	writer        Sink
+
+	// nextPTS is the PTS that follows the last frame. Gaps to it, e.g. of
+	// frames dropped upstream, are skipped in the RTP timestamps.
+	nextPTS    int64
+	hasNextPTS bool
+	layers     layerPayloader // nil for codecs without layer IDs in RTP
+	writer     Sink
+
+	// buf holds the marshaled packets of the current frame, pktBufs slices
+	// it into packets. Both are reused for the next frame.
+	buf     []byte
+	pktBufs [][]byte
 
 	unwrapper *logging.Unwrapper // for logging the rtp packets
 }
@@ -51,9 +51,19 @@ func (p *RTPPacketizerFactory) Link(w Sink, i Info) (Sink, error) {
 	fps := float64(i.TimebaseNum) / float64(i.TimebaseDen)
 	frameDuration := time.Duration(float64(time.Second) / fps)
 
-	payloader, err := getPacketizerByName(p.Codec)
-	if err != nil {
-		return nil, err
+	var payloader rtp.Payloader
+	var layers layerPayloader
+	if p.ScalabilityMode.IsLayered() {
+		layers = newLayerPayloader(p.Codec)
+	}
+	if layers != nil {
+		payloader = layers
+	} else {
+		var err error
+		payloader, err = p.Codec.NewPayloader()
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	packetizer := rtp.NewPacketizer(p.MTU, p.PT, p.SSRC, payloader, rtp.NewRandomSequencer(), p.ClockRate)
@@ -64,28 +74,54 @@ func (p *RTPPacketizerFactory) Link(w Sink, i Info) (Sink, error) {
 		ClockRate:     p.ClockRate,
 		frameDuration: frameDuration,
 		packetizer:    packetizer,
+		layers:        layers,
 		writer:        w,
 		unwrapper:     &logging.Unwrapper{},
 	}, nil
 }
 
 func (p *RTPPacketizer) Write(encFrame []byte, a Attributes) error {
-	samples := uint32(p.frameDuration.Seconds() * float64(p.ClockRate))
-	pkts := p.packetizer.Packetize(encFrame, samples)
-	pktBufs := make([][]byte, 0)
-
-	// get PTS from attributes for logging
+	frameDuration, err := getFrameDuration(a)
+	if err != nil {
+		frameDuration = p.frameDuration
+	}
+	// get PTS from attributes for logging and the RTP timestamp
 	pts, err := getPTS(a)
 	if err != nil {
 		return err
 	}
+	if p.hasNextPTS && pts > p.nextPTS {
+		gap := time.Duration(pts-p.nextPTS) * time.Microsecond
+		p.packetizer.SkipSamples(uint32(gap.Seconds() * float64(p.ClockRate)))
+	}
+	p.nextPTS = pts + frameDuration.Microseconds()
+	p.hasNextPTS = true
 
+	samples := uint32(frameDuration.Seconds() * float64(p.ClockRate))
+	var pkts []*rtp.Packet
+	if p.layers != nil {
+		pkts = p.packetizeLayers(encFrame, samples, a)
+	} else {
+		pkts = p.packetizer.Packetize(encFrame, samples)
+	}
+
+	size := 0
+	for _, pkt := range pkts {
+		size += pkt.MarshalSize()
+	}
+	if cap(p.buf) < size {
+		p.buf = make([]byte, size)
+	}
+	p.buf = p.buf[:size]
+	p.pktBufs = p.pktBufs[:0]
+	offset := 0
 	for _, pkt := range pkts {
-		buf, err := pkt.Marshal()
+		n, err := pkt.MarshalTo(p.buf[offset:])
 		if err != nil {
 			return err
 		}
-		pktBufs = append(pktBufs, buf)
+		p.pktBufs = append(p.pktBufs, p.buf[offset:offset+n:offset+n])
+		offset += n
 
 		// log packet
 		slog.Info("rtp to pts mapping",
@@ -96,11 +132,11 @@ func (p *RTPPacketizer) Write(encFrame []byte, a Attributes) error {
 		)
 	}
 	if writer, ok := p.writer.(MultiWriter); ok {
-		if err := writer.WriteAll(pktBufs, a); err != nil {
+		if err := writer.WriteAll(p.pktBufs, a); err != nil {
 			return err
 		}
 	} else {
-		for _, pkt := range pktBufs {
+		for _, pkt := range p.pktBufs {
 			if err := p.writer.Write(pkt, a); err != nil {
 				return err
 			}
@@ -108,3 +144,39 @@ func (p *RTPPacketizer) Write(encFrame []byte, a Attributes) error {
 	}
 	return nil
 }
+
+// packetizeLayers packetizes each spatial layer frame of encFrame on its own.
+// All layer frames share the RTP timestamp and only the last packet of the
+// highest layer has the marker bit set.
+func (p *RTPPacketizer) packetizeLayers(encFrame []byte, samples uint32, a Attributes) []*rtp.Packet {
+	temporalLayerID, err := getTemporalLayerID(a)
+	if err != nil {
+		temporalLayerID = 0
+	}
+	isKeyFrame, _ := a[IsKeyFrame].(bool)
+	sizes, err := getSpatialLayerSizes(a)
+	if err != nil {
+		sizes = []int{len(encFrame)}
+	}
+
+	var pkts []*rtp.Packet
+	offset := 0
+	for i, size := range sizes {
+		p.layers.setLayer(rtpLayer{
+			temporalLayerID: temporalLayerID,
+			spatialLayerID:  i,
+			isKeyFrame:      isKeyFrame,
+		})
+		layerSamples := uint32(0)
+		if i == len(sizes)-1 {
+			layerSamples = samples
+		}
+		layerPkts := p.packetizer.Packetize(encFrame[offset:offset+size], layerSamples)
+		if i < len(sizes)-1 && len(layerPkts) > 0 {
+			layerPkts[len(layerPkts)-1].Marker = false
+		}
+		pkts = append(pkts, layerPkts...)
+		offset += size
+	}
+	return pkts
+}
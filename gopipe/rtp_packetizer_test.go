@@ -0,0 +1,44 @@
+package gopipe
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mengelbart/mrtp"
+	"github.com/stretchr/testify/require"
+)
+
+func BenchmarkRTPPacketizer(b *testing.B) {
+	for _, c := range []mrtp.Codec{mrtp.VP8, mrtp.VP9, mrtp.H264} {
+		b.Run(c.String(), func(b *testing.B) {
+			factory := &RTPPacketizerFactory{
+				MTU:       1200,
+				PT:        96,
+				SSRC:      1,
+				ClockRate: 90_000,
+				Codec:     c,
+			}
+			sink := WriterFunc(func([]byte, Attributes) error { return nil })
+			w, err := factory.Link(sink, Info{TimebaseNum: 30, TimebaseDen: 1})
+			require.NoError(b, err)
+
+			frame := make([]byte, 10_000)
+			switch c {
+			case mrtp.VP9:
+				// the uncompressed header of a keyframe, the VP9 payloader
+				// drops frames it cannot parse
+				copy(frame, []byte{0x82, 0x49, 0x83, 0x42, 0x00, 0x77, 0xf0, 0x32})
+			case mrtp.H264:
+				// a single IDR NAL unit in Annex B format
+				copy(frame, []byte{0, 0, 0, 1, 0x65})
+			}
+			attrs := Attributes{PTS: int64(0), FrameDuration: 33 * time.Millisecond}
+
+			b.ReportAllocs()
+			b.SetBytes(int64(len(frame)))
+			for b.Loop() {
+				require.NoError(b, w.Write(frame, attrs))
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package gopipe
+
+import (
+	"fmt"
+	"image"
+	"sync"
+
+	"github.com/mengelbart/mrtp/gopipe/codec"
+)
+
+// Scaler scales planar YCbCr frames to the resolution set with
+// SetResolution. Frames are passed through unchanged until a resolution is
+// set. The output resolution is written to the Width and Height attributes.
+// Frames without ChromaSubsampling attribute are taken as 4:2:0.
+type Scaler struct {
+	lock   sync.Mutex
+	width  int
+	height int
+}
+
+func NewScaler() *Scaler {
+	return &Scaler{}
+}
+
+// SetResolution sets the output resolution. Width and height must be even.
+// Zero values pass frames through at the input resolution.
+func (s *Scaler) SetResolution(width, height int) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.width, s.height = width, height
+}
+
+func (s *Scaler) resolution() (int, int) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.width, s.height
+}
+
+func (s *Scaler) Link(next Sink, i Info) (Sink, error) {
+	return WriterFunc(func(b []byte, a Attributes) error {
+		srcWidth, err := getWidth(a)
+		if err != nil {
+			srcWidth = int(i.Width)
+		}
+		srcHeight, err := getHeight(a)
+		if err != nil {
+			srcHeight = int(i.Height)
+		}
+		csr, err := getChromaSubsampling(a)
+		if err != nil {
+			csr = image.YCbCrSubsampleRatio420
+		}
+
+		width, height := s.resolution()
+		if width == 0 || height == 0 || (width == srcWidth && height == srcHeight) {
+			a[Width] = srcWidth
+			a[Height] = srcHeight
+			return next.Write(b, a)
+		}
+		if len(b) < codec.FrameSize(srcWidth, srcHeight, csr) {
+			return fmt.Errorf("scaler: frame too short for %vx%v %v: %v bytes", srcWidth, srcHeight, csr, len(b))
+		}
+
+		scaled := make([]byte, codec.FrameSize(width, height, csr))
+		scaleFrame(scaled, b, srcWidth, srcHeight, width, height, csr)
+		a[Width] = width
+		a[Height] = height
+		return next.Write(scaled, a)
+	}), nil
+}
+
+// scaleFrame scales the frame src of size srcWidth x srcHeight with chroma
+// subsampling csr into dst of size width x height.
+func scaleFrame(dst, src []byte, srcWidth, srcHeight, width, height int, csr image.YCbCrSubsampleRatio) {
+	srcYSize := srcWidth * srcHeight
+	srcCWidth, srcCHeight := codec.ChromaSize(srcWidth, srcHeight, csr)
+	srcCSize := srcCWidth * srcCHeight
+
+	ySize := width * height
+	cWidth, cHeight := codec.ChromaSize(width, height, csr)
+	cSize := cWidth * cHeight
+
+	scalePlane(dst[:ySize], src[:srcYSize], srcWidth, srcHeight, width, height)
+	scalePlane(dst[ySize:ySize+cSize], src[srcYSize:srcYSize+srcCSize], srcCWidth, srcCHeight, cWidth, cHeight)
+	scalePlane(dst[ySize+cSize:ySize+2*cSize], src[srcYSize+srcCSize:srcYSize+2*srcCSize], srcCWidth, srcCHeight, cWidth, cHeight)
+}
+
+// scalePlane scales a plane with a box filter: each output sample is the
+// average of the input samples it covers. When upscaling, this is nearest
+// neighbour sampling.
+func scalePlane(dst, src []byte, srcWidth, srcHeight, width, height int) {
+	for y := range height {
+		y0 := y * srcHeight / height
+		y1 := max((y+1)*srcHeight/height, y0+1)
+		for x := range width {
+			x0 := x * srcWidth / width
+			x1 := max((x+1)*srcWidth/width, x0+1)
+			sum := 0
+			for sy := y0; sy < y1; sy++ {
+				row := src[sy*srcWidth:]
+				for sx := x0; sx < x1; sx++ {
+					sum += int(row[sx])
+				}
+			}
+			n := (y1 - y0) * (x1 - x0)
+			dst[y*width+x] = byte((sum + n/2) / n)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package gopipe
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+)
+
+// Tee duplicates the frames of a pipeline to additional branches, e.g. to
+// record the encoded frames next to sending them. The sink linked to the tee
+// is the main path: its errors are returned by Write. Errors of branches,
+// including the errors their elements post on the bus, are posted as warnings
+// and do not affect the main path or other branches. Branches are written
+// synchronously before the main path, so slow branches should start with a
+// [Queue]. The tee owns the elements of its branches: it starts, notifies and
+// closes them with itself.
+type Tee struct {
+	branches []*teeBranch
+	next     Sink
+	bus      *Bus
+}
+
+type teeBranch struct {
+	sink       Sink
+	processors []Processor
+	// elements in the direction of the data flow
+	elements []any
+
+	// each branch gets its own copy of the borrowed buffers, since sinks
+	// may modify them in place
+	buf  []byte
+	bufs [][]byte
+}
+
+func NewTee() *Tee {
+	return &Tee{}
+}
+
+// AddBranch adds a branch that ends in sink. The processors are listed like
+// in [Chain], i.e. the last processor is the first to receive the frames. It
+// must be called before Link.
+func (t *Tee) AddBranch(sink Sink, processors ...Processor) {
+	var elements []any
+	for _, p := range slices.Backward(processors) {
+		elements = append(elements, p)
+	}
+	t.branches = append(t.branches, &teeBranch{
+		sink:       sink,
+		processors: processors,
+		elements:   append(elements, sink),
+	})
+}
+
+func (t *Tee) Link(next Sink, i Info) (Sink, error) {
+	for _, b := range t.branches {
+		sink, err := Chain(i, b.sink, b.processors...)
+		if err != nil {
+			return nil, err
+		}
+		b.sink = sink
+	}
+	t.next = next
+	return t, nil
+}
+
+// SetBus sets the bus of the tee and the elements of its branches. The
+// elements of branches post their errors as warnings.
+func (t *Tee) SetBus(bus *Bus) {
+	t.bus = bus
+	branchBus := bus.warnings()
+	for _, b := range t.branches {
+		for _, e := range b.elements {
+			if poster, ok := e.(BusPoster); ok {
+				poster.SetBus(branchBus)
+			}
+		}
+	}
+}
+
+// Start starts the elements of the branches.
+func (t *Tee) Start(ctx context.Context) error {
+	for _, b := range t.branches {
+		if err := startElements(ctx, b.elements); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// EndOfStream notifies the elements of the branches.
+func (t *Tee) EndOfStream() error {
+	var errs []error
+	for _, b := range t.branches {
+		errs = append(errs, endOfStream(b.elements))
+	}
+	return errors.Join(errs...)
+}
+
+// Close closes the elements of the branches.
+func (t *Tee) Close() error {
+	var errs []error
+	for _, b := range t.branches {
+		errs = append(errs, closeElements(b.elements))
+	}
+	return errors.Join(errs...)
+}
+
+func (t *Tee) Write(buf []byte, attrs Attributes) error {
+	for i, b := range t.branches {
+		b.buf = append(b.buf[:0], buf...)
+		if err := b.sink.Write(b.buf, maps.Clone(attrs)); err != nil {
+			t.bus.Warning(t, fmt.Errorf("branch %v: %w", i, err))
+		}
+	}
+	return t.next.Write(buf, attrs)
+}
+
+// WriteAll writes all packets of a frame to each branch, see [MultiWriter].
+func (t *Tee) WriteAll(bufs [][]byte, attrs Attributes) error {
+	for i, b := range t.branches {
+		b.bufs = slices.Grow(b.bufs[:0], len(bufs))[:len(bufs)]
+		for j, buf := range bufs {
+			b.bufs[j] = append(b.bufs[j][:0], buf...)
+		}
+		if err := writeAll(b.sink, b.bufs, maps.Clone(attrs)); err != nil {
+			t.bus.Warning(t, fmt.Errorf("branch %v: %w", i, err))
+		}
+	}
+	return writeAll(t.next, bufs, attrs)
+}
+
+// writeAll writes the packets of a frame at once if s is a [MultiWriter] and
+// one by one otherwise.
+func writeAll(s Sink, bufs [][]byte, attrs Attributes) error {
+	if w, ok := s.(MultiWriter); ok {
+		return w.WriteAll(bufs, attrs)
+	}
+	for _, buf := range bufs {
+		if err := s.Write(buf, attrs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package gopipe
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingSink records copies of the frames written to it.
+type recordingSink struct {
+	frames [][]byte
+	writes int
+}
+
+func (s *recordingSink) Write(b []byte, _ Attributes) error {
+	s.frames = append(s.frames, bytes.Clone(b))
+	s.writes++
+	return nil
+}
+
+func (s *recordingSink) WriteAll(bufs [][]byte, _ Attributes) error {
+	s.frames = append(s.frames, bytes.Join(bufs, nil))
+	s.writes++
+	return nil
+}
+
+func TestTee(t *testing.T) {
+	var main, branch recordingSink
+	failed := 0
+	// a branch that modifies the buffer in place and fails
+	failing := processorFunc(func(Sink, Info) (Sink, error) {
+		return WriterFunc(func(b []byte, a Attributes) error {
+			b[0] = 0
+			a[PTS] = int64(-1)
+			failed++
+			return errors.New("branch failed")
+		}), nil
+	})
+
+	tee := NewTee()
+	tee.AddBranch(&branch)
+	tee.AddBranch(nil, failing)
+	var pts []int64
+	mainProcessor := processorFunc(func(next Sink, _ Info) (Sink, error) {
+		return WriterFunc(func(b []byte, a Attributes) error {
+			pts = append(pts, a[PTS].(int64))
+			return next.Write(b, a)
+		}), nil
+	})
+	w, err := Chain(Info{}, &main, mainProcessor, tee)
+	require.NoError(t, err)
+
+	require.NoError(t, w.Write([]byte{1, 2}, Attributes{PTS: int64(1)}))
+	require.NoError(t, w.Write([]byte{3}, Attributes{PTS: int64(2)}))
+	assert.Equal(t, [][]byte{{1, 2}, {3}}, main.frames)
+	assert.Equal(t, [][]byte{{1, 2}, {3}}, branch.frames)
+	assert.Equal(t, []int64{1, 2}, pts)
+	assert.Equal(t, 2, failed)
+
+	// frames of multiple packets are passed at once to multi writers
+	require.NoError(t, tee.WriteAll([][]byte{{4}, {5, 6}}, Attributes{PTS: int64(3)}))
+	assert.Equal(t, [][]byte{{4}, {5, 6}}, main.frames[2:])
+	assert.Equal(t, []byte{4, 5, 6}, branch.frames[2])
+	assert.Equal(t, 3, branch.writes)
+	// the failing branch stops at the first packet
+	assert.Equal(t, 3, failed)
+
+	// errors of the main path are returned
+	tee = NewTee()
+	tee.AddBranch(&branch)
+	w, err = tee.Link(WriterFunc(func([]byte, Attributes) error {
+		return errors.New("main failed")
+	}), Info{})
+	require.NoError(t, err)
+	assert.Error(t, w.Write([]byte{7}, Attributes{}))
+	assert.Equal(t, []byte{7}, branch.frames[3])
+}
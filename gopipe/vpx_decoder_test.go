@@ -5,11 +5,11 @@ package gopipe
 import (
 	"context"
 	"os"
-	"sync"
 	"testing"
 	"testing/synctest"
 	"time"
 
+	"github.com/mengelbart/mrtp"
 	"github.com/mengelbart/mrtp/gopipe/codec"
 	"github.com/stretchr/testify/assert"
 )
@@ -26,7 +26,7 @@ func TestVpxDecode(t *testing.T) {
 
 		framesReceived := 0
 
-		decoder, err := codec.NewVPXDecoder(codec.VP8)
+		decoder, err := codec.NewVPXDecoder(mrtp.VP8)
 		assert.NoError(t, err)
 
 		sink := WriterFunc(func(frame []byte, attr Attributes) error {
@@ -49,7 +49,7 @@ func TestVpxDecode(t *testing.T) {
 		assert.NoError(t, err)
 
 		i := fileSrc.GetInfo()
-		encoder := NewEncoder(codec.VP8)
+		encoder := NewEncoder(mrtp.VP8)
 		frameInter := newFrameInterceptor(false, 0, nil)
 
 		writer, err := Chain(i, sink, encoder, frameInter)
@@ -72,7 +72,7 @@ func TestVpxDecodeWithRtpVP8(t *testing.T) {
 		t.Skip("video not found")
 	}
 
-	runVpxDecodeWithRTP(t, codec.VP8)
+	runVpxDecodeWithRTP(t, mrtp.VP8)
 }
 
 func TestVpxDecodeWithRtpVP9(t *testing.T) {
@@ -82,10 +82,10 @@ func TestVpxDecodeWithRtpVP9(t *testing.T) {
 		t.Skip("video not found")
 	}
 
-	runVpxDecodeWithRTP(t, codec.VP9)
+	runVpxDecodeWithRTP(t, mrtp.VP9)
 }
 
-func runVpxDecodeWithRTP(t *testing.T, c codec.CodecType) {
+func runVpxDecodeWithRTP(t *testing.T, c mrtp.Codec) {
 	synctest.Test(t, func(t *testing.T) {
 		ctx, cancel := context.WithCancel(context.Background())
 
@@ -100,13 +100,12 @@ func runVpxDecodeWithRTP(t *testing.T, c codec.CodecType) {
 			assert.NoError(t, err)
 			assert.NotNil(t, rawFrame)
 			framesReceived++
+		}, func(err error) {
+			assert.NoError(t, err)
 		})
 		assert.NoError(t, err)
 
-		var wg sync.WaitGroup
-		wg.Go(func() {
-			depacketizer.Run()
-		})
+		depacketizer.start(ctx)
 
 		sink := WriterFunc(func(b []byte, _ Attributes) error {
 			return depacketizer.Write(b)
@@ -130,7 +129,7 @@ func runVpxDecodeWithRTP(t *testing.T, c codec.CodecType) {
 			ClockRate: 90_000,
 			Codec:     c,
 		}
-		pacer := NewFrameSpacer(ctx)
+		pacer := NewFrameSpacer()
 		defer func() {
 			assert.NoError(t, pacer.Close())
 		}()
@@ -139,6 +138,7 @@ func runVpxDecodeWithRTP(t *testing.T, c codec.CodecType) {
 
 		writer, err := Chain(i, sink, pacer, packetizer, encoder, frameInter)
 		assert.NoError(t, err)
+		assert.NoError(t, pacer.Start(ctx))
 
 		assert.NoError(t, fileSrc.StartLive(ctx, writer))
 
@@ -0,0 +1,81 @@
+package gopipe
+
+import (
+	"encoding/binary"
+	"io"
+	"os"
+)
+
+// wavHeaderSize is the size of the RIFF, fmt and data chunk headers written
+// by WAVSink.
+const wavHeaderSize = 44
+
+// WAVSink writes interleaved 16 bit PCM audio to a WAV file. The chunk sizes
+// in the header are updated on Close.
+type WAVSink struct {
+	file       *os.File
+	sampleRate int
+	channels   int
+	dataSize   uint32
+}
+
+func NewWAVSink(filePath string, sampleRate, channels int) (*WAVSink, error) {
+	file, err := os.Create(filePath)
+	if err != nil {
+		return nil, err
+	}
+	s := &WAVSink{
+		file:       file,
+		sampleRate: sampleRate,
+		channels:   channels,
+	}
+	if err := s.writeHeader(); err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	// writeHeader does not move the file offset
+	if _, err := file.Seek(wavHeaderSize, io.SeekStart); err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *WAVSink) writeHeader() error {
+	blockAlign := s.channels * 2
+	header := make([]byte, 0, wavHeaderSize)
+	header = append(header, "RIFF"...)
+	header = binary.LittleEndian.AppendUint32(header, wavHeaderSize-8+s.dataSize)
+	header = append(header, "WAVEfmt "...)
+	header = binary.LittleEndian.AppendUint32(header, 16)
+	header = binary.LittleEndian.AppendUint16(header, wavFormatPCM)
+	header = binary.LittleEndian.AppendUint16(header, uint16(s.channels))
+	header = binary.LittleEndian.AppendUint32(header, uint32(s.sampleRate))
+	header = binary.LittleEndian.AppendUint32(header, uint32(s.sampleRate*blockAlign))
+	header = binary.LittleEndian.AppendUint16(header, uint16(blockAlign))
+	header = binary.LittleEndian.AppendUint16(header, 16)
+	header = append(header, "data"...)
+	header = binary.LittleEndian.AppendUint32(header, s.dataSize)
+	_, err := s.file.WriteAt(header, 0)
+	return err
+}
+
+// Write implements the Writer interface for WAVSink.
+// For use in the processing pipeline.
+func (s *WAVSink) Write(b []byte, _ Attributes) error {
+	n, err := s.file.Write(b)
+	s.dataSize += uint32(n)
+	return err
+}
+
+func (s *WAVSink) Close() error {
+	if s.file == nil {
+		return nil
+	}
+	err := s.writeHeader()
+	if closeErr := s.file.Close(); err == nil {
+		err = closeErr
+	}
+	s.file = nil
+	return err
+}
@@ -0,0 +1,126 @@
+package gopipe
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// wavFormatPCM is the WAVE format tag of uncompressed PCM.
+const wavFormatPCM = 1
+
+// WAVSource reads interleaved 16 bit PCM audio from a WAV file and emits
+// frames of fixed duration.
+type WAVSource struct {
+	reader        io.Reader
+	sampleRate    int
+	channels      int
+	frameDuration time.Duration
+}
+
+// NewWAVSource parses the WAV header of reader. Each frame written to the
+// pipeline contains frameDuration of audio, which must be a frame size
+// supported by the audio encoder, e.g. 20ms for Opus.
+func NewWAVSource(reader io.Reader, frameDuration time.Duration) (*WAVSource, error) {
+	var riff [12]byte
+	if _, err := io.ReadFull(reader, riff[:]); err != nil {
+		return nil, fmt.Errorf("failed to read RIFF header: %w", err)
+	}
+	if string(riff[0:4]) != "RIFF" || string(riff[8:12]) != "WAVE" {
+		return nil, errors.New("not a RIFF WAVE file")
+	}
+
+	s := &WAVSource{
+		reader:        reader,
+		frameDuration: frameDuration,
+	}
+	for {
+		var chunk [8]byte
+		if _, err := io.ReadFull(reader, chunk[:]); err != nil {
+			return nil, fmt.Errorf("failed to read chunk header: %w", err)
+		}
+		size := int64(binary.LittleEndian.Uint32(chunk[4:8]))
+		switch string(chunk[0:4]) {
+		case "fmt ":
+			fmtChunk := make([]byte, size)
+			if _, err := io.ReadFull(reader, fmtChunk); err != nil {
+				return nil, fmt.Errorf("failed to read fmt chunk: %w", err)
+			}
+			if len(fmtChunk) < 16 {
+				return nil, errors.New("fmt chunk too short")
+			}
+			if format := binary.LittleEndian.Uint16(fmtChunk[0:2]); format != wavFormatPCM {
+				return nil, fmt.Errorf("unsupported WAVE format: %v", format)
+			}
+			if bits := binary.LittleEndian.Uint16(fmtChunk[14:16]); bits != 16 {
+				return nil, fmt.Errorf("unsupported bits per sample: %v", bits)
+			}
+			s.channels = int(binary.LittleEndian.Uint16(fmtChunk[2:4]))
+			s.sampleRate = int(binary.LittleEndian.Uint32(fmtChunk[4:8]))
+		case "data":
+			if s.sampleRate == 0 {
+				return nil, errors.New("data chunk before fmt chunk")
+			}
+			s.reader = io.LimitReader(reader, size)
+			return s, nil
+		default:
+			// chunks are padded to an even size
+			if _, err := io.CopyN(io.Discard, reader, size+size%2); err != nil {
+				return nil, fmt.Errorf("failed to skip chunk: %w", err)
+			}
+		}
+	}
+}
+
+// GetInfo returns the audio format. The timebase is the frame rate, i.e. the
+// inverse of the frame duration.
+func (s *WAVSource) GetInfo() Info {
+	return Info{
+		TimebaseNum: int(time.Second / s.frameDuration),
+		TimebaseDen: 1,
+		SampleRate:  s.sampleRate,
+		Channels:    s.channels,
+	}
+}
+
+func (s *WAVSource) frameSize() int {
+	return s.sampleRate * int(s.frameDuration/time.Microsecond) / 1_000_000 * s.channels * 2
+}
+
+// StartLive starts the source as live source.
+func (s *WAVSource) StartLive(ctx context.Context, pipeline Sink) error {
+	var pts int64
+
+	ticker := time.NewTicker(s.frameDuration)
+	defer ticker.Stop()
+	for range ticker.C {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+
+		frame := make([]byte, s.frameSize())
+		if _, err := io.ReadFull(s.reader, frame); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return nil
+			}
+			return err
+		}
+
+		attr := Attributes{
+			PTS:           pts,
+			FrameDuration: s.frameDuration,
+		}
+		pts += s.frameDuration.Microseconds()
+
+		if err := pipeline.Write(frame, attr); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
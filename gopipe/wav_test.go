@@ -0,0 +1,72 @@
+package gopipe
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/synctest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWAVRoundtrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.wav")
+
+	sink, err := NewWAVSink(path, 48_000, 2)
+	require.NoError(t, err)
+
+	// 100ms of stereo audio
+	samples := make([]byte, 48_000/10*2*2)
+	for i := range samples {
+		samples[i] = byte(i)
+	}
+	require.NoError(t, sink.Write(samples, nil))
+	require.NoError(t, sink.Close())
+
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer func() {
+		assert.NoError(t, file.Close())
+	}()
+
+	src, err := NewWAVSource(file, 20*time.Millisecond)
+	require.NoError(t, err)
+	assert.Equal(t, Info{
+		TimebaseNum: 50,
+		TimebaseDen: 1,
+		SampleRate:  48_000,
+		Channels:    2,
+	}, src.GetInfo())
+
+	synctest.Test(t, func(t *testing.T) {
+		received := []byte{}
+		pts := []int64{}
+		err := src.StartLive(context.Background(), WriterFunc(func(b []byte, a Attributes) error {
+			assert.Len(t, b, 960*2*2)
+			assert.Equal(t, 20*time.Millisecond, a[FrameDuration])
+			received = append(received, b...)
+			pts = append(pts, a[PTS].(int64))
+			return nil
+		}))
+		assert.NoError(t, err)
+		assert.Equal(t, samples, received)
+		assert.Equal(t, []int64{0, 20_000, 40_000, 60_000, 80_000}, pts)
+	})
+}
+
+func TestWAVSourceInvalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.wav")
+	require.NoError(t, os.WriteFile(path, []byte("YUV4MPEG2 W1 H1"), 0o644))
+
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer func() {
+		assert.NoError(t, file.Close())
+	}()
+
+	_, err = NewWAVSource(file, 20*time.Millisecond)
+	assert.Error(t, err)
+}
@@ -5,11 +5,11 @@ package gopipe
 import (
 	"context"
 	"os"
-	"sync"
 	"testing"
 	"testing/synctest"
 	"time"
 
+	"github.com/mengelbart/mrtp"
 	"github.com/mengelbart/mrtp/gopipe/codec"
 	"github.com/stretchr/testify/assert"
 )
@@ -49,7 +49,7 @@ func TestH264Decode(t *testing.T) {
 		assert.NoError(t, err)
 
 		i := fileSrc.GetInfo()
-		encoder := NewEncoder(codec.H264)
+		encoder := NewEncoder(mrtp.H264)
 		frameInter := newFrameInterceptor(false, 0, nil)
 
 		pipeline, err := Chain(i, sink, encoder, frameInter)
@@ -81,18 +81,17 @@ func TestH264DecodeWithRTP(t *testing.T) {
 		assert.NoError(t, err)
 
 		timeout := 10 * time.Millisecond
-		depacketizer, err := newRTPDepacketizer(timeout, codec.H264, func(frame []byte, pts int64) {
+		depacketizer, err := newRTPDepacketizer(timeout, mrtp.H264, func(frame []byte, pts int64) {
 			rawFrame, decodeErr := decoder.Decode(frame)
 			assert.NoError(t, decodeErr)
 			assert.NotNil(t, rawFrame)
 			framesReceived++
+		}, func(err error) {
+			assert.NoError(t, err)
 		})
 		assert.NoError(t, err)
 
-		var wg sync.WaitGroup
-		wg.Go(func() {
-			depacketizer.Run()
-		})
+		depacketizer.start(ctx)
 
 		sink := WriterFunc(func(b []byte, _ Attributes) error {
 			return depacketizer.Write(b)
@@ -108,19 +107,20 @@ func TestH264DecodeWithRTP(t *testing.T) {
 		assert.NoError(t, err)
 
 		i := fileSrc.GetInfo()
-		encoder := NewEncoder(codec.H264)
+		encoder := NewEncoder(mrtp.H264)
 		packetizer := &RTPPacketizerFactory{
 			MTU:       1420,
 			PT:        96,
 			SSRC:      0,
 			ClockRate: 90_000,
-			Codec:     codec.H264,
+			Codec:     mrtp.H264,
 		}
-		pacer := NewFrameSpacer(ctx)
+		pacer := NewFrameSpacer()
 		frameInter := newFrameInterceptor(false, 0, nil)
 
 		writer, err := Chain(i, sink, pacer, packetizer, encoder, frameInter)
 		assert.NoError(t, err)
+		assert.NoError(t, pacer.Start(ctx))
 
 		assert.NoError(t, fileSrc.StartLive(ctx, writer))
 
@@ -4,13 +4,23 @@ import (
 	"fmt"
 	"image"
 	"os"
+
+	"github.com/mengelbart/mrtp/gopipe/codec"
 )
 
+// Y4MSink writes frames to a Y4M file. The resolution and chroma subsampling
+// of the file are those of the first frame. Y4M does not support format
+// changes, so later frames with a different resolution, e.g. after the sender
+// adapted the resolution, or a different chroma subsampling are converted to
+// the format of the file.
 type Y4MSink struct {
 	file          *os.File
 	headerWritten bool
 	fpsNum        int
 	fpsDen        int
+	width         int
+	height        int
+	subsampling   image.YCbCrSubsampleRatio
 }
 
 func NewY4MSink(filePath string, fpsNum, fpsDen int) (*Y4MSink, error) {
@@ -49,6 +59,25 @@ func (s *Y4MSink) SaveFrame(frameData []byte, width, height int, subsampling ima
 			return err
 		}
 		s.headerWritten = true
+		s.width = width
+		s.height = height
+		s.subsampling = subsampling
+	}
+
+	if width != s.width || height != s.height || subsampling != s.subsampling {
+		if len(frameData) < codec.FrameSize(width, height, subsampling) {
+			return fmt.Errorf("frame too short for %vx%v %v: %v bytes", width, height, subsampling, len(frameData))
+		}
+		if subsampling != s.subsampling {
+			converted := make([]byte, codec.FrameSize(width, height, s.subsampling))
+			convertChroma(converted, frameData, width, height, subsampling, s.subsampling)
+			frameData = converted
+		}
+		if width != s.width || height != s.height {
+			scaled := make([]byte, codec.FrameSize(s.width, s.height, s.subsampling))
+			scaleFrame(scaled, frameData, width, height, s.width, s.height, s.subsampling)
+			frameData = scaled
+		}
 	}
 
 	// frame header
@@ -13,16 +13,24 @@ import (
 type Y4MSource struct {
 	reader *y4m.Reader
 	header *y4m.StreamHeader
+	csr    image.YCbCrSubsampleRatio
 }
 
+// NewY4MSource reads the stream header from reader. Streams with 4:1:1,
+// monochrome or alpha channel frames are not supported.
 func NewY4MSource(reader io.Reader) (*Y4MSource, error) {
 	y4mReader, y4mHeader, err := y4m.NewReader(reader)
 	if err != nil {
 		return nil, err
 	}
+	csr, err := convertSubsampleRatio(y4mHeader.ChromaSubsampling)
+	if err != nil {
+		return nil, err
+	}
 	return &Y4MSource{
 		reader: y4mReader,
 		header: y4mHeader,
+		csr:    csr,
 	}, nil
 }
 
@@ -40,35 +48,31 @@ func (s *Y4MSource) getFrame() ([]byte, Attributes, error) {
 	if err != nil {
 		return nil, nil, err
 	}
-	csr := convertSubsampleRatio(s.header.ChromaSubsampling)
-
 	attr := Attributes{
-		ChromaSubsampling: csr,
+		ChromaSubsampling: s.csr,
 	}
 
 	return frame, attr, nil
 }
 
-func convertSubsampleRatio(s y4m.ChromaSubsamplingType) image.YCbCrSubsampleRatio {
+// ChromaSubsampling returns the chroma subsampling of the frames.
+func (s *Y4MSource) ChromaSubsampling() image.YCbCrSubsampleRatio {
+	return s.csr
+}
+
+// convertSubsampleRatio returns the chroma subsampling of frames of type s.
+// The y4m reader cannot read 4:1:1 and monochrome frames and reads only the
+// first three planes of frames with alpha channel.
+func convertSubsampleRatio(s y4m.ChromaSubsamplingType) (image.YCbCrSubsampleRatio, error) {
 	switch s {
-	case y4m.CST411:
-		return image.YCbCrSubsampleRatio411
-	case y4m.CST420:
-		return image.YCbCrSubsampleRatio420
-	case y4m.CST420jpeg:
-		return image.YCbCrSubsampleRatio420
-	case y4m.CST420mpeg2:
-		return image.YCbCrSubsampleRatio420
-	case y4m.CST420paldv:
-		return image.YCbCrSubsampleRatio420
+	case y4m.CST420, y4m.CST420jpeg, y4m.CST420mpeg2, y4m.CST420paldv:
+		return image.YCbCrSubsampleRatio420, nil
 	case y4m.CST422:
-		return image.YCbCrSubsampleRatio422
+		return image.YCbCrSubsampleRatio422, nil
 	case y4m.CST444:
-		return image.YCbCrSubsampleRatio444
-	case y4m.CST444Alpha:
-		return image.YCbCrSubsampleRatio444
+		return image.YCbCrSubsampleRatio444, nil
 	default:
-		panic(fmt.Sprintf("unexpected y4m.ChromaSubsamplingType: %#v", s))
+		return 0, fmt.Errorf("unsupported y4m chroma subsampling: %v", s)
 	}
 }
 
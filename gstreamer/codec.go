@@ -0,0 +1,82 @@
+//go:build cgo
+
+package gstreamer
+
+import (
+	"fmt"
+
+	"github.com/go-gst/go-gst/gst"
+	"github.com/mengelbart/mrtp"
+)
+
+// Codec holds the GStreamer elements used to send and receive a codec of the
+// mrtp codec registry. Codecs without an entry cannot be used with
+// [StreamSource] and [StreamSink].
+type Codec struct {
+	// Encoder and EncoderProperties create the encoder element.
+	Encoder           string
+	EncoderProperties map[string]any
+
+	// SetBitrate sets the target rate of the encoder element.
+	SetBitrate func(encoder *gst.Element, ratebps uint) error
+
+	// Payloader and PayloaderProperties create the RTP payloader element.
+	// The payload type, MTU and sequence number offset are set by
+	// [StreamSource].
+	Payloader           string
+	PayloaderProperties map[string]any
+
+	Depayloader string
+	Decoder     string
+}
+
+var codecElements = map[mrtp.Codec]Codec{
+	mrtp.H264: {
+		Encoder: "x264enc",
+		EncoderProperties: map[string]any{
+			"pass":          0,    // const rate
+			"speed-preset":  1,    // ultrafast
+			"tune":          4,    // zerolatency
+			"bitrate":       750,  // init bitrate in kbps
+			"key-int-max":   0,    // auto
+			"intra-refresh": true, // use intra refresh instead of key frames
+		},
+		SetBitrate: func(encoder *gst.Element, ratebps uint) error {
+			return encoder.Set("bitrate", ratebps/1000)
+		},
+		Payloader: "rtph264pay",
+		PayloaderProperties: map[string]any{
+			"aggregate-mode": 1, // zero-latency
+		},
+		Depayloader: "rtph264depay",
+		Decoder:     "avdec_h264",
+	},
+	mrtp.VP8: {
+		Encoder: "vp8enc",
+		EncoderProperties: map[string]any{
+			"deadline":        1, // real time
+			"cpu-used":        5, // quality/speed
+			"error-resilient": 1, // better for packet loss
+		},
+		SetBitrate: func(encoder *gst.Element, ratebps uint) error {
+			return encoder.Set("target-bitrate", int(ratebps))
+		},
+		Payloader:   "rtpvp8pay",
+		Depayloader: "rtpvp8depay",
+		Decoder:     "vp8dec",
+	},
+}
+
+// RegisterCodec sets the GStreamer elements of codec. It is meant to be
+// called from init functions.
+func RegisterCodec(codec mrtp.Codec, c Codec) {
+	codecElements[codec] = c
+}
+
+func lookupCodec(codec mrtp.Codec) (Codec, error) {
+	c, ok := codecElements[codec]
+	if !ok {
+		return Codec{}, fmt.Errorf("no GStreamer elements for codec: %v", codec)
+	}
+	return c, nil
+}
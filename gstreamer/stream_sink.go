@@ -20,6 +20,8 @@ const (
 
 type StreamSinkOption func(*StreamSink) error
 
+// StreamSinkPayloadType sets the RTP payload type. Negative values and the
+// default select the payload type of the codec in the mrtp codec registry.
 func StreamSinkPayloadType(pt int) StreamSinkOption {
 	return func(s *StreamSink) error {
 		s.payloadType = pt
@@ -52,7 +54,7 @@ type StreamSink struct {
 	sinkType         SinkType
 	codec            mrtp.Codec
 	fileSinkLocation string
-	payloadType      int
+	payloadType      int // negative for the payload type of codec
 	location         string
 
 	bin      *gst.Bin
@@ -64,7 +66,7 @@ func NewStreamSink(name string, opts ...StreamSinkOption) (*StreamSink, error) {
 		sinkType:         Autovideosink,
 		codec:            mrtp.H264,
 		fileSinkLocation: "",
-		payloadType:      96,
+		payloadType:      -1,
 		location:         "out.y4m",
 		bin:              gst.NewBin(name),
 		elements:         []*gst.Element{},
@@ -75,41 +77,27 @@ func NewStreamSink(name string, opts ...StreamSinkOption) (*StreamSink, error) {
 		}
 	}
 
-	var err error
-	var depay *gst.Element
-	var dec *gst.Element
-	switch s.codec {
-	case mrtp.H264:
-		depay, err = gst.NewElement("rtph264depay")
-		if err != nil {
-			return nil, err
-		}
-		dec, err = gst.NewElement("avdec_h264")
-		if err != nil {
-			return nil, err
-		}
-		convert, err := gst.NewElement("videoconvert")
-		if err != nil {
-			return nil, err
-		}
-		s.elements = append(s.elements, depay, dec, convert)
-	case mrtp.VP8:
-		depay, err = gst.NewElement("rtpvp8depay")
-		if err != nil {
-			return nil, err
-		}
-		dec, err = gst.NewElement("vp8dec")
-		if err != nil {
-			return nil, err
-		}
-		convert, err := gst.NewElement("videoconvert")
-		if err != nil {
-			return nil, err
-		}
-		s.elements = append(s.elements, depay, dec, convert)
-	default:
-		return nil, fmt.Errorf("unknown codec: %v", s.codec)
+	if s.payloadType < 0 {
+		s.payloadType = int(s.codec.PayloadType())
+	}
+
+	c, err := lookupCodec(s.codec)
+	if err != nil {
+		return nil, err
+	}
+	depay, err := gst.NewElement(c.Depayloader)
+	if err != nil {
+		return nil, err
+	}
+	dec, err := gst.NewElement(c.Decoder)
+	if err != nil {
+		return nil, err
+	}
+	convert, err := gst.NewElement("videoconvert")
+	if err != nil {
+		return nil, err
 	}
+	s.elements = append(s.elements, depay, dec, convert)
 
 	// probe to log mapping RTP timestamp -> PTS
 	depaySinkPad := depay.GetStaticPad("sink")
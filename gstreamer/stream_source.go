@@ -25,15 +25,20 @@ type StreamSource struct {
 	source             Source
 	codec              mrtp.Codec
 	fileSourceLocation string
-	payloadType        uint
+	payloadType        int // negative for the payload type of codec
 
 	bin      *gst.Bin
 	elements []*gst.Element
 	encoder  *gst.Element
+
+	setBitrate func(encoder *gst.Element, ratebps uint) error
 }
 
-func StreamSourcePayloadType(pt int) StreamSinkOption {
-	return func(rs *StreamSink) error {
+// StreamSourcePayloadType sets the RTP payload type. Negative values and
+// the default select the payload type of the codec in the mrtp codec
+// registry.
+func StreamSourcePayloadType(pt int) StreamSourceOption {
+	return func(rs *StreamSource) error {
 		rs.payloadType = pt
 		return nil
 	}
@@ -65,7 +70,7 @@ func NewStreamSource(name string, opts ...StreamSourceOption) (*StreamSource, er
 		source:             Videotestsrc,
 		codec:              mrtp.H264,
 		fileSourceLocation: "",
-		payloadType:        96,
+		payloadType:        -1,
 		bin:                gst.NewBin(name),
 		elements:           []*gst.Element{},
 		encoder:            &gst.Element{},
@@ -76,6 +81,10 @@ func NewStreamSource(name string, opts ...StreamSourceOption) (*StreamSource, er
 		}
 	}
 
+	if s.payloadType < 0 {
+		s.payloadType = int(s.codec.PayloadType())
+	}
+
 	followUpElms := make([]*gst.Element, 0)
 
 	cs, err := gst.NewElement("clocksync")
@@ -84,57 +93,27 @@ func NewStreamSource(name string, opts ...StreamSourceOption) (*StreamSource, er
 	}
 	followUpElms = append(followUpElms, cs)
 
-	var pay *gst.Element
-	switch s.codec {
-	case mrtp.H264:
-		encSettings := map[string]any{
-			"pass":          0,    // const rate
-			"speed-preset":  1,    // ultrafast
-			"tune":          4,    // zerolatency
-			"bitrate":       750,  // init bitrate in kbps
-			"key-int-max":   0,    // auto
-			"intra-refresh": true, // use intra refresh instead of key frames
-		}
-		s.encoder, err = gst.NewElementWithProperties("x264enc", encSettings)
-		if err != nil {
-			return nil, err
-		}
-		paySettings := map[string]any{
-			"pt":             s.payloadType,
-			"mtu":            uint(1200),
-			"aggregate-mode": 1, // zero-latency
-			"seqnum-offset":  1,
-		}
-		pay, err = gst.NewElementWithProperties("rtph264pay", paySettings)
-		if err != nil {
-			return nil, err
-		}
-		followUpElms = append(followUpElms, s.encoder, pay)
-	case mrtp.VP8:
-		settings := map[string]any{
-			"deadline":        1, // real time
-			"cpu-used":        5, // quality/speed
-			"error-resilient": 1, // better for packet loss
-		}
-		s.encoder, err = gst.NewElementWithProperties("vp8enc", settings)
-		if err != nil {
-			return nil, err
-		}
-		pay, err = gst.NewElement("rtpvp8pay")
-		if err != nil {
-			return nil, err
-		}
-		if err = SetProperties(pay, map[string]any{
-			"pt":            s.payloadType,
-			"mtu":           uint(1200),
-			"seqnum-offset": 1,
-		}); err != nil {
-			return nil, err
-		}
-		followUpElms = append(followUpElms, s.encoder, pay)
-	default:
-		return nil, fmt.Errorf("unknown codec: %v", s.codec)
+	c, err := lookupCodec(s.codec)
+	if err != nil {
+		return nil, err
 	}
+	s.encoder, err = gst.NewElementWithProperties(c.Encoder, c.EncoderProperties)
+	if err != nil {
+		return nil, err
+	}
+	s.setBitrate = c.SetBitrate
+	pay, err := gst.NewElementWithProperties(c.Payloader, c.PayloaderProperties)
+	if err != nil {
+		return nil, err
+	}
+	if err = SetProperties(pay, map[string]any{
+		"pt":            uint(s.payloadType),
+		"mtu":           uint(1200),
+		"seqnum-offset": 1,
+	}); err != nil {
+		return nil, err
+	}
+	followUpElms = append(followUpElms, s.encoder, pay)
 
 	// probe to log pts before ecnoder
 	encSinkPad := s.encoder.GetStaticPad("sink")
@@ -277,17 +256,9 @@ func (s *StreamSource) SetBitrate(ratebps uint) error {
 	// reduce target rate
 	slog.Info("NEW_TARGET_MEDIA_RATE", "rate", ratebps)
 
-	switch s.codec {
-	case mrtp.H264:
-		rateKbps := ratebps / 1000
-		return s.encoder.Set("bitrate", rateKbps)
-	case mrtp.VP8:
-		return s.encoder.Set("target-bitrate", int(ratebps))
-	default:
-		return fmt.Errorf("unknown codec: %v", s.codec)
-	}
+	return s.setBitrate(s.encoder, ratebps)
 }
 
 func (s *StreamSource) EncodingName() string {
-	return fmt.Sprintf("%v/%v", s.codec.MediaType(), s.codec.String())
+	return s.codec.MimeType()
 }
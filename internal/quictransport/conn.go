@@ -51,7 +51,11 @@ func OpenClientConnWithNet(ctx context.Context, remoteAddress string, quicConfig
 	if c, ok := conn.(net.Conn); ok {
 		remoteAddr = c.RemoteAddr()
 	} else {
-		return nil, nil, fmt.Errorf("only implemented for net.Conn")
+		addr, err := net.ResolveUDPAddr("udp", remoteAddress)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to resolve remote address: %w", err)
+		}
+		remoteAddr = addr
 	}
 
 	quicConn, err := q.Dial(ctx, remoteAddr, &tls.Config{
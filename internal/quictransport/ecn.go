@@ -0,0 +1,100 @@
+package quictransport
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/mengelbart/mrtp"
+	"golang.org/x/sys/unix"
+)
+
+// SetECN makes the transport mark all outgoing packets with the ECN codepoint
+// ecn, which must be ECT(0) or ECT(1). Without this option, quic-go decides
+// about ECN marking. The transport opens its own UDP socket in this mode, so
+// the option cannot be combined with SetNetConn.
+func SetECN(ecn mrtp.ECN) Option {
+	return func(t *Transport) error {
+		if ecn != mrtp.ECNECT0 && ecn != mrtp.ECNECT1 {
+			return fmt.Errorf("invalid ECN codepoint for sending: %v", ecn)
+		}
+		t.ecn = ecn
+		return nil
+	}
+}
+
+// ecnConn hides the OOB capabilities of a UDP socket from quic-go. quic-go
+// then does not set the ECN codepoint of each packet itself and the codepoint
+// configured on the socket is used instead.
+type ecnConn struct {
+	conn *net.UDPConn
+}
+
+func (c *ecnConn) ReadFrom(p []byte) (int, net.Addr, error) {
+	return c.conn.ReadFrom(p)
+}
+
+func (c *ecnConn) WriteTo(p []byte, addr net.Addr) (int, error) {
+	return c.conn.WriteTo(p, addr)
+}
+
+func (c *ecnConn) Close() error {
+	return c.conn.Close()
+}
+
+func (c *ecnConn) LocalAddr() net.Addr {
+	return c.conn.LocalAddr()
+}
+
+func (c *ecnConn) SetDeadline(t time.Time) error {
+	return c.conn.SetDeadline(t)
+}
+
+func (c *ecnConn) SetReadDeadline(t time.Time) error {
+	return c.conn.SetReadDeadline(t)
+}
+
+func (c *ecnConn) SetWriteDeadline(t time.Time) error {
+	return c.conn.SetWriteDeadline(t)
+}
+
+func (c *ecnConn) SetReadBuffer(bytes int) error {
+	return c.conn.SetReadBuffer(bytes)
+}
+
+func (c *ecnConn) SetWriteBuffer(bytes int) error {
+	return c.conn.SetWriteBuffer(bytes)
+}
+
+// listenECN opens a UDP socket on address that marks all outgoing packets with
+// ecn. The returned conn only implements net.PacketConn and the buffer size
+// setters.
+func listenECN(address string, ecn mrtp.ECN) (net.PacketConn, error) {
+	addr, err := net.ResolveUDPAddr("udp", address)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.ListenUDP("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	rawConn, err := conn.SyscallConn()
+	if err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("failed to get raw connection: %w", err)
+	}
+	var errIP, errIPv6 error
+	if err = rawConn.Control(func(fd uintptr) {
+		errIP = unix.SetsockoptInt(int(fd), unix.IPPROTO_IP, unix.IP_TOS, int(ecn))
+		errIPv6 = unix.SetsockoptInt(int(fd), unix.IPPROTO_IPV6, unix.IPV6_TCLASS, int(ecn))
+	}); err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("failed to set socket options: %w", err)
+	}
+	if errIP != nil && errIPv6 != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("failed to set ECN codepoint: %w", errors.Join(errIP, errIPv6))
+	}
+	return &ecnConn{conn: conn}, nil
+}
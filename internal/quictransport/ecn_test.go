@@ -0,0 +1,53 @@
+package quictransport
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mengelbart/mrtp"
+	"github.com/quic-go/quic-go/qlog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewlyAcked(t *testing.T) {
+	f := &qlog.AckFrame{
+		AckRanges: []qlog.AckRange{
+			{Smallest: 8, Largest: 10},
+			{Smallest: 2, Largest: 5},
+		},
+	}
+	assert.Equal(t, []uint64{10, 9, 8, 5, 4, 3, 2}, newlyAcked(f, 0))
+	assert.Equal(t, []uint64{10, 9, 8, 5, 4}, newlyAcked(f, 4))
+	assert.Empty(t, newlyAcked(f, 11))
+}
+
+func TestPacketsAckedECN(t *testing.T) {
+	tr := &Transport{}
+	start := time.Now()
+	for i := range uint64(10) {
+		tr.packetSent(start, i, 1200)
+	}
+	for i := range uint64(5) {
+		tr.packetAcked(i, start.Add(10*time.Millisecond), mrtp.ECNNonECT)
+	}
+
+	tr.packetsAckedECN([]uint64{4, 3, 2, 1, 0}, 3, 0, 2)
+	assert.Equal(t, uint64(5), tr.nextECNAck)
+	require.Len(t, tr.packetFeedback, 5)
+	assert.Equal(t, []mrtp.ECN{mrtp.ECNECT0, mrtp.ECNECT0, mrtp.ECNECT0, mrtp.ECNCE, mrtp.ECNCE}, []mrtp.ECN{
+		tr.packetFeedback[0].ecn,
+		tr.packetFeedback[1].ecn,
+		tr.packetFeedback[2].ecn,
+		tr.packetFeedback[3].ecn,
+		tr.packetFeedback[4].ecn,
+	})
+
+	// marks for packets that were not yet acknowledged with a timestamp are
+	// kept until the timestamp arrives
+	tr.packetsAckedECN([]uint64{6, 5}, 3, 1, 3)
+	assert.Equal(t, mrtp.ECNCE, tr.inFlightPackets[1].ecn)
+	assert.Equal(t, mrtp.ECNECT1, tr.inFlightPackets[0].ecn)
+	tr.packetAcked(6, start.Add(10*time.Millisecond), mrtp.ECNNonECT)
+	assert.Equal(t, mrtp.ECNCE, tr.packetFeedback[5].ecn)
+}
@@ -0,0 +1,138 @@
+package quictransport
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/Willi-42/go-nada/nada"
+	"github.com/mengelbart/mrtp"
+	"github.com/quic-go/quic-go/quicvarint"
+)
+
+const (
+	// maxAcksPerFeedback limits the number of acknowledgments per feedback
+	// datagram so that a report always fits into a single QUIC packet.
+	maxAcksPerFeedback = 64
+
+	feedbackQueueSize = 4096
+)
+
+// EnableFeedback makes the transport record the arrival time and ECN marking
+// of every received packet and send them to the peer every interval in
+// datagrams on flowID. This allows a sender to run congestion control without
+// ACK receive timestamps, e.g. when the peer uses an unpatched QUIC stack.
+func EnableFeedback(flowID uint64, interval time.Duration) Option {
+	return func(t *Transport) error {
+		if interval <= 0 {
+			return fmt.Errorf("invalid feedback interval: %v", interval)
+		}
+		t.feedbackFlowID = flowID
+		t.feedbackInterval = interval
+		t.feedbackEvents = make(chan nada.Acknowledgment, feedbackQueueSize)
+		return nil
+	}
+}
+
+// EnableFeedbackReceiver makes the transport read feedback sent by a peer
+// using [EnableFeedback] on flowID and pass it to the BWE. ACK receive
+// timestamps are ignored in this mode.
+func EnableFeedbackReceiver(flowID uint64) Option {
+	return func(t *Transport) error {
+		t.feedbackFlowID = flowID
+		t.feedbackReports = make(chan []nada.Acknowledgment, feedbackQueueSize)
+		return nil
+	}
+}
+
+// packetReceived records the arrival of a packet if feedback is enabled.
+func (t *Transport) packetReceived(ts time.Time, seqNr uint64, marked bool) {
+	if t.feedbackEvents == nil {
+		return
+	}
+	select {
+	case t.feedbackEvents <- nada.Acknowledgment{
+		SeqNr:   seqNr,
+		Arrival: ts,
+		Marked:  marked,
+	}:
+	default:
+		slog.Warn("feedback queue full, dropping packet arrival", "seq-nr", seqNr)
+	}
+}
+
+// nextFeedback returns the next feedback datagram including the flow ID or nil
+// if there are no pending acknowledgments.
+func (t *Transport) nextFeedback() ([]byte, error) {
+	n := min(len(t.feedbackEvents), maxAcksPerFeedback)
+	if n == 0 {
+		return nil, nil
+	}
+	report, err := Marshal(t.feedbackEvents, n)
+	if err != nil {
+		return nil, err
+	}
+	dgram := quicvarint.Append(make([]byte, 0, quicvarint.Len(t.feedbackFlowID)+len(report)), t.feedbackFlowID)
+	return append(dgram, report...), nil
+}
+
+func (t *Transport) sendFeedback() {
+	ticker := time.NewTicker(t.feedbackInterval)
+	defer ticker.Stop()
+	for t.running.Load() {
+		select {
+		case <-t.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		for {
+			dgram, err := t.nextFeedback()
+			if err != nil {
+				slog.Error("failed to marshal feedback", "error", err)
+				break
+			}
+			if dgram == nil {
+				break
+			}
+			if err = t.quicConn.SendDatagram(dgram); err != nil {
+				slog.Error("failed to send feedback", "error", err)
+			}
+		}
+	}
+}
+
+// handleFeedback queues a feedback report received from the peer. The report
+// is passed to the BWE by the tracer to avoid concurrent access to the
+// congestion control state.
+func (t *Transport) handleFeedback(report []byte) {
+	acks, err := UnmarshalFeedback(report)
+	if err != nil {
+		slog.Error("failed to unmarshal feedback", "error", err)
+		return
+	}
+	select {
+	case t.feedbackReports <- acks:
+	default:
+		slog.Warn("feedback report queue full, dropping report", "acks", len(acks))
+	}
+}
+
+func (t *Transport) processFeedbackReports() {
+	if t.feedbackReports == nil {
+		return
+	}
+	for {
+		select {
+		case acks := <-t.feedbackReports:
+			for _, ack := range acks {
+				ecn := mrtp.ECNNonECT
+				if ack.Marked {
+					ecn = mrtp.ECNCE
+				}
+				t.packetAcked(ack.SeqNr, ack.Arrival, ecn)
+			}
+		default:
+			return
+		}
+	}
+}
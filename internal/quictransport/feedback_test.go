@@ -0,0 +1,67 @@
+package quictransport
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mengelbart/mrtp"
+	"github.com/quic-go/quic-go/quicvarint"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFeedback(t *testing.T) {
+	receiver := &Transport{}
+	require.NoError(t, EnableFeedback(4, 20*time.Millisecond)(receiver))
+	sender := &Transport{}
+	require.NoError(t, EnableFeedbackReceiver(4)(sender))
+
+	start := time.UnixMicro(1_000_000)
+	for i := range uint64(100) {
+		sender.packetSent(start.Add(time.Duration(i)*time.Millisecond), i, 1200)
+		if i == 50 {
+			continue
+		}
+		receiver.packetReceived(start.Add(time.Duration(i+10)*time.Millisecond), i, i%10 == 0)
+	}
+
+	for {
+		dgram, err := receiver.nextFeedback()
+		require.NoError(t, err)
+		if dgram == nil {
+			break
+		}
+		flowID, n, err := quicvarint.Parse(dgram)
+		require.NoError(t, err)
+		assert.Equal(t, uint64(4), flowID)
+		sender.handleFeedback(dgram[n:])
+	}
+	assert.Len(t, sender.feedbackReports, 2)
+
+	sender.processFeedbackReports()
+	assert.Equal(t, uint64(99), sender.highestAcked)
+	require.Len(t, sender.packetFeedback, 99)
+	require.Len(t, sender.inFlightPackets, 1)
+	assert.Equal(t, uint64(50), sender.inFlightPackets[0].seqNr)
+
+	for _, f := range sender.packetFeedback {
+		assert.True(t, f.arrived)
+		assert.Equal(t, f.departure.Add(10*time.Millisecond), f.arrival)
+		if f.seqNr%10 == 0 {
+			assert.Equal(t, mrtp.ECNCE, f.ecn)
+		} else {
+			assert.Equal(t, mrtp.ECNNonECT, f.ecn)
+		}
+	}
+}
+
+func TestFeedbackDisabled(t *testing.T) {
+	tr := &Transport{}
+	tr.packetReceived(time.Now(), 1, false)
+	dgram, err := tr.nextFeedback()
+	require.NoError(t, err)
+	assert.Nil(t, dgram)
+
+	tr.processFeedbackReports()
+	assert.Empty(t, tr.packetFeedback)
+}
@@ -1,6 +1,7 @@
 package quictransport
 
 import (
+	"fmt"
 	"time"
 
 	"github.com/Willi-42/go-nada/nada"
@@ -29,39 +30,45 @@ func Marshal(eventChan chan nada.Acknowledgment, readLen int) ([]byte, error) {
 	return buf, nil
 }
 
-func UnmarshalFeedback(buf []byte) ([]nada.Acknowledgment, error) {
-	var err error
-	packetEvents := make([]nada.Acknowledgment, 0)
+// minFeedbackEntrySize is the minimum encoded size of a packet in a feedback
+// report: three varints of at least one byte each.
+const minFeedbackEntrySize = 3
 
+func UnmarshalFeedback(buf []byte) ([]nada.Acknowledgment, error) {
 	// read the number of packets
 	numPackets, n, err := quicvarint.Parse(buf)
-	if n < 0 {
-		return nil, err
+	if err != nil {
+		return nil, fmt.Errorf("invalid number of packets: %w", err)
 	}
 	buf = buf[n:]
 
-	for range numPackets {
+	// reports are received from the peer, do not trust the packet count
+	if numPackets > uint64(len(buf)/minFeedbackEntrySize) {
+		return nil, fmt.Errorf("feedback report of %v bytes cannot contain %v packets", len(buf), numPackets)
+	}
+	packetEvents := make([]nada.Acknowledgment, 0, numPackets)
+
+	for i := range numPackets {
 		p := nada.Acknowledgment{
 			Arrived: true,
 		}
 
 		p.SeqNr, n, err = quicvarint.Parse(buf)
-		if n < 0 {
-			return nil, err
+		if err != nil {
+			return nil, fmt.Errorf("invalid sequence number of packet %v: %w", i, err)
 		}
 		buf = buf[n:]
 
 		arivalMicro, n, err := quicvarint.Parse(buf)
-		if n < 0 {
-			return nil, err
+		if err != nil {
+			return nil, fmt.Errorf("invalid arrival time of packet %v: %w", i, err)
 		}
-
 		p.Arrival = time.UnixMicro(int64(arivalMicro))
 		buf = buf[n:]
 
 		marked, n, err := quicvarint.Parse(buf)
-		if n < 0 {
-			return nil, err
+		if err != nil {
+			return nil, fmt.Errorf("invalid ECN mark of packet %v: %w", i, err)
 		}
 		buf = buf[n:]
 		p.Marked = marked == 1
@@ -5,6 +5,8 @@ import (
 	"time"
 
 	"github.com/Willi-42/go-nada/nada"
+	"github.com/quic-go/quic-go/quicvarint"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
@@ -41,3 +43,49 @@ func TestPacketEvent(t *testing.T) {
 
 	require.Equal(t, acks, res)
 }
+
+func TestUnmarshalFeedbackTruncated(t *testing.T) {
+	eventChan := make(chan nada.Acknowledgment, 2)
+	eventChan <- nada.Acknowledgment{SeqNr: 1000, Arrival: time.UnixMilli(110)}
+	eventChan <- nada.Acknowledgment{SeqNr: 1001, Arrival: time.UnixMilli(115), Marked: true}
+	data, err := Marshal(eventChan, 2)
+	require.NoError(t, err)
+
+	for i := range len(data) {
+		_, err = UnmarshalFeedback(data[:i])
+		assert.Error(t, err, "truncated to %v bytes", i)
+	}
+}
+
+func TestUnmarshalFeedbackPacketCount(t *testing.T) {
+	// a huge packet count must not be trusted
+	data := quicvarint.Append(nil, quicvarint.Max)
+	data = append(data, 1, 1, 0)
+	_, err := UnmarshalFeedback(data)
+	assert.Error(t, err)
+
+	data = quicvarint.Append(nil, 1)
+	data = append(data, 1, 1, 0)
+	acks, err := UnmarshalFeedback(data)
+	require.NoError(t, err)
+	assert.Len(t, acks, 1)
+}
+
+func FuzzUnmarshalFeedback(f *testing.F) {
+	eventChan := make(chan nada.Acknowledgment, 1)
+	eventChan <- nada.Acknowledgment{SeqNr: 42, Arrival: time.UnixMilli(110), Marked: true}
+	data, err := Marshal(eventChan, 1)
+	require.NoError(f, err)
+	f.Add(data)
+	f.Add([]byte{})
+	f.Add(quicvarint.Append(nil, quicvarint.Max))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		acks, err := UnmarshalFeedback(data)
+		if err != nil {
+			return
+		}
+		// every packet takes at least three bytes
+		assert.LessOrEqual(t, len(acks)*minFeedbackEntrySize, len(data))
+	})
+}
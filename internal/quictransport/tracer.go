@@ -11,6 +11,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/mengelbart/mrtp"
 	"github.com/quic-go/quic-go/qlog"
 	"github.com/quic-go/quic-go/qlogwriter"
 )
@@ -75,11 +76,20 @@ func (t *tracer) record(ts time.Time, event qlogwriter.Event) {
 	// TODO: Listen for relevant events
 	switch e := event.(type) {
 	case qlog.PacketReceived:
+		if e.Header.PacketType == qlog.PacketType1RTT {
+			t.transport.packetReceived(ts, uint64(e.Header.PacketNumber), e.ECN == qlog.ECNCE)
+		}
 		for _, frame := range e.Frames {
 			switch f := frame.Frame.(type) {
 			case *qlog.AckFrame:
 				previous := time.Time{}
-				for _, tsRange := range f.ReceiveTimestamps {
+				receiveTimestamps := f.ReceiveTimestamps
+				if t.transport.feedbackReports != nil {
+					// arrival times are reported by the peer on the feedback
+					// flow
+					receiveTimestamps = nil
+				}
+				for _, tsRange := range receiveTimestamps {
 					for j, delta := range tsRange.TimestampDelta {
 						seqNr := uint64(f.LargestAcked()) - tsRange.DeltaLargestAcknowledged - uint64(j)
 						delta := time.Duration(delta) * time.Microsecond
@@ -90,9 +100,12 @@ func (t *tracer) record(ts time.Time, event qlogwriter.Event) {
 							arrival = previous.Add(-delta)
 						}
 						previous = arrival
-						t.transport.packetAcked(seqNr, arrival)
+						t.transport.packetAcked(seqNr, arrival, mrtp.ECNNonECT)
 					}
 				}
+				if e.Header.PacketType == qlog.PacketType1RTT && t.transport.feedbackReports == nil {
+					t.transport.packetsAckedECN(newlyAcked(f, t.transport.nextECNAck), f.ECT0, f.ECT1, f.ECNCE)
+				}
 				t.transport.updateECNCounts(f.ECT0, f.ECT1, f.ECNCE)
 			}
 		}
@@ -101,9 +114,22 @@ func (t *tracer) record(ts time.Time, event qlogwriter.Event) {
 	case qlog.PacketLost:
 		t.transport.packetLost(uint64(e.Header.PacketNumber))
 	}
+	t.transport.processFeedbackReports()
 	t.transport.updateCongestionControl()
 }
 
+// newlyAcked returns the packet numbers acknowledged by f that are not smaller
+// than next in descending order.
+func newlyAcked(f *qlog.AckFrame, next uint64) []uint64 {
+	acked := []uint64{}
+	for _, r := range f.AckRanges {
+		for pn := int64(r.Largest); pn >= int64(r.Smallest) && pn >= int64(next); pn-- {
+			acked = append(acked, uint64(pn))
+		}
+	}
+	return acked
+}
+
 type traceWriter struct {
 	t *tracer
 }
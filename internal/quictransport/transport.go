@@ -10,6 +10,7 @@ import (
 	"sync/atomic"
 	"time"
 
+	"github.com/Willi-42/go-nada/nada"
 	"github.com/mengelbart/mrtp"
 	"github.com/quic-go/quic-go"
 	"github.com/quic-go/quic-go/quicvarint"
@@ -23,6 +24,7 @@ type Option func(*Transport) error
 type Transport struct {
 	ctx           context.Context
 	netConn       net.PacketConn
+	closeNetConn  bool
 	quicTransport *quic.Transport
 	quicConn      *quic.Conn
 	role          Role
@@ -31,13 +33,26 @@ type Transport struct {
 
 	running atomic.Bool
 
-	pacingFactor    func() float64
-	bwe             mrtp.BWE
-	lastBWEUpdate   time.Time
-	inFlightPackets []packetFeedback
-	lowestInFlight  uint64
-	highestAcked    uint64
-	packetFeedback  []packetFeedback
+	ecn                           mrtp.ECN
+	ackedECT0, ackedECT1, ackedCE uint64
+	nextECNAck                    uint64
+
+	pacingFactor      func() float64
+	bwe               mrtp.BWE
+	bweUpdateInterval time.Duration
+	lastBWEUpdate     time.Time
+	inFlightPackets   []packetFeedback
+	lowestInFlight    uint64
+	highestAcked      uint64
+	packetFeedback    []packetFeedback
+
+	bweStateLogInterval time.Duration
+	lastBWEStateLog     time.Time
+
+	feedbackFlowID   uint64
+	feedbackInterval time.Duration
+	feedbackEvents   chan nada.Acknowledgment
+	feedbackReports  chan []nada.Acknowledgment
 
 	qlogLabel string
 
@@ -53,6 +68,19 @@ func SetBWE(bwe mrtp.BWE) Option {
 	}
 }
 
+// SetBWEUpdateInterval sets the interval at which feedback is passed to the
+// BWE and the target rate is updated. It should match the feedback interval
+// of the receiver. Default: 20ms.
+func SetBWEUpdateInterval(interval time.Duration) Option {
+	return func(t *Transport) error {
+		if interval <= 0 {
+			return fmt.Errorf("invalid BWE update interval: %v", interval)
+		}
+		t.bweUpdateInterval = interval
+		return nil
+	}
+}
+
 func WithRole(r Role) Option {
 	return func(t *Transport) error {
 		t.role = r
@@ -88,6 +116,16 @@ func PacingFactor(factor func() float64) Option {
 	}
 }
 
+// SetBWEStateLogInterval sets the interval at which the state of BWEs
+// implementing [mrtp.BWEStateReporter] is logged. Zero, the default,
+// disables logging.
+func SetBWEStateLogInterval(interval time.Duration) Option {
+	return func(t *Transport) error {
+		t.bweStateLogInterval = interval
+		return nil
+	}
+}
+
 func SetQLOGLabel(label string) Option {
 	return func(t *Transport) error {
 		t.qlogLabel = label
@@ -97,9 +135,10 @@ func SetQLOGLabel(label string) Option {
 
 func New(ctx context.Context, tlsNextProtos []string, opts ...Option) (*Transport, error) {
 	t := &Transport{
-		role:         RoleServer,
-		ctx:          ctx,
-		pacingFactor: func() float64 { return 1.0 },
+		role:              RoleServer,
+		ctx:               ctx,
+		pacingFactor:      func() float64 { return 1.0 },
+		bweUpdateInterval: 20 * time.Millisecond,
 	}
 
 	for _, opt := range opts {
@@ -108,6 +147,22 @@ func New(ctx context.Context, tlsNextProtos []string, opts ...Option) (*Transpor
 		}
 	}
 
+	if t.ecn != mrtp.ECNNonECT {
+		if t.netConn != nil {
+			return nil, errors.New("ECN marking cannot be used with a custom net.PacketConn")
+		}
+		address := t.localAddress
+		if t.role == RoleClient {
+			address = ":0"
+		}
+		conn, err := listenECN(address, t.ecn)
+		if err != nil {
+			return nil, err
+		}
+		t.netConn = conn
+		t.closeNetConn = true
+	}
+
 	tracer := &tracerFactory{
 		qlogLabel: t.qlogLabel,
 		transport: t,
@@ -129,6 +184,7 @@ func New(ctx context.Context, tlsNextProtos []string, opts ...Option) (*Transpor
 			t.quicConn, err = OpenServerConn(ctx, t.localAddress, quicConfig, tlsNextProtos)
 		}
 		if err != nil {
+			t.closeOwnedNetConn()
 			return nil, err
 		}
 	} else {
@@ -147,6 +203,7 @@ func New(ctx context.Context, tlsNextProtos []string, opts ...Option) (*Transpor
 			t.quicConn, err = OpenClientConn(ctx, t.remoteAddress, quicConfig, tlsNextProtos)
 		}
 		if err != nil {
+			t.closeOwnedNetConn()
 			return nil, err
 		}
 	}
@@ -163,6 +220,9 @@ func (t *Transport) GetRTT() time.Duration {
 func (t *Transport) StartHandlers() {
 	go t.receiveDatagrams()
 	go t.receiveUniStreams() // already opened feedback stream; do not have to worry about that here
+	if t.feedbackEvents != nil {
+		go t.sendFeedback()
+	}
 }
 
 // GetQuicDataChannel returns the underlying quic connection.
@@ -179,6 +239,13 @@ func (t *Transport) Close() {
 	if t.quicTransport != nil {
 		_ = t.quicTransport.Close()
 	}
+	t.closeOwnedNetConn()
+}
+
+func (t *Transport) closeOwnedNetConn() {
+	if t.closeNetConn {
+		_ = t.netConn.Close()
+	}
 }
 
 func (t *Transport) receiveUniStreams() {
@@ -218,11 +285,16 @@ func (t *Transport) receiveDatagrams() {
 		}
 
 		// read flowID
-		flowID, _, err := quicvarint.Parse(dgram)
+		flowID, n, err := quicvarint.Parse(dgram)
 		if err != nil {
 			panic(err)
 		}
 
+		if t.feedbackReports != nil && flowID == t.feedbackFlowID {
+			t.handleFeedback(dgram[n:])
+			continue
+		}
+
 		if t.HandleDatagram != nil {
 			t.HandleDatagram(flowID, dgram)
 		}
@@ -235,6 +307,7 @@ type packetFeedback struct {
 	arrived   bool
 	departure time.Time
 	arrival   time.Time
+	ecn       mrtp.ECN
 }
 
 func (t *Transport) packetSent(ts time.Time, seqNr uint64, size int) {
@@ -276,7 +349,7 @@ func (t *Transport) packetLost(seqNr uint64) {
 	}
 }
 
-func (t *Transport) packetAcked(seqNr uint64, arrival time.Time) {
+func (t *Transport) packetAcked(seqNr uint64, arrival time.Time, ecn mrtp.ECN) {
 	if seqNr > t.highestAcked {
 		t.highestAcked = seqNr
 	}
@@ -293,6 +366,9 @@ func (t *Transport) packetAcked(seqNr uint64, arrival time.Time) {
 	feedback := t.inFlightPackets[idx]
 	feedback.arrived = true
 	feedback.arrival = arrival
+	if ecn != mrtp.ECNNonECT {
+		feedback.ecn = ecn
+	}
 	t.inFlightPackets = slices.Delete(t.inFlightPackets, idx, idx+1)
 
 	idx, ok = slices.BinarySearchFunc(t.packetFeedback, seqNr, func(a packetFeedback, b uint64) int {
@@ -301,11 +377,66 @@ func (t *Transport) packetAcked(seqNr uint64, arrival time.Time) {
 	if ok {
 		t.packetFeedback[idx].arrived = true
 		t.packetFeedback[idx].arrival = arrival
+		if ecn != mrtp.ECNNonECT {
+			t.packetFeedback[idx].ecn = ecn
+		}
 	} else {
 		t.packetFeedback = slices.Insert(t.packetFeedback, idx, feedback)
 	}
 }
 
+// packetsAckedECN assigns the ECN codepoints of the packets newly acknowledged
+// by an ACK frame. ACK frames only carry cumulative ECN counts, so the
+// increase of each count is assigned to the acknowledged packets in the order
+// CE, ECT(1), ECT(0), starting at the highest packet number. acked must be
+// sorted in descending order.
+func (t *Transport) packetsAckedECN(acked []uint64, ect0, ect1, ce uint64) {
+	newECT0, newECT1, newCE := countIncrease(t.ackedECT0, ect0), countIncrease(t.ackedECT1, ect1), countIncrease(t.ackedCE, ce)
+	t.ackedECT0, t.ackedECT1, t.ackedCE = ect0, ect1, ce
+	if len(acked) == 0 {
+		return
+	}
+	t.nextECNAck = acked[0] + 1
+
+	for _, seqNr := range acked {
+		var ecn mrtp.ECN
+		switch {
+		case newCE > 0:
+			ecn = mrtp.ECNCE
+			newCE--
+		case newECT1 > 0:
+			ecn = mrtp.ECNECT1
+			newECT1--
+		case newECT0 > 0:
+			ecn = mrtp.ECNECT0
+			newECT0--
+		default:
+			return
+		}
+		t.setPacketECN(seqNr, ecn)
+	}
+}
+
+func countIncrease(previous, current uint64) uint64 {
+	if current < previous {
+		return 0
+	}
+	return current - previous
+}
+
+func (t *Transport) setPacketECN(seqNr uint64, ecn mrtp.ECN) {
+	cmp := func(a packetFeedback, b uint64) int {
+		return int(a.seqNr - b)
+	}
+	if idx, ok := slices.BinarySearchFunc(t.packetFeedback, seqNr, cmp); ok {
+		t.packetFeedback[idx].ecn = ecn
+		return
+	}
+	if idx, ok := slices.BinarySearchFunc(t.inFlightPackets, seqNr, cmp); ok {
+		t.inFlightPackets[idx].ecn = ecn
+	}
+}
+
 func (t *Transport) updateECNCounts(ect0, ect1, ce uint64) {
 	if t.bwe != nil {
 		t.bwe.UpdateECNCounts(ect0, ect1, ce)
@@ -329,11 +460,24 @@ func (t *Transport) updateCongestionControl() {
 			}
 			t.quicConn.SetPacingRate(uint64(t.pacingFactor() * float64(target)))
 		}
+		t.logBWEState()
+	}
+}
+
+func (t *Transport) logBWEState() {
+	if t.bweStateLogInterval <= 0 || time.Since(t.lastBWEStateLog) < t.bweStateLogInterval {
+		return
+	}
+	state, ok := mrtp.GetBWEState(t.bwe)
+	if !ok {
+		return
 	}
+	t.lastBWEStateLog = time.Now()
+	slog.Info("BWE_STATE", "bwe", state)
 }
 
 func (t *Transport) updateBWE() uint {
-	if time.Since(t.lastBWEUpdate) < 20*time.Millisecond {
+	if time.Since(t.lastBWEUpdate) < t.bweUpdateInterval {
 		return 0
 	}
 	idx := 0
@@ -346,7 +490,7 @@ func (t *Transport) updateBWE() uint {
 			continue
 		}
 		if feedback.arrived {
-			t.bwe.OnAck(feedback.seqNr, int(feedback.size), feedback.departure, feedback.arrival, 0)
+			t.bwe.OnAck(feedback.seqNr, int(feedback.size), feedback.departure, feedback.arrival, feedback.ecn)
 		} else {
 			t.bwe.OnLoss(feedback.seqNr, int(feedback.size), feedback.departure)
 		}
@@ -0,0 +1,192 @@
+package mrtp
+
+import (
+	"time"
+)
+
+const (
+	pragueMSS = 1200 // bytes
+
+	// pragueAlphaGain is the EWMA gain used to update the CE marked fraction
+	// (g in DCTCP).
+	pragueAlphaGain = 1.0 / 16
+
+	// pragueBetaLoss is the multiplicative decrease applied after a loss. It
+	// is the classic fallback for paths without L4S marking.
+	pragueBetaLoss = 0.5
+
+	// pragueRefRTT is the reference RTT used to make the additive increase
+	// independent of the RTT of the path.
+	pragueRefRTT = 25 * time.Millisecond
+
+	// pragueMinEpoch is the minimum length of a control epoch, used while the
+	// RTT is still unknown or very small.
+	pragueMinEpoch = 5 * time.Millisecond
+)
+
+var (
+	_ BWE              = (*Prague)(nil)
+	_ BWEStateReporter = (*Prague)(nil)
+)
+
+// Prague is an L4S rate controller in the style of TCP Prague. It reacts once
+// per RTT to the fraction of CE marked packets derived from the aggregated ECN
+// counts: the rate is reduced by alpha/2 where alpha is an EWMA of the CE
+// fraction, as in DCTCP. The rate doubles every epoch until the first mark, as
+// long as the path reports ECN counts. Afterwards and on paths without ECN
+// feedback, the rate is increased additively by one MSS per reference RTT
+// without marks. Epochs without acknowledged ECN capable packets on paths
+// that report ECN counts hold the rate. Losses cause a classic multiplicative
+// decrease.
+type Prague struct {
+	minRate float64
+	maxRate float64
+	rate    float64
+
+	srtt time.Duration
+
+	alpha     float64
+	slowStart bool
+
+	epochStart  time.Time
+	lossInEpoch bool
+
+	ect0, ect1, ce          uint64
+	epochECT0, epochECT1    uint64
+	epochCE                 uint64
+	hasCounts, hasEpochBase bool
+
+	state BWERateState
+	stats bweFeedbackStats
+}
+
+// NewPrague creates a new Prague controller. All rates are in bits per
+// second.
+func NewPrague(initRate, minRate, maxRate uint) *Prague {
+	return &Prague{
+		minRate:   float64(minRate),
+		maxRate:   float64(maxRate),
+		rate:      float64(initRate),
+		slowStart: true,
+	}
+}
+
+// OnAck implements [BWE].
+func (p *Prague) OnAck(sequenceNumber uint64, size int, departure time.Time, arrival time.Time, ecn ECN) {
+	// prague uses the aggregated ECN counts, acks are only used for the
+	// reported state
+	p.stats.onAck(ecn)
+}
+
+// OnLoss implements [BWE].
+func (p *Prague) OnLoss(sequenceNumber uint64, size int, departure time.Time) {
+	p.stats.onLoss()
+	p.lossInEpoch = true
+}
+
+// UpdateECNCounts implements [BWE]. The counts are cumulative over the
+// lifetime of the connection.
+func (p *Prague) UpdateECNCounts(ect0 uint64, ect1 uint64, ce uint64) {
+	if ect0 < p.ect0 || ect1 < p.ect1 || ce < p.ce {
+		// counters were reset, start a new baseline
+		p.hasEpochBase = false
+	}
+	p.ect0, p.ect1, p.ce = ect0, ect1, ce
+	p.hasCounts = true
+	if !p.hasEpochBase {
+		p.startEpochCounts()
+	}
+}
+
+// UpdateRTT implements [BWE].
+func (p *Prague) UpdateRTT(rtt time.Duration) {
+	if rtt <= 0 {
+		return
+	}
+	if p.srtt == 0 {
+		p.srtt = rtt
+		return
+	}
+	p.srtt = time.Duration(0.875*float64(p.srtt) + 0.125*float64(rtt))
+}
+
+// UpdateTargetRate implements [BWE].
+func (p *Prague) UpdateTargetRate(now time.Time) int {
+	if p.epochStart.IsZero() {
+		p.epochStart = now
+		return int(p.rate)
+	}
+	epoch := now.Sub(p.epochStart)
+	if epoch < max(p.srtt, pragueMinEpoch) {
+		return int(p.rate)
+	}
+	defer func() {
+		p.stats.onTargetRate(int(p.rate))
+	}()
+
+	marked, total := p.epochMarks()
+	if total > 0 {
+		fraction := float64(marked) / float64(total)
+		p.alpha = (1-pragueAlphaGain)*p.alpha + pragueAlphaGain*fraction
+	}
+
+	switch {
+	case p.lossInEpoch:
+		p.rate *= pragueBetaLoss
+		p.slowStart = false
+		p.state = BWERateDecrease
+	case marked > 0:
+		p.rate *= 1 - p.alpha/2
+		p.slowStart = false
+		p.state = BWERateDecrease
+	case p.hasCounts && total == 0:
+		// nothing was acknowledged with ECN counts in this epoch, e.g.
+		// because the sender was idle or the ACKs are late
+		p.state = BWERateHold
+	case p.slowStart && total > 0:
+		p.rate *= 2
+		p.state = BWERateIncrease
+	default:
+		p.state = BWERateIncrease
+		// Without ECN feedback, marks cannot end slow start and the rate
+		// would only stop growing at the first loss.
+		if !p.hasCounts {
+			p.slowStart = false
+		}
+		// One MSS per reference RTT in window terms translates to a rate
+		// increase of 8*MSS/refRTT² per second.
+		p.rate += 8 * pragueMSS * epoch.Seconds() / (pragueRefRTT.Seconds() * pragueRefRTT.Seconds())
+	}
+	p.rate = min(max(p.rate, p.minRate), p.maxRate)
+
+	p.epochStart = now
+	p.lossInEpoch = false
+	p.startEpochCounts()
+
+	return int(p.rate)
+}
+
+// BWEState implements [BWEStateReporter].
+func (p *Prague) BWEState() BWEState {
+	state := p.stats.bweState()
+	state.State = p.state
+	state.RTT = p.srtt
+	state.ECNMarkRatio = p.alpha
+	return state
+}
+
+// epochMarks returns the number of CE marked packets and the total number of
+// ECN capable packets acknowledged during the current epoch.
+func (p *Prague) epochMarks() (marked, total uint64) {
+	if !p.hasCounts || !p.hasEpochBase {
+		return 0, 0
+	}
+	marked = p.ce - p.epochCE
+	total = marked + (p.ect0 - p.epochECT0) + (p.ect1 - p.epochECT1)
+	return marked, total
+}
+
+func (p *Prague) startEpochCounts() {
+	p.epochECT0, p.epochECT1, p.epochCE = p.ect0, p.ect1, p.ce
+	p.hasEpochBase = p.hasCounts
+}
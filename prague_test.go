@@ -0,0 +1,93 @@
+package mrtp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPragueSlowStartUntilFirstMark(t *testing.T) {
+	p := NewPrague(1_000_000, 100_000, 100_000_000)
+	now := time.Unix(0, 0)
+	p.UpdateRTT(20 * time.Millisecond)
+	p.UpdateECNCounts(0, 0, 0)
+	assert.Equal(t, 1_000_000, p.UpdateTargetRate(now))
+
+	p.UpdateECNCounts(0, 100, 0)
+	assert.Equal(t, 2_000_000, p.UpdateTargetRate(now.Add(20*time.Millisecond)))
+	assert.Equal(t, BWERateIncrease, p.BWEState().State)
+
+	// no new epoch yet
+	assert.Equal(t, 2_000_000, p.UpdateTargetRate(now.Add(30*time.Millisecond)))
+
+	p.UpdateECNCounts(0, 150, 50)
+	rate := p.UpdateTargetRate(now.Add(40 * time.Millisecond))
+	assert.Less(t, rate, 2_000_000)
+	assert.False(t, p.slowStart)
+	assert.InDelta(t, 0.5/16, p.alpha, 1e-9)
+	assert.Equal(t, BWERateDecrease, p.BWEState().State)
+
+	p.UpdateECNCounts(0, 250, 50)
+	assert.Greater(t, p.UpdateTargetRate(now.Add(60*time.Millisecond)), rate)
+}
+
+func TestPragueReductionScalesWithMarkingFraction(t *testing.T) {
+	reduction := func(ce uint64) int {
+		p := NewPrague(4_000_000, 100_000, 100_000_000)
+		p.slowStart = false
+		now := time.Unix(0, 0)
+		p.UpdateRTT(20 * time.Millisecond)
+		p.UpdateECNCounts(0, 0, 0)
+		p.UpdateTargetRate(now)
+		p.UpdateECNCounts(0, 100-ce, ce)
+		return 4_000_000 - p.UpdateTargetRate(now.Add(20*time.Millisecond))
+	}
+	assert.Less(t, reduction(10), reduction(90))
+}
+
+func TestPragueLossFallback(t *testing.T) {
+	p := NewPrague(4_000_000, 100_000, 100_000_000)
+	now := time.Unix(0, 0)
+	p.UpdateRTT(20 * time.Millisecond)
+	p.UpdateTargetRate(now)
+	p.OnLoss(1, 1200, now)
+	assert.Equal(t, 2_000_000, p.UpdateTargetRate(now.Add(20*time.Millisecond)))
+}
+
+func TestPragueNoSlowStartWithoutECN(t *testing.T) {
+	p := NewPrague(1_000_000, 100_000, 100_000_000)
+	now := time.Unix(0, 0)
+	p.UpdateRTT(20 * time.Millisecond)
+	assert.Equal(t, 1_000_000, p.UpdateTargetRate(now))
+
+	// additive increase of 8*MSS*epoch/refRTT² instead of doubling
+	assert.Equal(t, 1_307_200, p.UpdateTargetRate(now.Add(20*time.Millisecond)))
+	assert.False(t, p.slowStart)
+
+	// later ECN counts do not restart slow start, the first counts only
+	// start the baseline of the epoch
+	p.UpdateECNCounts(0, 100, 0)
+	assert.Equal(t, 1_307_200, p.UpdateTargetRate(now.Add(40*time.Millisecond)))
+	p.UpdateECNCounts(0, 200, 0)
+	assert.Equal(t, 1_614_400, p.UpdateTargetRate(now.Add(60*time.Millisecond)))
+}
+
+func TestPragueSlowStartAcrossEmptyEpoch(t *testing.T) {
+	p := NewPrague(1_000_000, 100_000, 100_000_000)
+	now := time.Unix(0, 0)
+	p.UpdateRTT(20 * time.Millisecond)
+	p.UpdateECNCounts(0, 0, 0)
+	p.UpdateTargetRate(now)
+
+	p.UpdateECNCounts(0, 100, 0)
+	assert.Equal(t, 2_000_000, p.UpdateTargetRate(now.Add(20*time.Millisecond)))
+
+	// an epoch without acknowledged packets holds the rate
+	assert.Equal(t, 2_000_000, p.UpdateTargetRate(now.Add(40*time.Millisecond)))
+	assert.Equal(t, BWERateHold, p.BWEState().State)
+	assert.True(t, p.slowStart)
+
+	p.UpdateECNCounts(0, 200, 0)
+	assert.Equal(t, 4_000_000, p.UpdateTargetRate(now.Add(60*time.Millisecond)))
+}
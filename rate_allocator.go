@@ -0,0 +1,243 @@
+package mrtp
+
+import (
+	"cmp"
+	"errors"
+	"math"
+	"slices"
+	"sync"
+)
+
+// RateFlowConfig configures a flow registered at a [RateAllocator]. All rates
+// are in bits per second.
+type RateFlowConfig struct {
+	// Name identifies the flow.
+	Name string
+
+	// Priority orders flows. The rate that remains after all minimum rates
+	// were allocated is first shared between the flows with the highest
+	// priority. Flows with lower priority only get what is left when all
+	// higher priority flows reached their maximum rate or demand.
+	Priority int
+
+	// Weight is the share of a flow relative to the other flows of the same
+	// priority. Flows with zero weight only get their MinRate.
+	Weight float64
+
+	// MinRate is allocated to the flow before any rate is shared by weight,
+	// as long as the target rate suffices.
+	MinRate uint
+
+	// MaxRate limits the rate of the flow. Zero means unlimited.
+	MaxRate uint
+
+	// MaxShare limits the rate of the flow to this fraction of the target
+	// rate, e.g. to leave headroom for packet overhead. Zero means
+	// unlimited.
+	MaxShare float64
+
+	// SetRate is called with the new rate of the flow whenever it changes.
+	// It must not call back into the allocator.
+	SetRate func(ratebps uint) error
+
+	// Active reports whether the flow currently sends. Inactive flows are
+	// not allocated any rate. A nil Active means the flow is always active.
+	Active func() bool
+}
+
+// RateAllocator distributes the target rate of a single [BWE] across multiple
+// flows, e.g. video and audio encoders and data channels.
+type RateAllocator struct {
+	lock      sync.Mutex
+	flows     []*RateFlow
+	target    uint
+	hasTarget bool
+}
+
+// NewRateAllocator creates an allocator without flows.
+func NewRateAllocator() *RateAllocator {
+	return &RateAllocator{}
+}
+
+// RateFlow is a flow registered at a [RateAllocator].
+type RateFlow struct {
+	allocator *RateAllocator
+	config    RateFlowConfig
+
+	demand    uint
+	hasDemand bool
+
+	rate    uint
+	hasRate bool
+
+	// scratch space used during allocation
+	limit     float64
+	allocated float64
+}
+
+// AddFlow registers a new flow. The flow is included in the next allocation.
+func (a *RateAllocator) AddFlow(config RateFlowConfig) *RateFlow {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	f := &RateFlow{
+		allocator: a,
+		config:    config,
+	}
+	a.flows = append(a.flows, f)
+	return f
+}
+
+// SetTargetRate distributes ratebps across all registered flows and calls
+// SetRate of each flow whose rate changed. Its signature matches the target
+// rate callbacks of the transports.
+func (a *RateAllocator) SetTargetRate(ratebps uint) error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.target = ratebps
+	a.hasTarget = true
+	return a.allocate()
+}
+
+// Name returns the name of the flow.
+func (f *RateFlow) Name() string {
+	return f.config.Name
+}
+
+// Rate returns the rate last allocated to the flow.
+func (f *RateFlow) Rate() uint {
+	f.allocator.lock.Lock()
+	defer f.allocator.lock.Unlock()
+	return f.rate
+}
+
+// SetDemand limits the flow to ratebps. Flows that currently need less than
+// their share use this to hand back the unused rate to the other flows.
+func (f *RateFlow) SetDemand(ratebps uint) error {
+	a := f.allocator
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if f.hasDemand && f.demand == ratebps {
+		return nil
+	}
+	f.demand = ratebps
+	f.hasDemand = true
+	return a.reallocate()
+}
+
+// ResetDemand removes a demand set with SetDemand.
+func (f *RateFlow) ResetDemand() error {
+	a := f.allocator
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if !f.hasDemand {
+		return nil
+	}
+	f.hasDemand = false
+	return a.reallocate()
+}
+
+// Remove unregisters the flow and shares its rate between the remaining
+// flows.
+func (f *RateFlow) Remove() error {
+	a := f.allocator
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.flows = slices.DeleteFunc(a.flows, func(g *RateFlow) bool {
+		return g == f
+	})
+	return a.reallocate()
+}
+
+func (f *RateFlow) active() bool {
+	return f.config.Active == nil || f.config.Active()
+}
+
+func (a *RateAllocator) reallocate() error {
+	if !a.hasTarget {
+		return nil
+	}
+	return a.allocate()
+}
+
+func (a *RateAllocator) allocate() error {
+	active := make([]*RateFlow, 0, len(a.flows))
+	for _, f := range a.flows {
+		f.allocated = 0
+		if !f.active() {
+			continue
+		}
+		f.limit = math.Inf(1)
+		if f.config.MaxRate > 0 {
+			f.limit = float64(f.config.MaxRate)
+		}
+		if f.config.MaxShare > 0 {
+			f.limit = min(f.limit, f.config.MaxShare*float64(a.target))
+		}
+		if f.hasDemand {
+			f.limit = min(f.limit, float64(f.demand))
+		}
+		active = append(active, f)
+	}
+	slices.SortStableFunc(active, func(x, y *RateFlow) int {
+		return cmp.Compare(y.config.Priority, x.config.Priority)
+	})
+
+	remaining := float64(a.target)
+	for _, f := range active {
+		f.allocated = min(float64(f.config.MinRate), f.limit, remaining)
+		remaining -= f.allocated
+	}
+	for start := 0; start < len(active); {
+		end := start + 1
+		for end < len(active) && active[end].config.Priority == active[start].config.Priority {
+			end++
+		}
+		remaining = shareByWeight(active[start:end], remaining)
+		start = end
+	}
+
+	var errs []error
+	for _, f := range a.flows {
+		rate := uint(f.allocated)
+		if f.hasRate && f.rate == rate {
+			continue
+		}
+		f.rate = rate
+		f.hasRate = true
+		if f.config.SetRate != nil {
+			if err := f.config.SetRate(rate); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// shareByWeight distributes remaining between flows by weight without
+// exceeding their limits and returns the rate that could not be allocated.
+func shareByWeight(flows []*RateFlow, remaining float64) float64 {
+	// every round either distributes everything or saturates at least one
+	// flow
+	for range len(flows) {
+		var total float64
+		for _, f := range flows {
+			if f.allocated < f.limit && f.config.Weight > 0 {
+				total += f.config.Weight
+			}
+		}
+		if total == 0 || remaining <= 0 {
+			break
+		}
+		distributed := 0.0
+		for _, f := range flows {
+			if f.allocated >= f.limit || f.config.Weight <= 0 {
+				continue
+			}
+			share := min(remaining*f.config.Weight/total, f.limit-f.allocated)
+			f.allocated += share
+			distributed += share
+		}
+		remaining -= distributed
+	}
+	return max(remaining, 0)
+}
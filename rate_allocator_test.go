@@ -0,0 +1,140 @@
+package mrtp
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateAllocatorWeights(t *testing.T) {
+	a := NewRateAllocator()
+	var video, data uint
+	a.AddFlow(RateFlowConfig{Name: "video", Weight: 3, SetRate: func(r uint) error { video = r; return nil }})
+	a.AddFlow(RateFlowConfig{Name: "data", Weight: 1, SetRate: func(r uint) error { data = r; return nil }})
+
+	require.NoError(t, a.SetTargetRate(1_000_000))
+	assert.Equal(t, uint(750_000), video)
+	assert.Equal(t, uint(250_000), data)
+}
+
+func TestRateAllocatorMinMax(t *testing.T) {
+	a := NewRateAllocator()
+	video := a.AddFlow(RateFlowConfig{Name: "video", Weight: 1, MaxRate: 2_000_000})
+	audio := a.AddFlow(RateFlowConfig{Name: "audio", Weight: 1, MinRate: 64_000, MaxRate: 128_000})
+	data := a.AddFlow(RateFlowConfig{Name: "data", Weight: 1})
+
+	// audio reaches its maximum, the rest is shared between video and data
+	require.NoError(t, a.SetTargetRate(1_064_000))
+	assert.Equal(t, uint(468_000), video.Rate())
+	assert.Equal(t, uint(128_000), audio.Rate())
+	assert.Equal(t, uint(468_000), data.Rate())
+
+	// video is capped, remaining rate goes to the other flows
+	require.NoError(t, a.SetTargetRate(10_000_000))
+	assert.Equal(t, uint(2_000_000), video.Rate())
+	assert.Equal(t, uint(128_000), audio.Rate())
+	assert.Equal(t, uint(10_000_000-2_000_000-128_000), data.Rate())
+
+	// minimum rates are served first
+	require.NoError(t, a.SetTargetRate(50_000))
+	assert.Equal(t, uint(0), video.Rate())
+	assert.Equal(t, uint(50_000), audio.Rate())
+	assert.Equal(t, uint(0), data.Rate())
+}
+
+func TestRateAllocatorMaxShare(t *testing.T) {
+	a := NewRateAllocator()
+	running := false
+	media := a.AddFlow(RateFlowConfig{Name: "media", Weight: 50, MaxShare: 0.8})
+	data := a.AddFlow(RateFlowConfig{Name: "data", Weight: 50, Active: func() bool { return running }})
+
+	// the share not used by media is left unallocated
+	require.NoError(t, a.SetTargetRate(1_000_000))
+	assert.Equal(t, uint(800_000), media.Rate())
+	assert.Equal(t, uint(0), data.Rate())
+
+	running = true
+	require.NoError(t, a.SetTargetRate(1_000_000))
+	assert.Equal(t, uint(500_000), media.Rate())
+	assert.Equal(t, uint(500_000), data.Rate())
+}
+
+func TestRateAllocatorPriority(t *testing.T) {
+	a := NewRateAllocator()
+	audio := a.AddFlow(RateFlowConfig{Name: "audio", Priority: 2, Weight: 1, MaxRate: 100_000})
+	video := a.AddFlow(RateFlowConfig{Name: "video", Priority: 1, Weight: 1, MaxRate: 600_000})
+	data := a.AddFlow(RateFlowConfig{Name: "data", Weight: 1})
+
+	require.NoError(t, a.SetTargetRate(500_000))
+	assert.Equal(t, uint(100_000), audio.Rate())
+	assert.Equal(t, uint(400_000), video.Rate())
+	assert.Equal(t, uint(0), data.Rate())
+
+	require.NoError(t, a.SetTargetRate(1_000_000))
+	assert.Equal(t, uint(100_000), audio.Rate())
+	assert.Equal(t, uint(600_000), video.Rate())
+	assert.Equal(t, uint(300_000), data.Rate())
+}
+
+func TestRateAllocatorDemand(t *testing.T) {
+	a := NewRateAllocator()
+	calls := 0
+	video := a.AddFlow(RateFlowConfig{Name: "video", Weight: 1, SetRate: func(uint) error { calls++; return nil }})
+	data := a.AddFlow(RateFlowConfig{Name: "data", Weight: 1})
+
+	// demand before the first target rate does not allocate anything
+	require.NoError(t, data.SetDemand(100_000))
+	assert.Equal(t, 0, calls)
+
+	require.NoError(t, a.SetTargetRate(1_000_000))
+	assert.Equal(t, uint(900_000), video.Rate())
+	assert.Equal(t, uint(100_000), data.Rate())
+	assert.Equal(t, 1, calls)
+
+	// unchanged rates do not trigger callbacks
+	require.NoError(t, a.SetTargetRate(1_000_000))
+	assert.Equal(t, 1, calls)
+
+	require.NoError(t, data.ResetDemand())
+	assert.Equal(t, uint(500_000), video.Rate())
+	assert.Equal(t, uint(500_000), data.Rate())
+	assert.Equal(t, 2, calls)
+
+	require.NoError(t, data.Remove())
+	assert.Equal(t, uint(1_000_000), video.Rate())
+}
+
+func TestRateAllocatorZeroWeight(t *testing.T) {
+	a := NewRateAllocator()
+	video := a.AddFlow(RateFlowConfig{Name: "video", Weight: 1})
+	data := a.AddFlow(RateFlowConfig{Name: "data", MinRate: 100_000})
+
+	require.NoError(t, a.SetTargetRate(1_000_000))
+	assert.Equal(t, uint(900_000), video.Rate())
+	assert.Equal(t, uint(100_000), data.Rate())
+}
+
+func TestRateAllocatorInactive(t *testing.T) {
+	a := NewRateAllocator()
+	running := false
+	video := a.AddFlow(RateFlowConfig{Name: "video", Weight: 1})
+	data := a.AddFlow(RateFlowConfig{Name: "data", Weight: 1, Active: func() bool { return running }})
+
+	require.NoError(t, a.SetTargetRate(1_000_000))
+	assert.Equal(t, uint(1_000_000), video.Rate())
+	assert.Equal(t, uint(0), data.Rate())
+
+	running = true
+	require.NoError(t, a.SetTargetRate(1_000_000))
+	assert.Equal(t, uint(500_000), video.Rate())
+	assert.Equal(t, uint(500_000), data.Rate())
+}
+
+func TestRateAllocatorError(t *testing.T) {
+	a := NewRateAllocator()
+	errFoo := errors.New("foo")
+	a.AddFlow(RateFlowConfig{Name: "video", Weight: 1, SetRate: func(uint) error { return errFoo }})
+	assert.ErrorIs(t, a.SetTargetRate(1_000_000), errFoo)
+}
@@ -0,0 +1,156 @@
+package mrtp
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// RateFilterOption configures a [RateFilter].
+type RateFilterOption func(*RateFilter) error
+
+// RateFilterSmoothing sets the EWMA gains used to smooth increasing and
+// decreasing rates. Gains must be in (0, 1], where 1 disables smoothing. A
+// small up and a large down gain make the filter follow decreases faster than
+// increases. Default: 1, 1.
+func RateFilterSmoothing(up, down float64) RateFilterOption {
+	return func(f *RateFilter) error {
+		if up <= 0 || up > 1 || down <= 0 || down > 1 {
+			return fmt.Errorf("invalid smoothing gains %v, %v: must be in (0, 1]", up, down)
+		}
+		f.up, f.down = up, down
+		return nil
+	}
+}
+
+// RateFilterMinDwell sets the minimum time between two changes of the output
+// rate. Default: 0.
+func RateFilterMinDwell(d time.Duration) RateFilterOption {
+	return func(f *RateFilter) error {
+		if d < 0 {
+			return fmt.Errorf("invalid minimum dwell time: %v", d)
+		}
+		f.minDwell = d
+		return nil
+	}
+}
+
+// RateFilterMinRelativeDelta suppresses changes of the output rate that are
+// smaller than delta relative to the current output rate, e.g. 0.05 for 5%.
+// Default: 0.
+func RateFilterMinRelativeDelta(delta float64) RateFilterOption {
+	return func(f *RateFilter) error {
+		if delta < 0 {
+			return fmt.Errorf("invalid minimum relative delta: %v", delta)
+		}
+		f.minDelta = delta
+		return nil
+	}
+}
+
+// RateFilterHysteresis sets the additional relative delta required to change
+// the output rate in the opposite direction of the previous change. Default:
+// 0.
+func RateFilterHysteresis(hysteresis float64) RateFilterOption {
+	return func(f *RateFilter) error {
+		if hysteresis < 0 {
+			return fmt.Errorf("invalid hysteresis: %v", hysteresis)
+		}
+		f.hysteresis = hysteresis
+		return nil
+	}
+}
+
+// RateFilter smooths and throttles a sequence of target rates, so that
+// encoders are not reconfigured on every small change of the estimate.
+type RateFilter struct {
+	up, down   float64
+	minDwell   time.Duration
+	minDelta   float64
+	hysteresis float64
+
+	initialized   bool
+	smoothed      float64
+	rate          int
+	lastChange    time.Time
+	lastDirection int
+}
+
+// NewRateFilter creates a new filter. Without options, the filter passes all
+// rates unchanged.
+func NewRateFilter(opts ...RateFilterOption) (*RateFilter, error) {
+	f := &RateFilter{
+		up:   1,
+		down: 1,
+	}
+	for _, opt := range opts {
+		if err := opt(f); err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+// Update adds a new rate at time now and returns the filtered rate.
+func (f *RateFilter) Update(now time.Time, rate int) int {
+	if !f.initialized {
+		f.initialized = true
+		f.smoothed = float64(rate)
+		f.rate = rate
+		f.lastChange = now
+		return f.rate
+	}
+
+	gain := f.up
+	if float64(rate) < f.smoothed {
+		gain = f.down
+	}
+	f.smoothed += gain * (float64(rate) - f.smoothed)
+
+	candidate := int(math.Round(f.smoothed))
+	if candidate == f.rate || now.Sub(f.lastChange) < f.minDwell {
+		return f.rate
+	}
+	direction := 1
+	if candidate < f.rate {
+		direction = -1
+	}
+	threshold := f.minDelta
+	if f.lastDirection != 0 && direction != f.lastDirection {
+		threshold += f.hysteresis
+	}
+	if f.rate > 0 && math.Abs(float64(candidate-f.rate))/float64(f.rate) < threshold {
+		return f.rate
+	}
+	f.rate = candidate
+	f.lastChange = now
+	f.lastDirection = direction
+	return f.rate
+}
+
+// Rate returns the current output rate of the filter.
+func (f *RateFilter) Rate() int {
+	return f.rate
+}
+
+// FilterTargetRate returns a target rate callback that passes rates through
+// filter and calls setRate whenever the filtered rate changes. It belongs
+// between a transport and the encoders or a [RateAllocator]; pacing should
+// keep following the unfiltered target rate. If setRate fails, the rate is
+// passed again with the next update.
+func FilterTargetRate(filter *RateFilter, setRate func(ratebps uint) error) func(ratebps uint) error {
+	var last uint
+	called := false
+	return func(ratebps uint) error {
+		rate := uint(filter.Update(time.Now(), int(ratebps)))
+		if called && rate == last {
+			return nil
+		}
+		if err := setRate(rate); err != nil {
+			return err
+		}
+		called = true
+		last = rate
+		return nil
+	}
+}
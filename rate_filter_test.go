@@ -0,0 +1,110 @@
+package mrtp
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateFilterPassThrough(t *testing.T) {
+	f, err := NewRateFilter()
+	require.NoError(t, err)
+	now := time.Unix(10, 0)
+	for _, rate := range []int{1000, 1200, 900, 900, 5000} {
+		assert.Equal(t, rate, f.Update(now, rate))
+		now = now.Add(20 * time.Millisecond)
+	}
+}
+
+func TestRateFilterSmoothing(t *testing.T) {
+	f, err := NewRateFilter(RateFilterSmoothing(0.5, 1))
+	require.NoError(t, err)
+	now := time.Unix(10, 0)
+	assert.Equal(t, 1000, f.Update(now, 1000))
+	assert.Equal(t, 1500, f.Update(now, 2000))
+	assert.Equal(t, 1750, f.Update(now, 2000))
+	// decreases are applied immediately
+	assert.Equal(t, 500, f.Update(now, 500))
+}
+
+func TestRateFilterDwellAndDelta(t *testing.T) {
+	f, err := NewRateFilter(RateFilterMinDwell(100*time.Millisecond), RateFilterMinRelativeDelta(0.1))
+	require.NoError(t, err)
+	now := time.Unix(10, 0)
+	assert.Equal(t, 1000, f.Update(now, 1000))
+
+	// too early
+	assert.Equal(t, 1000, f.Update(now.Add(50*time.Millisecond), 2000))
+	// too small
+	assert.Equal(t, 1000, f.Update(now.Add(100*time.Millisecond), 1050))
+	assert.Equal(t, 1200, f.Update(now.Add(100*time.Millisecond), 1200))
+	// too early again
+	assert.Equal(t, 1200, f.Update(now.Add(150*time.Millisecond), 600))
+	assert.Equal(t, 600, f.Update(now.Add(200*time.Millisecond), 600))
+	assert.Equal(t, 600, f.Rate())
+}
+
+func TestRateFilterHysteresis(t *testing.T) {
+	f, err := NewRateFilter(RateFilterMinRelativeDelta(0.05), RateFilterHysteresis(0.1))
+	require.NoError(t, err)
+	now := time.Unix(10, 0)
+	assert.Equal(t, 1000, f.Update(now, 1000))
+	assert.Equal(t, 1100, f.Update(now, 1100))
+	// same direction only needs the minimum delta
+	assert.Equal(t, 1160, f.Update(now, 1160))
+	// reversing needs 15%
+	assert.Equal(t, 1160, f.Update(now, 1050))
+	assert.Equal(t, 980, f.Update(now, 980))
+}
+
+func TestRateFilterInvalidOptions(t *testing.T) {
+	for _, opt := range []RateFilterOption{
+		RateFilterSmoothing(0, 1),
+		RateFilterSmoothing(1, 1.5),
+		RateFilterMinDwell(-time.Second),
+		RateFilterMinRelativeDelta(-1),
+		RateFilterHysteresis(-1),
+	} {
+		_, err := NewRateFilter(opt)
+		assert.Error(t, err)
+	}
+}
+
+func TestFilterTargetRate(t *testing.T) {
+	f, err := NewRateFilter(RateFilterMinRelativeDelta(0.15))
+	require.NoError(t, err)
+	var rates []uint
+	setRate := FilterTargetRate(f, func(ratebps uint) error {
+		rates = append(rates, ratebps)
+		return nil
+	})
+
+	require.NoError(t, setRate(10_000))
+	require.NoError(t, setRate(11_000))
+	require.NoError(t, setRate(10_500))
+	require.NoError(t, setRate(12_000))
+	assert.Equal(t, []uint{10_000, 12_000}, rates)
+}
+
+func TestFilterTargetRateRetriesFailedRate(t *testing.T) {
+	f, err := NewRateFilter()
+	require.NoError(t, err)
+	var rates []uint
+	fail := true
+	setRate := FilterTargetRate(f, func(ratebps uint) error {
+		rates = append(rates, ratebps)
+		if fail {
+			return errors.New("allocator failed")
+		}
+		return nil
+	})
+
+	assert.Error(t, setRate(10_000))
+	fail = false
+	require.NoError(t, setRate(10_000))
+	require.NoError(t, setRate(10_000))
+	assert.Equal(t, []uint{10_000, 10_000}, rates)
+}
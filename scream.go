@@ -0,0 +1,293 @@
+package mrtp
+
+import (
+	"time"
+)
+
+const (
+	screamMSS = 1200 // bytes
+
+	// screamQDelayTarget is the queuing delay the controller tries to stay
+	// below.
+	screamQDelayTarget = 60 * time.Millisecond
+
+	// screamGain scales the delay based window increase and decrease.
+	screamGain = 1.0
+
+	// screamBetaLoss is the window reduction factor after a loss event.
+	screamBetaLoss = 0.7
+
+	// screamBetaECN is the window reduction factor after a CE mark when the
+	// path is not L4S capable.
+	screamBetaECN = 0.8
+
+	// screamL4SGain is the EWMA gain used to update the fraction of CE marked
+	// bytes.
+	screamL4SGain = 1.0 / 16
+
+	// screamFastIncreaseDelay is the time without congestion after which the
+	// controller returns to fast increase.
+	screamFastIncreaseDelay = 5 * time.Second
+
+	// screamBaseOWDWindow is the length of a base delay history bucket.
+	// screamBaseOWDBuckets buckets are kept, so that the base delay adapts to
+	// route changes after screamBaseOWDWindow * screamBaseOWDBuckets.
+	screamBaseOWDWindow  = time.Minute
+	screamBaseOWDBuckets = 10
+
+	// screamMaxCwndFactor limits the congestion window relative to the
+	// delivered bytes per RTT, so that the window does not grow without bound
+	// while the source is application limited.
+	screamMaxCwndFactor = 1.5
+)
+
+var (
+	_ BWE              = (*SCReAM)(nil)
+	_ BWEStateReporter = (*SCReAM)(nil)
+)
+
+// SCReAM is a native implementation of the Self-Clocked Rate Adaptation for
+// Multimedia (RFC 8298) congestion controller. The congestion window is
+// updated from one-way delay samples, losses and per packet ECN marks and
+// translated to a target rate using the smoothed RTT.
+type SCReAM struct {
+	minRate float64
+	maxRate float64
+	rate    float64
+
+	cwnd float64 // bytes
+	srtt time.Duration
+
+	baseOWD      []time.Duration
+	baseOWDStart time.Time
+	qdelay       time.Duration
+
+	bytesNewlyAcked uint64
+	bytesDelivered  uint64
+	bytesMarked     uint64
+	bytesAckedL4S   uint64
+	deliveryStart   time.Time
+	deliveredPerRTT float64
+
+	l4s             bool
+	l4sAlpha        float64
+	lastAlphaUpdate time.Time
+
+	lossPending    bool
+	cePending      bool
+	lastCongestion time.Time
+	lastReaction   time.Time
+	inFastIncrease bool
+	state          BWERateState
+
+	stats bweFeedbackStats
+}
+
+// NewSCReAM creates a new SCReAM controller. All rates are in bits per
+// second.
+func NewSCReAM(initRate, minRate, maxRate uint) *SCReAM {
+	return &SCReAM{
+		minRate:        float64(minRate),
+		maxRate:        float64(maxRate),
+		rate:           float64(initRate),
+		baseOWD:        make([]time.Duration, 0, screamBaseOWDBuckets),
+		inFastIncrease: true,
+	}
+}
+
+// OnAck implements [BWE].
+func (s *SCReAM) OnAck(sequenceNumber uint64, size int, departure time.Time, arrival time.Time, ecn ECN) {
+	s.stats.onAck(ecn)
+	s.updateQDelay(arrival, arrival.Sub(departure))
+
+	s.bytesNewlyAcked += uint64(size)
+	s.bytesDelivered += uint64(size)
+	s.bytesAckedL4S += uint64(size)
+
+	switch ecn {
+	case ECNECT1:
+		s.l4s = true
+	case ECNCE:
+		s.bytesMarked += uint64(size)
+		s.cePending = true
+	}
+}
+
+// OnLoss implements [BWE].
+func (s *SCReAM) OnLoss(sequenceNumber uint64, size int, departure time.Time) {
+	s.stats.onLoss()
+	s.lossPending = true
+}
+
+// UpdateECNCounts implements [BWE].
+func (s *SCReAM) UpdateECNCounts(ect0 uint64, ect1 uint64, ce uint64) {
+	// scream uses the per packet ECN marks passed to OnAck
+}
+
+// UpdateRTT implements [BWE].
+func (s *SCReAM) UpdateRTT(rtt time.Duration) {
+	if rtt <= 0 {
+		return
+	}
+	if s.srtt == 0 {
+		s.srtt = rtt
+		return
+	}
+	s.srtt = time.Duration(0.875*float64(s.srtt) + 0.125*float64(rtt))
+}
+
+// UpdateTargetRate implements [BWE].
+func (s *SCReAM) UpdateTargetRate(now time.Time) int {
+	defer func() {
+		s.stats.onTargetRate(int(s.rate))
+	}()
+	if s.srtt == 0 {
+		// Cannot translate between window and rate before the first RTT
+		// sample.
+		s.state = BWERateHold
+		return int(s.rate)
+	}
+	if s.cwnd == 0 {
+		s.cwnd = max(s.rate/8*s.srtt.Seconds(), 2*screamMSS)
+	}
+
+	s.updateDeliveryRate(now)
+	s.updateL4SAlpha(now)
+	s.updateCwnd(now)
+
+	rate := 8 * s.cwnd / s.srtt.Seconds()
+	rate = min(max(rate, s.minRate), s.maxRate)
+	s.rate = rate
+
+	// keep the window consistent with the clamped rate
+	s.cwnd = max(rate/8*s.srtt.Seconds(), 2*screamMSS)
+
+	return int(s.rate)
+}
+
+// BWEState implements [BWEStateReporter].
+func (s *SCReAM) BWEState() BWEState {
+	state := s.stats.bweState()
+	state.State = s.state
+	state.RTT = s.srtt
+	state.QueuingDelay = s.qdelay
+	if s.l4s {
+		state.ECNMarkRatio = s.l4sAlpha
+	}
+	return state
+}
+
+// updateQDelay updates the base one-way delay history and the current queuing
+// delay estimate. One-way delays may include an unknown clock offset, which
+// cancels out when the base delay is subtracted.
+func (s *SCReAM) updateQDelay(now time.Time, owd time.Duration) {
+	if len(s.baseOWD) == 0 || now.Sub(s.baseOWDStart) > screamBaseOWDWindow {
+		if len(s.baseOWD) == screamBaseOWDBuckets {
+			s.baseOWD = s.baseOWD[1:]
+		}
+		s.baseOWD = append(s.baseOWD, owd)
+		s.baseOWDStart = now
+	}
+	last := len(s.baseOWD) - 1
+	s.baseOWD[last] = min(s.baseOWD[last], owd)
+
+	base := s.baseOWD[0]
+	for _, d := range s.baseOWD[1:] {
+		base = min(base, d)
+	}
+	s.qdelay = owd - base
+}
+
+func (s *SCReAM) updateDeliveryRate(now time.Time) {
+	if s.deliveryStart.IsZero() {
+		s.deliveryStart = now
+		return
+	}
+	elapsed := now.Sub(s.deliveryStart)
+	if elapsed < s.srtt {
+		return
+	}
+	s.deliveredPerRTT = float64(s.bytesDelivered) * s.srtt.Seconds() / elapsed.Seconds()
+	s.bytesDelivered = 0
+	s.deliveryStart = now
+}
+
+func (s *SCReAM) updateL4SAlpha(now time.Time) {
+	if s.lastAlphaUpdate.IsZero() {
+		s.lastAlphaUpdate = now
+		return
+	}
+	if now.Sub(s.lastAlphaUpdate) < s.srtt || s.bytesAckedL4S == 0 {
+		return
+	}
+	fraction := float64(s.bytesMarked) / float64(s.bytesAckedL4S)
+	s.l4sAlpha = (1-screamL4SGain)*s.l4sAlpha + screamL4SGain*fraction
+	s.bytesMarked = 0
+	s.bytesAckedL4S = 0
+	s.lastAlphaUpdate = now
+}
+
+func (s *SCReAM) updateCwnd(now time.Time) {
+	bytesNewlyAcked := float64(s.bytesNewlyAcked)
+	s.bytesNewlyAcked = 0
+
+	// react to at most one congestion event per RTT
+	canReact := now.Sub(s.lastReaction) > s.srtt
+
+	s.state = BWERateHold
+	switch {
+	case s.lossPending:
+		if canReact {
+			s.cwnd *= screamBetaLoss
+			s.onCongestion(now)
+		}
+	case s.cePending:
+		if canReact {
+			if s.l4s {
+				s.cwnd *= 1 - s.l4sAlpha/2
+			} else {
+				s.cwnd *= screamBetaECN
+			}
+			s.onCongestion(now)
+		}
+	default:
+		offTarget := float64(screamQDelayTarget-s.qdelay) / float64(screamQDelayTarget)
+		if s.inFastIncrease && s.qdelay < screamQDelayTarget/2 {
+			s.cwnd += bytesNewlyAcked
+			if bytesNewlyAcked > 0 {
+				s.state = BWERateIncrease
+			}
+		} else {
+			if offTarget < 0 {
+				s.lastCongestion = now
+				s.inFastIncrease = false
+			}
+			s.cwnd += screamGain * offTarget * bytesNewlyAcked * screamMSS / s.cwnd
+			switch {
+			case bytesNewlyAcked == 0 || offTarget == 0:
+			case offTarget > 0:
+				s.state = BWERateIncrease
+			default:
+				s.state = BWERateDecrease
+			}
+		}
+	}
+	s.lossPending = false
+	s.cePending = false
+
+	if !s.inFastIncrease && now.Sub(s.lastCongestion) > screamFastIncreaseDelay {
+		s.inFastIncrease = true
+	}
+
+	if s.deliveredPerRTT > 0 {
+		s.cwnd = min(s.cwnd, max(screamMaxCwndFactor*s.deliveredPerRTT, 2*screamMSS))
+	}
+	s.cwnd = max(s.cwnd, 2*screamMSS)
+}
+
+func (s *SCReAM) onCongestion(now time.Time) {
+	s.state = BWERateDecrease
+	s.lastCongestion = now
+	s.lastReaction = now
+	s.inFastIncrease = false
+}
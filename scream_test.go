@@ -0,0 +1,96 @@
+package mrtp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// feedSCReAM acks count packets of size bytes sent every interval with the
+// given one-way delay and returns the time after the last packet.
+func feedSCReAM(s *SCReAM, start time.Time, seqNr *uint64, count, size int, interval, owd time.Duration, ecn ECN) time.Time {
+	now := start
+	for range count {
+		s.OnAck(*seqNr, size, now, now.Add(owd), ecn)
+		*seqNr++
+		now = now.Add(interval)
+		if *seqNr%10 == 0 {
+			s.UpdateRTT(2 * owd)
+			s.UpdateTargetRate(now)
+		}
+	}
+	return now
+}
+
+func TestSCReAMIncreasesWithoutCongestion(t *testing.T) {
+	s := NewSCReAM(1_000_000, 100_000, 10_000_000)
+	var seqNr uint64
+	now := time.Unix(0, 0)
+	s.UpdateRTT(20 * time.Millisecond)
+	assert.Equal(t, 1_000_000, s.UpdateTargetRate(now))
+
+	now = feedSCReAM(s, now, &seqNr, 1000, 1200, time.Millisecond, 10*time.Millisecond, ECNNonECT)
+	assert.Equal(t, BWERateIncrease, s.BWEState().State)
+	assert.Greater(t, s.UpdateTargetRate(now), 1_000_000)
+
+	// no new acks
+	assert.Equal(t, BWERateHold, s.BWEState().State)
+}
+
+func TestSCReAMDecreasesOnQueuingDelay(t *testing.T) {
+	s := NewSCReAM(5_000_000, 100_000, 10_000_000)
+	var seqNr uint64
+	now := time.Unix(0, 0)
+	s.UpdateRTT(20 * time.Millisecond)
+	now = feedSCReAM(s, now, &seqNr, 100, 1200, time.Millisecond, 10*time.Millisecond, ECNNonECT)
+	before := s.UpdateTargetRate(now)
+
+	now = feedSCReAM(s, now, &seqNr, 1000, 1200, time.Millisecond, 200*time.Millisecond, ECNNonECT)
+	assert.Equal(t, BWERateDecrease, s.BWEState().State)
+	assert.Greater(t, s.BWEState().QueuingDelay, 100*time.Millisecond)
+	assert.Less(t, s.UpdateTargetRate(now), before)
+}
+
+func TestSCReAMDecreasesOnLoss(t *testing.T) {
+	s := NewSCReAM(5_000_000, 100_000, 10_000_000)
+	var seqNr uint64
+	now := time.Unix(0, 0)
+	s.UpdateRTT(20 * time.Millisecond)
+	now = feedSCReAM(s, now, &seqNr, 100, 1200, time.Millisecond, 10*time.Millisecond, ECNNonECT)
+	before := s.UpdateTargetRate(now.Add(50 * time.Millisecond))
+
+	s.OnLoss(seqNr, 1200, now)
+	assert.Less(t, s.UpdateTargetRate(now.Add(100*time.Millisecond)), before)
+	assert.Equal(t, BWERateDecrease, s.BWEState().State)
+}
+
+func TestSCReAML4SReactsToMarkingFraction(t *testing.T) {
+	s := NewSCReAM(5_000_000, 100_000, 10_000_000)
+	var seqNr uint64
+	now := time.Unix(0, 0)
+	s.UpdateRTT(20 * time.Millisecond)
+	now = feedSCReAM(s, now, &seqNr, 100, 1200, time.Millisecond, 10*time.Millisecond, ECNECT1)
+	before := s.UpdateTargetRate(now.Add(50 * time.Millisecond))
+
+	now = feedSCReAM(s, now, &seqNr, 200, 1200, time.Millisecond, 10*time.Millisecond, ECNCE)
+	assert.True(t, s.l4s)
+	assert.Greater(t, s.l4sAlpha, 0.0)
+	assert.Less(t, s.UpdateTargetRate(now), before)
+}
+
+func TestSCReAMRespectsBounds(t *testing.T) {
+	s := NewSCReAM(1_000_000, 500_000, 2_000_000)
+	var seqNr uint64
+	now := time.Unix(0, 0)
+	s.UpdateRTT(20 * time.Millisecond)
+	now = feedSCReAM(s, now, &seqNr, 5000, 1200, 100*time.Microsecond, 10*time.Millisecond, ECNNonECT)
+	assert.LessOrEqual(t, s.UpdateTargetRate(now), 2_000_000)
+
+	for range 20 {
+		s.OnLoss(seqNr, 1200, now)
+		now = now.Add(100 * time.Millisecond)
+		s.UpdateTargetRate(now)
+	}
+	assert.GreaterOrEqual(t, s.UpdateTargetRate(now), 500_000)
+}
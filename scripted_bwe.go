@@ -0,0 +1,180 @@
+package mrtp
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	_ BWE              = (*ScriptedBWE)(nil)
+	_ BWEStateReporter = (*ScriptedBWE)(nil)
+)
+
+// RateStep sets the target rate of a [ScriptedBWE] to Rate bits per second
+// from Offset after the first target rate update on.
+type RateStep struct {
+	Offset time.Duration
+	Rate   int
+}
+
+// ScriptedBWE is a [BWE] that ignores all feedback and returns target rates
+// from a fixed schedule. It is useful to test media pipelines under known
+// rate changes. Feedback is only used for the reported [BWEState].
+type ScriptedBWE struct {
+	steps []RateStep
+	start time.Time
+	state BWERateState
+	stats bweFeedbackStats
+}
+
+// NewScriptedBWE creates a BWE that follows steps. The steps must be sorted by
+// offset and the first step must start at offset zero.
+func NewScriptedBWE(steps []RateStep) (*ScriptedBWE, error) {
+	if len(steps) == 0 {
+		return nil, errors.New("rate schedule is empty")
+	}
+	if steps[0].Offset != 0 {
+		return nil, fmt.Errorf("first rate step must start at offset 0, got %v", steps[0].Offset)
+	}
+	for i, s := range steps {
+		if s.Rate < 0 {
+			return nil, fmt.Errorf("negative rate in step %v: %v", i, s.Rate)
+		}
+		if i > 0 && s.Offset <= steps[i-1].Offset {
+			return nil, fmt.Errorf("rate steps not sorted by offset at step %v", i)
+		}
+	}
+	return &ScriptedBWE{
+		steps: slices.Clone(steps),
+	}, nil
+}
+
+// NewConstantBWE creates a BWE that always returns rate.
+func NewConstantBWE(rate int) (*ScriptedBWE, error) {
+	return NewScriptedBWE([]RateStep{{Offset: 0, Rate: rate}})
+}
+
+// ParseRateSteps parses a comma separated list of offset=rate pairs, e.g.
+// "0s=1000000,10s=2000000". Offsets use the [time.ParseDuration] format and
+// rates are in bits per second.
+func ParseRateSteps(s string) ([]RateStep, error) {
+	steps := []RateStep{}
+	for pair := range strings.SplitSeq(s, ",") {
+		offset, rate, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid rate step %q, expected offset=rate", pair)
+		}
+		step, err := parseRateStep(offset, rate, time.ParseDuration)
+		if err != nil {
+			return nil, err
+		}
+		steps = append(steps, step)
+	}
+	return steps, nil
+}
+
+// ReadRateSchedule reads a CSV file of time,rate records. Time is the offset
+// in seconds and rate is in bits per second. The file may start with the
+// header line "time,rate".
+func ReadRateSchedule(r io.Reader) ([]RateStep, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = 2
+	reader.TrimLeadingSpace = true
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	start := 0
+	if len(records) > 0 && isRateScheduleHeader(records[0]) {
+		start = 1
+	}
+	steps := []RateStep{}
+	for i, record := range records[start:] {
+		step, err := parseRateStep(record[0], record[1], parseSeconds)
+		if err != nil {
+			return nil, fmt.Errorf("line %v: %w", start+i+1, err)
+		}
+		steps = append(steps, step)
+	}
+	return steps, nil
+}
+
+func isRateScheduleHeader(record []string) bool {
+	return strings.EqualFold(strings.TrimSpace(record[0]), "time") &&
+		strings.EqualFold(strings.TrimSpace(record[1]), "rate")
+}
+
+func parseSeconds(s string) (time.Duration, error) {
+	seconds, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+func parseRateStep(offset, rate string, parseOffset func(string) (time.Duration, error)) (RateStep, error) {
+	o, err := parseOffset(strings.TrimSpace(offset))
+	if err != nil {
+		return RateStep{}, fmt.Errorf("invalid offset %q: %w", offset, err)
+	}
+	r, err := strconv.Atoi(strings.TrimSpace(rate))
+	if err != nil {
+		return RateStep{}, fmt.Errorf("invalid rate %q: %w", rate, err)
+	}
+	return RateStep{Offset: o, Rate: r}, nil
+}
+
+// OnAck implements [BWE].
+func (b *ScriptedBWE) OnAck(sequenceNumber uint64, size int, departure time.Time, arrival time.Time, ecn ECN) {
+	b.stats.onAck(ecn)
+}
+
+// OnLoss implements [BWE].
+func (b *ScriptedBWE) OnLoss(sequenceNumber uint64, size int, departure time.Time) {
+	b.stats.onLoss()
+}
+
+// UpdateRTT implements [BWE].
+func (b *ScriptedBWE) UpdateRTT(rtt time.Duration) {
+	b.stats.onRTT(rtt)
+}
+
+// UpdateECNCounts implements [BWE].
+func (b *ScriptedBWE) UpdateECNCounts(ect0 uint64, ect1 uint64, ce uint64) {
+}
+
+// UpdateTargetRate implements [BWE]. The schedule starts with the first call.
+func (b *ScriptedBWE) UpdateTargetRate(now time.Time) int {
+	first := b.start.IsZero()
+	if first {
+		b.start = now
+	}
+	elapsed := max(now.Sub(b.start), 0)
+	// index of the first step after elapsed, steps[0] always starts at 0
+	i, _ := slices.BinarySearchFunc(b.steps, elapsed, func(s RateStep, d time.Duration) int {
+		if s.Offset <= d {
+			return -1
+		}
+		return 1
+	})
+	rate := b.steps[i-1].Rate
+	b.state = BWERateHold
+	if !first {
+		b.state = rateDirection(b.stats.rate, rate)
+	}
+	b.stats.onTargetRate(rate)
+	return rate
+}
+
+// BWEState implements [BWEStateReporter].
+func (b *ScriptedBWE) BWEState() BWEState {
+	state := b.stats.bweState()
+	state.State = b.state
+	return state
+}
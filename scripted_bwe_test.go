@@ -0,0 +1,78 @@
+package mrtp
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScriptedBWE(t *testing.T) {
+	b, err := NewScriptedBWE([]RateStep{
+		{Offset: 0, Rate: 1_000_000},
+		{Offset: 10 * time.Second, Rate: 2_000_000},
+		{Offset: 20 * time.Second, Rate: 500_000},
+	})
+	require.NoError(t, err)
+
+	start := time.Unix(100, 0)
+	// feedback is ignored
+	b.OnLoss(1, 1200, start)
+	b.OnAck(2, 1200, start, start.Add(time.Second), ECNCE)
+
+	assert.Equal(t, 1_000_000, b.UpdateTargetRate(start))
+	assert.Equal(t, 1_000_000, b.UpdateTargetRate(start.Add(10*time.Second-time.Millisecond)))
+	assert.Equal(t, 2_000_000, b.UpdateTargetRate(start.Add(10*time.Second)))
+	assert.Equal(t, 2_000_000, b.UpdateTargetRate(start.Add(15*time.Second)))
+	assert.Equal(t, 500_000, b.UpdateTargetRate(start.Add(time.Hour)))
+	assert.Equal(t, BWERateDecrease, b.BWEState().State)
+}
+
+func TestScriptedBWEInvalid(t *testing.T) {
+	for _, steps := range [][]RateStep{
+		nil,
+		{{Offset: time.Second, Rate: 1}},
+		{{Offset: 0, Rate: -1}},
+		{{Offset: 0, Rate: 1}, {Offset: 0, Rate: 2}},
+	} {
+		_, err := NewScriptedBWE(steps)
+		assert.Error(t, err)
+	}
+}
+
+func TestParseRateSteps(t *testing.T) {
+	steps, err := ParseRateSteps("0s=1000000, 1.5s=2000000,1m=300000")
+	require.NoError(t, err)
+	assert.Equal(t, []RateStep{
+		{Offset: 0, Rate: 1_000_000},
+		{Offset: 1500 * time.Millisecond, Rate: 2_000_000},
+		{Offset: time.Minute, Rate: 300_000},
+	}, steps)
+
+	_, err = ParseRateSteps("0s:1000000")
+	assert.Error(t, err)
+	_, err = ParseRateSteps("0s=fast")
+	assert.Error(t, err)
+}
+
+func TestReadRateSchedule(t *testing.T) {
+	steps, err := ReadRateSchedule(bytes.NewBufferString("time,rate\n0,1000000\n2.5, 2000000\n"))
+	require.NoError(t, err)
+	assert.Equal(t, []RateStep{
+		{Offset: 0, Rate: 1_000_000},
+		{Offset: 2500 * time.Millisecond, Rate: 2_000_000},
+	}, steps)
+
+	steps, err = ReadRateSchedule(bytes.NewBufferString("0,1000000\n"))
+	require.NoError(t, err)
+	assert.Len(t, steps, 1)
+
+	_, err = ReadRateSchedule(bytes.NewBufferString("0,1000000\nfoo,1\n"))
+	assert.Error(t, err)
+
+	// a malformed first line is not a header
+	_, err = ReadRateSchedule(bytes.NewBufferString("0s,1000000\n1,2000000\n"))
+	assert.Error(t, err)
+}
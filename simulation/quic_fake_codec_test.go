@@ -15,7 +15,6 @@ import (
 
 	"github.com/mengelbart/mrtp"
 	"github.com/mengelbart/mrtp/gopipe"
-	"github.com/mengelbart/mrtp/gopipe/codec"
 	"github.com/mengelbart/mrtp/internal/quictransport"
 	"github.com/mengelbart/mrtp/roq"
 	"github.com/mengelbart/netsim"
@@ -36,6 +35,16 @@ func TestFakeCodecNada(t *testing.T) {
 	testFakeCodec(t, bwe, "FakeCodecNada")
 }
 
+func TestFakeCodecSCReAM(t *testing.T) {
+	bwe := mrtp.NewSCReAM(1_000_000, 400_000, 8_000_000)
+	testFakeCodec(t, bwe, "FakeCodecSCReAM")
+}
+
+func TestFakeCodecPrague(t *testing.T) {
+	bwe := mrtp.NewPrague(1_000_000, 400_000, 8_000_000)
+	testFakeCodec(t, bwe, "FakeCodecPrague")
+}
+
 func testFakeCodec(t *testing.T, bwe mrtp.BWE, testName string) {
 	synctest.Test(t, func(t *testing.T) {
 		err := initTestResultDir(t)
@@ -167,10 +176,10 @@ func runFakeSender(ctx context.Context, quicConn *quictransport.Transport) error
 		return err
 	})
 
-	fakeSource := gopipe.NewFakeSource(100*time.Second, 250_000, 8_000_000, 750_000)
-	defer fakeSource.Close()
-
-	i := fakeSource.GetInfo()
+	fakeSource, err := gopipe.NewFakeSource(100*time.Second, 250_000, 8_000_000, 750_000)
+	if err != nil {
+		return err
+	}
 
 	// set rate callbacks
 	quicConn.SetSourceTargetRate = func(ratebps uint) error {
@@ -186,17 +195,15 @@ func runFakeSender(ctx context.Context, quicConn *quictransport.Transport) error
 		PT:        96,
 		SSRC:      0,
 		ClockRate: 90_000,
-		Codec:     codec.FAKE,
+		Codec:     mrtp.FAKE,
 	}
-	pacer := gopipe.NewFrameSpacer(ctx)
-	defer pacer.Close()
-
-	rtpPipeline, err := gopipe.Chain(i, appSink, pacer, packetizer)
+	rtpPipeline, err := gopipe.NewPipeline(fakeSource, packetizer, gopipe.NewFrameSpacer(), appSink)
 	if err != nil {
 		return err
 	}
+	defer rtpPipeline.Close()
 
-	return fakeSource.StartLive(ctx, rtpPipeline)
+	return rtpPipeline.Run(ctx)
 }
 
 func runFakeReceiver(ctx context.Context, quicConn *quictransport.Transport, wg *sync.WaitGroup) error {
@@ -235,16 +242,19 @@ func runFakeReceiver(ctx context.Context, quicConn *quictransport.Transport, wg
 	}
 
 	maxTimeout := 150 * time.Millisecond
-	depacketizer, err := gopipe.NewRTPDepacketizer(maxTimeout, codec.FAKE)
+	depacketizer, err := gopipe.NewRTPDepacketizer(maxTimeout, mrtp.FAKE)
 	if err != nil {
 		return err
 	}
-	defer depacketizer.Close()
 
-	rtpPipeline, err := gopipe.Chain(gopipe.Info{}, fakeSink, depacketizer)
+	rtpPipeline, err := gopipe.NewPipeline(depacketizer, fakeSink)
 	if err != nil {
 		return err
 	}
+	defer rtpPipeline.Close()
+	if err = rtpPipeline.Start(ctx); err != nil {
+		return err
+	}
 
 	wg.Go(func() {
 		// end receiver orderly on context cancellation
@@ -252,7 +262,6 @@ func runFakeReceiver(ctx context.Context, quicConn *quictransport.Transport, wg
 		roqTransport.CloseLogFile()
 		roqTransport.Close()
 		rtpSrc.Close()
-		depacketizer.Close()
 	})
 
 	buf := make([]byte, 150000)
@@ -261,6 +270,11 @@ func runFakeReceiver(ctx context.Context, quicConn *quictransport.Transport, wg
 		case <-ctx.Done():
 			println("receiver: context cancelled, exiting")
 			return nil
+		case m := <-rtpPipeline.Bus().Messages():
+			if m.Type == gopipe.MessageError {
+				return fmt.Errorf("%T: %w", m.Element, m.Err)
+			}
+			slog.Warn("receiver pipeline", "type", m.Type, "error", m.Err)
 		default:
 		}
 
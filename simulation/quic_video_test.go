@@ -16,7 +16,6 @@ import (
 
 	"github.com/mengelbart/mrtp"
 	"github.com/mengelbart/mrtp/gopipe"
-	"github.com/mengelbart/mrtp/gopipe/codec"
 	"github.com/mengelbart/mrtp/internal/quictransport"
 	"github.com/mengelbart/mrtp/roq"
 	"github.com/mengelbart/netsim"
@@ -29,15 +28,27 @@ import (
 func TestQUICh264GCC(t *testing.T) {
 	bwe, err := mrtp.NewGCC(1_000_000, 400_000, 8_000_000)
 	require.NoError(t, err)
-	testQUICh264(t, bwe, "QUICh264GCC")
+	testQUICVideo(t, bwe, mrtp.H264, "QUICh264GCC")
 }
 
 func TestQUICh264Nada(t *testing.T) {
 	bwe := mrtp.NewNada(1_000_000, 400_000, 8_000_000, 20*time.Millisecond)
-	testQUICh264(t, bwe, "QUICh264Nada")
+	testQUICVideo(t, bwe, mrtp.H264, "QUICh264Nada")
 }
 
-func testQUICh264(t *testing.T, bwe mrtp.BWE, testName string) {
+func TestQUICvp9GCC(t *testing.T) {
+	bwe, err := mrtp.NewGCC(1_000_000, 400_000, 8_000_000)
+	require.NoError(t, err)
+	testQUICVideo(t, bwe, mrtp.VP9, "QUICvp9GCC")
+}
+
+func TestQUICav1GCC(t *testing.T) {
+	bwe, err := mrtp.NewGCC(1_000_000, 400_000, 8_000_000)
+	require.NoError(t, err)
+	testQUICVideo(t, bwe, mrtp.AV1, "QUICav1GCC")
+}
+
+func testQUICVideo(t *testing.T, bwe mrtp.BWE, c mrtp.Codec, testName string) {
 	// video file must exist
 	if _, err := os.Stat("Johnny_1280x720_60.y4m"); os.IsNotExist(err) {
 		println("Video file not found: Johnny_1280x720_60.y4m - run ./get-video.sh to download it.\n")
@@ -100,12 +111,12 @@ func testQUICh264(t *testing.T, bwe mrtp.BWE, testName string) {
 
 		// all connected, start sender and receiver
 		wg.Go(func() {
-			err = runH264Receiver(t, ctx, serverTransport, &wg)
+			err = runVideoReceiver(t, ctx, serverTransport, c, &wg)
 			assert.NoError(t, err)
 			println("receiver ended")
 		})
 
-		err = runH264Sender(ctx, clientTransport)
+		err = runVideoSender(ctx, clientTransport, c)
 		assert.NoError(t, err)
 
 		time.Sleep(20 * time.Second)
@@ -132,7 +143,7 @@ func testQUICh264(t *testing.T, bwe mrtp.BWE, testName string) {
 	})
 }
 
-func runH264Sender(ctx context.Context, quicConn *quictransport.Transport) error {
+func runVideoSender(ctx context.Context, quicConn *quictransport.Transport, sendCodec mrtp.Codec) error {
 	// open roq connection
 	roqTransport, err := roq.New(ctx, quicConn.GetQuicConnection())
 	if err != nil {
@@ -185,8 +196,6 @@ func runH264Sender(ctx context.Context, quicConn *quictransport.Transport) error
 		return err
 	}
 
-	sendCodec := codec.H264
-	i := fileSrc.GetInfo()
 	encoder := gopipe.NewEncoder(sendCodec)
 
 	// set rate callbacks
@@ -205,18 +214,16 @@ func runH264Sender(ctx context.Context, quicConn *quictransport.Transport) error
 		ClockRate: 90_000,
 		Codec:     sendCodec,
 	}
-	pacer := gopipe.NewFrameSpacer(ctx)
-	defer pacer.Close()
-
-	rtpPipeline, err := gopipe.Chain(i, appSink, pacer, packetizer, encoder)
+	rtpPipeline, err := gopipe.NewPipeline(fileSrc, encoder, packetizer, gopipe.NewFrameSpacer(), appSink)
 	if err != nil {
 		return err
 	}
+	defer rtpPipeline.Close()
 
-	return fileSrc.StartLive(ctx, rtpPipeline)
+	return rtpPipeline.Run(ctx)
 }
 
-func runH264Receiver(t *testing.T, ctx context.Context, quicConn *quictransport.Transport, wg *sync.WaitGroup) error {
+func runVideoReceiver(t *testing.T, ctx context.Context, quicConn *quictransport.Transport, recvCodec mrtp.Codec, wg *sync.WaitGroup) error {
 	roqTransport, err := roq.New(ctx, quicConn.GetQuicConnection())
 	if err != nil {
 		return err
@@ -246,7 +253,6 @@ func runH264Receiver(t *testing.T, ctx context.Context, quicConn *quictransport.
 	}
 	defer rtpSrc.Close()
 
-	recvCodec := codec.H264
 	decoder, err := gopipe.NewDecoder(recvCodec)
 	if err != nil {
 		return err
@@ -256,19 +262,21 @@ func runH264Receiver(t *testing.T, ctx context.Context, quicConn *quictransport.
 	if err != nil {
 		return err
 	}
-	defer fileSink.Close()
 
 	maxTimeout := 150 * time.Millisecond
 	depacketizer, err := gopipe.NewRTPDepacketizer(maxTimeout, recvCodec)
 	if err != nil {
 		return err
 	}
-	defer depacketizer.Close()
 
-	rtpPipeline, err := gopipe.Chain(gopipe.Info{}, fileSink, decoder, depacketizer)
+	rtpPipeline, err := gopipe.NewPipeline(depacketizer, decoder, fileSink)
 	if err != nil {
 		return err
 	}
+	defer rtpPipeline.Close()
+	if err = rtpPipeline.Start(ctx); err != nil {
+		return err
+	}
 
 	wg.Go(func() {
 		// end receiver orderly on context cancellation
@@ -276,7 +284,6 @@ func runH264Receiver(t *testing.T, ctx context.Context, quicConn *quictransport.
 		roqTransport.CloseLogFile()
 		roqTransport.Close()
 		rtpSrc.Close()
-		depacketizer.Close()
 	})
 
 	buf := make([]byte, 150000)
@@ -285,6 +292,11 @@ func runH264Receiver(t *testing.T, ctx context.Context, quicConn *quictransport.
 		case <-ctx.Done():
 			println("receiver: context cancelled, exiting")
 			return nil
+		case m := <-rtpPipeline.Bus().Messages():
+			if m.Type == gopipe.MessageError {
+				return fmt.Errorf("%T: %w", m.Element, m.Err)
+			}
+			slog.Warn("receiver pipeline", "type", m.Type, "error", m.Err)
 		default:
 		}
 
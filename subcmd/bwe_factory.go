@@ -1,9 +1,19 @@
 package subcmd
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/mengelbart/mrtp"
+	pion_logging "github.com/pion/logging"
+	"gopkg.in/yaml.v3"
 )
 
 const (
@@ -11,10 +21,125 @@ const (
 	minTargetRate  = 400_000
 )
 
+// BWEConfig configures a BWE created by a [BWEFactory]. It can be loaded from
+// a JSON or YAML file using [LoadBWEConfig]. Rates are in bits per second.
 type BWEConfig struct {
-	InitTargetRate uint
-	MinTargetRate  uint
-	MaxTargetRate  uint
+	InitTargetRate uint `json:"init-target-rate" yaml:"init-target-rate"`
+	MinTargetRate  uint `json:"min-target-rate" yaml:"min-target-rate"`
+	MaxTargetRate  uint `json:"max-target-rate" yaml:"max-target-rate"`
+
+	// FeedbackInterval is the interval in milliseconds at which the sender
+	// passes feedback to the BWE and updates the target rate. NADA uses it
+	// as its expected feedback interval. Receivers sending explicit feedback
+	// (-quic-feedback, WebRTC) should use the same -feedback-interval.
+	// Default: 20.
+	FeedbackInterval uint `json:"feedback-interval" yaml:"feedback-interval"`
+
+	Nada NadaConfig `json:"nada" yaml:"nada"`
+	// GCC only configures logging, GCC has no parameters to tune.
+	GCC GCCConfig `json:"gcc" yaml:"gcc"`
+
+	// Filter smooths and throttles the target rates passed to the encoders
+	// and the rate allocator. Pacing uses the unfiltered target rate. Target
+	// rates are not filtered if Filter is nil.
+	Filter *RateFilterConfig `json:"filter" yaml:"filter"`
+
+	// Arg is the part of the BWE name after the first colon, e.g.
+	// 'rates.csv' for 'script:rates.csv'.
+	Arg string `json:"-" yaml:"-"`
+}
+
+// NadaConfig holds NADA specific parameters. Zero values select the defaults.
+type NadaConfig struct {
+	// RefCongLevel is the reference congestion level in milliseconds.
+	// Default: 15.
+	RefCongLevel uint `json:"ref-cong-level" yaml:"ref-cong-level"`
+	// QDelayWrapping enables the queuing delay wrapping after losses.
+	QDelayWrapping bool `json:"qdelay-wrapping" yaml:"qdelay-wrapping"`
+}
+
+func (c NadaConfig) validate() error {
+	if c.RefCongLevel > 1000 {
+		return fmt.Errorf("nada: ref-cong-level must be at most 1000ms, got %v", c.RefCongLevel)
+	}
+	return nil
+}
+
+// GCCConfig holds GCC specific parameters. The pion/bwe controller takes no
+// tuning options besides the rates of BWEConfig, so -bwe-config can only set
+// its logging. Its delay thresholds and rate control gains are fixed.
+type GCCConfig struct {
+	// Log selects the logger of the GCC controller, 'json' (default) or
+	// 'text'.
+	Log string `json:"log" yaml:"log"`
+}
+
+func (c GCCConfig) validate() error {
+	switch c.Log {
+	case "", "json", "text":
+		return nil
+	}
+	return fmt.Errorf("gcc: unknown log format: %q", c.Log)
+}
+
+// RateFilterConfig configures a [mrtp.RateFilter]. Zero values select the
+// defaults, which pass all target rates unchanged.
+type RateFilterConfig struct {
+	// SmoothingUp and SmoothingDown are the EWMA gains for increasing and
+	// decreasing target rates in (0, 1]. Default: 1.
+	SmoothingUp   float64 `json:"smoothing-up" yaml:"smoothing-up"`
+	SmoothingDown float64 `json:"smoothing-down" yaml:"smoothing-down"`
+	// MinDwell is the minimum time between two target rate changes in
+	// milliseconds.
+	MinDwell uint `json:"min-dwell" yaml:"min-dwell"`
+	// MinRelativeDelta suppresses target rate changes smaller than this
+	// fraction of the current target rate, e.g. 0.05 for 5%.
+	MinRelativeDelta float64 `json:"min-relative-delta" yaml:"min-relative-delta"`
+	// Hysteresis is added to MinRelativeDelta when the target rate changes
+	// direction.
+	Hysteresis float64 `json:"hysteresis" yaml:"hysteresis"`
+}
+
+func (c RateFilterConfig) makeFilter() (*mrtp.RateFilter, error) {
+	up, down := c.SmoothingUp, c.SmoothingDown
+	if up == 0 {
+		up = 1
+	}
+	if down == 0 {
+		down = 1
+	}
+	filter, err := mrtp.NewRateFilter(
+		mrtp.RateFilterSmoothing(up, down),
+		mrtp.RateFilterMinDwell(time.Duration(c.MinDwell)*time.Millisecond),
+		mrtp.RateFilterMinRelativeDelta(c.MinRelativeDelta),
+		mrtp.RateFilterHysteresis(c.Hysteresis),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("filter: %w", err)
+	}
+	return filter, nil
+}
+
+// defaultFeedbackInterval is the feedback interval of the transports if the
+// BWE config does not set one.
+const defaultFeedbackInterval = 20 * time.Millisecond
+
+// feedbackInterval returns the FeedbackInterval or its default.
+func (c BWEConfig) feedbackInterval() time.Duration {
+	if c.FeedbackInterval == 0 {
+		return defaultFeedbackInterval
+	}
+	return time.Duration(c.FeedbackInterval) * time.Millisecond
+}
+
+func (c BWEConfig) validateRates() error {
+	if c.MinTargetRate > c.MaxTargetRate {
+		return fmt.Errorf("min-target-rate %v is larger than max-target-rate %v", c.MinTargetRate, c.MaxTargetRate)
+	}
+	if c.InitTargetRate < c.MinTargetRate || c.InitTargetRate > c.MaxTargetRate {
+		return fmt.Errorf("init-target-rate %v is not between min-target-rate %v and max-target-rate %v", c.InitTargetRate, c.MinTargetRate, c.MaxTargetRate)
+	}
+	return nil
 }
 
 type BWEFactory interface {
@@ -29,9 +154,174 @@ func (f BWEFactoryFunc) MakeBWE(config BWEConfig) (mrtp.BWE, error) {
 
 var BWEFactories = map[string]BWEFactory{
 	"nada": BWEFactoryFunc(func(config BWEConfig) (mrtp.BWE, error) {
-		return mrtp.NewNada(config.InitTargetRate, config.MinTargetRate, config.MaxTargetRate, 20*time.Millisecond), nil
+		if err := config.validateRates(); err != nil {
+			return nil, err
+		}
+		if err := config.Nada.validate(); err != nil {
+			return nil, err
+		}
+		opts := []mrtp.NadaOption{mrtp.NadaQDelayWrapping(config.Nada.QDelayWrapping)}
+		if config.Nada.RefCongLevel > 0 {
+			opts = append(opts, mrtp.NadaRefCongLevel(time.Duration(config.Nada.RefCongLevel)*time.Millisecond))
+		}
+		return mrtp.NewNada(config.InitTargetRate, config.MinTargetRate, config.MaxTargetRate, config.feedbackInterval(), opts...), nil
 	}),
 	"gcc": BWEFactoryFunc(func(config BWEConfig) (mrtp.BWE, error) {
-		return mrtp.NewGCC(config.InitTargetRate, config.MinTargetRate, config.MaxTargetRate)
+		if err := config.validateRates(); err != nil {
+			return nil, err
+		}
+		if err := config.GCC.validate(); err != nil {
+			return nil, err
+		}
+		opts := []mrtp.GCCOption{}
+		if config.GCC.Log == "text" {
+			opts = append(opts, mrtp.GCCLoggerFactory(pion_logging.NewDefaultLoggerFactory()))
+		}
+		return mrtp.NewGCC(config.InitTargetRate, config.MinTargetRate, config.MaxTargetRate, opts...)
+	}),
+	"scream": BWEFactoryFunc(func(config BWEConfig) (mrtp.BWE, error) {
+		if err := config.validateRates(); err != nil {
+			return nil, err
+		}
+		return mrtp.NewSCReAM(config.InitTargetRate, config.MinTargetRate, config.MaxTargetRate), nil
+	}),
+	"l4s": BWEFactoryFunc(func(config BWEConfig) (mrtp.BWE, error) {
+		if err := config.validateRates(); err != nil {
+			return nil, err
+		}
+		return mrtp.NewPrague(config.InitTargetRate, config.MinTargetRate, config.MaxTargetRate), nil
+	}),
+	"constant": BWEFactoryFunc(func(config BWEConfig) (mrtp.BWE, error) {
+		// the constant rate replaces the initial rate and must be within
+		// the rate limits like it
+		if len(config.Arg) > 0 {
+			rate, err := strconv.ParseUint(config.Arg, 10, 0)
+			if err != nil {
+				return nil, fmt.Errorf("invalid constant rate: %w", err)
+			}
+			config.InitTargetRate = uint(rate)
+		}
+		if config.InitTargetRate == 0 {
+			return nil, errors.New("constant rate must be positive")
+		}
+		if err := config.validateRates(); err != nil {
+			return nil, err
+		}
+		return mrtp.NewConstantBWE(int(config.InitTargetRate))
+	}),
+	"steps": BWEFactoryFunc(func(config BWEConfig) (mrtp.BWE, error) {
+		steps, err := mrtp.ParseRateSteps(config.Arg)
+		if err != nil {
+			return nil, err
+		}
+		return mrtp.NewScriptedBWE(steps)
 	}),
+	"script": BWEFactoryFunc(func(config BWEConfig) (mrtp.BWE, error) {
+		f, err := os.Open(config.Arg)
+		if err != nil {
+			return nil, err
+		}
+		defer func() {
+			_ = f.Close()
+		}()
+		steps, err := mrtp.ReadRateSchedule(f)
+		if err != nil {
+			return nil, err
+		}
+		return mrtp.NewScriptedBWE(steps)
+	}),
+}
+
+// makeBWE creates a BWE from a name as passed to the -bwe flags. Everything
+// after the first colon of name is passed to the factory as BWEConfig.Arg. If
+// configPath is not empty, the config file is loaded on top of config. The
+// returned config is the one the BWE was created with.
+func makeBWE(name, configPath string, config BWEConfig) (mrtp.BWE, BWEConfig, error) {
+	if len(configPath) > 0 {
+		if err := LoadBWEConfig(configPath, &config); err != nil {
+			return nil, config, err
+		}
+	}
+	if config.FeedbackInterval > 1000 {
+		return nil, config, fmt.Errorf("feedback-interval must be at most 1000ms, got %v", config.FeedbackInterval)
+	}
+	name, config.Arg, _ = strings.Cut(name, ":")
+	bweFactory, ok := BWEFactories[name]
+	if !ok {
+		return nil, config, fmt.Errorf("unknown BWE: %v", name)
+	}
+	if config.Filter != nil {
+		if _, err := config.Filter.makeFilter(); err != nil {
+			return nil, config, err
+		}
+	}
+	bwe, err := bweFactory.MakeBWE(config)
+	if err != nil {
+		return nil, config, err
+	}
+	return bwe, config, nil
+}
+
+// filterTargetRate passes the target rates given to setRate through the
+// filter of the config, if any.
+func (c BWEConfig) filterTargetRate(setRate func(ratebps uint) error) (func(ratebps uint) error, error) {
+	if c.Filter == nil {
+		return setRate, nil
+	}
+	filter, err := c.Filter.makeFilter()
+	if err != nil {
+		return nil, err
+	}
+	return mrtp.FilterTargetRate(filter, setRate), nil
+}
+
+// recordBWE wraps bwe in a [mrtp.BWERecorder] that writes the trace to a new
+// file at path. The returned closer must be closed to flush the trace.
+func recordBWE(bwe mrtp.BWE, path string) (mrtp.BWE, io.Closer, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	recorder := mrtp.NewBWERecorder(bwe, f)
+	return recorder, &bweTraceFile{recorder: recorder, file: f}, nil
+}
+
+// bweTraceFile flushes the trace of a BWERecorder before closing its file.
+type bweTraceFile struct {
+	recorder *mrtp.BWERecorder
+	file     *os.File
+}
+
+func (t *bweTraceFile) Close() error {
+	return errors.Join(t.recorder.Flush(), t.file.Close())
+}
+
+// LoadBWEConfig reads a JSON or YAML file, depending on the file extension,
+// into config. Fields that are not set in the file keep their current value
+// and unknown fields are rejected.
+func LoadBWEConfig(path string, config *BWEConfig) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".json":
+		decoder := json.NewDecoder(f)
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(config)
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(f)
+		decoder.KnownFields(true)
+		err = decoder.Decode(config)
+	default:
+		return fmt.Errorf("unknown BWE config file extension: %q, expected .json, .yaml or .yml", ext)
+	}
+	if err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("failed to parse BWE config %v: %w", path, err)
+	}
+	return nil
 }
@@ -10,6 +10,7 @@ import (
 	"log/slog"
 	"math"
 	"os"
+	"time"
 
 	"github.com/mengelbart/mrtp"
 	"github.com/mengelbart/mrtp/cmdmain"
@@ -25,8 +26,15 @@ func init() {
 	cmdmain.RegisterSubCmd("receive", func() cmdmain.SubCmd { return new(Receive) })
 }
 
+// codecPayloadType selects the payload type of the codec in the mrtp codec
+// registry when passed to [StreamSinkFactory.MakeStreamSink] or
+// [gstreamer.StreamSinkPayloadType].
+const codecPayloadType = -1
+
 type StreamSinkFactory interface {
 	ConfigureFlags(*flag.FlagSet)
+	// MakeStreamSink creates a sink for RTP packets of payloadType, or of the
+	// payload type of its codec if payloadType is codecPayloadType.
 	MakeStreamSink(name string, payloadType int) (gstreamer.RTPSinkBin, error)
 }
 
@@ -39,7 +47,7 @@ type gstreamerVideoStreamSinkFactory struct {
 func (f *gstreamerVideoStreamSinkFactory) ConfigureFlags(fs *flag.FlagSet) {
 	fs.UintVar(&f.sinkType, "sink-type", uint(0), "Sink type (0: autovideosink, 1: filesink, requires <location> to be set, 2: fakesink)")
 	fs.StringVar(&f.sinkLocation, "sink-location", "", "Location for filesink (if <sink-type> is 1 (filesink))")
-	fs.StringVar(&f.codec, "sink-codec", mrtp.H264.String(), "Codec to use for decoder (H264, VP8)")
+	fs.StringVar(&f.codec, "sink-codec", mrtp.H264.String(), fmt.Sprintf("Codec to use for decoder (%v)", mrtp.CodecNames()))
 }
 
 func (f *gstreamerVideoStreamSinkFactory) MakeStreamSink(name string, pt int) (gstreamer.RTPSinkBin, error) {
@@ -82,6 +90,9 @@ type Receive struct {
 	rtcpSendFlowID    uint
 	rtcpRecvFlowID    uint
 	udpRecvBufferSize int
+	quicFeedback      bool
+	feedbackFlowID    uint
+	feedbackInterval  uint
 }
 
 func (r *Receive) Help() string {
@@ -105,6 +116,9 @@ func (r *Receive) Exec(cmd string, args []string) error {
 	fs.UintVar(&r.rtcpRecvPort, "rtcp-recv-porto", 5001, "UDP port for incoming RTCP stream")
 	fs.UintVar(&r.rtcpSendFlowID, "rtcp-send-flow-id", 1, "RTCP Sender Flow ID when using RTP over QUIC")
 	fs.UintVar(&r.rtcpRecvFlowID, "rtcp-recv-flow-id", 2, "RTCP Receiver Flow ID when using RTP over QUIC")
+	fs.BoolVar(&r.quicFeedback, "quic-feedback", false, "Send arrival times and ECN marks of received QUIC packets to the sender (RoQ only)")
+	fs.UintVar(&r.feedbackFlowID, "feedback-flow-id", 4, "Flow ID of the feedback when using -quic-feedback")
+	fs.UintVar(&r.feedbackInterval, "feedback-interval", 20, "Interval in milliseconds at which feedback is sent when using -quic-feedback")
 
 	fs.IntVar(&r.udpRecvBufferSize, "recv-buffer-size", r.udpRecvBufferSize, "UDP receive 'buffer-size' of Gstreamer udpsrc element")
 
@@ -165,7 +179,7 @@ Flags:
 		return err
 	}
 
-	r.sink, err = DefaultStreamSinkFactory.MakeStreamSink("rtp-stream-sink", 96)
+	r.sink, err = DefaultStreamSinkFactory.MakeStreamSink("rtp-stream-sink", codecPayloadType)
 	if err != nil {
 		return err
 	}
@@ -188,6 +202,9 @@ func (r *Receive) setupRoQ(ctx context.Context) error {
 		quictransport.SetRemoteAddress(r.remoteAddr, r.udpPort),
 		quictransport.SetQLOGLabel("reicever"),
 	}
+	if r.quicFeedback {
+		quicOptions = append(quicOptions, quictransport.EnableFeedback(uint64(r.feedbackFlowID), time.Duration(r.feedbackInterval)*time.Millisecond))
+	}
 
 	quicConn, err := quictransport.New(ctx, []string{roqALPN}, quicOptions...)
 	if err != nil {
@@ -4,10 +4,14 @@ package subcmd
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log/slog"
 	"os"
+	"slices"
+	"sync"
 	"time"
 
 	"github.com/mengelbart/mrtp"
@@ -30,6 +34,8 @@ type ReceiveGo struct {
 	remoteAddr        string
 	roqServer         bool
 	codec             string
+	pipeline          string
+	metrics           string
 	traceRTP          bool
 	datachannel       bool
 	dataChannelFlowID uint
@@ -37,6 +43,14 @@ type ReceiveGo struct {
 	rtpFlowID         uint
 	rtcpSendFlowID    uint
 	rtcpRecvFlowID    uint
+	quicFeedback      bool
+	feedbackFlowID    uint
+	feedbackInterval  uint
+	audioSink         string
+	audioCodec        string
+	audioFlowID       uint
+	maxSpatialLayer   int
+	maxTemporalLayer  int
 }
 
 func (r *ReceiveGo) Help() string {
@@ -48,7 +62,9 @@ func (r *ReceiveGo) Exec(cmd string, args []string) error {
 	fs.StringVar(&r.localAddr, "local", "127.0.0.1", "Local address")
 	fs.StringVar(&r.remoteAddr, "remote", "127.0.0.1", "Remote address")
 	fs.BoolVar(&r.roqServer, "roq-server", false, "Use RoQ server transport.")
-	fs.StringVar(&r.codec, "sink-codec", mrtp.H264.String(), "Codec to use (H264, VP8)")
+	fs.StringVar(&r.codec, "sink-codec", mrtp.H264.String(), fmt.Sprintf("Codec to use (%v)", mrtp.CodecNames()))
+	fs.StringVar(&r.pipeline, "pipeline", "", "Description of the video pipeline that the RTP flow is written to, e.g. 'rtpdepay codec=VP8 ! vp8dec ! y4msink location=out.y4m'. Replaces -sink-codec and the layer flags.")
+	fs.StringVar(&r.metrics, "metrics", "", "File to write the per element metrics of the video pipeline to at the end of the run, as per frame trace if the name ends in .csv and as JSON otherwise. If empty, no metrics are collected.")
 	fs.BoolVar(&r.traceRTP, "trace-rtp-recv", false, "Log incoming RTP packets")
 	fs.BoolVar(&r.datachannel, "dc", false, "Send/Receive data with data channels")
 	fs.UintVar(&r.dataChannelFlowID, "dc-flow-id", 3, "QUIC Flow ID to use for sending/receiving data with data channels")
@@ -56,6 +72,14 @@ func (r *ReceiveGo) Exec(cmd string, args []string) error {
 	fs.UintVar(&r.rtpFlowID, "rtp-flow-id", 0, "RTP Flow ID when using RTP over QUIC")
 	fs.UintVar(&r.rtcpSendFlowID, "rtcp-send-flow-id", 1, "RTCP Sender Flow ID when using RTP over QUIC")
 	fs.UintVar(&r.rtcpRecvFlowID, "rtcp-recv-flow-id", 2, "RTCP Receiver Flow ID when using RTP over QUIC")
+	fs.BoolVar(&r.quicFeedback, "quic-feedback", false, "Send arrival times and ECN marks of received QUIC packets to the sender")
+	fs.UintVar(&r.feedbackFlowID, "feedback-flow-id", 4, "Flow ID of the feedback when using -quic-feedback")
+	fs.UintVar(&r.feedbackInterval, "feedback-interval", 20, "Interval in milliseconds at which feedback is sent when using -quic-feedback")
+	fs.StringVar(&r.audioSink, "audio-sink", "", "WAV file to write the received audio flow to. If empty, no audio is received.")
+	fs.StringVar(&r.audioCodec, "audio-codec", mrtp.OPUS.String(), "Codec of the audio flow")
+	fs.UintVar(&r.audioFlowID, "audio-flow-id", 5, "RTP Flow ID of the audio flow when using RTP over QUIC")
+	fs.IntVar(&r.maxSpatialLayer, "max-spatial-layer", -1, "Drop VP9 spatial layers above this layer ID. Negative values keep all layers.")
+	fs.IntVar(&r.maxTemporalLayer, "max-temporal-layer", -1, "Drop VP8/VP9 temporal layers above this layer ID. Negative values keep all layers.")
 
 	fs.Usage = func() {
 		fmt.Fprintf(os.Stderr, `Run a receiver pipeline
@@ -87,6 +111,9 @@ Flags:
 		quictransport.SetRemoteAddress(r.remoteAddr, r.udpPort),
 		quictransport.SetQLOGLabel("receiver"),
 	}
+	if r.quicFeedback {
+		quicOptions = append(quicOptions, quictransport.EnableFeedback(uint64(r.feedbackFlowID), time.Duration(r.feedbackInterval)*time.Millisecond))
+	}
 
 	quicConn, err := quictransport.New(ctx, []string{roqALPN}, quicOptions...)
 	if err != nil {
@@ -109,7 +136,7 @@ Flags:
 		roqTransport.HandleDatagram(dgram)
 	}
 	quicConn.HandleUniStream = func(flowID uint64, rs *quic.ReceiveStream) {
-		if flowID == uint64(r.rtpFlowID) || flowID == uint64(r.rtcpRecvFlowID) || flowID == uint64(r.rtcpSendFlowID) {
+		if flowID == uint64(r.rtpFlowID) || flowID == uint64(r.rtcpRecvFlowID) || flowID == uint64(r.rtcpSendFlowID) || (len(r.audioSink) > 0 && flowID == uint64(r.audioFlowID)) {
 			roqTransport.HandleUniStreamWithFlowID(flowID, roq.NewQuicGoReceiveStream(rs))
 			return
 		}
@@ -147,58 +174,281 @@ Flags:
 		}()
 	}
 
+	if len(r.audioSink) > 0 {
+		if err = r.startAudio(ctx, roqTransport, quicConn); err != nil {
+			return err
+		}
+	}
+
 	rtpSrc, err := roqTransport.NewReceiveFlow(uint64(r.rtpFlowID), r.traceRTP)
 	if err != nil {
 		return err
 	}
+	defer func() {
+		_ = rtpSrc.Close()
+	}()
 
-	codecTyp, err := codec.CodecTypeFromString(r.codec)
+	// request keyframes to recover from lost or undecodable frames
+	rtcpSink, err := roqTransport.NewSendFlow(uint64(r.rtcpSendFlowID), roq.SendModeDatagram, false)
 	if err != nil {
 		return err
 	}
+	defer func() {
+		_ = rtcpSink.Close()
+	}()
+	keyFrameRequester := gopipe.NewKeyFrameRequester(rtcpSink, goVideoSSRC, keyFrameRequestInterval)
+	requestKeyFrame := func() {
+		if requestErr := keyFrameRequester.RequestKeyFrame(); requestErr != nil {
+			slog.Error("failed to request keyframe", "error", requestErr)
+		}
+	}
+	onDecodeError := func(decodeErr error) {
+		slog.Info("failed to decode frame", "error", decodeErr)
+		if !errors.Is(decodeErr, codec.ErrFrameNotReady) {
+			requestKeyFrame()
+		}
+	}
 
-	decoder, err := gopipe.NewDecoder(codecTyp)
+	var metrics *gopipe.Metrics
+	if len(r.metrics) > 0 {
+		metrics = gopipe.NewMetrics()
+	}
+	var pipeline *gopipe.Pipeline
+	if len(r.pipeline) > 0 {
+		pipeline, err = r.parseVideoPipeline(ctx, requestKeyFrame, onDecodeError, metrics)
+	} else {
+		pipeline, err = r.buildVideoPipeline(requestKeyFrame, onDecodeError, metrics)
+	}
 	if err != nil {
 		return err
 	}
+	defer func() {
+		if closeErr := pipeline.Close(); closeErr != nil {
+			slog.Error("failed to close video pipeline", "error", closeErr)
+		}
+		if metrics != nil {
+			if metricsErr := writeMetrics(metrics, r.metrics); metricsErr != nil {
+				slog.Error("failed to write metrics", "error", metricsErr)
+			}
+		}
+	}()
+	var rttElements []interface{ UpdateRTT(time.Duration) }
+	for _, e := range pipeline.Elements() {
+		if rttElement, ok := e.(interface{ UpdateRTT(time.Duration) }); ok {
+			rttElements = append(rttElements, rttElement)
+		}
+	}
+	if err = pipeline.Start(ctx); err != nil {
+		return err
+	}
 
-	fileSink, err := gopipe.NewY4MSink("./out.y4m", 30, 1)
+	return receivePackets(ctx, "video pipeline", rtpSrc, pipeline, 150000, func() {
+		rtt := quicConn.GetRTT()
+		for _, e := range rttElements {
+			e.UpdateRTT(rtt)
+		}
+	})
+}
+
+// receivePackets writes the packets read from src to pipeline until ctx is
+// done, reading or writing fails or an element posts an error on the bus. The
+// bus is watched from its own goroutine, which sets an expired read deadline
+// on src to end a blocked Read. onPacket is called before each packet is
+// written.
+func receivePackets(ctx context.Context, name string, src *roq.Receiver, pipeline *gopipe.Pipeline, bufSize int, onPacket func()) error {
+	readCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var busErr error
+	var wg sync.WaitGroup
+	wg.Go(func() {
+		defer func() {
+			_ = src.SetReadDeadline(time.Now())
+		}()
+		for {
+			select {
+			case <-readCtx.Done():
+				return
+			case m := <-pipeline.Bus().Messages():
+				if m.Type == gopipe.MessageError {
+					busErr = fmt.Errorf("%T: %w", m.Element, m.Err)
+					return
+				}
+				slog.Warn(name, "type", m.Type, "error", m.Err)
+			}
+		}
+	})
+
+	buf := make([]byte, bufSize)
+	var err error
+	for err == nil && readCtx.Err() == nil {
+		var n int
+		if n, err = src.Read(buf); err != nil {
+			break
+		}
+		onPacket()
+		err = pipeline.Write(buf[:n], gopipe.Attributes{})
+	}
+	cancel()
+	wg.Wait()
+
+	// reads fail once the bus watcher set the deadline
+	if busErr != nil {
+		return busErr
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+// buildVideoPipeline creates the video pipeline from the codec and layer
+// flags. Depacketizers and decoders report lost and undecodable frames to the
+// given callbacks, all elements report to metrics unless it is nil.
+func (r *ReceiveGo) buildVideoPipeline(onFrameDropped func(), onDecodeError func(error), metrics *gopipe.Metrics) (*gopipe.Pipeline, error) {
+	codecTyp, err := mrtp.NewCodec(r.codec)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	var elements []any
+	if r.maxSpatialLayer >= 0 || r.maxTemporalLayer >= 0 {
+		layerFilter, filterErr := gopipe.NewRTPLayerFilter(codecTyp)
+		if filterErr != nil {
+			return nil, filterErr
+		}
+		layerFilter.SetMaxLayers(r.maxSpatialLayer, r.maxTemporalLayer)
+		elements = append(elements, layerFilter)
 	}
 
 	maxTimeout := 150 * time.Millisecond
 	depacketizer, err := gopipe.NewRTPDepacketizer(maxTimeout, codecTyp)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	defer func() {
-		_ = depacketizer.Close()
-	}()
+	depacketizer.OnFrameDropped(onFrameDropped)
+	elements = append(elements, depacketizer)
 
-	rtpPipeline, err := gopipe.Chain(gopipe.Info{}, fileSink, decoder, depacketizer)
+	// the depacketizer and the layer filter hold no resources before they
+	// are started
+	decoder, err := gopipe.NewDecoder(codecTyp)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	decoder.OnDecodeError(onDecodeError)
 
-	buf := make([]byte, 150000)
-	for {
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		default:
-		}
+	fileSink, err := gopipe.NewY4MSink("./out.y4m", 30, 1)
+	if err != nil {
+		_ = decoder.Close()
+		return nil, err
+	}
+	return gopipe.NewPipelineWithMetrics(metrics, append(elements, decoder, fileSink)...)
+}
 
-		n, err := rtpSrc.Read(buf)
+// parseVideoPipeline creates the video pipeline from the -pipeline
+// description. Depacketizers and decoders report lost and undecodable frames
+// to the given callbacks, all elements report to metrics unless it is nil.
+func (r *ReceiveGo) parseVideoPipeline(ctx context.Context, onFrameDropped func(), onDecodeError func(error), metrics *gopipe.Metrics) (*gopipe.Pipeline, error) {
+	registry := gopipe.NewRegistry()
+	registry.SetMetrics(metrics)
+	newDepacketizer, ok := registry.Lookup("rtpdepay")
+	if !ok {
+		return nil, errors.New("rtpdepay element not registered")
+	}
+	// the callback must be set before the depacketizer is started
+	registry.Register("rtpdepay", func(ctx context.Context, p *gopipe.Properties) (any, error) {
+		e, err := newDepacketizer(ctx, p)
 		if err != nil {
-			return err
+			return nil, err
+		}
+		depacketizer, ok := e.(*gopipe.RTPDepacketizer)
+		if !ok {
+			if c, isCloser := e.(io.Closer); isCloser {
+				_ = c.Close()
+			}
+			return nil, fmt.Errorf("unexpected depacketizer type %T", e)
 		}
+		depacketizer.OnFrameDropped(onFrameDropped)
+		return depacketizer, nil
+	})
+	pipeline, err := registry.Parse(ctx, r.pipeline)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range pipeline.Elements() {
+		if decoder, ok := e.(*gopipe.Decoder); ok {
+			decoder.OnDecodeError(onDecodeError)
+		}
+	}
+	return pipeline, nil
+}
 
-		depacketizer.UpdateRTT(quicConn.GetRTT())
+// startAudio starts receiving the audio flow and writing it to the audio
+// sink.
+func (r *ReceiveGo) startAudio(ctx context.Context, roqTransport *roq.Transport, quicConn *quictransport.Transport) (err error) {
+	audioCodec, err := mrtp.NewCodec(r.audioCodec)
+	if err != nil {
+		return err
+	}
+	info, _ := audioCodec.Info()
+	if info.MediaType != "audio" {
+		return fmt.Errorf("not an audio codec: %v", audioCodec)
+	}
+	sampleRate, channels := int(info.ClockRate), int(info.Channels)
 
-		err = rtpPipeline.Write(buf[:n], gopipe.Attributes{})
+	// close what was created so far if starting fails
+	var closers []io.Closer
+	defer func() {
 		if err != nil {
-			return err
+			for _, c := range slices.Backward(closers) {
+				_ = c.Close()
+			}
 		}
+	}()
+
+	audioSrc, err := roqTransport.NewReceiveFlow(uint64(r.audioFlowID), r.traceRTP)
+	if err != nil {
+		return err
+	}
+	closers = append(closers, audioSrc)
+	decoder, err := gopipe.NewAudioDecoder(audioCodec, sampleRate, channels)
+	if err != nil {
+		return err
+	}
+	closers = append(closers, decoder)
+	wavSink, err := gopipe.NewWAVSink(r.audioSink, sampleRate, channels)
+	if err != nil {
+		return err
 	}
+	closers = append(closers, wavSink)
+	depacketizer, err := gopipe.NewRTPDepacketizer(150*time.Millisecond, audioCodec)
+	if err != nil {
+		return err
+	}
+	// the pipeline owns its elements, also if linking fails
+	closers = closers[:1]
+	pipeline, err := gopipe.NewPipeline(depacketizer, decoder, wavSink)
+	if err != nil {
+		return err
+	}
+	closers = append(closers, pipeline)
+	if err = pipeline.Start(ctx); err != nil {
+		return err
+	}
+
+	go func() {
+		defer func() {
+			if closeErr := pipeline.Close(); closeErr != nil {
+				slog.Error("failed to close audio pipeline", "error", closeErr)
+			}
+			_ = audioSrc.Close()
+		}()
+		receiveErr := receivePackets(ctx, "audio pipeline", audioSrc, pipeline, 1500, func() {
+			depacketizer.UpdateRTT(quicConn.GetRTT())
+		})
+		if receiveErr != nil && ctx.Err() == nil {
+			slog.Error("failed to receive audio", "error", receiveErr)
+		}
+	}()
+	return nil
 }
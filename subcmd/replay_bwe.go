@@ -0,0 +1,110 @@
+package subcmd
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/mengelbart/mrtp"
+	"github.com/mengelbart/mrtp/cmdmain"
+)
+
+func init() {
+	cmdmain.RegisterSubCmd("replay-bwe", func() cmdmain.SubCmd { return new(ReplayBWE) })
+}
+
+// ReplayBWE feeds a recorded BWE trace into a bandwidth estimator offline.
+type ReplayBWE struct {
+	trace         string
+	bwe           string
+	bweConfig     string
+	output        string
+	maxTargetRate uint
+}
+
+func (r *ReplayBWE) Help() string {
+	return "Replay a recorded BWE feedback trace into a bandwidth estimator"
+}
+
+func (r *ReplayBWE) Exec(cmd string, args []string) error {
+	fs := flag.NewFlagSet("replay-bwe", flag.ExitOnError)
+	fs.StringVar(&r.trace, "trace", "", "BWE trace file recorded with -bwe-trace")
+	fs.StringVar(&r.bwe, "bwe", "nada", "Bandwidth estimator to replay the trace into, e.g. 'nada', 'gcc', 'scream' or 'l4s'")
+	fs.StringVar(&r.bweConfig, "bwe-config", "", "JSON or YAML file with BWE parameters, overrides -max-target-rate")
+	fs.StringVar(&r.output, "output", "", "CSV output file for the target rates, empty string means stdout")
+	fs.UintVar(&r.maxTargetRate, "max-target-rate", 30_000_000, "Set the maximum target rate of the congestion controller in bits per second")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, `%v
+
+Usage:
+	%v replay-bwe [flags]
+
+Flags:
+`, r.Help(), cmd)
+		fs.PrintDefaults()
+		fmt.Fprintln(os.Stderr)
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if len(r.trace) == 0 {
+		fmt.Fprintf(os.Stderr, "Flag -trace is required\n")
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	bwe, _, err := makeBWE(r.bwe, r.bweConfig, BWEConfig{
+		InitTargetRate: initTargetRate,
+		MinTargetRate:  minTargetRate,
+		MaxTargetRate:  r.maxTargetRate,
+	})
+	if err != nil {
+		return err
+	}
+
+	traceFile, err := os.Open(r.trace)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = traceFile.Close()
+	}()
+
+	samples, err := mrtp.ReplayBWETrace(traceFile, bwe)
+	if err != nil {
+		return err
+	}
+
+	var out io.Writer = os.Stdout
+	if len(r.output) > 0 {
+		f, err := os.Create(r.output)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = f.Close()
+		}()
+		out = f
+	}
+
+	w := csv.NewWriter(out)
+	if err = w.Write([]string{"time", "recorded", "replayed"}); err != nil {
+		return err
+	}
+	for _, s := range samples {
+		if err = w.Write([]string{
+			strconv.FormatInt(s.Time.UnixMicro(), 10),
+			strconv.Itoa(s.Recorded),
+			strconv.Itoa(s.Replayed),
+		}); err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
@@ -7,9 +7,11 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log/slog"
 	"math"
 	"os"
+	"time"
 
 	"github.com/mengelbart/mrtp"
 	"github.com/mengelbart/mrtp/cmdmain"
@@ -44,7 +46,7 @@ type gstreamerVideoStreamSourceFactory struct {
 
 func (f *gstreamerVideoStreamSourceFactory) ConfigureFlags(fs *flag.FlagSet) {
 	fs.StringVar(&f.sourceLocation, "source-location", "", "Location for filesource (or videotestsrc to generate a testsource)")
-	fs.StringVar(&f.codec, "source-codec", mrtp.H264.String(), "Codec to use for encoder (H264, VP8)")
+	fs.StringVar(&f.codec, "source-codec", mrtp.H264.String(), fmt.Sprintf("Codec to use for encoder (%v)", mrtp.CodecNames()))
 }
 
 func (f *gstreamerVideoStreamSourceFactory) MakeStreamSource(name string) (gstreamer.RTPSourceBin, error) {
@@ -69,6 +71,10 @@ func (f *gstreamerVideoStreamSourceFactory) MakeStreamSource(name string) (gstre
 
 var DefaultStreamSourceFactory StreamSourceFactory = &gstreamerVideoStreamSourceFactory{}
 
+// mediaMaxShare is the maximum fraction of the target rate allocated to the
+// gstreamer encoder.
+const mediaMaxShare = 0.8
+
 var (
 	gstSCReAM    bool
 	dcPercentage uint
@@ -81,6 +87,12 @@ type Send struct {
 	roqServer         bool
 	roqClient         bool
 	bwe               string
+	bweTrace          string
+	bweStateLog       uint
+	bweConfig         string
+	quicFeedback      bool
+	feedbackFlowID    uint
+	ecn               string
 	maxTargetRate     uint
 	traceRTP          bool
 	datachannel       bool
@@ -109,7 +121,13 @@ func (s *Send) Exec(cmd string, args []string) error {
 	fs.UintVar(&s.roqMapping, "roq-mapping", 0, "RTP mapping to QUIC. 0: datagrams, 1: stream per packet, 2: single stream")
 	fs.BoolVar(&s.roqServer, "roq-server", false, "Use RoQ server transport")
 	fs.BoolVar(&s.roqClient, "roq-client", false, "Use RoQ client transport")
-	fs.StringVar(&s.bwe, "bwe", "", "Set a bandwidth estimator by name, e.g. 'nada' or 'gcc'")
+	fs.StringVar(&s.bwe, "bwe", "", "Set a bandwidth estimator by name, e.g. 'nada', 'gcc', 'scream', 'l4s', 'constant:2000000', 'steps:0s=1000000,10s=2000000' or 'script:rates.csv'")
+	fs.StringVar(&s.bweTrace, "bwe-trace", "", "Record all BWE feedback to this file for offline replay")
+	fs.UintVar(&s.bweStateLog, "bwe-state-log-interval", 0, "Interval in milliseconds at which the BWE state is logged. 0 disables logging.")
+	fs.StringVar(&s.bweConfig, "bwe-config", "", "JSON or YAML file with BWE parameters, overrides -max-target-rate")
+	fs.BoolVar(&s.quicFeedback, "quic-feedback", false, "Use feedback sent by the receiver instead of QUIC ACK receive timestamps for the BWE (RoQ only)")
+	fs.UintVar(&s.feedbackFlowID, "feedback-flow-id", 4, "Flow ID of the receiver feedback when using -quic-feedback")
+	fs.StringVar(&s.ecn, "ecn", "", "Mark all outgoing QUIC packets with this ECN codepoint, 'ect0' or 'ect1' (RoQ only)")
 	fs.UintVar(&s.maxTargetRate, "max-target-rate", 30_000_000, "Set the maximum target rate of the congestion controller in bits per second")
 	fs.BoolVar(&s.traceRTP, "trace-rtp-send", false, "Log outgoing RTP packets")
 	fs.BoolVar(&s.datachannel, "dc", false, "Send/Receive data with data channels")
@@ -124,7 +142,7 @@ func (s *Send) Exec(cmd string, args []string) error {
 	fs.UintVar(&s.rtcpSendFlowID, "rtcp-send-flow-id", 2, "RTCP Sender Flow ID when using RTP over QUIC")
 	fs.UintVar(&s.rtcpRecvFlowID, "rtcp-recv-flow-id", 1, "RTCP Receiver Flow ID when using RTP over QUIC")
 	fs.BoolVar(&gstSCReAM, "gst-scream", false, "Run SCReAM Gstreamer element")
-	fs.UintVar(&dcPercentage, "dc-tr-share", 50, "Percentage of target rate to be used for data channel (RoQ only)")
+	fs.UintVar(&dcPercentage, "dc-tr-share", 50, "Percentage of target rate to be used for data channel while it is sending (RoQ only)")
 
 	DefaultStreamSourceFactory.ConfigureFlags(fs)
 
@@ -152,8 +170,8 @@ Flags:
 		os.Exit(1)
 	}
 
-	if (s.bwe == "nada" || s.bwe == "gcc" || s.roqMapping != 0) && (!s.roqServer && !s.roqClient) {
-		fmt.Fprintf(os.Stderr, "Flags -bwe {gcc,nada}, and -roq-mapping are only valid for RoQ\n")
+	if (len(s.bwe) > 0 || s.roqMapping != 0) && (!s.roqServer && !s.roqClient) {
+		fmt.Fprintf(os.Stderr, "Flags -bwe and -roq-mapping are only valid for RoQ\n")
 		fs.Usage()
 		os.Exit(1)
 	}
@@ -164,6 +182,12 @@ Flags:
 		os.Exit(1)
 	}
 
+	if dcPercentage > 100 {
+		fmt.Fprintf(os.Stderr, "Invalid -dc-tr-share value %v, must be at most 100.\n", dcPercentage)
+		fs.Usage()
+		os.Exit(1)
+	}
+
 	if len(fs.Args()) > 1 {
 		fmt.Fprintf(os.Stderr, "error: unknown extra arguments: %v\n", flag.Args()[1:])
 		fs.Usage()
@@ -212,12 +236,10 @@ Flags:
 			quictransport.SetQLOGLabel("sender"),
 		}
 
+		// the zero config does not filter the target rate
+		var bweConfig BWEConfig
 		if len(s.bwe) > 0 {
-			bweFactory, ok := BWEFactories[s.bwe]
-			if !ok {
-				return fmt.Errorf("unknown BWE: %v", s.bwe)
-			}
-			bwe, err := bweFactory.MakeBWE(BWEConfig{
+			bwe, config, err := makeBWE(s.bwe, s.bweConfig, BWEConfig{
 				InitTargetRate: initTargetRate,
 				MinTargetRate:  minTargetRate,
 				MaxTargetRate:  s.maxTargetRate,
@@ -225,7 +247,32 @@ Flags:
 			if err != nil {
 				return err
 			}
-			quicOptions = append(quicOptions, quictransport.SetBWE(bwe))
+			if len(s.bweTrace) > 0 {
+				var traceFile io.Closer
+				bwe, traceFile, err = recordBWE(bwe, s.bweTrace)
+				if err != nil {
+					return err
+				}
+				defer func() {
+					_ = traceFile.Close()
+				}()
+			}
+			quicOptions = append(quicOptions,
+				quictransport.SetBWE(bwe),
+				quictransport.SetBWEUpdateInterval(config.feedbackInterval()),
+				quictransport.SetBWEStateLogInterval(time.Duration(s.bweStateLog)*time.Millisecond),
+			)
+			bweConfig = config
+		}
+		if s.quicFeedback {
+			quicOptions = append(quicOptions, quictransport.EnableFeedbackReceiver(uint64(s.feedbackFlowID)))
+		}
+		if len(s.ecn) > 0 {
+			ecn, err := mrtp.NewECN(s.ecn)
+			if err != nil {
+				return err
+			}
+			quicOptions = append(quicOptions, quictransport.SetECN(ecn))
 		}
 
 		// open quic connection
@@ -291,21 +338,36 @@ Flags:
 		}
 
 		// set rate callbacks
+		allocator := mrtp.NewRateAllocator()
+		if mediaBa != nil {
+			allocator.AddFlow(mrtp.RateFlowConfig{
+				Name:   "media",
+				Weight: float64(100 - dcPercentage),
+				// leave headroom for the RTP and RoQ overhead, the encoder
+				// rate only covers the payload
+				MaxShare: mediaMaxShare,
+				SetRate:  mediaBa.SetBitrate,
+			})
+		}
+		if s.datachannel {
+			allocator.AddFlow(mrtp.RateFlowConfig{
+				Name:   "data",
+				Weight: float64(dcPercentage),
+				SetRate: func(ratebps uint) error {
+					s.dataSource.SetRateLimit(ratebps)
+					return nil
+				},
+				Active: s.dataSource.Running,
+			})
+		}
+		// pacing follows the unfiltered target rate
+		setTargetRate, err := bweConfig.filterTargetRate(allocator.SetTargetRate)
+		if err != nil {
+			return err
+		}
 		quicConn.SetSourceTargetRate = func(ratebps uint) error {
 			slog.Info("NEW_TARGET_RATE", "rate", ratebps)
-
-			var mediaTargetRate uint
-			if s.datachannel && s.dataSource != nil && s.dataSource.Running() {
-				mediaTargetRate = ratebps * (100 - dcPercentage) / 100
-			} else {
-				mediaTargetRate = uint(0.8 * float64(ratebps))
-			}
-			err := mediaBa.SetBitrate(mediaTargetRate)
-			if err != nil {
-				panic(err)
-			}
-
-			return nil
+			return setTargetRate(ratebps)
 		}
 
 		rtpSink, err := roqTransport.NewSendFlow(uint64(s.rtpFlowID), roq.SendMode(s.roqMapping), s.traceRTP)
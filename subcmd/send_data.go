@@ -33,6 +33,8 @@ type SendData struct {
 	nada              bool
 	gcc               bool
 	maxTargetRate     uint
+	bweConfig         string
+	bweStateLog       uint
 	dataChannelFlowID uint
 }
 
@@ -47,6 +49,8 @@ func (s *SendData) Exec(cmd string, args []string) error {
 	fs.BoolVar(&s.nada, "nada", false, "Enable NADA congestion control")
 	fs.BoolVar(&s.gcc, "pion-gcc", false, "Enable GCC congestion control")
 	fs.UintVar(&s.maxTargetRate, "max-target-rate", 3_000_000, "Set the maximum target rate of the congestion controller in bits per second")
+	fs.StringVar(&s.bweConfig, "bwe-config", "", "JSON or YAML file with BWE parameters, overrides -max-target-rate")
+	fs.UintVar(&s.bweStateLog, "bwe-state-log-interval", 0, "Interval in milliseconds at which the BWE state is logged. 0 disables logging.")
 	fs.UintVar(&s.dataChannelFlowID, "dc-flow-id", 3, "Data Channel Flow ID when using quic data channels")
 
 	sourceFile := fs.String("source-file", "", "File to be sent. If empty, random data will be sent.")
@@ -81,17 +85,27 @@ Flags:
 		quictransport.SetQLOGLabel("sender"),
 	}
 
-	if s.nada {
-		nada := mrtp.NewNada(initTargetRate, minTargetRate, s.maxTargetRate, 20*time.Millisecond)
-		quicOptions = append(quicOptions, quictransport.SetBWE(nada))
-	}
-
-	if s.gcc {
-		gcc, err := mrtp.NewGCC(initTargetRate, minTargetRate, s.maxTargetRate)
+	// the zero config does not filter the target rate
+	var bweConfig BWEConfig
+	if s.nada || s.gcc {
+		name := "nada"
+		if s.gcc {
+			name = "gcc"
+		}
+		bwe, config, err := makeBWE(name, s.bweConfig, BWEConfig{
+			InitTargetRate: initTargetRate,
+			MinTargetRate:  minTargetRate,
+			MaxTargetRate:  s.maxTargetRate,
+		})
 		if err != nil {
 			return err
 		}
-		quicOptions = append(quicOptions, quictransport.SetBWE(gcc))
+		quicOptions = append(quicOptions,
+			quictransport.SetBWE(bwe),
+			quictransport.SetBWEUpdateInterval(config.feedbackInterval()),
+			quictransport.SetBWEStateLogInterval(time.Duration(s.bweStateLog)*time.Millisecond),
+		)
+		bweConfig = config
 	}
 
 	// open quic connection
@@ -136,12 +150,24 @@ Flags:
 
 	if s.gcc || s.nada {
 		// rate is controlled by cc
+		allocator := mrtp.NewRateAllocator()
+		allocator.AddFlow(mrtp.RateFlowConfig{
+			Name:   "data",
+			Weight: 1,
+			SetRate: func(ratebps uint) error {
+				source.SetRateLimit(ratebps)
+				return nil
+			},
+		})
+		// pacing follows the unfiltered target rate
+		setTargetRate, err := bweConfig.filterTargetRate(allocator.SetTargetRate)
+		if err != nil {
+			return err
+		}
 		quicConn.SetSourceTargetRate = func(ratebps uint) error {
 			// log "combined" target rate even if we do not split it. Makes plotting easier
 			slog.Info("NEW_TARGET_RATE", "rate", ratebps)
-
-			source.SetRateLimit(ratebps)
-			return nil
+			return setTargetRate(ratebps)
 		}
 	} else if rateLimit > 0 {
 		// fixed rate limit
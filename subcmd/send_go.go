@@ -4,10 +4,13 @@ package subcmd
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log/slog"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/mengelbart/mrtp"
@@ -25,6 +28,15 @@ func init() {
 	cmdmain.RegisterSubCmd("send-go", func() cmdmain.SubCmd { return new(SendGo) })
 }
 
+const (
+	goVideoSSRC uint32 = 0
+	goAudioSSRC uint32 = 1
+
+	// keyFrameRequestInterval is the minimum time between keyframe requests
+	// of the receiver and between keyframes forced by the sender.
+	keyFrameRequestInterval = 500 * time.Millisecond
+)
+
 // Help implements cmdmain.SubCmd.
 func (s *SendGo) Help() string {
 	return "Run sender pipeline without gstreamer (experimental)"
@@ -36,20 +48,46 @@ type SendGo struct {
 	roqMapping        uint
 	roqServer         bool
 	sourceLocation    string
+	pipeline          string
+	metrics           string
 	codec             string
+	scalabilityMode   string
+	encoderRate       uint
+	encoderPreset     string
+	encoderThreads    int
+	keyFrameInterval  int
+	minQuantizer      int
+	maxQuantizer      int
+	vbvBufferSize     time.Duration
+	errorResilient    bool
+	pixelFormat       string
+	adaptQuality      bool
+	dropFrames        bool
+	bwe               string
+	bweTrace          string
+	bweStateLog       uint
 	nada              bool
 	gcc               bool
 	maxTargetRate     uint
+	bweConfig         string
+	quicFeedback      bool
+	feedbackFlowID    uint
+	ecn               string
 	traceRTP          bool
 	datachannel       bool
 	dcSourceFile      string
 	dcStartDelay      uint
 	dcChunks          bool
+	dcShare           uint
 	dataChannelFlowID uint
 	udpPort           uint
 	rtpFlowID         uint
 	rtcpSendFlowID    uint
 	rtcpRecvFlowID    uint
+	audioSource       string
+	audioCodec        string
+	audioFlowID       uint
+	audioMaxRate      uint
 }
 
 // Exec implements cmdmain.SubCmd.
@@ -60,20 +98,46 @@ func (s *SendGo) Exec(cmd string, args []string) error {
 	fs.UintVar(&s.roqMapping, "roq-mapping", 0, "RTP mapping to QUIC. 0: datagrams, 1: stream per packet, 2: single stream")
 	fs.BoolVar(&s.roqServer, "roq-server", false, "Usr RoQ server transport")
 	fs.StringVar(&s.sourceLocation, "source-location", "", "Location for filesource")
-	fs.StringVar(&s.codec, "source-codec", mrtp.H264.String(), "Codec to use (H264, VP8)")
-	fs.BoolVar(&s.nada, "nada", false, "Enable NADA congestion control")
-	fs.BoolVar(&s.gcc, "pion-gcc", false, "Enable GCC congestion control")
+	fs.StringVar(&s.pipeline, "pipeline", "", "Description of the video pipeline, e.g. 'y4msrc location=video.y4m ! vp8enc ! rtppay ! spacer ! roqsink', where roqsink sends to the RTP flow. Replaces the source and encoder flags.")
+	fs.StringVar(&s.metrics, "metrics", "", "File to write the per element metrics of the video pipeline to at the end of the run, as per frame trace if the name ends in .csv and as JSON otherwise. If empty, no metrics are collected.")
+	fs.StringVar(&s.codec, "source-codec", mrtp.H264.String(), fmt.Sprintf("Codec to use (%v)", mrtp.CodecNames()))
+	fs.StringVar(&s.scalabilityMode, "scalability-mode", "L1T1", "Spatial and temporal layers of the video stream, e.g. L1T3 (VP8, VP9) or L2T2 (VP9). H264 and AV1 only support L1T1")
+	fs.UintVar(&s.encoderRate, "encoder-initial-rate", 0, "Initial target rate of the video encoder in bits per second. 0 uses the initial rate of the BWE or 750 kbps without BWE.")
+	fs.StringVar(&s.encoderPreset, "encoder-preset", "", "Encoder speed preset: x264 preset name or libvpx/libaom cpu-used value. Empty selects the encoder default.")
+	fs.IntVar(&s.encoderThreads, "encoder-threads", 0, "Number of encoder threads. 0 selects the encoder default.")
+	fs.IntVar(&s.keyFrameInterval, "keyframe-interval", 0, "Maximum number of frames between keyframes. 0 selects the encoder default.")
+	fs.IntVar(&s.minQuantizer, "min-quantizer", 0, "Minimum quantizer of the encoder. 0 selects the encoder default.")
+	fs.IntVar(&s.maxQuantizer, "max-quantizer", 0, "Maximum quantizer of the encoder. 0 selects the encoder default.")
+	fs.DurationVar(&s.vbvBufferSize, "vbv-buffer", 0, "Size of the encoder rate control buffer, e.g. 500ms. 0 selects the encoder default.")
+	fs.BoolVar(&s.errorResilient, "error-resilient", true, "Enable the error resilient mode of libvpx and libaom")
+	fs.StringVar(&s.pixelFormat, "pixel-format", "", "Pixel format of the encoder input (I420, I422, I444). If empty, the format of the source is used if the codec supports it, otherwise I420.")
+	fs.BoolVar(&s.adaptQuality, "adapt-quality", false, "Reduce resolution and frame rate of the video when the target rate is too low for the source")
+	fs.BoolVar(&s.dropFrames, "drop-frames", false, "Drop frames before the encoder while its output exceeds the target rate")
+	fs.StringVar(&s.bwe, "bwe", "", "Set a bandwidth estimator by name, e.g. 'nada', 'gcc', 'scream', 'l4s', 'constant:2000000', 'steps:0s=1000000,10s=2000000' or 'script:rates.csv'")
+	fs.StringVar(&s.bweTrace, "bwe-trace", "", "Record all BWE feedback to this file for offline replay")
+	fs.UintVar(&s.bweStateLog, "bwe-state-log-interval", 0, "Interval in milliseconds at which the BWE state is logged. 0 disables logging.")
+	fs.BoolVar(&s.nada, "nada", false, "Enable NADA congestion control, same as -bwe nada")
+	fs.BoolVar(&s.gcc, "pion-gcc", false, "Enable GCC congestion control, same as -bwe gcc")
 	fs.UintVar(&s.maxTargetRate, "max-target-rate", 3_000_000, "Set the maximum target rate of the congestion controller in bits per second")
+	fs.StringVar(&s.bweConfig, "bwe-config", "", "JSON or YAML file with BWE parameters, overrides -max-target-rate")
+	fs.BoolVar(&s.quicFeedback, "quic-feedback", false, "Use feedback sent by the receiver instead of QUIC ACK receive timestamps for congestion control")
+	fs.UintVar(&s.feedbackFlowID, "feedback-flow-id", 4, "Flow ID of the receiver feedback when using -quic-feedback")
+	fs.StringVar(&s.ecn, "ecn", "", "Mark all outgoing QUIC packets with this ECN codepoint, 'ect0' or 'ect1'")
 	fs.BoolVar(&s.traceRTP, "trace-rtp-send", false, "Log outgoing RTP packets")
 	fs.BoolVar(&s.datachannel, "dc", false, "Send/Receive data with data channels")
 	fs.StringVar(&s.dcSourceFile, "dc-source", "", "File to be sent. If empty, random data will be sent.")
 	fs.UintVar(&s.dcStartDelay, "dc-start-delay", 0, "Start delay in seconds before data channel source starts sending data.")
 	fs.BoolVar(&s.dcChunks, "dc-chunks", false, "Send chunks on datachannel")
+	fs.UintVar(&s.dcShare, "dc-tr-share", 50, "Percentage of target rate to be used for data channel while it is sending")
 	fs.UintVar(&s.dataChannelFlowID, "dc-flow-id", 3, "Data Channel Flow ID when using quic data channels")
 	fs.UintVar(&s.udpPort, "rtp-port", 5000, "UDP Port number for outgoing RTP stream")
 	fs.UintVar(&s.rtpFlowID, "rtp-flow-id", 0, "RTP Flow ID when using RTP over QUIC")
 	fs.UintVar(&s.rtcpSendFlowID, "rtcp-send-flow-id", 2, "RTCP Sender Flow ID when using RTP over QUIC")
 	fs.UintVar(&s.rtcpRecvFlowID, "rtcp-recv-flow-id", 1, "RTCP Receiver Flow ID when using RTP over QUIC")
+	fs.StringVar(&s.audioSource, "audio-source", "", "WAV file to send as audio flow next to the video. If empty, no audio is sent.")
+	fs.StringVar(&s.audioCodec, "audio-codec", mrtp.OPUS.String(), "Codec to use for the audio flow")
+	fs.UintVar(&s.audioFlowID, "audio-flow-id", 5, "RTP Flow ID of the audio flow when using RTP over QUIC")
+	fs.UintVar(&s.audioMaxRate, "audio-max-rate", 64_000, "Maximum target rate of the audio encoder in bits per second")
 
 	fs.Usage = func() {
 		fmt.Fprintf(os.Stderr, `Run a sender
@@ -98,6 +162,12 @@ Flags:
 		os.Exit(1)
 	}
 
+	if s.dcShare > 100 {
+		fmt.Fprintf(os.Stderr, "Invalid -dc-tr-share value %v, must be at most 100.\n", s.dcShare)
+		fs.Usage()
+		os.Exit(1)
+	}
+
 	if len(fs.Args()) > 1 {
 		fmt.Fprintf(os.Stderr, "error: unknown extra arguments: %v\n", flag.Args()[1:])
 		fs.Usage()
@@ -111,17 +181,51 @@ Flags:
 		quictransport.SetQLOGLabel("sender"),
 	}
 
-	if s.nada {
-		nada := mrtp.NewNada(initTargetRate, minTargetRate, s.maxTargetRate, 20*time.Millisecond)
-		quicOptions = append(quicOptions, quictransport.SetBWE(nada))
+	bweConfig := BWEConfig{
+		InitTargetRate: initTargetRate,
+		MinTargetRate:  minTargetRate,
+		MaxTargetRate:  s.maxTargetRate,
+	}
+	bweName := s.bweName()
+	if len(bweName) > 0 {
+		// load the config here to start the encoder at the initial rate of
+		// the BWE
+		if len(s.bweConfig) > 0 {
+			if err := LoadBWEConfig(s.bweConfig, &bweConfig); err != nil {
+				return err
+			}
+		}
+		bwe, _, err := makeBWE(bweName, "", bweConfig)
+		if err != nil {
+			return err
+		}
+		if len(s.bweTrace) > 0 {
+			var traceFile io.Closer
+			bwe, traceFile, err = recordBWE(bwe, s.bweTrace)
+			if err != nil {
+				return err
+			}
+			defer func() {
+				_ = traceFile.Close()
+			}()
+		}
+		quicOptions = append(quicOptions,
+			quictransport.SetBWE(bwe),
+			quictransport.SetBWEUpdateInterval(bweConfig.feedbackInterval()),
+			quictransport.SetBWEStateLogInterval(time.Duration(s.bweStateLog)*time.Millisecond),
+		)
+	}
+
+	if s.quicFeedback {
+		quicOptions = append(quicOptions, quictransport.EnableFeedbackReceiver(uint64(s.feedbackFlowID)))
 	}
 
-	if s.gcc {
-		gcc, err := mrtp.NewGCC(initTargetRate, minTargetRate, s.maxTargetRate)
+	if len(s.ecn) > 0 {
+		ecn, err := mrtp.NewECN(s.ecn)
 		if err != nil {
 			return err
 		}
-		quicOptions = append(quicOptions, quictransport.SetBWE(gcc))
+		quicOptions = append(quicOptions, quictransport.SetECN(ecn))
 	}
 
 	quicConn, err := quictransport.New(ctx, []string{roqALPN}, quicOptions...)
@@ -147,7 +251,7 @@ Flags:
 		roqTransport.HandleDatagram(dgram)
 	}
 	quicConn.HandleUniStream = func(flowID uint64, rs *quic.ReceiveStream) {
-		if flowID == uint64(s.rtpFlowID) || flowID == uint64(s.rtcpRecvFlowID) || flowID == uint64(s.rtcpSendFlowID) {
+		if flowID == uint64(s.rtpFlowID) || flowID == uint64(s.rtcpRecvFlowID) || flowID == uint64(s.rtcpSendFlowID) || (len(s.audioSource) > 0 && flowID == uint64(s.audioFlowID)) {
 			roqTransport.HandleUniStreamWithFlowID(flowID, roq.NewQuicGoReceiveStream(rs))
 			return
 		}
@@ -187,11 +291,26 @@ Flags:
 		return err
 	}
 
+	var metrics *gopipe.Metrics
+	if len(s.metrics) > 0 {
+		metrics = gopipe.NewMetrics()
+	}
+	var video *videoFlow
 	defer func() {
 		println("closing sender")
 
 		// give pacer time to send everything
 		time.Sleep(5 * time.Second)
+		if video != nil {
+			if closeErr := video.close(); closeErr != nil {
+				slog.Error("failed to close video pipeline", "error", closeErr)
+			}
+		}
+		if metrics != nil {
+			if metricsErr := writeMetrics(metrics, s.metrics); metricsErr != nil {
+				slog.Error("failed to write metrics", "error", metricsErr)
+			}
+		}
 		_ = rtpSink.Close()
 		_ = roqTransport.Close()
 		_ = roqTransport.CloseLogFile()
@@ -202,52 +321,343 @@ Flags:
 		return writeErr
 	})
 
-	file, err := os.Open(s.sourceLocation)
+	if len(s.pipeline) > 0 {
+		video, err = s.parseVideoPipeline(ctx, appSink, metrics)
+	} else {
+		video, err = s.buildVideoPipeline(appSink, bweConfig, metrics)
+	}
 	if err != nil {
 		return err
 	}
+
+	// set rate callbacks
+	allocator := mrtp.NewRateAllocator()
+	allocator.AddFlow(mrtp.RateFlowConfig{
+		Name:   "media",
+		Weight: float64(100 - s.dcShare),
+		SetRate: func(ratebps uint) error {
+			video.setTargetRate(uint64(ratebps))
+			return nil
+		},
+	})
+	if dataSource != nil {
+		allocator.AddFlow(mrtp.RateFlowConfig{
+			Name:   "data",
+			Weight: float64(s.dcShare),
+			SetRate: func(ratebps uint) error {
+				dataSource.SetRateLimit(ratebps)
+				return nil
+			},
+			Active: dataSource.Running,
+		})
+	}
+	if len(s.audioSource) > 0 {
+		if err = s.startAudio(ctx, roqTransport, allocator); err != nil {
+			return err
+		}
+	}
+	// pacing follows the unfiltered target rate
+	setTargetRate, err := bweConfig.filterTargetRate(allocator.SetTargetRate)
+	if err != nil {
+		return err
+	}
+	quicConn.SetSourceTargetRate = func(ratebps uint) error {
+		slog.Info("NEW_TARGET_RATE", "rate", ratebps)
+		return setTargetRate(ratebps)
+	}
+
+	if video.keyFrames != nil {
+		if err = s.handleKeyFrameRequests(roqTransport, video.keyFrames); err != nil {
+			return err
+		}
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	return video.start(ctx)
+}
+
+// bweName returns the name of the BWE selected by -bwe, -nada or -pion-gcc
+// and an empty string if the sender runs without BWE.
+func (s *SendGo) bweName() string {
+	switch {
+	case len(s.bwe) > 0:
+		return s.bwe
+	case s.gcc:
+		return "gcc"
+	case s.nada:
+		return "nada"
+	}
+	return ""
+}
+
+// videoFlow is the video pipeline of the sender.
+type videoFlow struct {
+	start         func(context.Context) error
+	setTargetRate func(uint64)
+	// keyFrames is nil for pipelines without encoder.
+	keyFrames gopipe.KeyFrameForcer
+	close     func() error
+}
+
+// parseVideoPipeline creates the video pipeline from the -pipeline
+// description. Its elements report to metrics unless it is nil.
+func (s *SendGo) parseVideoPipeline(ctx context.Context, appSink gopipe.Sink, metrics *gopipe.Metrics) (*videoFlow, error) {
+	registry := gopipe.NewRegistry()
+	registry.SetMetrics(metrics)
+	registry.Register("roqsink", func(context.Context, *gopipe.Properties) (any, error) {
+		return appSink, nil
+	})
+	pipeline, err := registry.Parse(ctx, s.pipeline)
+	if err != nil {
+		return nil, err
+	}
+	video := &videoFlow{
+		start:         pipeline.Run,
+		setTargetRate: pipeline.SetTargetRate,
+		close:         pipeline.Close,
+	}
+	for _, e := range pipeline.Elements() {
+		if forcer, ok := e.(gopipe.KeyFrameForcer); ok {
+			video.keyFrames = forcer
+			break
+		}
+	}
+	return video, nil
+}
+
+// buildVideoPipeline creates the video pipeline from the source and encoder
+// flags. Its elements report to metrics unless it is nil.
+func (s *SendGo) buildVideoPipeline(appSink gopipe.Sink, bweConfig BWEConfig, metrics *gopipe.Metrics) (video *videoFlow, err error) {
+	file, err := os.Open(s.sourceLocation)
+	if err != nil {
+		return nil, err
+	}
 	defer func() {
-		if closeErr := file.Close(); closeErr != nil {
-			slog.Error("failed to close file", "error", closeErr)
+		if err != nil {
+			_ = file.Close()
 		}
 	}()
 
 	fileSrc, err := gopipe.NewY4MSource(file)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	i := fileSrc.GetInfo()
-	codecTyp, err := codec.CodecTypeFromString(s.codec)
+	codecTyp, err := mrtp.NewCodec(s.codec)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	encoder := gopipe.NewEncoder(codecTyp)
+	scalabilityMode, err := codec.ParseScalabilityMode(s.scalabilityMode)
+	if err != nil {
+		return nil, err
+	}
+	// NewY4MSource rejects chroma subsamplings without pixel format
+	sourceFormat, err := codec.PixelFormatOf(fileSrc.ChromaSubsampling())
+	if err != nil {
+		return nil, err
+	}
+	pixelFormat := sourceFormat
+	if len(s.pixelFormat) > 0 {
+		pixelFormat, err = codec.ParsePixelFormat(s.pixelFormat)
+		if err != nil {
+			return nil, err
+		}
+	} else if !codec.SupportsPixelFormat(codecTyp, pixelFormat) {
+		pixelFormat = codec.PixelFormatI420
+	}
+	encoderOpts := []gopipe.EncoderOption{
+		gopipe.EncoderPixelFormat(pixelFormat),
+		gopipe.EncoderScalabilityMode(scalabilityMode),
+		gopipe.EncoderPreset(s.encoderPreset),
+		gopipe.EncoderThreads(s.encoderThreads),
+		gopipe.EncoderKeyFrameInterval(s.keyFrameInterval),
+		gopipe.EncoderQuantizerRange(s.minQuantizer, s.maxQuantizer),
+		gopipe.EncoderVBVBufferSize(s.vbvBufferSize),
+		gopipe.EncoderErrorResilience(s.errorResilient),
+	}
+	encoderRate := s.encoderRate
+	if encoderRate == 0 && len(s.bweName()) > 0 {
+		encoderRate = bweConfig.InitTargetRate
+	}
+	if encoderRate > 0 {
+		encoderOpts = append(encoderOpts, gopipe.EncoderInitialRate(uint64(encoderRate)))
+	}
+	encoder := gopipe.NewEncoder(codecTyp, encoderOpts...)
+
+	var scaler *gopipe.Scaler
+	var decimator *gopipe.FrameRateDecimator
+	var qualityAdapter *gopipe.QualityAdapter
+	if s.adaptQuality {
+		scaler = gopipe.NewScaler()
+		decimator = gopipe.NewFrameRateDecimator()
+		fps := float64(i.TimebaseNum) / float64(i.TimebaseDen)
+		steps := gopipe.DefaultQualitySteps(int(i.Width), int(i.Height), fps)
+		qualityAdapter = gopipe.NewQualityAdapter(scaler, decimator, steps)
+	}
 
-	// set rate callbacks
-	quicConn.SetSourceTargetRate = func(ratebps uint) error {
-		slog.Info("NEW_TARGET_RATE", "rate", ratebps)
+	var frameDropper *gopipe.FrameDropper
+	if s.dropFrames {
+		frameDropper = gopipe.NewFrameDropper()
+	}
 
-		encoder.SetTargetRate(uint64(ratebps))
+	packetizer := &gopipe.RTPPacketizerFactory{
+		MTU:             1420,
+		PT:              codecTyp.PayloadType(),
+		SSRC:            goVideoSSRC,
+		ClockRate:       uint32(codecTyp.ClockRate()),
+		Codec:           codecTyp,
+		ScalabilityMode: scalabilityMode,
+	}
+	elements := []any{fileSrc}
+	if pixelFormat != sourceFormat {
+		elements = append(elements, gopipe.NewChromaConverter(pixelFormat.SubsampleRatio()))
+	}
+	if s.adaptQuality {
+		elements = append(elements, decimator, scaler)
+	}
+	if s.dropFrames {
+		elements = append(elements, frameDropper, encoder, frameDropper.Monitor())
+	} else {
+		elements = append(elements, encoder)
+	}
+	elements = append(elements, packetizer, gopipe.NewFrameSpacer(), appSink)
+	pipeline, err := gopipe.NewPipelineWithMetrics(metrics, elements...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &videoFlow{
+		start: pipeline.Run,
+		setTargetRate: func(targetRate uint64) {
+			if qualityAdapter != nil {
+				qualityAdapter.SetTargetRate(targetRate)
+			}
+			if frameDropper != nil {
+				frameDropper.SetTargetRate(targetRate)
+			}
+			encoder.SetTargetRate(targetRate)
+		},
+		keyFrames: encoder,
+		close: func() error {
+			return errors.Join(pipeline.Close(), file.Close())
+		},
+	}, nil
+}
 
-		return nil
+// startAudio starts sending the audio source on its own RoQ flow with a rate
+// from allocator. The audio flow hands back its rate when the source ends.
+func (s *SendGo) startAudio(ctx context.Context, roqTransport *roq.Transport, allocator *mrtp.RateAllocator) error {
+	audioCodec, err := mrtp.NewCodec(s.audioCodec)
+	if err != nil {
+		return err
+	}
+	if audioCodec.MediaType() != "audio" {
+		return fmt.Errorf("not an audio codec: %v", audioCodec)
 	}
 
+	file, err := os.Open(s.audioSource)
+	if err != nil {
+		return err
+	}
+	audioSrc, err := gopipe.NewWAVSource(file, 20*time.Millisecond)
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+
+	audioSink, err := roqTransport.NewSendFlow(uint64(s.audioFlowID), roq.SendMode(s.roqMapping), s.traceRTP)
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+	appSink := gopipe.WriterFunc(func(b []byte, _ gopipe.Attributes) error {
+		_, writeErr := audioSink.Write(b)
+		return writeErr
+	})
+
+	encoder := gopipe.NewAudioEncoder(audioCodec, uint64(s.audioMaxRate))
 	packetizer := &gopipe.RTPPacketizerFactory{
 		MTU:       1420,
-		PT:        96,
-		SSRC:      0,
-		ClockRate: 90_000,
-		Codec:     codecTyp,
+		PT:        audioCodec.PayloadType(),
+		SSRC:      goAudioSSRC,
+		ClockRate: uint32(audioCodec.ClockRate()),
+		Codec:     audioCodec,
 	}
-	pacer := gopipe.NewFrameSpacer(ctx)
-	rtpPipeline, err := gopipe.Chain(i, appSink, pacer, packetizer, encoder)
+	pipeline, err := gopipe.NewPipeline(audioSrc, encoder, packetizer, appSink)
 	if err != nil {
+		_ = file.Close()
 		return err
 	}
 
-	time.Sleep(100 * time.Millisecond)
+	flow := allocator.AddFlow(mrtp.RateFlowConfig{
+		Name:     "audio",
+		Priority: 1,
+		Weight:   1,
+		MaxRate:  s.audioMaxRate,
+		SetRate: func(ratebps uint) error {
+			encoder.SetTargetRate(uint64(ratebps))
+			return nil
+		},
+	})
+
+	go func() {
+		defer func() {
+			_ = pipeline.Close()
+			_ = audioSink.Close()
+			_ = file.Close()
+		}()
+		if audioErr := pipeline.Run(ctx); audioErr != nil {
+			slog.Error("failed to run audio pipeline", "error", audioErr)
+		}
+		// the source ended, leave the audio rate to the other flows
+		if demandErr := flow.SetDemand(0); demandErr != nil {
+			slog.Error("failed to hand back audio rate", "error", demandErr)
+		}
+	}()
+	return nil
+}
+
+// handleKeyFrameRequests forces keyframes on encoder when the receiver sends
+// PLI or FIR on the RTCP flow.
+func (s *SendGo) handleKeyFrameRequests(roqTransport *roq.Transport, encoder gopipe.KeyFrameForcer) error {
+	rtcpSrc, err := roqTransport.NewReceiveFlow(uint64(s.rtcpRecvFlowID), false)
+	if err != nil {
+		return err
+	}
+	handler := gopipe.NewKeyFrameHandler(encoder, goVideoSSRC, keyFrameRequestInterval)
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			n, readErr := rtcpSrc.Read(buf)
+			if readErr != nil {
+				slog.Error("failed to read RTCP flow", "error", readErr)
+				return
+			}
+			if n == 0 {
+				continue
+			}
+			if handleErr := handler.HandleRTCP(buf[:n]); handleErr != nil {
+				slog.Error("failed to handle RTCP packet", "error", handleErr)
+			}
+		}
+	}()
+	return nil
+}
 
-	return fileSrc.StartLive(ctx, rtpPipeline)
+// writeMetrics writes the trace of metrics as CSV to location if it ends in
+// .csv and the snapshot and trace as JSON otherwise.
+func writeMetrics(metrics *gopipe.Metrics, location string) error {
+	file, err := os.Create(location)
+	if err != nil {
+		return err
+	}
+	if strings.HasSuffix(location, ".csv") {
+		err = metrics.WriteTraceCSV(file)
+	} else {
+		err = metrics.WriteJSON(file)
+	}
+	return errors.Join(err, file.Close())
 }
@@ -6,10 +6,13 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"io"
 	"net"
 	"os"
+	"time"
 
 	"github.com/julienschmidt/httprouter"
+	"github.com/mengelbart/mrtp"
 	"github.com/mengelbart/mrtp/cmdmain"
 	"github.com/mengelbart/mrtp/data"
 	"github.com/mengelbart/mrtp/gstreamer"
@@ -21,13 +24,10 @@ func init() {
 	cmdmain.RegisterSubCmd("webrtc", func() cmdmain.SubCmd { return new(WebRTC) })
 }
 
-type WebRTCCodecParameters struct {
-	MimeType    string
-	ClockRate   uint32
-	PayloadType uint8
-}
-
-var WebRTCExtraCodecs = []WebRTCCodecParameters{}
+// WebRTCExtraCodecs are registered with the WebRTC media engine in addition
+// to the default codecs. Custom codecs can be added to the registry with
+// [mrtp.RegisterCodec].
+var WebRTCExtraCodecs = []mrtp.Codec{}
 
 type WebRTC struct {
 	localAddr        string
@@ -37,6 +37,9 @@ type WebRTC struct {
 	offer            bool
 	gstCCFB          bool
 	bwe              string
+	bweTrace         string
+	bweStateLog      uint
+	bweConfig        string
 	maxTargetRate    uint
 	traceOutgoingRTP bool
 	traceIncomingRTP bool
@@ -44,6 +47,8 @@ type WebRTC struct {
 	dcSourceFile     string
 	dcStartDelay     uint
 	dcChunks         bool
+	dcShare          uint
+	feedbackInterval uint
 	pionCCFB         bool
 	pionTWCC         bool
 	pionReports      bool
@@ -63,7 +68,10 @@ func (w *WebRTC) Exec(cmd string, args []string) error {
 	fs.StringVar(&w.localAddr, "local", "127.0.0.1", "Local address")
 	fs.StringVar(&w.remoteAddr, "remote", "127.0.0.1", "Remote address")
 	fs.BoolVar(&w.gstCCFB, "gst-ccfb", false, "Send CCFB RTCP Feedback packets generated by the screamrx Gstreamer element")
-	fs.StringVar(&w.bwe, "bwe", "", "Set a bandwidth estimator by name, e.g. 'nada' or 'gcc'")
+	fs.StringVar(&w.bwe, "bwe", "", "Set a bandwidth estimator by name, e.g. 'nada', 'gcc', 'scream', 'l4s', 'constant:2000000', 'steps:0s=1000000,10s=2000000' or 'script:rates.csv'")
+	fs.StringVar(&w.bweTrace, "bwe-trace", "", "Record all BWE feedback to this file for offline replay")
+	fs.UintVar(&w.bweStateLog, "bwe-state-log-interval", 0, "Interval in milliseconds at which the BWE state is logged. 0 disables logging.")
+	fs.StringVar(&w.bweConfig, "bwe-config", "", "JSON or YAML file with BWE parameters, overrides -max-target-rate")
 	fs.UintVar(&w.maxTargetRate, "max-target-rate", 30_000_000, "Set the maximum target rate of the congestion controller in bits per second")
 	fs.BoolVar(&w.traceOutgoingRTP, "trace-rtp-send", false, "Log outgoing RTP packets")
 	fs.BoolVar(&w.traceIncomingRTP, "trace-rtp-recv", false, "Log incoming RTP packets")
@@ -73,6 +81,7 @@ func (w *WebRTC) Exec(cmd string, args []string) error {
 
 	fs.BoolVar(&w.offer, "offer", false, "Act as the offerer for WebRTC signaling")
 	fs.BoolVar(&w.pionCCFB, "pion-ccfb", false, "Send RTCP CCFB packets generated by Pion")
+	fs.UintVar(&w.feedbackInterval, "feedback-interval", 20, "Interval in milliseconds at which Pion sends CCFB or TWCC feedback, also the default feedback interval of the BWE")
 	fs.BoolVar(&w.pionTWCC, "pion-twcc", false, "Send RTCP TWCC packets generated by Pion")
 	fs.BoolVar(&w.pionReports, "pion-reports", false, "Send RTCP SR/RR packets generated by Pion")
 	fs.BoolVar(&w.pionNACK, "pion-nack", false, "Send RTCP NACK packets generated by Pion")
@@ -83,6 +92,7 @@ func (w *WebRTC) Exec(cmd string, args []string) error {
 	fs.StringVar(&w.dcSourceFile, "dc-source", "", "File to be sent. If empty, random data will be sent.")
 	fs.UintVar(&w.dcStartDelay, "dc-start-delay", 0, "Start delay in seconds before data channel source starts sending data.")
 	fs.BoolVar(&w.dcChunks, "dc-chunks", false, "Send chunks on datachannel")
+	fs.UintVar(&w.dcShare, "dc-tr-share", 50, "Percentage of target rate to be used for data channel while it is sending")
 
 	fs.BoolVar(&w.pacing, "pacing", false, "Enable packet pacing")
 
@@ -102,6 +112,18 @@ Usage:
 		return err
 	}
 
+	if w.feedbackInterval == 0 || w.feedbackInterval > 1000 {
+		fmt.Fprintf(os.Stderr, "Invalid -feedback-interval value %v, must be between 1 and 1000.\n", w.feedbackInterval)
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	if w.dcShare > 100 {
+		fmt.Fprintf(os.Stderr, "Invalid -dc-tr-share value %v, must be at most 100.\n", w.dcShare)
+		fs.Usage()
+		os.Exit(1)
+	}
+
 	pipeline, err := gstreamer.NewRTPBin()
 	if err != nil {
 		return err
@@ -143,6 +165,7 @@ Usage:
 	if w.traceOutgoingRTP {
 		webrtcOptions = append(webrtcOptions, webrtc.EnableRTPSendTraceLogging())
 	}
+	webrtcOptions = append(webrtcOptions, webrtc.SetFeedbackInterval(time.Duration(w.feedbackInterval)*time.Millisecond))
 	if w.pionCCFB {
 		webrtcOptions = append(webrtcOptions, webrtc.EnableCCFB())
 	}
@@ -161,20 +184,33 @@ Usage:
 	if w.pacing {
 		webrtcOptions = append(webrtcOptions, webrtc.EnablePacing())
 	}
+	// the zero config does not filter the target rate
+	var bweConfig BWEConfig
 	if w.bwe != "" {
-		bweFactory, exists := BWEFactories[w.bwe]
-		if !exists {
-			return fmt.Errorf("unknown BWE factory: %v", w.bwe)
-		}
-		bwe, err := bweFactory.MakeBWE(BWEConfig{
-			InitTargetRate: initTargetRate,
-			MinTargetRate:  minTargetRate,
-			MaxTargetRate:  w.maxTargetRate,
+		bwe, config, err := makeBWE(w.bwe, w.bweConfig, BWEConfig{
+			InitTargetRate:   initTargetRate,
+			MinTargetRate:    minTargetRate,
+			MaxTargetRate:    w.maxTargetRate,
+			FeedbackInterval: w.feedbackInterval,
 		})
 		if err != nil {
 			return err
 		}
-		webrtcOptions = append(webrtcOptions, webrtc.SetBWE(bwe))
+		if len(w.bweTrace) > 0 {
+			var traceFile io.Closer
+			bwe, traceFile, err = recordBWE(bwe, w.bweTrace)
+			if err != nil {
+				return err
+			}
+			defer func() {
+				_ = traceFile.Close()
+			}()
+		}
+		webrtcOptions = append(webrtcOptions,
+			webrtc.SetBWE(bwe),
+			webrtc.SetBWEStateLogInterval(time.Duration(w.bweStateLog)*time.Millisecond),
+		)
+		bweConfig = config
 	}
 
 	connectedCtx, cancelConnectedCtx := context.WithCancel(context.Background())
@@ -183,9 +219,7 @@ Usage:
 	}))
 
 	if len(WebRTCExtraCodecs) > 0 {
-		for _, c := range WebRTCExtraCodecs {
-			webrtcOptions = append(webrtcOptions, webrtc.AddExtraCodecs(c.MimeType, c.ClockRate, c.PayloadType))
-		}
+		webrtcOptions = append(webrtcOptions, webrtc.AddExtraCodecs(WebRTCExtraCodecs...))
 	}
 
 	transport, err := webrtc.NewTransport(
@@ -218,6 +252,13 @@ Usage:
 		}
 	}()
 
+	allocator := mrtp.NewRateAllocator()
+	// pacing follows the unfiltered target rate
+	transport.SetTargetRate, err = bweConfig.filterTargetRate(allocator.SetTargetRate)
+	if err != nil {
+		return err
+	}
+
 	if w.offer && w.datachannel {
 		dcSender := transport.NewDataChannelSender("data")
 		var dataSource *data.DataBin
@@ -225,6 +266,15 @@ Usage:
 		if err != nil {
 			return err
 		}
+		allocator.AddFlow(mrtp.RateFlowConfig{
+			Name:   "data",
+			Weight: float64(w.dcShare),
+			SetRate: func(ratebps uint) error {
+				dataSource.SetRateLimit(ratebps)
+				return nil
+			},
+			Active: dataSource.Running,
+		})
 		go func() {
 			if sourceErr := dataSource.Run(ctx); sourceErr != nil {
 				fmt.Printf("failed to run data source: %v\n", sourceErr)
@@ -263,7 +313,11 @@ Usage:
 		// set callback of transport, so CCs can set the target rate of the encoder
 		ba, ok := source.(BitrateAdapter)
 		if ok {
-			transport.SetTargetRate = ba.SetBitrate
+			allocator.AddFlow(mrtp.RateFlowConfig{
+				Name:    "media",
+				Weight:  float64(100 - w.dcShare),
+				SetRate: ba.SetBitrate,
+			})
 		}
 
 		// TODO(ME): Cannot enable SCReAM here because WebRTC rewrites the SSRCs
@@ -2,6 +2,7 @@ package webrtc
 
 import (
 	"errors"
+	"fmt"
 	"io"
 	"log/slog"
 	"sync"
@@ -22,11 +23,6 @@ import (
 	"github.com/pion/webrtc/v4"
 )
 
-const (
-	// TODO(ME): Make the interval configurable?
-	feedbackInterval = 20 * time.Millisecond
-)
-
 type Signaler interface {
 	SendSessionDescription(*webrtc.SessionDescription) error
 	SendICECandidate(*webrtc.ICECandidate) error
@@ -51,10 +47,15 @@ type Transport struct {
 	onRemoteTrack func(*RTPReceiver)
 	onConnected   func()
 
+	feedbackInterval time.Duration
+
 	pacer         *pacing.InterceptorFactory
 	bwe           mrtp.BWE
 	SetTargetRate func(ratebps uint) error
 
+	bweStateLogInterval time.Duration
+	lastBWEStateLog     time.Time
+
 	ect0, ect1, ecnce uint64
 }
 
@@ -86,6 +87,18 @@ func EnableRTCPReports() Option {
 	}
 }
 
+// SetFeedbackInterval sets the interval at which TWCC and CCFB feedback is
+// sent. It must precede EnableTWCC and EnableCCFB. Default: 20ms.
+func SetFeedbackInterval(interval time.Duration) Option {
+	return func(t *Transport) error {
+		if interval <= 0 {
+			return fmt.Errorf("invalid feedback interval: %v", interval)
+		}
+		t.feedbackInterval = interval
+		return nil
+	}
+}
+
 func EnableTWCC() Option {
 	return func(t *Transport) error {
 		t.mediaEngine.RegisterFeedback(webrtc.RTCPFeedback{Type: webrtc.TypeRTCPFBTransportCC}, webrtc.RTPCodecTypeVideo)
@@ -102,7 +115,7 @@ func EnableTWCC() Option {
 			return err
 		}
 
-		generator, err := twcc.NewSenderInterceptor(twcc.SendInterval(feedbackInterval))
+		generator, err := twcc.NewSenderInterceptor(twcc.SendInterval(t.feedbackInterval))
 		if err != nil {
 			return err
 		}
@@ -117,7 +130,7 @@ func EnableCCFB() Option {
 		t.mediaEngine.RegisterFeedback(webrtc.RTCPFeedback{Type: webrtc.TypeRTCPFBACK, Parameter: "ccfb"}, webrtc.RTPCodecTypeVideo)
 		t.mediaEngine.RegisterFeedback(webrtc.RTCPFeedback{Type: webrtc.TypeRTCPFBACK, Parameter: "ccfb"}, webrtc.RTPCodecTypeAudio)
 		generator, err := rfc8888.NewSenderInterceptor(
-			rfc8888.SendInterval(feedbackInterval),
+			rfc8888.SendInterval(t.feedbackInterval),
 			rfc8888.WithECNLookupTable(t),
 		)
 		if err != nil {
@@ -135,6 +148,16 @@ func SetBWE(bwe mrtp.BWE) Option {
 	}
 }
 
+// SetBWEStateLogInterval sets the interval at which the state of BWEs
+// implementing [mrtp.BWEStateReporter] is logged. Zero, the default,
+// disables logging.
+func SetBWEStateLogInterval(interval time.Duration) Option {
+	return func(t *Transport) error {
+		t.bweStateLogInterval = interval
+		return nil
+	}
+}
+
 func EnableCCFBReceiver() Option {
 	return func(t *Transport) error {
 		f, err := rtpfb.NewInterceptor()
@@ -168,18 +191,33 @@ func EnableRTPSendTraceLogging() Option {
 	}
 }
 
-func AddExtraCodecs(name string, clockRate uint32, payloadType uint8) Option {
+// AddExtraCodecs registers codecs from the mrtp codec registry with the
+// media engine, using their default payload types.
+func AddExtraCodecs(codecs ...mrtp.Codec) Option {
 	return func(t *Transport) error {
-		return t.mediaEngine.RegisterCodec(webrtc.RTPCodecParameters{
-			RTPCodecCapability: webrtc.RTPCodecCapability{
-				MimeType:     name,
-				ClockRate:    clockRate,
-				Channels:     0,
-				SDPFmtpLine:  "",
-				RTCPFeedback: []webrtc.RTCPFeedback{},
-			},
-			PayloadType: webrtc.PayloadType(payloadType),
-		}, webrtc.RTPCodecTypeVideo)
+		for _, c := range codecs {
+			info, ok := c.Info()
+			if !ok {
+				return fmt.Errorf("unknown codec: %v", int(c))
+			}
+			codecType := webrtc.RTPCodecTypeVideo
+			if info.MediaType == "audio" {
+				codecType = webrtc.RTPCodecTypeAudio
+			}
+			if err := t.mediaEngine.RegisterCodec(webrtc.RTPCodecParameters{
+				RTPCodecCapability: webrtc.RTPCodecCapability{
+					MimeType:     info.MimeType(),
+					ClockRate:    info.ClockRate,
+					Channels:     info.Channels,
+					SDPFmtpLine:  info.SDPFmtpLine,
+					RTCPFeedback: []webrtc.RTCPFeedback{},
+				},
+				PayloadType: webrtc.PayloadType(info.PayloadType),
+			}, codecType); err != nil {
+				return err
+			}
+		}
+		return nil
 	}
 }
 
@@ -230,6 +268,7 @@ func NewTransport(signaler Signaler, offerer bool, opts ...Option) (*Transport,
 		mediaEngine:         &webrtc.MediaEngine{},
 		interceptorRegistry: &interceptor.Registry{},
 		SetTargetRate:       nil,
+		feedbackInterval:    20 * time.Millisecond,
 	}
 	for _, opt := range opts {
 		if err := opt(t); err != nil {
@@ -463,10 +502,23 @@ func (t *Transport) onCCFB(report rtpfb.Report) error {
 				t.pacer.SetRate(t.pc.ID(), int(1.5*float64(tr)))
 			}
 		}
+		t.logBWEState()
 	}
 	return nil
 }
 
+func (t *Transport) logBWEState() {
+	if t.bweStateLogInterval <= 0 || time.Since(t.lastBWEStateLog) < t.bweStateLogInterval {
+		return
+	}
+	state, ok := mrtp.GetBWEState(t.bwe)
+	if !ok {
+		return
+	}
+	t.lastBWEStateLog = time.Now()
+	t.logger.Info("BWE_STATE", "bwe", state)
+}
+
 func (t *Transport) GetECN(ssrc uint32, sequenceNumber uint16) uint8 {
 	if t.net == nil {
 		return 0